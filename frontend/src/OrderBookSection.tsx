@@ -10,6 +10,7 @@ import { getCached, setCached, CACHE_KEYS_ORDERBOOK } from './dataCache'
 import { nodeGet, nodePost } from './nodeClient'
 import { usePairMarketPrice } from './hooks/useTokenPrice'
 import { signOrder, signCancelOrder, generateOrderId } from './services/orderSigning'
+import { fetchNextNonce } from './services/orderService'
 import { verifyOrderSignatureSignedData } from './services/orderVerification'
 import { LoadingSpinner } from './components/LoadingSpinner'
 import { ErrorDisplay } from './components/ErrorDisplay'
@@ -340,11 +341,14 @@ export function OrderBookSection({ account, getSigner, onBackToDashboard }: Orde
       const priceWei = ethers.parseUnits(price, 18)
       const amountOutWei = (BigInt(amountInWei.toString()) * BigInt(priceWei.toString())) / BigInt(1e18)
       const orderId = generateOrderId()
+      const nonce = await fetchNextNonce(account)
       const orderData = {
         orderId,
         userAddress: account,
+        nonce,
         tokenIn: TOKEN0_ADDRESS,
         tokenOut: TOKEN1_ADDRESS,
+        side,
         amountIn: amountInWei.toString(),
         amountOut: String(amountOutWei),
         price: priceWei.toString(),
@@ -365,7 +369,7 @@ export function OrderBookSection({ account, getSigner, onBackToDashboard }: Orde
         amount: orderData.amountIn,
         filled: '0',
         status: 'open',
-        nonce: timestamp,
+        nonce,
         createdAt: timestamp,
         expiresAt,
         signature,
@@ -2,6 +2,7 @@ import React, { useState, useEffect, useCallback } from 'react'
 import { ethers, Contract } from 'ethers'
 import { useP2P } from '../contexts/P2PContext'
 import { signOrder, generateOrderId } from '../services/orderSigning'
+import { fetchNextNonce } from '../services/orderService'
 import { verifyOrderSignatureSignedData } from '../services/orderVerification'
 import { usePairMarketPrice } from '../hooks/useTokenPrice'
 import { TOKEN0_ADDRESS, TOKEN1_ADDRESS, ERC20_ABI } from '../config'
@@ -147,11 +148,14 @@ export function OrderForm({ pair, account, onSuccess }: OrderFormProps) {
       const p = BigInt(priceWei.toString())
       const amountOutWei = (a * p) / BigInt(1e18)
 
+      const nonce = await fetchNextNonce(address)
       const orderData = {
         orderId,
         userAddress: address,
+        nonce,
         tokenIn: TOKEN0_ADDRESS,
         tokenOut: TOKEN1_ADDRESS,
+        side,
         amountIn: amountInWei.toString(),
         amountOut: String(amountOutWei),
         price: priceWei.toString(),
@@ -172,6 +176,7 @@ export function OrderForm({ pair, account, onSuccess }: OrderFormProps) {
         side,
         price: orderData.price,
         amount: orderData.amountIn,
+        nonce,
         timestamp,
         expiresAt,
         signature,
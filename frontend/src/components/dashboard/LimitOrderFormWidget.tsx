@@ -6,6 +6,7 @@ import { formatError } from '../../utils'
 import { nodePost } from '../../nodeClient'
 import { p2pOrderBroadcast } from '../../p2p/orderBroadcast'
 import { signOrder, generateOrderId } from '../../services/orderSigning'
+import { fetchNextNonce } from '../../services/orderService'
 import { verifyOrderSignatureSignedData } from '../../services/orderVerification'
 import { TOKEN0_ADDRESS, TOKEN1_ADDRESS } from '../../config'
 import type { Signer } from 'ethers'
@@ -59,11 +60,14 @@ export function LimitOrderFormWidget({ account, getSigner, recommendedPrice, onS
       const priceWei = ethers.parseUnits(price, 18)
       const amountOutWei = (BigInt(amountInWei.toString()) * BigInt(priceWei.toString())) / BigInt(1e18)
       const orderId = generateOrderId()
+      const nonce = await fetchNextNonce(account)
       const orderData = {
         orderId,
         userAddress: account,
+        nonce,
         tokenIn: TOKEN0_ADDRESS,
         tokenOut: TOKEN1_ADDRESS,
+        side: side as 'buy' | 'sell',
         amountIn: amountInWei.toString(),
         amountOut: String(amountOutWei),
         price: priceWei.toString(),
@@ -82,7 +86,7 @@ export function LimitOrderFormWidget({ account, getSigner, recommendedPrice, onS
         amount: orderData.amountIn,
         filled: '0',
         status: 'open',
-        nonce: timestamp,
+        nonce,
         createdAt: timestamp,
         expiresAt,
         signature,
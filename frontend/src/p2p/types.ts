@@ -5,6 +5,8 @@ export interface Order {
   side: 'buy' | 'sell'
   price: string
   amount: string
+  /** trader nonce（已签入 EIP-712 订单，节点据此做 Replay 防护） */
+  nonce?: number
   timestamp: number
   signature: string
   /** 过期时间戳（毫秒），未设则永不过期；加载/恢复时过滤已过期订单 */
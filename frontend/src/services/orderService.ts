@@ -1,5 +1,5 @@
 import { ethers } from 'ethers'
-import { nodePost } from '../nodeClient'
+import { nodeGet, nodePost } from '../nodeClient'
 import { signOrder, signCancelOrder, generateOrderId, OrderData } from './orderSigning'
 
 export interface OrderParams {
@@ -13,6 +13,15 @@ export interface OrderParams {
   pair: string
 }
 
+/**
+ * 从节点查询 trader 的下一个可用 nonce（已使用的最大 nonce + 1，且不低于批量撤单下限）
+ * nonce 各交易对共用且须严格递增：较大 nonce 先入簿后较小 nonce 的订单会被拒绝，多个订单须串行提交
+ */
+export async function fetchNextNonce(trader: string): Promise<number> {
+  const { data } = await nodeGet<{ next: number }>('/api/nonce', { trader })
+  return Number(data.next)
+}
+
 export async function submitOrder(
   params: OrderParams,
   signer: ethers.Signer
@@ -22,13 +31,16 @@ export async function submitOrder(
   const expiresAt = timestamp + 86400 // 24 小时后过期
   
   const orderId = generateOrderId()
+  const nonce = await fetchNextNonce(address)
   
   // 构造订单数据
   const orderData: OrderData = {
     orderId,
     userAddress: address,
+    nonce,
     tokenIn: params.tokenIn,
     tokenOut: params.tokenOut,
+    side: params.side,
     amountIn: ethers.parseUnits(params.amountIn, 18).toString(),
     amountOut: ethers.parseUnits(params.amountOut, 18).toString(),
     price: ethers.parseUnits(params.price, 18).toString(),
@@ -49,6 +61,7 @@ export async function submitOrder(
     amount: params.amountIn,
     filled: '0',
     status: 'open',
+    nonce,
     createdAt: timestamp,
     signature,
   })
@@ -2,17 +2,28 @@ import { ethers } from 'ethers'
 import {
   EIP712_DOMAIN,
   ORDER_TYPES,
+  MARKET_ORDER_TYPES,
   CANCEL_TYPES,
   type OrderData,
+  type MarketOrderData,
+  withOrderDefaults,
+  withMarketOrderDefaults,
 } from './orderSigningTypes'
 
-export type { OrderData } from './orderSigningTypes'
+export type { OrderData, MarketOrderData } from './orderSigningTypes'
 
 export async function signOrder(
   order: OrderData,
   signer: ethers.Signer
 ): Promise<string> {
-  return signer.signTypedData(EIP712_DOMAIN, ORDER_TYPES, order)
+  return signer.signTypedData(EIP712_DOMAIN, ORDER_TYPES, withOrderDefaults(order))
+}
+
+export async function signMarketOrder(
+  order: MarketOrderData,
+  signer: ethers.Signer
+): Promise<string> {
+  return signer.signTypedData(EIP712_DOMAIN, MARKET_ORDER_TYPES, withMarketOrderDefaults(order))
 }
 
 export async function signCancelOrder(
@@ -13,18 +13,44 @@ export const EIP712_DOMAIN = {
   verifyingContract: ZERO_ADDRESS,
 }
 
-/** Order 类型定义（与 ethers TypedDataField[] 兼容） */
+/** Order 类型定义（与 ethers TypedDataField[] 兼容）；nonce 取自节点 /api/nonce，签入后不可篡改 */
 export const ORDER_TYPES = {
   Order: [
     { name: 'orderId', type: 'string' },
     { name: 'userAddress', type: 'address' },
+    { name: 'nonce', type: 'uint256' },
     { name: 'tokenIn', type: 'address' },
     { name: 'tokenOut', type: 'address' },
+    { name: 'side', type: 'string' },
     { name: 'amountIn', type: 'uint256' },
     { name: 'amountOut', type: 'uint256' },
     { name: 'price', type: 'uint256' },
     { name: 'timestamp', type: 'uint256' },
     { name: 'expiresAt', type: 'uint256' },
+    { name: 'timeInForce', type: 'string' },
+    { name: 'trigger', type: 'string' },
+    { name: 'triggerPrice', type: 'uint256' },
+    { name: 'displayAmount', type: 'uint256' },
+    { name: 'postOnlyReprice', type: 'bool' },
+    { name: 'selfTradePrevention', type: 'string' },
+  ],
+}
+
+/** MarketOrder 类型定义（市价单：无限价，amount 与 quoteAmount 至少一项为正，quoteAmount 仅买单） */
+export const MARKET_ORDER_TYPES = {
+  MarketOrder: [
+    { name: 'orderId', type: 'string' },
+    { name: 'userAddress', type: 'address' },
+    { name: 'nonce', type: 'uint256' },
+    { name: 'tokenIn', type: 'address' },
+    { name: 'tokenOut', type: 'address' },
+    { name: 'side', type: 'string' },
+    { name: 'amount', type: 'uint256' },
+    { name: 'quoteAmount', type: 'uint256' },
+    { name: 'maxSlippageBps', type: 'uint256' },
+    { name: 'timestamp', type: 'uint256' },
+    { name: 'expiresAt', type: 'uint256' },
+    { name: 'selfTradePrevention', type: 'string' },
   ],
 }
 
@@ -37,14 +63,77 @@ export const CANCEL_TYPES = {
   ],
 }
 
+/** AmendOrder 类型定义（改单：newPrice/newAmount 为 0 表示不变，newAmount 为新的剩余数量） */
+export const AMEND_TYPES = {
+  AmendOrder: [
+    { name: 'orderId', type: 'string' },
+    { name: 'userAddress', type: 'address' },
+    { name: 'newPrice', type: 'uint256' },
+    { name: 'newAmount', type: 'uint256' },
+    { name: 'timestamp', type: 'uint256' },
+  ],
+}
+
 export interface OrderData {
   orderId: string
   userAddress: string
+  /** trader 的下一个可用 nonce（须与提交的订单 nonce 一致） */
+  nonce: number
   tokenIn: string
   tokenOut: string
+  side: 'buy' | 'sell'
   amountIn: string
   amountOut: string
   price: string
   timestamp: number
   expiresAt: number
+  /** GTC | GTD | IOC | FOK | POST_ONLY，未设置按 GTC 签名 */
+  timeInForce?: string
+  /** 条件单：stop | take_profit，普通订单为空 */
+  trigger?: string
+  /** 条件单触发价（最小单位），普通订单为 0 */
+  triggerPrice?: string
+  /** 冰山单每次展示数量（最小单位），普通订单为 0 */
+  displayAmount?: string
+  /** POST_ONLY 会吃单时改价为对手盘最优价内侧一档，而非拒绝 */
+  postOnlyReprice?: boolean
+  /** 自成交防护：cancel_newest | cancel_oldest | cancel_both | decrement_and_cancel，空为按交易对配置 */
+  selfTradePrevention?: string
+}
+
+/** 补齐 Order 签名字段默认值（与节点 signature.go 一致） */
+export function withOrderDefaults(order: OrderData): Required<OrderData> {
+  return {
+    ...order,
+    timeInForce: order.timeInForce || 'GTC',
+    trigger: order.trigger || '',
+    triggerPrice: order.triggerPrice || '0',
+    displayAmount: order.displayAmount || '0',
+    postOnlyReprice: order.postOnlyReprice || false,
+    selfTradePrevention: order.selfTradePrevention || '',
+  }
+}
+
+export interface MarketOrderData {
+  orderId: string
+  userAddress: string
+  nonce: number
+  tokenIn: string
+  tokenOut: string
+  side: 'buy' | 'sell'
+  amount: string
+  quoteAmount: string
+  maxSlippageBps: number
+  timestamp: number
+  expiresAt: number
+  /** 自成交防护模式，空为按交易对配置 */
+  selfTradePrevention?: string
+}
+
+/** 补齐 MarketOrder 签名字段默认值（与节点 signature.go 一致） */
+export function withMarketOrderDefaults(order: MarketOrderData): Required<MarketOrderData> {
+  return {
+    ...order,
+    selfTradePrevention: order.selfTradePrevention || '',
+  }
 }
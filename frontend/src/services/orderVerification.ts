@@ -9,21 +9,31 @@ import {
   CANCEL_TYPES,
   ZERO_ADDRESS,
   type OrderData,
+  withOrderDefaults,
 } from './orderSigningTypes'
 
 export type { OrderData } from './orderSigningTypes'
 
-function toMessage(orderData: OrderData) {
+function toMessage(order: OrderData) {
+  const orderData = withOrderDefaults(order)
   return {
     orderId: orderData.orderId,
     userAddress: orderData.userAddress,
+    nonce: orderData.nonce,
     tokenIn: orderData.tokenIn || ZERO_ADDRESS,
     tokenOut: orderData.tokenOut || ZERO_ADDRESS,
+    side: orderData.side,
     amountIn: orderData.amountIn,
     amountOut: orderData.amountOut,
     price: orderData.price,
     timestamp: orderData.timestamp,
     expiresAt: orderData.expiresAt,
+    timeInForce: orderData.timeInForce,
+    trigger: orderData.trigger,
+    triggerPrice: orderData.triggerPrice,
+    displayAmount: orderData.displayAmount,
+    postOnlyReprice: orderData.postOnlyReprice,
+    selfTradePrevention: orderData.selfTradePrevention,
   }
 }
 
@@ -0,0 +1,1216 @@
+// 主节点入口：libp2p Host + GossipSub + 订单广播/订阅 + 撮合引擎 + HTTP/WebSocket API
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/api"
+	"github.com/P2P-P2P/p2p/node/internal/chain"
+	"github.com/P2P-P2P/p2p/node/internal/config"
+	"github.com/P2P-P2P/p2p/node/internal/match"
+	"github.com/P2P-P2P/p2p/node/internal/p2p"
+	"github.com/P2P-P2P/p2p/node/internal/relay"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+	"github.com/P2P-P2P/p2p/node/internal/sync"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// exitFatal 打印错误并退出；Windows 下等待按键避免窗口闪退
+func exitFatal(msg string) {
+	log.Print(msg)
+	if runtime.GOOS == "windows" {
+		fmt.Print("按 Enter 键退出...")
+		_, _ = bufio.NewReader(os.Stdin).ReadByte()
+	}
+	os.Exit(1)
+}
+
+func exitFatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	if runtime.GOOS == "windows" {
+		fmt.Print("按 Enter 键退出...")
+		_, _ = bufio.NewReader(os.Stdin).ReadByte()
+	}
+	os.Exit(1)
+}
+
+func main() {
+	port := flag.Int("port", 4001, "libp2p 监听端口")
+	configPath := flag.String("config", "config.yaml", "配置文件路径")
+	connectAddr := flag.String("connect", "", "连接到的节点 multiaddr")
+	rewardWallet := flag.String("reward-wallet", "", "领奖钱包地址（必填；可通过本参数、环境变量 REWARD_WALLET 或配置文件 reward_wallet 设置）")
+	modeRelay := flag.Bool("mode=relay", false, "轻量 relay 模式：仅 GossipSub + WebSocket，不启撮合引擎与存储，适合公共 relay 节点")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		exitFatalf("加载配置: %v", err)
+	}
+	// 无配置文件或未设置 api.listen 时默认开启 :8080（便于 Railway/Fly 等云部署）
+	if cfg.API.Listen == "" {
+		cfg.API.Listen = ":8080"
+	}
+	// 领奖地址：命令行 > 环境变量 > 配置文件
+	w := strings.TrimSpace(*rewardWallet)
+	if w == "" {
+		w = strings.TrimSpace(cfg.Node.RewardWallet)
+	}
+	if w == "" {
+		exitFatal("未指定领奖钱包地址，节点拒绝启动。请通过 -reward-wallet、环境变量 REWARD_WALLET 或配置文件 node.reward_wallet 设置。")
+	}
+	if !strings.HasPrefix(w, "0x") || len(w) != 42 {
+		exitFatalf("领奖钱包地址格式错误：应为 0x 开头的 42 字符（0x+40 位十六进制），当前: %q", w)
+	}
+	for _, c := range w[2:] {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			continue
+		}
+		exitFatalf("领奖钱包地址含非十六进制字符: %q", w)
+	}
+	cfg.Node.RewardWallet = w
+
+	// --mode=relay：强制轻量 relay（只广播 + WS，不撮合、不落库）
+	if *modeRelay {
+		cfg.Node.Type = "relay"
+		cfg.Match.Pairs = nil
+		log.Print("已启用 --mode=relay：仅 GossipSub + WebSocket，不启撮合与存储")
+	}
+
+	// 监听地址（-port 覆盖配置）
+	listenAddrs := cfg.Node.Listen
+	if *port != 4001 || len(listenAddrs) == 0 {
+		listenAddrs = []string{"/ip4/0.0.0.0/tcp/" + strconv.Itoa(*port)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 1. 创建 libp2p Host（支持可选 Tor 出口）
+	hostOpts := p2p.HostOptsFromNetwork(cfg.Network.UseTor, cfg.Network.TorSocksAddr)
+	h, err := p2p.NewHostWithOpts(listenAddrs, cfg.Node.DataDir, hostOpts)
+	if err != nil {
+		exitFatalf("创建 Host: %v", err)
+	}
+	log.Printf("节点启动 | PeerID: %s", h.ID())
+	log.Printf("  领奖地址: %s", cfg.Node.RewardWallet)
+	for _, a := range h.Addrs() {
+		log.Printf("  监听: %s/p2p/%s", a, h.ID())
+	}
+
+	// 2. 连接节点（无中心：-connect 或 config network.bootstrap 均可，任一连上即可参与 Gossip）
+	if *connectAddr != "" {
+		if err := p2p.ConnectToPeer(ctx, h, *connectAddr); err != nil {
+			log.Printf("连接 -connect 失败: %v", err)
+		} else {
+			log.Printf("已连接 -connect，当前连接数: %d", len(h.Network().Peers()))
+		}
+	}
+	// bootstrap 并行连接，加快启动
+	for _, addrStr := range cfg.Network.Bootstrap {
+		if addrStr == "" {
+			continue
+		}
+		addrStr := addrStr
+		go func() {
+			if err := p2p.ConnectToPeer(ctx, h, addrStr); err != nil {
+				log.Printf("连接 bootstrap %q 失败: %v", addrStr, err)
+			} else {
+				log.Printf("已连接 bootstrap，当前连接数: %d", len(h.Network().Peers()))
+			}
+		}()
+	}
+	if len(cfg.Network.Bootstrap) > 0 {
+		time.Sleep(2 * time.Second) // 留时间让并行连接完成
+	}
+
+	// 3. GossipSub
+	ps, err := p2p.NewGossipSub(ctx, h)
+	if err != nil {
+		exitFatalf("GossipSub: %v", err)
+	}
+
+	// 3.1 中继 Spam 防护：按 peer 速率限制 + 信誉记录（可用于后续奖励与惩罚）
+	var perPeerLimiter *relay.Limiter
+	var reputation *relay.Reputation
+	if cfg.Relay.RateLimitBytesPerSecPerPeer > 0 || cfg.Relay.RateLimitMsgsPerSecPerPeer > 0 {
+		perPeerLimiter = relay.NewLimiter(cfg.Relay.RateLimitBytesPerSecPerPeer, cfg.Relay.RateLimitMsgsPerSecPerPeer)
+		reputation = relay.NewReputation()
+		log.Printf("[relay] 已启用 Gossip 限流：每 peer 每秒字节上限=%d，每秒消息数上限=%d",
+			cfg.Relay.RateLimitBytesPerSecPerPeer, cfg.Relay.RateLimitMsgsPerSecPerPeer)
+	}
+
+	// 4. 订单发布器（加入订单/撤单/成交主题）
+	orderPub, err := sync.NewOrderPublisher(h, ps)
+	if err != nil {
+		exitFatalf("OrderPublisher: %v", err)
+	}
+
+	// 5. 撮合引擎（match 启用；relay 仅在配置了 pairs 时启用，--mode=relay 时 Pairs 已清空故不启）
+	var matchEngine *match.Engine
+	var dispatcher *match.Dispatcher
+	var router *match.Router
+	var registry *match.Registry
+	var journal *match.Journal
+	var markets *match.MarketRegistry
+	var snapshotDir string
+	localPairs := make([]string, 0)
+
+	enableMatch := cfg.Node.Type == "match" || (cfg.Node.Type == "relay" && len(cfg.Match.Pairs) > 0)
+	if enableMatch {
+		pairTokens, err := match.PairTokensFromConfig(cfg.Match.Pairs)
+		if err != nil {
+			log.Fatalf("[match] %v", err)
+		}
+		for pair := range pairTokens {
+			localPairs = append(localPairs, pair)
+		}
+		matchEngine = match.NewEngine(pairTokens)
+		// 每个交易对一个撮合 worker 与有界输入队列，不同交易对并行撮合；队列满时 API 返回 429、gossip 新订单被拒绝
+		dispatcher = match.NewDispatcher(cfg.Match.QueueSize, matchEngine.HasPair)
+		log.Printf("[match] 撮合引擎已启用（%s），交易对: %d", cfg.Node.Type, len(pairTokens))
+
+		// 方案 B：初始化路由和注册表（分片按交易对）
+		localPeerID := h.ID().String()
+		router = match.NewRouter(localPeerID, matchEngine)
+		publishFn := func(topic string, data []byte) error {
+			return orderPub.PublishRaw(ctx, topic, data)
+		}
+		registry = match.NewRegistry(router, localPeerID, localPairs, publishFn)
+		registry.Start()
+		log.Printf("[router] 路由和注册表已启用，本地交易对: %v", localPairs)
+		
+		// 定期清理过期节点
+		go func() {
+			ticker := time.NewTicker(5 * time.Minute)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					router.CleanupStaleNodes()
+				}
+			}
+		}()
+	}
+
+	// 6. 存储（storage 或 带撮合的 relay/match 落库；--mode=relay 不落库）
+	needStore := cfg.Node.Type == "storage" || (cfg.Node.Type == "relay" && enableMatch) || (enableMatch && cfg.Node.Type == "match")
+	var store *storage.DB
+	if needStore {
+		store, err = storage.Open(cfg.Node.DataDir)
+		if err != nil {
+			exitFatalf("打开存储: %v", err)
+		}
+		log.Printf("[storage] 已打开数据库（%s）", cfg.Node.Type)
+	}
+
+	// 订单簿恢复（接收订单之前，只执行一次）：最新快照 + 其后的撮合日志；均无数据时从本地存储恢复
+	if matchEngine != nil {
+		if !cfg.Match.DisableJournal {
+			journal, err = match.OpenJournal(filepath.Join(cfg.Node.DataDir, "journal"), cfg.Match.JournalNoSync)
+			if err != nil {
+				exitFatalf("打开撮合日志: %v", err)
+			}
+			journal.SetArchiveDir(cfg.Match.JournalArchiveDir)
+		}
+		snapshotDir = filepath.Join(cfg.Node.DataDir, "snapshots")
+		// 运行时上架/下架的交易对覆盖配置文件（恢复前加载，快照与日志中的订单按最新交易对集合恢复）
+		markets = match.NewMarketRegistry(matchEngine, store, registry)
+		if err := markets.Load(); err != nil {
+			exitFatalf("加载交易对注册表: %v", err)
+		}
+		if _, err := match.Restore(matchEngine, snapshotDir, journal, store); err != nil {
+			exitFatalf("恢复撮合引擎: %v", err)
+		}
+		if err := markets.RestoreStates(); err != nil {
+			exitFatalf("恢复交易对状态: %v", err)
+		}
+		if journal != nil {
+			go match.RunSnapshots(ctx, matchEngine, snapshotDir, time.Duration(cfg.Match.SnapshotIntervalSec)*time.Second)
+		}
+	}
+
+	// 订单 nonce 校验：本地记录每个 trader 已使用的最大 nonce；配置了 OrderNonceManager 时经链上 isValidNonce 交叉校验
+	var nonces *match.NonceGuard
+	if store != nil {
+		var reader chain.NonceReader
+		if cfg.Chain.NonceManager != "" && cfg.Chain.RPCURL != "" {
+			r, err := chain.DialNonceManager(cfg.Chain.RPCURL, cfg.Chain.NonceManager)
+			if err != nil {
+				log.Printf("[nonce] 连接 OrderNonceManager 失败，仅按本地记录校验: %v", err)
+			} else {
+				defer r.Close()
+				reader = r
+				log.Printf("[nonce] 已启用链上 nonce 校验 contract=%s", cfg.Chain.NonceManager)
+			}
+		}
+		nonces = match.NewNonceGuard(store, reader)
+	}
+
+	// Vault 余额：配置了 Vault 合约时校验托管余额并按事件同步，余额不足时撤销挂单
+	var balances *match.BalanceService
+	if matchEngine != nil && cfg.Chain.Vault != "" && cfg.Chain.RPCURL != "" {
+		vault, err := chain.DialVault(cfg.Chain.RPCURL, cfg.Chain.Vault)
+		if err != nil {
+			log.Printf("[balance] 连接 Vault 失败，不校验余额: %v", err)
+		} else {
+			defer vault.Close()
+			balances = match.NewBalanceService(matchEngine, vault)
+			log.Printf("[balance] 已启用 Vault 余额校验 contract=%s", cfg.Chain.Vault)
+		}
+	}
+
+	// 订单签名验证：API、gossip 与转发订单进入撮合引擎前经同一验证器（worker 池 + 按签名哈希的 LRU 缓存）
+	verifier := match.NewSignatureVerifier(ctx, cfg.Match.SignatureWorkers, cfg.Match.SignatureCacheSize)
+	// 无撮合引擎的节点按 match.pairs 的代币配置验签；未配置的交易对无法验签，其订单不落库、不占用 nonce
+	var verifyPairs map[string]match.PairTokens
+	if matchEngine == nil && len(cfg.Match.Pairs) > 0 {
+		verifyPairs, err = match.PairTokensFromConfig(cfg.Match.Pairs)
+		if err != nil {
+			log.Fatalf("[match] %v", err)
+		}
+	}
+
+	// 7. WebSocket 服务器（供前端订阅订单簿/成交）
+	wsServer := api.NewWSServer()
+	if matchEngine != nil {
+		// L2 行情：引擎按交易对发布带序号的档位增量，WS depth 频道按订阅的档位数与价格粒度下发快照与增量
+		depthHub := api.NewDepthHub(func(pair string) (*match.DepthSnapshot, bool) {
+			return matchEngine.DepthSnapshot(pair, 0)
+		})
+		matchEngine.SetDepthSink(depthHub.Publish)
+		go depthHub.Run(ctx)
+		wsServer.SetDepthHub(depthHub)
+		// L3 逐笔行情：引擎为每次订单簿变更生成带序号与校验和的事件，经 WS l3 频道与 libp2p 流协议分发
+		l3Feed := match.NewL3Feed(matchEngine)
+		go l3Feed.Run(ctx)
+		wsServer.SetL3Hub(api.NewL3Hub(l3Feed))
+		sync.ServeL3(h, l3Feed)
+	}
+	// K 线：由已执行的成交聚合 1m～1w 各周期 K 线写入 SQLite（独立保留期），启动时从成交表补齐，WS kline 频道推送当前 K 线
+	var candles *storage.CandleAggregator
+	if store != nil {
+		retention, err := storage.CandleRetention(cfg.Storage.CandleRetentionDays)
+		if err != nil {
+			exitFatalf("K 线保留期配置: %v", err)
+		}
+		candles = storage.NewCandleAggregator(store, retention)
+		if n, err := candles.Backfill(); err != nil {
+			log.Printf("[candles] 从成交表回填 K 线失败: %v", err)
+		} else {
+			log.Printf("[candles] 已从成交表回填 %d 根 K 线", n)
+		}
+		klineHub := api.NewKlineHub()
+		candles.SetSink(klineHub.Publish)
+		wsServer.SetKlineHub(klineHub)
+		go candles.Run(ctx)
+	}
+	go wsServer.Run()
+
+	// 8. 订单处理 Handler：新订单入簿并撮合，成交广播
+	handler := &orderMatchHandler{
+		engine:    matchEngine,
+		publisher:  orderPub,
+		store:     store,
+		ws:        wsServer,
+		router:    router,
+		registry:  registry,
+		markets:   markets,
+		nonces:    nonces,
+		balances:  balances,
+		dispatch:  dispatcher,
+		verifier:  verifier,
+		candles:   candles,
+		matchers:  pairMatchers(cfg.Network.PairMatchers),
+		pairs:     verifyPairs,
+	}
+	if store != nil {
+		store.SetOrderEventHandler(handler.onOrderEvent)
+	}
+	if matchEngine != nil {
+		go match.RunExpirySweeper(ctx, matchEngine, handler.onExpired)
+	}
+	if balances != nil {
+		interval := time.Duration(cfg.Chain.VaultSyncSec) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		go match.RunBalanceSync(ctx, balances, interval, handler.onBalanceCancelled)
+	}
+	subscriber := sync.NewOrderSubscriberWithSecurity(ps, handler, perPeerLimiter, reputation)
+	if err := subscriber.Start(ctx); err != nil {
+		exitFatalf("OrderSubscriber: %v", err)
+	}
+
+	// 手续费等级：按近 30 天成交额刷新，每小时检查一次（窗口按 UTC 日对齐，同一天内结果不变）
+	if matchEngine != nil && store != nil {
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for {
+				if err := match.RefreshFeeTiers(matchEngine, store, time.Now()); err != nil {
+					log.Printf("[fees] 刷新手续费等级失败: %v", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
+	// 批量拍卖：每个 Epoch 结束后清算批量模式交易对（含运行期通过管理 API 上架的交易对）
+	if matchEngine != nil {
+		go handler.runAuctions(ctx)
+	}
+
+	// 交易对状态：每秒推进熔断冷却/集合竞价并发布状态变化（含撮合中触发的自动暂停与管理员操作）
+	if matchEngine != nil {
+		go handler.runPairStates(ctx)
+	}
+
+	// 订阅节点注册消息（方案 B）
+	if registry != nil {
+		if err := subscribeMatchRegistry(ctx, ps, registry); err != nil {
+			log.Printf("[registry] 订阅注册消息失败: %v", err)
+		}
+		// 订阅转发订单主题（方案 B）
+		if err := subscribeForwardedOrders(ctx, ps, handler); err != nil {
+			log.Printf("[router] 订阅转发订单失败: %v", err)
+		}
+	}
+
+	// 9. API 的 Publish 回调：按主题发布原始字节
+	publishFn := func(topic string, data []byte) error {
+		return orderPub.PublishRaw(ctx, topic, data)
+	}
+
+	// 10. HTTP API
+	srv := &api.Server{
+		Store:                   store,
+		MatchEngine:             matchEngine,
+		Publish:                 publishFn,
+		NodeType:                cfg.Node.Type,
+		RewardWallet:            cfg.Node.RewardWallet,
+		WSServer:                wsServer,
+		RateLimitOrdersPerMinute: cfg.API.RateLimitOrdersPerMinute,
+		BlockedTraders:           api.BuildTraderBlacklist(cfg.API.BlockedTraders),
+		AdminToken:               cfg.API.AdminToken,
+		Markets:                  markets,
+		Nonces:                   nonces,
+		Balances:                 balances,
+		Dispatcher:               dispatcher,
+		Verifier:                 verifier,
+		Candles:                  candles,
+	}
+	if cfg.API.Listen != "" {
+		srv.Run(cfg.API.Listen)
+	}
+
+	// 11. 优雅退出
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+	log.Println("收到退出信号，关闭...")
+	cancel()
+	if dispatcher != nil {
+		// 等待已入队的订单撮合完毕，最后一次快照包含其结果
+		dispatcher.Close()
+	}
+	if journal != nil {
+		// 退出前写最后一次快照，下次启动只需回放其后的日志
+		if info, err := matchEngine.WriteSnapshot(snapshotDir); err != nil {
+			log.Printf("[snapshot] 退出快照写入失败: %v", err)
+		} else {
+			log.Printf("[snapshot] 已写入 %s（seq=%d）", filepath.Base(info.Path), info.Seq)
+		}
+		_ = journal.Close()
+	}
+}
+
+// subscribeMatchRegistry 订阅节点注册消息（方案 B）
+func subscribeMatchRegistry(ctx context.Context, ps *pubsub.PubSub, registry *match.Registry) error {
+	topic, err := ps.Join(sync.TopicMatchRegister)
+	if err != nil {
+		return err
+	}
+	
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+	
+	go func() {
+		defer sub.Cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				msg, err := sub.Next(ctx)
+				if err != nil {
+					log.Printf("[registry] 订阅错误: %v", err)
+					return
+				}
+				// 处理注册消息
+				registry.HandleRegistration(msg.Data)
+			}
+		}
+	}()
+	
+	log.Printf("[registry] 已订阅节点注册主题: %s", sync.TopicMatchRegister)
+	return nil
+}
+
+// subscribeForwardedOrders 订阅转发订单主题（方案 B）
+func subscribeForwardedOrders(ctx context.Context, ps *pubsub.PubSub, handler *orderMatchHandler) error {
+	// 订阅所有转发订单主题（通配符主题：/p2p-exchange/match/order/*）
+	// 注意：libp2p pubsub 不支持通配符，需要订阅具体主题
+	// 这里我们订阅一个通用主题，然后根据消息内容判断
+	topic, err := ps.Join("/p2p-exchange/match/order")
+	if err != nil {
+		return err
+	}
+	
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+	
+	go func() {
+		defer sub.Cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				msg, err := sub.Next(ctx)
+				if err != nil {
+					log.Printf("[router] 订阅转发订单错误: %v", err)
+					return
+				}
+				// 解析订单并本地处理
+				var order storage.Order
+				if err := json.Unmarshal(msg.Data, &order); err != nil {
+					log.Printf("[router] 解析转发订单失败: %v", err)
+					continue
+				}
+				log.Printf("[router] 收到转发订单 %s (pair=%s)", order.OrderID, order.Pair)
+				// 转发方可能无法验签（其未上架该交易对），本节点完整校验后本地处理（不再次路由）
+				if err := handler.admitOrder(&order); err != nil {
+					log.Printf("[router] 拒绝转发订单: %v", err)
+					continue
+				}
+				_ = handler.processOrderLocally(&order)
+			}
+		}
+	}()
+	
+	log.Printf("[router] 已订阅转发订单主题: /p2p-exchange/match/order")
+	return nil
+}
+
+// orderMatchHandler 实现 sync.OrderHandler：新订单入簿、撮合、广播成交
+type orderMatchHandler struct {
+	engine    *match.Engine
+	publisher *sync.OrderPublisher
+	store     *storage.DB
+	ws        *api.WSServer
+	router    *match.Router
+	registry  *match.Registry
+	markets   *match.MarketRegistry
+	nonces    *match.NonceGuard
+	balances  *match.BalanceService
+	dispatch  *match.Dispatcher // 按交易对分派撮合（nil 时在订阅协程内同步撮合）
+	verifier  *match.SignatureVerifier
+	candles   *storage.CandleAggregator // K 线聚合（无存储时为 nil）
+	matchers  map[string]map[string]bool // 交易对 -> 可发布订单状态的撮合节点 peer ID（network.pair_matchers）
+	pairs     map[string]match.PairTokens  // 无撮合引擎时验签用的交易对代币配置（match.pairs）
+}
+
+// pairMatchers 将 network.pair_matchers 转为按交易对查询的 peer ID 集合
+func pairMatchers(cfg map[string][]string) map[string]map[string]bool {
+	out := make(map[string]map[string]bool, len(cfg))
+	for pair, peers := range cfg {
+		set := make(map[string]bool, len(peers))
+		for _, p := range peers {
+			set[p] = true
+		}
+		out[pair] = set
+	}
+	return out
+}
+
+// gossipEnqueueTimeout gossip 新订单等待撮合队列空位的最长时间，超时拒绝（订阅协程短暂阻塞即对上游形成背压）
+const gossipEnqueueTimeout = 2 * time.Second
+
+func (h *orderMatchHandler) OnNewOrder(order *storage.Order) error {
+	if order == nil || order.OrderID == "" || order.Pair == "" {
+		return nil
+	}
+	if storage.OrderExpired(order) {
+		log.Printf("[order/new] 已过期，跳过 orderId=%s expiresAt=%d", order.OrderID, order.ExpiresAt)
+		return nil
+	}
+	// 本地未上架、由其他撮合节点负责的交易对：本节点没有其代币配置、无法验签，原样转发给负责节点，
+	// 由其校验交易规则、签名、归属、余额与 nonce；未验签的订单不占用本地 nonce、不落库
+	if h.engine != nil && h.engine.GetPairTokens(order.Pair) == nil && h.router != nil && h.router.HasPair(order.Pair) {
+		return h.forwardUnlistedOrder(order)
+	}
+	if err := h.admitOrder(order); err != nil {
+		return err
+	}
+	// 方案 B：路由订单（如果启用了路由）
+	if h.router != nil {
+		needForward, targetPeerID, err := h.router.RouteOrder(order)
+		if err != nil {
+			log.Printf("[router] 路由失败: %v，降级为本地处理", err)
+		} else if needForward {
+			// 转发到目标节点
+			log.Printf("[router] 转发订单 %s (pair=%s) 到节点 %s", order.OrderID, order.Pair, targetPeerID)
+			if err := h.forwardOrderToNode(targetPeerID, order); err != nil {
+				log.Printf("[router] 转发失败: %v，降级为本地处理", err)
+				// 降级：本地处理
+				return h.processOrderLocally(order)
+			}
+			// 转发成功，本地只存储（不撮合）
+			if h.store != nil {
+				_ = h.store.InsertOrder(order)
+			}
+			return nil
+		}
+	}
+	
+	// 本地处理
+	return h.processOrderLocally(order)
+}
+
+// admitOrder 入簿前的准入校验（gossip 新订单与转发订单）：交易规则、签名、orderId 归属、余额与 nonce（只读）
+// nonce 在本节点实际处理订单时才占用（见 processOrderLocally），转发给其他节点或入队失败的订单不消耗 nonce
+func (h *orderMatchHandler) admitOrder(order *storage.Order) error {
+	// 交易规则（tick/lot、数量上下限、最小成交额、价格带）：不符合的订单不入簿
+	if h.engine != nil {
+		if err := h.engine.CheckMarketRules(order); err != nil {
+			return fmt.Errorf("reject orderId=%s: %w", order.OrderID, err)
+		}
+	}
+	// 签名：先于余额与 nonce 校验，伪造订单不能占用他人的 nonce
+	if err := h.verifyOrder(order); err != nil {
+		return err
+	}
+	// orderId 归属：不得以他人的 orderId 覆盖其订单（先于占用 nonce）
+	if err := h.checkOrderOwner(order); err != nil {
+		return fmt.Errorf("reject orderId=%s: %w", order.OrderID, err)
+	}
+	// 资金预检：可用余额不足的订单尽早拒绝（入簿时在撮合 worker 内按 trader/token 加锁再次校验，见 submitOrder）
+	if err := h.balances.Admit(order); err != nil {
+		return fmt.Errorf("reject orderId=%s: %w", order.OrderID, err)
+	}
+	// Replay 防护：已使用、低于批量撤单下限或链上无效的 nonce 直接拒绝
+	if err := h.nonces.Check(order); err != nil {
+		return fmt.Errorf("reject orderId=%s: %w", order.OrderID, err)
+	}
+	return nil
+}
+
+// forwardUnlistedOrder 将本地未上架交易对的订单转发给负责的撮合节点；无可用节点时拒绝
+func (h *orderMatchHandler) forwardUnlistedOrder(order *storage.Order) error {
+	needForward, targetPeerID, err := h.router.RouteOrder(order)
+	if err != nil || !needForward {
+		return fmt.Errorf("reject orderId=%s: %w: %s", order.OrderID, match.ErrUnknownPair, order.Pair)
+	}
+	log.Printf("[router] 转发未上架交易对订单 %s (pair=%s) 到节点 %s", order.OrderID, order.Pair, targetPeerID)
+	if err := h.forwardOrderToNode(targetPeerID, order); err != nil {
+		return fmt.Errorf("reject orderId=%s: forward: %w", order.OrderID, err)
+	}
+	return nil
+}
+
+// processOrderLocally 本地处理订单（撮合或仅转发到 WS）
+func (h *orderMatchHandler) processOrderLocally(order *storage.Order) error {
+	if h.engine != nil {
+		if !h.engine.EnsurePair(order.Pair) {
+			return fmt.Errorf("reject orderId=%s: %w: %s", order.OrderID, match.ErrUnknownPair, order.Pair)
+		}
+		// 入簿前验证签名（gossip 入口已验证的订单命中缓存；转发订单在此首次验证）
+		if err := h.verifyOrder(order); err != nil {
+			return err
+		}
+		if h.dispatch == nil {
+			return h.submitOrder(order)
+		}
+		// 交由该交易对的撮合 worker 按序处理；队列持续满载时拒绝。余额校验与 nonce 占用在 worker 内入簿前进行，入队超时的订单不消耗 nonce
+		ctx, cancel := context.WithTimeout(context.Background(), gossipEnqueueTimeout)
+		defer cancel()
+		err := h.dispatch.SubmitWait(ctx, order.Pair, func() {
+			if err := h.submitOrder(order); err != nil {
+				log.Printf("[order/new] 拒绝 orderId=%s: %v", order.OrderID, err)
+			}
+		})
+		if err != nil {
+			h.rejectOrder(order)
+			return fmt.Errorf("reject orderId=%s: %w", order.OrderID, err)
+		}
+		return nil
+	}
+	// 无撮合引擎：同样先验签再占用 nonce 与落库，无法验签的订单拒绝
+	if err := h.verifyOrder(order); err != nil {
+		return err
+	}
+	if err := h.nonces.Claim(order); err != nil {
+		return fmt.Errorf("reject orderId=%s: %w", order.OrderID, err)
+	}
+	if h.ws != nil {
+		// 轻量 relay 模式：无撮合引擎时仍将新订单推给 WS 客户端
+		h.ws.BroadcastOrderStatus(order)
+	}
+	if h.store != nil {
+		if err := h.store.InsertOrder(order); err != nil {
+			log.Printf("[order/new] 写入失败 orderId=%s: %v", order.OrderID, err)
+		}
+	}
+	return nil
+}
+
+// verifyOrder 验证订单签名：撮合节点按引擎的交易对配置，无撮合引擎的节点按 match.pairs；无代币配置的交易对拒绝
+// （撮合节点的非本地交易对经 forwardUnlistedOrder 转发，由负责的撮合节点验证）
+func (h *orderMatchHandler) verifyOrder(order *storage.Order) error {
+	var tokens *match.PairTokens
+	if h.engine != nil {
+		tokens = h.engine.GetPairTokens(order.Pair)
+	} else if t, ok := h.pairs[order.Pair]; ok {
+		tokens = &t
+	}
+	// 没有代币配置无法构造签名内容，一律拒绝（不得未验签入簿、落库或占用 nonce）
+	if tokens == nil {
+		return fmt.Errorf("reject orderId=%s: %w: %s (no token config to verify signature)", order.OrderID, match.ErrUnknownPair, order.Pair)
+	}
+	valid, err := h.verifier.Verify(order, tokens)
+	if err != nil {
+		return fmt.Errorf("reject orderId=%s: signature: %w", order.OrderID, err)
+	}
+	if !valid {
+		return fmt.Errorf("reject orderId=%s: invalid signature", order.OrderID)
+	}
+	return nil
+}
+
+// checkOrderOwner 校验 orderId 未被撮合引擎或本地存储中其他签名订单占用，nonce 未在撮合引擎的其他交易对使用
+func (h *orderMatchHandler) checkOrderOwner(order *storage.Order) error {
+	if h.engine != nil {
+		if err := h.engine.CheckOrderOwner(order); err != nil {
+			return err
+		}
+	}
+	if h.store != nil {
+		return h.store.CheckOrderOwner(order)
+	}
+	return nil
+}
+
+// submitOrder 校验余额、占用 nonce 后撮合并发布结果：先撮合再按 timeInForce 挂单/撤销（原子完成）；
+// 余额校验、nonce 占用与入簿在 trader/token 校验锁内完成，并发订单不会重复使用同一笔余额
+// 结果（pending/filled/partial/open/cancelled/rejected）写回订单以便持久化与推送
+// orderId 冲突的订单不落库也不推送（其 orderId 属于他人的订单）
+func (h *orderMatchHandler) submitOrder(order *storage.Order) error {
+	var res *match.SubmitResult
+	err := h.balances.Submit(order, func() error {
+		if err := h.nonces.Claim(order); err != nil {
+			return err
+		}
+		res = h.engine.Submit(order)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reject orderId=%s: %w", order.OrderID, err)
+	}
+	if errors.Is(res.Reason, storage.ErrOrderIDConflict) {
+		log.Printf("[order/new] 拒绝 orderId 冲突的订单 orderId=%s trader=%s: %v", order.OrderID, order.Trader, res.Reason)
+		return nil
+	}
+	h.publishSubmitResult(order, res)
+	if h.ws != nil {
+		h.ws.BroadcastOrderStatus(order)
+	}
+	return nil
+}
+
+// rejectOrder 通知未能入队撮合的订单被拒绝（API 已以 202 受理）：以 rejected 状态落库，经订单事件推送 WS 与 gossip；
+// 同一 orderId 已在簿内或已落库为其他状态时状态机拒绝迁移，不覆盖。无存储时直接推送 WS
+func (h *orderMatchHandler) rejectOrder(order *storage.Order) {
+	rejected := *order
+	rejected.Status = storage.OrderStatusRejected
+	if h.store == nil {
+		if h.ws != nil && h.engine.GetOrder(order.OrderID) == nil {
+			h.ws.BroadcastOrderStatus(&rejected)
+		}
+		return
+	}
+	h.persistTx(func(tx *storage.Tx, check func(error) error) error {
+		return check(tx.InsertOrder(&rejected))
+	})
+}
+
+// persistTx 在一个事务中写入订单与成交；订单状态迁移不合法（如迟到消息使已成交订单回退）或 orderId 归属冲突只记录日志并跳过该订单，
+// 不回滚引擎已产生的成交。事务提交后订单事件经 onOrderEvent 推送；返回事务是否已提交（无存储时为 false）
+func (h *orderMatchHandler) persistTx(fn func(tx *storage.Tx, check func(error) error) error) bool {
+	if h.store == nil {
+		return false
+	}
+	check := func(err error) error {
+		if errors.Is(err, storage.ErrInvalidOrderTransition) || errors.Is(err, storage.ErrOrderIDConflict) {
+			log.Printf("[storage] 跳过订单写入: %v", err)
+			return nil
+		}
+		return err
+	}
+	tx, err := h.store.Begin()
+	if err != nil {
+		log.Printf("[storage] 开始事务失败: %v", err)
+		return false
+	}
+	defer tx.Rollback()
+	if err := fn(tx, check); err != nil {
+		log.Printf("[storage] 写入订单与成交失败: %v", err)
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[storage] 提交事务失败: %v", err)
+		return false
+	}
+	return true
+}
+
+// onOrderEvent 订单状态迁移：推送 WS；本节点产生的迁移同时广播到 gossip（来自 gossip 的不再转发）
+func (h *orderMatchHandler) onOrderEvent(ev *storage.OrderEvent) {
+	if h.ws != nil {
+		h.ws.BroadcastOrderEvent(ev)
+	}
+	if !ev.Remote && h.publisher != nil {
+		_ = h.publisher.PublishOrderStatus(context.Background(), ev)
+	}
+}
+
+// publishSubmitResult 发布撮合结果：成交、taker（可为 nil）、被激活的条件单、maker 成交量、自成交防护撤销/减量的挂单
+// 全部订单状态迁移与成交在同一事务中落库；WS 订单状态推送不含 taker 自身（由调用方推送）
+func (h *orderMatchHandler) publishSubmitResult(taker *storage.Order, res *match.SubmitResult) {
+	h.publishTrades(res.Trades)
+	committed := h.persistTx(func(tx *storage.Tx, check func(error) error) error {
+		for _, t := range res.Trades {
+			if err := tx.InsertTrade(t); err != nil {
+				return err
+			}
+		}
+		// taker 与被激活的条件单先写入本次撮合后的状态，其后作为 maker 的成交（级联激活）由 ApplyMakerFills 累加
+		if taker != nil {
+			if err := check(tx.InsertOrder(taker)); err != nil {
+				return err
+			}
+		}
+		for _, activated := range res.Activated {
+			if err := check(tx.InsertOrder(activated)); err != nil {
+				return err
+			}
+		}
+		if err := check(tx.ApplyMakerFills(res.Trades)); err != nil {
+			return err
+		}
+		for _, prevented := range res.Prevented {
+			if prevented.Status == storage.OrderStatusCancelled {
+				if err := check(tx.CloseOrder(prevented.OrderID, storage.OrderStatusCancelled)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	// 成交落库提交后才计入 K 线，未落库的成交不出现在 K 线中
+	if committed && h.candles != nil {
+		h.candles.Add(res.Trades...)
+	}
+	if h.ws == nil {
+		return
+	}
+	// 被成交触发的条件单推送激活后的状态；自成交防护撤销/减量均以订单状态推送（不产生成交）
+	for _, activated := range res.Activated {
+		h.ws.BroadcastOrderStatus(activated)
+	}
+	for _, prevented := range res.Prevented {
+		h.ws.BroadcastOrderStatus(prevented)
+	}
+}
+
+// onExpired 过期调度器回调：订单在存储中置为 expired（经订单事件推送 WS 与 gossip），并推送订单状态
+func (h *orderMatchHandler) onExpired(orders []*storage.Order) {
+	h.persistTx(func(tx *storage.Tx, check func(error) error) error {
+		for _, o := range orders {
+			if err := check(tx.CloseOrder(o.OrderID, storage.OrderStatusExpired)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for _, o := range orders {
+		log.Printf("[expiry] 订单已过期移除 orderId=%s pair=%s expiresAt=%d", o.OrderID, o.Pair, o.ExpiresAt)
+		if h.ws != nil {
+			h.ws.BroadcastOrderStatus(o)
+		}
+	}
+}
+
+// onBalanceCancelled 持久化并推送因 Vault 余额不足被撤销的挂单
+func (h *orderMatchHandler) onBalanceCancelled(orders []*storage.Order) {
+	h.persistTx(func(tx *storage.Tx, check func(error) error) error {
+		for _, o := range orders {
+			if err := check(tx.CloseOrder(o.OrderID, storage.OrderStatusCancelled)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for _, o := range orders {
+		log.Printf("[balance] 余额不足撤销挂单 orderId=%s pair=%s trader=%s", o.OrderID, o.Pair, o.Trader)
+		if h.ws != nil {
+			h.ws.BroadcastOrderStatus(o)
+		}
+	}
+}
+
+// runAuctions 每秒检查 Epoch 是否结束，结束后对各批量拍卖交易对清算上一个 Epoch 并发布结果
+// 每次都重新读取批量模式交易对，运行期上架/下架的交易对随即生效
+func (h *orderMatchHandler) runAuctions(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		closed := match.CurrentEpochID(match.EpochDurationSec) - 1
+		for _, pair := range h.engine.BatchPairs() {
+			if res := h.engine.RunAuction(pair, closed); res != nil {
+				h.publishAuctionResult(res)
+			}
+		}
+	}
+}
+
+// runPairStates 每秒推进到期的交易对状态；状态变化推送到 WS，复盘集合竞价的成交与订单状态照批量拍卖结果发布落库
+func (h *orderMatchHandler) runPairStates(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, ch := range h.engine.AdvancePairStates() {
+			if h.markets != nil {
+				h.markets.RecordState(ch)
+			}
+			if h.ws != nil {
+				h.ws.BroadcastMarketState(ch)
+			}
+			if ch.Auction != nil {
+				h.publishAuctionResult(ch.Auction)
+			}
+		}
+	}
+}
+
+// publishAuctionResult 发布批量拍卖结果：成交广播，成交与订单状态在同一事务中落库（filled 按本次成交量累加）
+func (h *orderMatchHandler) publishAuctionResult(res *match.AuctionResult) {
+	h.publishTrades(res.Trades)
+	fills := make(map[string]*big.Int)
+	for _, t := range res.Trades {
+		for _, id := range []string{t.MakerOrderID, t.TakerOrderID} {
+			if fills[id] == nil {
+				fills[id] = new(big.Int)
+			}
+			fills[id].Add(fills[id], storage.MustUnits(t.Amount))
+		}
+	}
+	committed := h.persistTx(func(tx *storage.Tx, check func(error) error) error {
+		for _, t := range res.Trades {
+			if err := tx.InsertTrade(t); err != nil {
+				return err
+			}
+		}
+		for _, o := range res.Orders {
+			if err := check(tx.AddFilled(o.OrderID, o.Status, fills[o.OrderID])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// 成交落库提交后才计入 K 线，未落库的成交不出现在 K 线中
+	if committed && h.candles != nil {
+		h.candles.Add(res.Trades...)
+	}
+	if h.ws != nil {
+		for _, o := range res.Orders {
+			h.ws.BroadcastOrderStatus(o)
+		}
+	}
+}
+
+// publishTrades 广播成交到 P2P 与 WS（落库与订单状态一起在 publishSubmitResult / publishAuctionResult 的事务中完成，提交后计入 K 线）
+func (h *orderMatchHandler) publishTrades(trades []*storage.Trade) {
+	for _, t := range trades {
+		data, _ := json.Marshal(t)
+		_ = h.publisher.PublishRaw(context.Background(), sync.TopicTradeExecuted, data)
+		if h.ws != nil {
+			h.ws.BroadcastTrade(t)
+		}
+	}
+}
+
+// forwardOrderToNode 转发订单到目标节点
+func (h *orderMatchHandler) forwardOrderToNode(targetPeerID string, order *storage.Order) error {
+	// 使用专用主题转发：/p2p-exchange/match/order/{pair}
+	topic := "/p2p-exchange/match/order/" + order.Pair
+	data, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	return h.publisher.PublishRaw(context.Background(), topic, data)
+}
+
+func (h *orderMatchHandler) OnCancelOrder(cancel *sync.CancelRequest) error {
+	if cancel == nil || cancel.OrderID == "" {
+		return nil
+	}
+	if h.engine != nil {
+		h.engine.RemoveOrder("", cancel.OrderID)
+	}
+	if h.store != nil {
+		if err := h.store.CloseOrder(cancel.OrderID, storage.OrderStatusCancelled); err != nil {
+			log.Printf("[order/cancel] 更新失败 orderId=%s: %v", cancel.OrderID, err)
+		}
+	}
+	return nil
+}
+
+// OnCancelAll 处理按 nonce 批量撤单：校验 trader 的 CancelAllBelowNonce 签名后撤销其所有交易对中 nonce 更小的订单，
+// 并提高本地 nonce 下限（此后更小 nonce 的订单被拒绝）；订单事件经存储回调推送
+func (h *orderMatchHandler) OnCancelAll(req *sync.CancelAllRequest) error {
+	if req == nil || req.Trader == "" || req.Nonce <= 0 {
+		return nil
+	}
+	valid, err := match.VerifyCancelAllSignature(req.Trader, req.Nonce, req.Signature, req.Timestamp)
+	if err != nil || !valid {
+		return fmt.Errorf("cancel-all trader=%s: invalid signature", req.Trader)
+	}
+	var cancelled []*storage.Order
+	if h.engine != nil {
+		cancelled = h.engine.CancelTraderBelowNonce(req.Trader, req.Nonce)
+	}
+	if h.store != nil {
+		if _, err := h.store.CancelBelowNonce(req.Trader, req.Nonce); err != nil {
+			log.Printf("[order/cancel-all] 更新失败 trader=%s: %v", req.Trader, err)
+		}
+	} else if h.ws != nil {
+		for _, o := range cancelled {
+			h.ws.BroadcastOrderStatus(o)
+		}
+	}
+	return nil
+}
+
+// OnAmendOrder 处理改单：校验 trader 的 AmendOrder 签名后在撮合引擎内原子改单，并更新本地存储
+func (h *orderMatchHandler) OnAmendOrder(amend *sync.AmendRequest) error {
+	if amend == nil || amend.OrderID == "" {
+		return nil
+	}
+	var existing *storage.Order
+	if h.store != nil {
+		existing, _ = h.store.GetOrder(amend.OrderID)
+	}
+	trader := ""
+	if existing != nil {
+		trader = existing.Trader
+	} else if h.engine != nil {
+		if o := h.engine.GetOrder(amend.OrderID); o != nil {
+			trader = o.Trader
+		}
+	}
+	if trader == "" {
+		return nil
+	}
+	valid, err := match.VerifyAmendSignature(amend.OrderID, trader, amend.NewPrice, amend.NewAmount, amend.Signature, amend.Timestamp)
+	if err != nil || !valid {
+		return fmt.Errorf("amend orderId=%s: invalid signature", amend.OrderID)
+	}
+	if h.engine == nil {
+		// 无撮合引擎：仅按请求更新本地存储
+		if existing == nil || amend.Timestamp <= existing.AmendedAt || amend.Timestamp > time.Now().Unix()+match.AmendClockSkew {
+			return nil
+		}
+		price, amount, err := match.ParseAmendFields(amend.NewPrice, amend.NewAmount)
+		if err != nil {
+			return err
+		}
+		existing.AppendAmend(signedAmend(amend))
+		if price != nil {
+			existing.Price = storage.FormatUnits(price)
+			existing.QueuedAt = amend.Timestamp
+		}
+		if amount != nil {
+			existing.Amount = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(existing.Filled), amount))
+		}
+		return h.store.InsertOrder(existing)
+	}
+	// 加量或买单提价增加占用：与新订单相同，须有足够的 Vault 可用余额（校验与改单在 trader/token 校验锁内完成）
+	var res *match.AmendResult
+	err = h.balances.Amend(trader, amend.OrderID, amend.NewPrice, amend.NewAmount, func() error {
+		var err error
+		res, err = h.engine.AmendOrder(amend.OrderID, amend.NewPrice, amend.NewAmount, amend.Timestamp, amend.Signature)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("amend orderId=%s: %w", amend.OrderID, err)
+	}
+	updated := res.Order
+	if existing != nil {
+		// 持久化订单：Amount 按剩余数量变化调整，Filled 累加改价后作为 taker 的成交
+		filled := storage.MustUnits(existing.Filled)
+		for _, t := range res.Trades {
+			if t.TakerOrderID == amend.OrderID {
+				filled.Add(filled, storage.MustUnits(t.Amount))
+			}
+		}
+		// 改单签名随订单落库（首次改单时记录原始签名的价格与数量），结算据此验证改单后的订单
+		existing.AppendAmend(signedAmend(amend))
+		existing.Price = res.Order.Price
+		existing.Amount = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(existing.Amount), res.SizeDelta))
+		existing.Filled = storage.FormatUnits(filled)
+		existing.QueuedAt = res.Order.QueuedAt
+		switch {
+		case res.Order.Status == storage.OrderStatusCancelled || res.Order.Status == storage.OrderStatusFilled:
+			existing.Status = res.Order.Status
+		case filled.Sign() > 0:
+			existing.Status = storage.OrderStatusPartial
+		default:
+			existing.Status = storage.OrderStatusOpen
+		}
+		updated = existing
+	}
+	// 改单后的订单（本地无记录时为 nil）与其成交、maker 成交量在同一事务中落库
+	h.publishSubmitResult(existing, &res.SubmitResult)
+	if h.ws != nil {
+		h.ws.BroadcastOrderStatus(updated)
+	}
+	return nil
+}
+
+// signedAmend 改单请求中的签名内容（追加到订单的改单签名链）
+func signedAmend(amend *sync.AmendRequest) storage.SignedAmend {
+	return storage.SignedAmend{NewPrice: amend.NewPrice, NewAmount: amend.NewAmount, Timestamp: amend.Timestamp, Signature: amend.Signature}
+}
+
+// OnOrderStatus 其他节点广播的订单状态迁移（maker 成交、撤单、过期等）：按状态机应用到本地存储
+// 本地撮合的交易对以本引擎为准，忽略远端状态；其他交易对只接受 pair_matchers 中该交易对撮合节点发布的事件
+func (h *orderMatchHandler) OnOrderStatus(ev *storage.OrderEvent) error {
+	if ev == nil || ev.OrderID == "" || h.store == nil {
+		return nil
+	}
+	if h.engine != nil && h.engine.GetPairTokens(ev.Pair) != nil {
+		return nil
+	}
+	if !h.matchers[ev.Pair][ev.Source] {
+		return fmt.Errorf("reject order status orderId=%s: peer %s is not a matcher of %s", ev.OrderID, ev.Source, ev.Pair)
+	}
+	return h.store.ApplyOrderEvent(ev)
+}
+
+// OnTradeExecuted 处理 gossip 成交。本地撮合的交易对以本引擎产生的成交为准（已由 publishSubmitResult 落库并计入 K 线），忽略 gossip 副本；
+// 其他交易对只接受 pair_matchers 中该交易对撮合节点发布的成交（与 OnOrderStatus 相同），且须引用本地已知的该交易对 maker/taker 订单
+// 并与之相符（方向相反、价格在双方限价内、数量不超过双方订单数量）才落库并计入 K 线，任意 peer 伪造的成交不得污染成交历史与 K 线
+func (h *orderMatchHandler) OnTradeExecuted(trade *storage.Trade) error {
+	if trade == nil || h.store == nil {
+		return nil
+	}
+	if h.engine != nil && h.engine.GetPairTokens(trade.Pair) != nil {
+		return nil
+	}
+	if !h.matchers[trade.Pair][trade.Source] {
+		return fmt.Errorf("reject tradeId=%s: peer %s is not a matcher of %s", trade.TradeID, trade.Source, trade.Pair)
+	}
+	maker, err := h.tradeOrder(trade.Pair, trade.MakerOrderID, trade.Maker)
+	if err != nil {
+		return fmt.Errorf("reject tradeId=%s: maker: %w", trade.TradeID, err)
+	}
+	taker, err := h.tradeOrder(trade.Pair, trade.TakerOrderID, trade.Taker)
+	if err != nil {
+		return fmt.Errorf("reject tradeId=%s: taker: %w", trade.TradeID, err)
+	}
+	if err := checkTradeMatches(trade, maker, taker); err != nil {
+		return fmt.Errorf("reject tradeId=%s: %w", trade.TradeID, err)
+	}
+	if err := h.store.InsertTrade(trade); err != nil {
+		return fmt.Errorf("reject tradeId=%s: %w", trade.TradeID, err)
+	}
+	if h.candles != nil {
+		h.candles.Add(trade)
+	}
+	return nil
+}
+
+// tradeOrder 返回成交引用的本地订单，须存在且交易对与 trader 一致
+func (h *orderMatchHandler) tradeOrder(pair, orderID, trader string) (*storage.Order, error) {
+	o, err := h.store.GetOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil || o.Pair != pair || !strings.EqualFold(o.Trader, trader) {
+		return nil, fmt.Errorf("unknown order %q on pair %s", orderID, pair)
+	}
+	return o, nil
+}
+
+// checkTradeMatches 校验成交与双方订单相符：方向相反，成交价不高于买方限价、不低于卖方限价（市价单不限），
+// 数量为正且不超过双方订单数量（按 quote 金额下单、未指定数量的市价买单不限数量）
+// 不按剩余数量校验：成交与订单状态经不同 gossip 主题到达，filled 状态可能先于成交到达
+func checkTradeMatches(trade *storage.Trade, maker, taker *storage.Order) error {
+	if maker.Side == taker.Side {
+		return fmt.Errorf("maker and taker both %s", maker.Side)
+	}
+	price, ok1 := storage.ParseUnits(trade.Price)
+	amount, ok2 := storage.ParseUnits(trade.Amount)
+	if !ok1 || !ok2 || price.Sign() <= 0 || amount.Sign() <= 0 {
+		return fmt.Errorf("invalid price/amount %s/%s", trade.Price, trade.Amount)
+	}
+	for _, o := range []*storage.Order{maker, taker} {
+		if limit, ok := storage.ParseUnits(o.Price); ok && limit.Sign() > 0 {
+			if (o.Side == "buy" && price.Cmp(limit) > 0) || (o.Side == "sell" && price.Cmp(limit) < 0) {
+				return fmt.Errorf("price %s outside %s limit %s of order %s", price, o.Side, limit, o.OrderID)
+			}
+		}
+		if o.QuoteAmount != "" && storage.MustUnits(o.Amount).Sign() == 0 {
+			continue
+		}
+		if size := storage.MustUnits(o.Amount); amount.Cmp(size) > 0 {
+			return fmt.Errorf("amount %s exceeds size %s of order %s", amount, size, o.OrderID)
+		}
+	}
+	return nil
+}
@@ -8,7 +8,6 @@ import (
 	"log"
 	"math/big"
 	"os"
-	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -34,7 +33,7 @@ type NodeReputationData struct {
 func main() {
 	var (
 		configPath     = flag.String("config", "config.yaml", "配置文件路径")
-		rpcURL         = flag.String("rpc", "", "RPC URL（必需）")
+		rpcURL         = flag.String("rpc", "", "RPC URL（未填则用配置文件 chain.rpc_url）")
 		contractAddr   = flag.String("contract", "", "ContributorReward 合约地址（必需）")
 		privateKeyHex  = flag.String("key", "", "私钥（用于签名交易，必需）")
 		reputationFile = flag.String("reputation", "reputation.json", "信誉数据 JSON 文件路径")
@@ -42,15 +41,17 @@ func main() {
 	)
 	flag.Parse()
 
-	if *rpcURL == "" || *contractAddr == "" || *privateKeyHex == "" {
-		log.Fatal("需要提供 -rpc, -contract, -key 参数")
-	}
-
 	// 加载配置
 	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatalf("加载配置失败: %v", err)
 	}
+	if *rpcURL == "" {
+		*rpcURL = cfg.Chain.RPCURL
+	}
+	if *rpcURL == "" || *contractAddr == "" || *privateKeyHex == "" {
+		log.Fatal("需要提供 -rpc（或配置 chain.rpc_url）, -contract, -key 参数")
+	}
 
 	// 读取信誉数据
 	reputationData, err := loadReputationData(*reputationFile)
@@ -89,6 +90,9 @@ func main() {
 		log.Fatalf("创建交易签名器失败: %v", err)
 	}
 
+	if !common.IsHexAddress(*contractAddr) {
+		log.Fatalf("无效的合约地址: %q", *contractAddr)
+	}
 	contractAddress := common.HexToAddress(*contractAddr)
 	// 注意：这里需要 ContributorReward 的 ABI，实际使用时需要导入或加载
 	// 为了示例，这里只展示逻辑
@@ -129,6 +133,7 @@ func main() {
 	//     log.Fatalf("提交交易失败: %v", err)
 	// }
 	// fmt.Printf("交易已提交: %s\n", tx.Hash().Hex())
+	_ = auth
 }
 
 func loadReputationData(filePath string) ([]NodeReputationData, error) {
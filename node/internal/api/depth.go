@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/P2P-P2P/p2p/node/internal/match"
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+)
+
+// DepthHub L2 行情分发（WS depth 频道）：
+//   - 引擎按交易对序号顺序调用 Publish，Publish 只入队，不在引擎锁内做任何计算
+//   - Run 协程为被订阅的交易对维护 DepthBook，按各订阅的档位数（10/50/full）与价格粒度计算视图变化并推送
+//   - 协议：订阅后先收到 depth_snapshot，此后 depth_update 的 prevSeq 等于上一条消息的 seq；
+//     客户端发现不连续时重新发送 subscribe 以取得新快照；客户端发送队列满丢弃增量时，服务端下一次改发快照
+type DepthHub struct {
+	source func(pair string) (*match.DepthSnapshot, bool) // 全量快照（引擎 DepthSnapshot(pair, 0)）
+
+	mu      sync.Mutex // 保护 pending
+	pending []*match.DepthUpdate
+	wake    chan struct{}
+
+	bmu   sync.Mutex // 保护 books、subs 与 WSClient.depthClosed；加锁顺序 bmu → 引擎锁 → mu
+	books map[string]*match.DepthBook
+	subs  map[string]map[*WSClient]*depthSub
+}
+
+// depthSub 单个客户端对一个交易对的订阅
+type depthSub struct {
+	view   *match.DepthView
+	depth  string // 订阅参数原样回显
+	group  string
+	resync bool // 发送队列满丢弃过消息，下一次改发快照
+}
+
+// depthSnapshotMessage depth_snapshot 消息体
+type depthSnapshotMessage struct {
+	*match.DepthSnapshot
+	Depth string `json:"depth"`
+	Group string `json:"group,omitempty"`
+}
+
+// NewDepthHub 创建行情分发；source 返回交易对全量 L2 快照（订阅的交易对首次被订阅或序号缺口时调用）
+func NewDepthHub(source func(pair string) (*match.DepthSnapshot, bool)) *DepthHub {
+	return &DepthHub{
+		source: source,
+		wake:   make(chan struct{}, 1),
+		books:  make(map[string]*match.DepthBook),
+		subs:   make(map[string]map[*WSClient]*depthSub),
+	}
+}
+
+// Publish 接收引擎增量（见 match.Engine.SetDepthSink）：只入队并唤醒 Run 协程
+func (h *DepthHub) Publish(u *match.DepthUpdate) {
+	h.mu.Lock()
+	h.pending = append(h.pending, u)
+	h.mu.Unlock()
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 处理入队的增量直至 ctx 结束
+func (h *DepthHub) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.wake:
+		}
+		h.drain()
+	}
+}
+
+// drain 按序处理已入队的增量
+func (h *DepthHub) drain() {
+	h.mu.Lock()
+	batch := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+	h.bmu.Lock()
+	defer h.bmu.Unlock()
+	for _, u := range batch {
+		h.applyLocked(u)
+	}
+}
+
+// applyLocked 将增量应用到交易对 DepthBook 并向订阅推送视图变化；无订阅的交易对忽略
+func (h *DepthHub) applyLocked(u *match.DepthUpdate) {
+	book, ok := h.books[u.Pair]
+	if !ok {
+		return
+	}
+	if !u.Reset && u.Seq <= book.Seq {
+		return // 已包含在快照中
+	}
+	if err := book.Apply(u); err != nil {
+		log.Printf("[depth] %v，重新拉取快照", err)
+		delete(h.books, u.Pair)
+		if book, err = h.bookLocked(u.Pair); err != nil {
+			return
+		}
+		u = &match.DepthUpdate{Pair: u.Pair, Reset: true}
+	}
+	for c, sub := range h.subs[u.Pair] {
+		if u.Reset || sub.resync {
+			h.sendSnapshotLocked(c, sub, book)
+			continue
+		}
+		if d := sub.view.Update(book, u); d != nil && !sendDepth(c, "depth_update", d) {
+			sub.resync = true
+		}
+	}
+}
+
+// bookLocked 返回交易对 DepthBook，不存在则从 source 拉取快照创建
+func (h *DepthHub) bookLocked(pair string) (*match.DepthBook, error) {
+	if book, ok := h.books[pair]; ok {
+		return book, nil
+	}
+	snap, ok := h.source(pair)
+	if !ok {
+		return nil, fmt.Errorf("unknown pair %q", pair)
+	}
+	book := match.NewDepthBook(snap)
+	h.books[pair] = book
+	return book, nil
+}
+
+// Subscribe 订阅交易对行情（同一客户端重复订阅即为重新同步：替换视图并重新下发快照）
+func (h *DepthHub) Subscribe(c *WSClient, pair, depth, group string) error {
+	limit, err := match.ParseDepthLimit(depth)
+	if err != nil {
+		return err
+	}
+	g, err := match.ParseDepthGroup(group)
+	if err != nil {
+		return err
+	}
+	h.bmu.Lock()
+	defer h.bmu.Unlock()
+	if c.depthClosed {
+		return fmt.Errorf("connection closed")
+	}
+	book, err := h.bookLocked(pair)
+	if err != nil {
+		return err
+	}
+	if depth == "" {
+		depth = "full"
+	}
+	if h.subs[pair] == nil {
+		h.subs[pair] = make(map[*WSClient]*depthSub)
+	}
+	sub := &depthSub{view: match.NewDepthView(limit, g), depth: depth, group: group}
+	h.subs[pair][c] = sub
+	h.sendSnapshotLocked(c, sub, book)
+	return nil
+}
+
+// Unsubscribe 取消客户端对交易对的订阅
+func (h *DepthHub) Unsubscribe(c *WSClient, pair string) {
+	h.bmu.Lock()
+	defer h.bmu.Unlock()
+	h.removeLocked(c, pair)
+}
+
+// RemoveClient 移除客户端的全部订阅，此后不再向其发送（须在关闭 c.send 之前调用）
+func (h *DepthHub) RemoveClient(c *WSClient) {
+	h.bmu.Lock()
+	defer h.bmu.Unlock()
+	c.depthClosed = true
+	for pair := range h.subs {
+		h.removeLocked(c, pair)
+	}
+}
+
+// removeLocked 移除订阅；交易对无订阅时释放其 DepthBook
+func (h *DepthHub) removeLocked(c *WSClient, pair string) {
+	subs, ok := h.subs[pair]
+	if !ok {
+		return
+	}
+	delete(subs, c)
+	if len(subs) == 0 {
+		delete(h.subs, pair)
+		delete(h.books, pair)
+	}
+}
+
+// sendSnapshotLocked 下发视图快照；发送队列已满时保持 resync，下一次增量到来时重试
+func (h *DepthHub) sendSnapshotLocked(c *WSClient, sub *depthSub, book *match.DepthBook) {
+	if sub.resync {
+		metrics.RecordDepthResync(book.Pair)
+	}
+	snap := sub.view.Snapshot(book)
+	sub.resync = !sendDepth(c, "depth_snapshot", &depthSnapshotMessage{DepthSnapshot: snap, Depth: sub.depth, Group: sub.group})
+}
+
+// sendDepth 非阻塞放入客户端发送队列；队列已满返回 false
+func sendDepth(c *WSClient, typ string, data interface{}) bool {
+	msg, err := json.Marshal(map[string]interface{}{"type": typ, "data": data})
+	if err != nil {
+		return false
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// wsRequest 客户端 WS 请求：{"op":"subscribe","channel":"depth","pair":"TKA/TKB","depth":10,"group":"100"}
+// depth 为 10、50 或 "full"（默认 full），group 为价格合并粒度（价格最小单位，默认不合并）；l3 频道只需 pair；
+// kline 频道需 pair 与 interval（1m～1w）
+type wsRequest struct {
+	Op       string          `json:"op"`
+	Channel  string          `json:"channel"`
+	Pair     string          `json:"pair"`
+	Depth    json.RawMessage `json:"depth"`
+	Group    string          `json:"group"`
+	Interval string          `json:"interval"`
+}
+
+// handleRequest 处理客户端请求；出错时回复 type 为 error 的消息
+func (c *WSClient) handleRequest(req *wsRequest) {
+	depth, l3, kline := c.server.depth, c.server.l3, c.server.kline
+	var err error
+	switch {
+	case req.Channel == "depth" && depth != nil && req.Op == "subscribe":
+		err = depth.Subscribe(c, req.Pair, strings.Trim(string(req.Depth), `"`), req.Group)
+	case req.Channel == "depth" && depth != nil && req.Op == "unsubscribe":
+		depth.Unsubscribe(c, req.Pair)
+	case req.Channel == "l3" && l3 != nil && req.Op == "subscribe":
+		err = l3.Subscribe(c, req.Pair)
+	case req.Channel == "l3" && l3 != nil && req.Op == "unsubscribe":
+		l3.Unsubscribe(c, req.Pair)
+	case req.Channel == "kline" && kline != nil && req.Op == "subscribe":
+		err = kline.Subscribe(c, req.Pair, req.Interval)
+	case req.Channel == "kline" && kline != nil && req.Op == "unsubscribe":
+		kline.Unsubscribe(c, req.Pair, req.Interval)
+	case req.Channel == "depth" && depth != nil, req.Channel == "l3" && l3 != nil, req.Channel == "kline" && kline != nil:
+		err = fmt.Errorf("unknown op %q", req.Op)
+	default:
+		log.Printf("[ws] 收到消息: %+v", req)
+		return
+	}
+	if err != nil {
+		sendDepth(c, "error", map[string]string{"op": req.Op, "channel": req.Channel, "pair": req.Pair, "message": err.Error()})
+	}
+}
+
+// handleDepth GET /api/depth?pair=&depth=10|50|full&group= 返回交易对 L2 快照及其对应的行情序号 seq
+// （WS depth 频道订阅时直接下发快照，无需先调用本接口）
+func (s *Server) handleDepth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	pair := q.Get("pair")
+	if pair == "" {
+		http.Error(w, "pair required", http.StatusBadRequest)
+		return
+	}
+	limit, err := match.ParseDepthLimit(q.Get("depth"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group, err := match.ParseDepthGroup(q.Get("group"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.MatchEngine == nil {
+		http.Error(w, "match engine not enabled", http.StatusNotFound)
+		return
+	}
+	snap, ok := depthSnapshot(s.MatchEngine, pair, limit, group)
+	if !ok {
+		http.Error(w, "unknown pair", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(snap)
+}
+
+// depthSnapshot 返回按档位数与粒度裁剪的快照；合并价格时先取全量再合并
+func depthSnapshot(e *match.Engine, pair string, limit int, group *big.Int) (*match.DepthSnapshot, bool) {
+	if group == nil {
+		return e.DepthSnapshot(pair, limit)
+	}
+	snap, ok := e.DepthSnapshot(pair, 0)
+	if !ok {
+		return nil, false
+	}
+	return match.NewDepthBook(snap).Snapshot(limit, group), true
+}
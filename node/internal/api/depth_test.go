@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/match"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+type depthMessage struct {
+	Type string `json:"type"`
+	Data struct {
+		Seq     uint64             `json:"seq"`
+		PrevSeq uint64             `json:"prevSeq"`
+		Depth   string             `json:"depth"`
+		Bids    []match.PriceLevel `json:"bids"`
+		Asks    []match.PriceLevel `json:"asks"`
+	} `json:"data"`
+}
+
+func readDepth(t *testing.T, c *WSClient) depthMessage {
+	t.Helper()
+	select {
+	case raw := <-c.send:
+		var m depthMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("no depth message")
+	}
+	return depthMessage{}
+}
+
+func depthOrder(id, side, price, amount string, ts int64) *storage.Order {
+	return &storage.Order{OrderID: id, Trader: "0x1", Pair: "TKA/TKB", Side: side, Price: price, Amount: amount, Filled: "0", CreatedAt: ts}
+}
+
+// 订阅后先收到快照，增量 prevSeq 与上一条消息的 seq 连续；发送队列满丢弃增量后改发快照
+func TestDepthChannelSnapshotThenDiffs(t *testing.T) {
+	e := match.NewEngine(map[string]match.PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	e.AddOrder(depthOrder("b1", "buy", "100", "5", 1))
+	hub := NewDepthHub(func(pair string) (*match.DepthSnapshot, bool) { return e.DepthSnapshot(pair, 0) })
+	e.SetDepthSink(hub.Publish)
+
+	c := &WSClient{send: make(chan []byte, 1), server: &WSServer{depth: hub}}
+	if err := hub.Subscribe(c, "TKA/TKB", "10", ""); err != nil {
+		t.Fatal(err)
+	}
+	snap := readDepth(t, c)
+	if snap.Type != "depth_snapshot" || snap.Data.Depth != "10" || len(snap.Data.Bids) != 1 || snap.Data.Bids[0].Amount != "5" {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+	e.AddOrder(depthOrder("b2", "buy", "100", "3", 2))
+	hub.drain()
+	u := readDepth(t, c)
+	if u.Type != "depth_update" || u.Data.PrevSeq != snap.Data.Seq || len(u.Data.Bids) != 1 || u.Data.Bids[0].Amount != "8" {
+		t.Fatalf("update = %+v, want bid 100 -> 8 after seq %d", u, snap.Data.Seq)
+	}
+
+	// 客户端未读取：第二条增量放不进发送队列，下一次改发快照
+	e.AddOrder(depthOrder("a1", "sell", "110", "1", 3))
+	e.AddOrder(depthOrder("a2", "sell", "111", "1", 4))
+	hub.drain()
+	if m := readDepth(t, c); m.Type != "depth_update" {
+		t.Fatalf("queued message = %+v", m)
+	}
+	e.AddOrder(depthOrder("a3", "sell", "112", "1", 5))
+	hub.drain()
+	if m := readDepth(t, c); m.Type != "depth_snapshot" || len(m.Data.Asks) != 3 {
+		t.Fatalf("resync = %+v, want snapshot with 3 asks", m)
+	}
+
+	hub.RemoveClient(c)
+	if err := hub.Subscribe(c, "TKA/TKB", "", ""); err == nil {
+		t.Error("subscribe after RemoveClient should fail")
+	}
+	if err := hub.Subscribe(&WSClient{send: make(chan []byte, 1)}, "TKA/TKB", "20", ""); err == nil {
+		t.Error("depth 20 should be rejected")
+	}
+}
+
+func TestHandleDepthGroupsLevels(t *testing.T) {
+	e := match.NewEngine(map[string]match.PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	for i, p := range []string{"109", "105", "99", "80"} {
+		e.AddOrder(depthOrder("b"+p, "buy", p, "1", int64(i)))
+	}
+	s := &Server{MatchEngine: e}
+	w := httptest.NewRecorder()
+	s.handleDepth(w, httptest.NewRequest(http.MethodGet, "/api/depth?pair=TKA/TKB&depth=10&group=10", nil))
+	var snap match.DepthSnapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("code=%d body=%s", w.Code, w.Body)
+	}
+	if len(snap.Bids) != 3 || snap.Bids[0] != (match.PriceLevel{Price: "100", Amount: "2", Orders: 2}) || snap.Seq == 0 {
+		t.Errorf("grouped depth = %+v", snap)
+	}
+	for _, q := range []string{"pair=TKA/TKB&depth=20", "pair=TKA/TKB&group=0", "depth=10"} {
+		w := httptest.NewRecorder()
+		s.handleDepth(w, httptest.NewRequest(http.MethodGet, "/api/depth?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code=%d, want 400", q, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	s.handleDepth(w, httptest.NewRequest(http.MethodGet, "/api/depth?pair=NOPE/X", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown pair: code=%d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+const (
+	// klinesDefaultLimit /api/klines 默认返回根数
+	klinesDefaultLimit = 500
+	// klinesMaxLimit /api/klines 单次最多返回根数
+	klinesMaxLimit = 1000
+)
+
+// KlineHub K 线推送（WS kline 频道）：订阅交易对与周期后，每笔成交更新的当前 K 线以 kline 消息推送（整根 K 线，可直接覆盖）；
+// 历史 K 线经 /api/klines 获取。发送队列满时丢弃本次更新，下一笔成交的更新仍为完整状态
+type KlineHub struct {
+	mu   sync.Mutex // 保护 subs 与 WSClient.klineClosed；向 c.send 发送时持有
+	subs map[string]map[*WSClient]struct{}
+}
+
+// NewKlineHub 创建 kline 频道推送
+func NewKlineHub() *KlineHub {
+	return &KlineHub{subs: make(map[string]map[*WSClient]struct{})}
+}
+
+func klineTopic(pair, interval string) string {
+	return pair + "|" + interval
+}
+
+// Publish 推送 K 线更新（见 storage.CandleAggregator.SetSink）
+func (h *KlineHub) Publish(c *storage.Candle) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.subs[klineTopic(c.Pair, c.Interval)] {
+		sendDepth(client, "kline", c)
+	}
+}
+
+// Subscribe 订阅交易对某周期的 K 线更新
+func (h *KlineHub) Subscribe(c *WSClient, pair, interval string) error {
+	if pair == "" {
+		return fmt.Errorf("pair required")
+	}
+	if _, ok := storage.CandleDuration(interval); !ok {
+		return fmt.Errorf("invalid interval %q", interval)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.klineClosed {
+		return fmt.Errorf("connection closed")
+	}
+	topic := klineTopic(pair, interval)
+	if h.subs[topic] == nil {
+		h.subs[topic] = make(map[*WSClient]struct{})
+	}
+	h.subs[topic][c] = struct{}{}
+	return nil
+}
+
+// Unsubscribe 取消订阅
+func (h *KlineHub) Unsubscribe(c *WSClient, pair, interval string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(c, klineTopic(pair, interval))
+}
+
+// RemoveClient 移除客户端的全部订阅，此后不再向其发送（须在关闭 c.send 之前调用）
+func (h *KlineHub) RemoveClient(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.klineClosed = true
+	for topic := range h.subs {
+		h.removeLocked(c, topic)
+	}
+}
+
+func (h *KlineHub) removeLocked(c *WSClient, topic string) {
+	subs, ok := h.subs[topic]
+	if !ok {
+		return
+	}
+	delete(subs, c)
+	if len(subs) == 0 {
+		delete(h.subs, topic)
+	}
+}
+
+// handleKlines GET /api/klines?pair=&interval=1m&from=&to=&limit= 返回按起始时间升序的 K 线
+// from/to 为周期起始时间范围（unix 秒，含两端；to 默认当前时间），limit 默认 500、最多 1000，超出时取最近的 limit 根
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	pair := q.Get("pair")
+	if pair == "" {
+		http.Error(w, "pair required", http.StatusBadRequest)
+		return
+	}
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "1m"
+	}
+	if _, ok := storage.CandleDuration(interval); !ok {
+		http.Error(w, "invalid interval", http.StatusBadRequest)
+		return
+	}
+	from, to := int64(0), time.Now().Unix()
+	for name, dst := range map[string]*int64{"from": &from, "to": &to} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+	if from > to {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+	limit := klinesDefaultLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > klinesMaxLimit {
+			http.Error(w, fmt.Sprintf("invalid limit: must be 1-%d", klinesMaxLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	candles := []*storage.Candle{}
+	if s.Candles != nil {
+		list, err := s.Candles.Candles(pair, interval, from, to, limit)
+		if err != nil {
+			log.Printf("[api] klines: %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		candles = append(candles, list...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(candles)
+}
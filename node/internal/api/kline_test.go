@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 订阅交易对与周期后，成交更新的当前 K 线以 kline 消息推送；其他周期与取消订阅后不再推送
+func TestKlineChannel(t *testing.T) {
+	db, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	hub := NewKlineHub()
+	candles := storage.NewCandleAggregator(db, nil)
+	candles.SetSink(hub.Publish)
+
+	c := &WSClient{send: make(chan []byte, 16), server: &WSServer{kline: hub}}
+	c.handleRequest(&wsRequest{Op: "subscribe", Channel: "kline", Pair: "TKA/TKB", Interval: "5m"})
+	candles.Add(&storage.Trade{TradeID: "t1", Pair: "TKA/TKB", Price: "100", Amount: "2", Timestamp: 1000})
+	candles.Add(&storage.Trade{TradeID: "t2", Pair: "TKA/TKB", Price: "90", Amount: "1", Timestamp: 1010})
+	var k storage.Candle
+	readL3(t, c, "kline", &k)
+	readL3(t, c, "kline", &k)
+	if k.Interval != "5m" || k.OpenTime != 900 || k.Open != "100" || k.Close != "90" || k.Volume != "3" || k.Trades != 2 {
+		t.Errorf("kline = %+v", k)
+	}
+
+	c.handleRequest(&wsRequest{Op: "unsubscribe", Channel: "kline", Pair: "TKA/TKB", Interval: "5m"})
+	candles.Add(&storage.Trade{TradeID: "t3", Pair: "TKA/TKB", Price: "95", Amount: "1", Timestamp: 1020})
+	select {
+	case raw := <-c.send:
+		t.Errorf("message after unsubscribe: %s", raw)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.handleRequest(&wsRequest{Op: "subscribe", Channel: "kline", Pair: "TKA/TKB", Interval: "7m"})
+	var errMsg map[string]string
+	readL3(t, c, "error", &errMsg)
+	hub.RemoveClient(c)
+	if err := hub.Subscribe(c, "TKA/TKB", "1m"); err == nil {
+		t.Error("subscribe after RemoveClient should fail")
+	}
+}
+
+func TestHandleKlines(t *testing.T) {
+	db, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	candles := storage.NewCandleAggregator(db, nil)
+	for i, p := range []string{"10", "11", "12"} {
+		candles.Add(&storage.Trade{TradeID: p, Pair: "TKA/TKB", Price: p, Amount: "1", Timestamp: int64(60 * (i + 1))})
+	}
+	s := &Server{Candles: candles}
+	get := func(q string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleKlines(w, httptest.NewRequest(http.MethodGet, "/api/klines?"+q, nil))
+		return w
+	}
+
+	w := get("pair=TKA/TKB&from=60&to=120")
+	var list []storage.Candle
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("code=%d body=%s", w.Code, w.Body)
+	}
+	if len(list) != 2 || list[0].OpenTime != 60 || list[1].Close != "11" {
+		t.Errorf("klines = %+v", list)
+	}
+	list = nil
+	_ = json.Unmarshal(get("pair=TKA/TKB&interval=1h&limit=1").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Open != "10" || list[0].Close != "12" || list[0].Trades != 3 {
+		t.Errorf("1h klines = %+v", list)
+	}
+	for _, q := range []string{"interval=1m", "pair=TKA/TKB&interval=2m", "pair=TKA/TKB&from=x", "pair=TKA/TKB&from=100&to=50", "pair=TKA/TKB&limit=1001"} {
+		if w := get(q); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code=%d, want 400", q, w.Code)
+		}
+	}
+}
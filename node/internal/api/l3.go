@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/match"
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+)
+
+const (
+	// l3SubBuffer 每个 l3 订阅可积压的事件批次数
+	l3SubBuffer = 256
+	// l3ResyncDelay 客户端发送队列满时重新订阅前的等待时间
+	l3ResyncDelay = 100 * time.Millisecond
+)
+
+// L3Hub L3 逐笔行情分发（WS l3 频道）：每个客户端的每个交易对订阅对应一个 match.L3Subscription 与转发协程
+//   - 协议：订阅后先收到 l3_snapshot（含 seq 与 checksum），此后 l3 消息按序携带事件批次，事件 seq 逐条连续；
+//     reset 事件替换整个订单簿；客户端发现不连续或校验和不一致时重新发送 subscribe
+//   - 订阅积压或客户端发送队列满丢弃消息时，服务端重新订阅并下发新的 l3_snapshot
+type L3Hub struct {
+	feed *match.L3Feed
+
+	mu   sync.Mutex // 保护 subs 与 WSClient.l3Closed；向 c.send 发送时持有（RemoveClient 之后不再发送）
+	subs map[*WSClient]map[string]*match.L3Subscription
+}
+
+// l3Message l3 消息体
+type l3Message struct {
+	Pair   string           `json:"pair"`
+	Events []*match.L3Event `json:"events"`
+}
+
+// NewL3Hub 创建 l3 频道分发
+func NewL3Hub(feed *match.L3Feed) *L3Hub {
+	return &L3Hub{feed: feed, subs: make(map[*WSClient]map[string]*match.L3Subscription)}
+}
+
+// Subscribe 订阅交易对逐笔行情（同一客户端重复订阅即为重新同步：替换订阅并重新下发快照）
+func (h *L3Hub) Subscribe(c *WSClient, pair string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.l3Closed {
+		return fmt.Errorf("connection closed")
+	}
+	sub, err := h.feed.Subscribe(pair, l3SubBuffer)
+	if err != nil {
+		return err
+	}
+	if old, ok := h.subs[c][pair]; ok {
+		old.Close()
+	}
+	if h.subs[c] == nil {
+		h.subs[c] = make(map[string]*match.L3Subscription)
+	}
+	h.subs[c][pair] = sub
+	go h.forward(c, sub)
+	return nil
+}
+
+// Unsubscribe 取消客户端对交易对的订阅
+func (h *L3Hub) Unsubscribe(c *WSClient, pair string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if sub, ok := h.subs[c][pair]; ok {
+		sub.Close()
+		delete(h.subs[c], pair)
+	}
+}
+
+// RemoveClient 移除客户端的全部订阅，此后不再向其发送（须在关闭 c.send 之前调用）
+func (h *L3Hub) RemoveClient(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.l3Closed = true
+	for _, sub := range h.subs[c] {
+		sub.Close()
+	}
+	delete(h.subs, c)
+}
+
+// forward 下发快照并转发事件批次直至订阅被取消；积压或发送队列满时重新订阅
+func (h *L3Hub) forward(c *WSClient, sub *match.L3Subscription) {
+	for {
+		ok := h.send(c, sub, "l3_snapshot", sub.Snapshot)
+		for ok {
+			events, open := <-sub.C
+			if !open {
+				break
+			}
+			ok = h.send(c, sub, "l3", &l3Message{Pair: sub.Pair, Events: events})
+		}
+		if !ok {
+			metrics.RecordL3Resync(sub.Pair)
+			time.Sleep(l3ResyncDelay)
+		}
+		if sub = h.resubscribe(c, sub); sub == nil {
+			return
+		}
+	}
+}
+
+// send 订阅仍有效时非阻塞放入客户端发送队列；订阅已取消或队列已满返回 false
+func (h *L3Hub) send(c *WSClient, sub *match.L3Subscription, typ string, data interface{}) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.currentLocked(c, sub) && sendDepth(c, typ, data)
+}
+
+// resubscribe 订阅仍有效时以新订阅替换；已取消或交易对已不存在时返回 nil
+func (h *L3Hub) resubscribe(c *WSClient, old *match.L3Subscription) *match.L3Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.currentLocked(c, old) {
+		return nil
+	}
+	old.Close()
+	sub, err := h.feed.Subscribe(old.Pair, l3SubBuffer)
+	if err != nil {
+		delete(h.subs[c], old.Pair)
+		sendDepth(c, "error", map[string]string{"channel": "l3", "pair": old.Pair, "message": err.Error()})
+		return nil
+	}
+	h.subs[c][old.Pair] = sub
+	return sub
+}
+
+func (h *L3Hub) currentLocked(c *WSClient, sub *match.L3Subscription) bool {
+	return !c.l3Closed && h.subs[c][sub.Pair] == sub
+}
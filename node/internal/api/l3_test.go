@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/match"
+)
+
+type l3TestMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func readL3(t *testing.T, c *WSClient, typ string, v interface{}) {
+	t.Helper()
+	select {
+	case raw := <-c.send:
+		var m l3TestMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != typ {
+			t.Fatalf("message type = %s (%s), want %s", m.Type, m.Data, typ)
+		}
+		if err := json.Unmarshal(m.Data, v); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no %s message", typ)
+	}
+}
+
+// 订阅后先收到 l3_snapshot，此后 l3 消息的事件可在快照上按序重建订单簿；取消订阅后不再推送
+func TestL3ChannelSnapshotThenEvents(t *testing.T) {
+	e := match.NewEngine(map[string]match.PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	e.AddOrder(depthOrder("b1", "buy", "100", "5", 1))
+	feed := match.NewL3Feed(e)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go feed.Run(ctx)
+	hub := NewL3Hub(feed)
+
+	c := &WSClient{send: make(chan []byte, 16), server: &WSServer{l3: hub}}
+	c.handleRequest(&wsRequest{Op: "subscribe", Channel: "l3", Pair: "TKA/TKB"})
+	var snap match.L3Snapshot
+	readL3(t, c, "l3_snapshot", &snap)
+	if len(snap.Bids) != 1 || snap.Bids[0].OrderID != "b1" {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+	book := match.NewL3Book(&snap)
+
+	e.AddOrder(depthOrder("a1", "sell", "110", "2", 2))
+	e.RemoveOrder("TKA/TKB", "b1")
+	for book.Seq < snap.Seq+2 {
+		var msg l3Message
+		readL3(t, c, "l3", &msg)
+		for _, ev := range msg.Events {
+			if err := book.Apply(ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, ok := book.Order("b1"); ok || len(book.Levels(false, 0)) != 1 {
+		t.Errorf("rebuilt book: bids=%+v asks=%+v", book.Levels(true, 0), book.Levels(false, 0))
+	}
+
+	c.handleRequest(&wsRequest{Op: "unsubscribe", Channel: "l3", Pair: "TKA/TKB"})
+	e.AddOrder(depthOrder("a2", "sell", "111", "2", 3))
+	select {
+	case raw := <-c.send:
+		t.Errorf("message after unsubscribe: %s", raw)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.handleRequest(&wsRequest{Op: "subscribe", Channel: "l3", Pair: "NOPE/X"})
+	var errMsg map[string]string
+	readL3(t, c, "error", &errMsg)
+	hub.RemoveClient(c)
+	if err := hub.Subscribe(c, "TKA/TKB"); err == nil {
+		t.Error("subscribe after RemoveClient should fail")
+	}
+}
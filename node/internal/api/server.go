@@ -2,8 +2,12 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
 	"strconv"
@@ -11,10 +15,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/P2P-P2P/p2p/node/internal/config"
 	"github.com/P2P-P2P/p2p/node/internal/match"
 	"github.com/P2P-P2P/p2p/node/internal/storage"
 	syncpkg "github.com/P2P-P2P/p2p/node/internal/sync"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/yaml.v3"
 )
 
 // cachedResponse 缓存的响应
@@ -69,7 +75,7 @@ func (l *orderRateLimiter) allowTokenBucket(key string) bool {
 			tokens:     float64(l.limit),
 			lastUpdate: now,
 			capacity:   float64(l.limit),
-			rate:       float64(l.limit) / window.Seconds(),
+			rate:       float64(l.limit) / l.window.Seconds(),
 		}
 		l.tokens[key] = bucket
 	}
@@ -160,6 +166,13 @@ type Server struct {
 	WSServer                 *WSServer // WebSocket 服务器
 	RateLimitOrdersPerMinute uint64    // 每 IP 每分钟下单上限，0=不限制（Spam 防护）
 	BlockedTraders           map[string]struct{} // 黑名单：拒绝这些地址下单（Spam 防护；从 config api.blocked_traders 构建）
+	AdminToken               string              // 管理接口 Bearer 令牌（config api.admin_token），空则管理接口返回 404
+	Markets                  *match.MarketRegistry // 交易对注册表（管理接口上架/下架/暂停），无撮合引擎时为 nil
+	Nonces                   *match.NonceGuard     // 订单 nonce 校验（已使用/低于批量撤单下限/链上无效则拒绝），nil 为不校验
+	Balances                 *match.BalanceService // Vault 余额校验（可用余额不足则拒绝），nil 为不校验
+	Dispatcher               *match.Dispatcher     // 本节点撮合输入队列：交易对队列已满时下单返回 429，nil 为不检查
+	Verifier                 *match.SignatureVerifier // 订单签名验证（worker 池 + 签名哈希缓存），nil 时同步验证
+	Candles                  *storage.CandleAggregator // K 线聚合（/api/klines），nil 时返回空列表
 	orderLimiter              *orderRateLimiter
 	// 响应缓存优化
 	responseCache            map[string]*cachedResponse
@@ -199,12 +212,6 @@ func (s *Server) Run(listen string) {
 	if listen == "" {
 		return
 	}
-	// 节点启动时从存储恢复订单簿（清单 1.1 节点重启后订单簿同步）
-	if s.Store != nil && s.MatchEngine != nil {
-		if err := match.RestoreOrdersFromStore(s.MatchEngine, s.Store); err != nil {
-			log.Printf("[api] 订单簿恢复失败: %v", err)
-		}
-	}
 	if s.RateLimitOrdersPerMinute > 0 {
 		s.orderLimiter = newOrderRateLimiter(int(s.RateLimitOrdersPerMinute), time.Minute)
 		log.Printf("[api] 下单速率限制: 每 IP 每分钟 %d 笔", s.RateLimitOrdersPerMinute)
@@ -233,12 +240,22 @@ func (s *Server) Run(listen string) {
 	
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/orderbook", s.cors(s.handleOrderbook))
+	mux.HandleFunc("/api/depth", s.cors(s.handleDepth))
 	mux.HandleFunc("/api/trades", s.cors(s.handleTrades))
+	mux.HandleFunc("/api/klines", s.cors(s.handleKlines))
 	mux.HandleFunc("/api/orders", s.cors(s.handleOrders))
 	mux.HandleFunc("/api/order", s.cors(s.handlePostOrder))
 	mux.HandleFunc("/api/order/cancel", s.cors(s.handleCancelOrder))
+	mux.HandleFunc("/api/order/amend", s.cors(s.handleAmendOrder))
+	mux.HandleFunc("/api/order/cancel-all", s.cors(s.handleCancelAll))
+	mux.HandleFunc("/api/nonce", s.cors(s.handleNonce))
+	mux.HandleFunc("/api/markets", s.cors(s.handleMarkets))
+	mux.HandleFunc("/api/fees", s.cors(s.handleFees))
 	mux.HandleFunc("/api/health", s.cors(s.handleHealth))
 	mux.HandleFunc("/api/node", s.cors(s.handleNode))
+	mux.HandleFunc("/api/admin/market", s.handleAdminMarket)
+	mux.HandleFunc("/api/admin/market/list", s.handleAdminListMarket)
+	mux.HandleFunc("/api/admin/market/delist", s.handleAdminDelistMarket)
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/ws", s.handleWebSocket)
 	srv := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
@@ -342,6 +359,196 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(out)
 }
 
+// handleMarkets 返回交易对列表与交易规则（tick/lot、数量上下限、最小成交额、价格带），供客户端下单前预校验
+func (s *Server) handleMarkets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	markets := []match.MarketInfo{}
+	if s.MatchEngine != nil {
+		markets = s.MatchEngine.Markets()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(markets)
+}
+
+// AdminMarketRequest 管理员设置交易对状态：state 为 trading | halted | auction | cancel-only，durationSec > 0 时到期自动流转
+type AdminMarketRequest struct {
+	Pair        string `json:"pair"`
+	State       string `json:"state"`
+	DurationSec int64  `json:"durationSec"`
+	Reason      string `json:"reason"`
+}
+
+// AdminListMarketRequest 管理员上架交易对：除 pair 外字段与 config.yaml match.pairs 下单个交易对相同（token0、tick_size、maker_fee_bps 等）
+type AdminListMarketRequest struct {
+	Pair              string `yaml:"pair"`
+	config.PairTokens `yaml:",inline"`
+}
+
+// checkAdmin 校验管理接口请求：未配置令牌时返回 404，仅接受 POST 与正确的 Authorization: Bearer <admin_token>
+func (s *Server) checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.AdminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if s.Markets == nil {
+		http.Error(w, "match engine not configured", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// writeMarketError 按交易对注册表错误类型返回状态码
+func writeMarketError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, match.ErrUnknownPair):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, match.ErrPairExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, match.ErrJournalWrite):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// handleAdminMarket 管理员手动暂停/只撤单/恢复交易对；须携带 Authorization: Bearer <admin_token>，未配置令牌时不开放
+// 状态变化（含复盘集合竞价成交）由节点的状态推进循环统一推送与落库
+func (s *Server) handleAdminMarket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	var req AdminMarketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Pair == "" || req.State == "" {
+		http.Error(w, "pair and state required", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "admin"
+	}
+	ch, err := s.Markets.SetState(req.Pair, req.State, req.DurationSec, req.Reason)
+	if err != nil {
+		writeMarketError(w, err)
+		return
+	}
+	log.Printf("[api] 管理员设置交易对状态 pair=%s %s → %s until=%d reason=%s", ch.Pair, ch.From, ch.To, ch.Until, ch.Reason)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ch)
+}
+
+// handleAdminListMarket 管理员运行时上架交易对（无需重启）；请求体为 JSON，字段名同 config.yaml
+func (s *Server) handleAdminListMarket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	// JSON 是 YAML 的子集：按 yaml 标签解析，字段名与配置文件一致
+	var req AdminListMarketRequest
+	if err := yaml.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := s.Markets.List(req.Pair, req.PairTokens); err != nil {
+		writeMarketError(w, err)
+		return
+	}
+	log.Printf("[api] 管理员上架交易对 pair=%s", req.Pair)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "pair": req.Pair})
+}
+
+// handleAdminDelistMarket 管理员运行时下架交易对：撤销其全部订单（订单状态经 WS 推送），此后拒绝该交易对的订单
+func (s *Server) handleAdminDelistMarket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Pair string `json:"pair"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Pair == "" {
+		http.Error(w, "pair required", http.StatusBadRequest)
+		return
+	}
+	cancelled, err := s.Markets.Delist(req.Pair)
+	if s.WSServer != nil {
+		for _, o := range cancelled {
+			s.WSServer.BroadcastOrderStatus(o)
+		}
+	}
+	if err != nil {
+		writeMarketError(w, err)
+		return
+	}
+	log.Printf("[api] 管理员下架交易对 pair=%s 撤销订单=%d", req.Pair, len(cancelled))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "pair": req.Pair, "cancelled": len(cancelled)})
+}
+
+// handleFees 返回指定统计周期按手续费代币汇总的净手续费（供 FeeDistributor 对账）
+func (s *Server) handleFees(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		http.Error(w, "period required", http.StatusBadRequest)
+		return
+	}
+	fees := map[string]string{}
+	if s.MatchEngine != nil {
+		fees = s.MatchEngine.GetPeriodFees(period)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"period": period, "fees": fees})
+}
+
+// handleNonce 返回 trader 的 nonce 记录与下一个可用 nonce（客户端签名前获取，nonce 签入 EIP-712 订单）
+// nonce 须严格递增且各交易对共用：同时在多个交易对下单时，较大 nonce 先入簿会使较小 nonce 的订单被拒绝，客户端须串行使用 nonce
+func (s *Server) handleNonce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	trader := r.URL.Query().Get("trader")
+	if trader == "" {
+		http.Error(w, "trader required", http.StatusBadRequest)
+		return
+	}
+	n := &storage.TraderNonce{Trader: strings.ToLower(trader), MaxUsed: -1}
+	if s.Store != nil {
+		var err error
+		if n, err = s.Store.GetTraderNonce(trader); err != nil {
+			log.Printf("[api] nonce: %v", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"trader": n.Trader, "maxUsed": n.MaxUsed, "minValid": n.MinValid, "next": n.NextNonce(),
+	})
+}
+
 func (s *Server) handleOrderbook(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -374,6 +581,8 @@ func (s *Server) handleOrderbook(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "db error", http.StatusInternalServerError)
 			return
 		}
+		// 冰山单只展示可见部分
+		bids, asks = publicOrders(bids), publicOrders(asks)
 	}
 	
 	response := OrderbookResponse{Pair: pair, Bids: bids, Asks: asks}
@@ -381,9 +590,7 @@ func (s *Server) handleOrderbook(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Cache", "MISS")
 	
 	// 编码并缓存响应
-	var buf []byte
 	if data, err := json.Marshal(response); err == nil {
-		buf = data
 		s.setCachedResponse(cacheKey, data)
 		_, _ = w.Write(data)
 	} else {
@@ -481,10 +688,74 @@ func (s *Server) handlePostOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	if o.OrderID == "" || o.Pair == "" || o.Side == "" || o.Price == "" || o.Amount == "" {
+	if o.OrderID == "" || o.Pair == "" || o.Side == "" {
 		http.Error(w, "missing required fields", http.StatusBadRequest)
 		return
 	}
+	if o.Side != "buy" && o.Side != "sell" {
+		http.Error(w, "invalid side", http.StatusBadRequest)
+		return
+	}
+	switch o.Type {
+	case "", storage.OrderTypeLimit:
+		if o.Price == "" || o.Amount == "" {
+			http.Error(w, "missing required fields", http.StatusBadRequest)
+			return
+		}
+		// 价格与数量须为最小单位正整数（定点撮合，拒绝小数字符串）
+		if p, ok := storage.ParseUnits(o.Price); !ok || p.Sign() <= 0 {
+			http.Error(w, "invalid price: must be a positive integer in base units", http.StatusBadRequest)
+			return
+		}
+		if a, ok := storage.ParseUnits(o.Amount); !ok || a.Sign() <= 0 {
+			http.Error(w, "invalid amount: must be a positive integer in base units", http.StatusBadRequest)
+			return
+		}
+		if o.QuoteAmount != "" || o.MaxSlippageBps != 0 {
+			http.Error(w, "quoteAmount/maxSlippageBps only allowed for market orders", http.StatusBadRequest)
+			return
+		}
+	case storage.OrderTypeMarket:
+		if _, err := match.ValidateMarketOrder(&o); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "invalid type: must be limit or market", http.StatusBadRequest)
+		return
+	}
+	if err := match.ValidateTimeInForce(&o); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := match.ValidateTrigger(&o); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := match.ValidateIceberg(&o); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := match.ValidateSelfTradePrevention(o.SelfTradePrevention); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if o.AmendedAt != 0 || o.QueuedAt != 0 {
+		http.Error(w, "amendedAt/queuedAt must not be set by client", http.StatusBadRequest)
+		return
+	}
+	// 交易对规则：tick/lot、数量上下限、最小成交额、价格带（规则见 /api/markets）
+	if s.MatchEngine != nil {
+		if err := s.MatchEngine.CheckMarketRules(&o); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// 节点退出中不再接收订单（先于签名验证，不做无用功）；队列准入见发布前的 Dispatcher.Saturated
+	if s.Dispatcher != nil && s.Dispatcher.Closed() {
+		http.Error(w, "matching engine shutting down", http.StatusServiceUnavailable)
+		return
+	}
 	// Spam 防护：黑名单 trader 拒绝
 	if s.BlockedTraders != nil {
 		if _, blocked := s.BlockedTraders[strings.ToLower(o.Trader)]; blocked {
@@ -501,13 +772,13 @@ func (s *Server) handlePostOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "order expired", http.StatusBadRequest)
 		return
 	}
-	// 验证订单签名（EIP-712，与前端 orderSigning 一致）
+	// 验证订单签名（EIP-712，与前端 orderSigning 一致）；结果按签名哈希缓存，gossip 回环到本节点时不再重复 ecrecover
 	{
 		var pairTokens *match.PairTokens
 		if s.MatchEngine != nil {
 			pairTokens = s.MatchEngine.GetPairTokens(o.Pair)
 		}
-		valid, err := match.VerifyOrderSignature(&o, pairTokens)
+		valid, err := s.Verifier.Verify(&o, pairTokens)
 		if err != nil {
 			log.Printf("[api] 签名验证错误: %v", err)
 			http.Error(w, "signature verification error", http.StatusBadRequest)
@@ -518,11 +789,55 @@ func (s *Server) handlePostOrder(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	// orderId 归属：同 ID 的已有订单须为同一签名订单（签名哈希），否则拒绝（防止以他人的 orderId 挤掉其挂单）；nonce 不得已在其他交易对使用
+	if err := s.checkOrderOwner(&o); err != nil {
+		if errors.Is(err, storage.ErrOrderIDConflict) || errors.Is(err, storage.ErrNonceUsed) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("[api] orderId 归属校验错误: %v", err)
+		http.Error(w, "order id check error", http.StatusInternalServerError)
+		return
+	}
+	// 资金预检：订单所需数量不得超过 Vault 托管余额减去挂单占用（防止虚假深度）；入簿时由撮合节点在 trader/token 校验锁内再次校验
+	if err := s.Balances.Admit(&o); err != nil {
+		if errors.Is(err, match.ErrInsufficientBalance) {
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
+			return
+		}
+		if errors.Is(err, match.ErrBalanceUnavailable) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Replay 防护：nonce 须未使用且不低于批量撤单下限（入簿时由撮合节点再次校验并占用）
+	if err := s.Nonces.Check(&o); err != nil {
+		if errors.Is(err, storage.ErrNonceUsed) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, match.ErrNonceUnavailable) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("[api] nonce 校验错误: %v", err)
+		http.Error(w, "nonce check error", http.StatusInternalServerError)
+		return
+	}
 	data, err := json.Marshal(&o)
 	if err != nil {
 		http.Error(w, "encode error", http.StatusInternalServerError)
 		return
 	}
+	// 背压预检：该交易对撮合队列已满返回 429，客户端按 Retry-After 重试，订单不发布；
+	// 发布在本处理协程内进行，不占用撮合 worker，订单经本节点的 gossip 订阅入队撮合（见 OnNewOrder）
+	if s.Dispatcher != nil && s.Dispatcher.Saturated(o.Pair) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(match.RetryAfter/time.Second)))
+		http.Error(w, "matching queue full for pair "+o.Pair+", retry later", http.StatusTooManyRequests)
+		return
+	}
 	if err := s.Publish(syncpkg.TopicOrderNew, data); err != nil {
 		log.Printf("[api] publish order: %v", err)
 		http.Error(w, "publish failed", http.StatusInternalServerError)
@@ -534,10 +849,25 @@ func (s *Server) handlePostOrder(w http.ResponseWriter, r *http.Request) {
 		s.WSServer.BroadcastOrderStatus(&o)
 	}
 	
+	// 订单已发布、尚未撮合：返回 202。预检后队列仍可能占满，入队失败的订单以 rejected 订单状态经 WS 与 gossip 异步通知
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
 	_, _ = w.Write([]byte(`{"ok":true,"orderId":"` + o.OrderID + `"}`))
 }
 
+// checkOrderOwner 校验 orderId 未被撮合引擎或本地存储中其他签名订单占用，nonce 未在撮合引擎的其他交易对使用
+func (s *Server) checkOrderOwner(o *storage.Order) error {
+	if s.MatchEngine != nil {
+		if err := s.MatchEngine.CheckOrderOwner(o); err != nil {
+			return err
+		}
+	}
+	if s.Store != nil {
+		return s.Store.CheckOrderOwner(o)
+	}
+	return nil
+}
+
 func (s *Server) handleCancelOrder(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -606,6 +936,158 @@ func (s *Server) handleCancelOrder(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(`{"ok":true}`))
 }
 
+// handleAmendOrder 改单（cancel-replace 原子操作）：须携带订单 trader 的 AmendOrder 签名，校验后广播到改单主题
+func (s *Server) handleAmendOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Publish == nil {
+		http.Error(w, "publish not configured", http.StatusServiceUnavailable)
+		return
+	}
+	var req syncpkg.AmendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.OrderID == "" || req.Signature == "" || req.Timestamp <= 0 {
+		http.Error(w, "orderId, signature and timestamp required", http.StatusBadRequest)
+		return
+	}
+	if req.Timestamp > time.Now().Unix()+match.AmendClockSkew {
+		http.Error(w, match.ErrAmendFuture.Error(), http.StatusBadRequest)
+		return
+	}
+	newPrice, newAmount, err := match.ParseAmendFields(req.NewPrice, req.NewAmount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var order *storage.Order
+	if s.Store != nil {
+		order, _ = s.Store.GetOrder(req.OrderID)
+	}
+	if order == nil && s.MatchEngine != nil {
+		order = s.MatchEngine.GetOrder(req.OrderID)
+	}
+	if order == nil {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	}
+	if order.Status != storage.OrderStatusOpen && order.Status != storage.OrderStatusPartial {
+		http.Error(w, "order not amendable in status "+order.Status, http.StatusConflict)
+		return
+	}
+	// 改后的订单同样须满足交易对规则
+	if s.MatchEngine != nil {
+		amended := *order
+		if newPrice != nil {
+			amended.Price = storage.FormatUnits(newPrice)
+		}
+		if newAmount != nil {
+			amended.Amount = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(amended.Filled), newAmount))
+		}
+		if err := s.MatchEngine.CheckMarketRules(&amended); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// Spam 防护：黑名单 trader 拒绝改单
+	if s.BlockedTraders != nil {
+		if _, blocked := s.BlockedTraders[strings.ToLower(order.Trader)]; blocked {
+			http.Error(w, "trader blocked", http.StatusForbidden)
+			return
+		}
+	}
+	valid, err := match.VerifyAmendSignature(req.OrderID, order.Trader, req.NewPrice, req.NewAmount, req.Signature, req.Timestamp)
+	if err != nil {
+		log.Printf("[api] 改单签名验证错误: %v", err)
+		http.Error(w, "signature verification error", http.StatusBadRequest)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	// 资金预检：加量或买单提价增加的占用不得超过 Vault 可用余额；改单时由撮合节点在 trader/token 校验锁内再次校验
+	if err := s.Balances.AdmitAmend(order.Trader, req.OrderID, req.NewPrice, req.NewAmount); err != nil {
+		switch {
+		case errors.Is(err, match.ErrInsufficientBalance):
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
+		case errors.Is(err, match.ErrBalanceUnavailable):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case errors.Is(err, match.ErrAmendOrderNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	data, err := json.Marshal(&req)
+	if err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.Publish(syncpkg.TopicOrderAmend, data); err != nil {
+		log.Printf("[api] publish amend: %v", err)
+		http.Error(w, "publish failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "orderId": req.OrderID})
+}
+
+// handleCancelAll 按 nonce 批量撤单：须携带 trader 的 CancelAllBelowNonce 签名，校验后广播到批量撤单主题
+// 各节点撤销该 trader 在所有交易对中 nonce 小于请求 nonce 的订单
+func (s *Server) handleCancelAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Publish == nil {
+		http.Error(w, "publish not configured", http.StatusServiceUnavailable)
+		return
+	}
+	var req syncpkg.CancelAllRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Trader == "" || req.Signature == "" || req.Timestamp <= 0 || req.Nonce <= 0 {
+		http.Error(w, "trader, nonce, signature and timestamp required", http.StatusBadRequest)
+		return
+	}
+	if s.BlockedTraders != nil {
+		if _, blocked := s.BlockedTraders[strings.ToLower(req.Trader)]; blocked {
+			http.Error(w, "trader blocked", http.StatusForbidden)
+			return
+		}
+	}
+	valid, err := match.VerifyCancelAllSignature(req.Trader, req.Nonce, req.Signature, req.Timestamp)
+	if err != nil {
+		log.Printf("[api] 批量撤单签名验证错误: %v", err)
+		http.Error(w, "signature verification error", http.StatusBadRequest)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	data, err := json.Marshal(&req)
+	if err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.Publish(syncpkg.TopicOrderCancelAll, data); err != nil {
+		log.Printf("[api] publish cancel-all: %v", err)
+		http.Error(w, "publish failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
+
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
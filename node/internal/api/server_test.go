@@ -1,6 +1,20 @@
 package api
 
-import "testing"
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/P2P-P2P/p2p/node/internal/match"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
 
 func TestBuildTraderBlacklist(t *testing.T) {
 	addrs := []string{
@@ -23,3 +37,93 @@ func TestBuildTraderBlacklist(t *testing.T) {
 	}
 }
 
+// 下单经撮合队列非阻塞准入：发布不经撮合 worker、不等待撮合；队列已满时返回 429（不发布），分派器关闭后返回 503
+func TestPostOrderBackpressure(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := match.PairTokens{Token0: "0x1111111111111111111111111111111111111111", Token1: "0x2222222222222222222222222222222222222222"}
+	engine := match.NewEngine(map[string]match.PairTokens{"TKA/TKB": tokens})
+	d := match.NewDispatcher(1, engine.HasPair)
+	var published atomic.Int32
+	s := &Server{
+		MatchEngine: engine,
+		Dispatcher:  d,
+		Publish:     func(string, []byte) error { published.Add(1); return nil },
+	}
+	post := func(id string) *httptest.ResponseRecorder {
+		o := &storage.Order{
+			OrderID: id, Trader: crypto.PubkeyToAddress(key.PublicKey).Hex(), Pair: "TKA/TKB", Side: "buy",
+			Price: "100", Amount: "1", CreatedAt: time.Now().Unix(), ExpiresAt: time.Now().Unix() + 3600,
+		}
+		hash, err := match.OrderSigningHash(o, &tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := crypto.Sign(hash.Bytes(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Signature = "0x" + hex.EncodeToString(sig)
+		body, _ := json.Marshal(o)
+		w := httptest.NewRecorder()
+		s.handlePostOrder(w, httptest.NewRequest(http.MethodPost, "/api/order", bytes.NewReader(body)))
+		return w
+	}
+
+	// worker 被占用时下单仍立即发布（不排入撮合队列、不等待 worker），返回 202：订单已受理、尚未撮合
+	block, started := make(chan struct{}), make(chan struct{})
+	_ = d.Submit("TKA/TKB", func() { close(started); <-block })
+	<-started
+	if w := post("o1"); w.Code != http.StatusAccepted || published.Load() != 1 || d.QueueLen("TKA/TKB") != 0 {
+		t.Fatalf("admitted order: code=%d published=%d queued=%d body=%s", w.Code, published.Load(), d.QueueLen("TKA/TKB"), w.Body)
+	}
+	// 队列已满（长度 1）：下单被拒绝
+	_ = d.Submit("TKA/TKB", func() {})
+	if w := post("o2"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("full queue: code=%d Retry-After=%q body=%s, want 429 with retry hint", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+	close(block)
+	if n := published.Load(); n != 1 {
+		t.Errorf("published %d orders, want 1", n)
+	}
+	d.Close()
+	if w := post("o3"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("closed dispatcher: code=%d, want 503", w.Code)
+	}
+}
+
+func TestHandleNonce(t *testing.T) {
+	db, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &Server{Store: db}
+	get := func(q string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleNonce(w, httptest.NewRequest(http.MethodGet, "/api/nonce?"+q, nil))
+		return w
+	}
+	next := func() int64 {
+		t.Helper()
+		var resp struct{ Next int64 }
+		if err := json.Unmarshal(get("trader=0xAbC").Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Next
+	}
+	if n := next(); n != 0 {
+		t.Errorf("fresh trader next = %d, want 0", n)
+	}
+	if err := db.UseNonce("0xabc", 4); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(); n != 5 {
+		t.Errorf("after nonce 4 next = %d, want 5", n)
+	}
+	if w := get(""); w.Code != http.StatusBadRequest {
+		t.Errorf("missing trader: code=%d, want 400", w.Code)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	
 	"github.com/gorilla/websocket"
 	
+	"github.com/P2P-P2P/p2p/node/internal/match"
 	"github.com/P2P-P2P/p2p/node/internal/storage"
 )
 
@@ -22,10 +23,13 @@ var upgrader = websocket.Upgrader{
 
 // WSClient WebSocket 客户端
 type WSClient struct {
-	conn     *websocket.Conn
-	send     chan []byte
-	server   *WSServer
-	lastPong time.Time // 最后收到pong的时间
+	conn        *websocket.Conn
+	send        chan []byte
+	server      *WSServer
+	lastPong    time.Time // 最后收到pong的时间
+	depthClosed bool      // 已从行情订阅移除（连接关闭），由 DepthHub.bmu 保护
+	l3Closed    bool      // 已从逐笔行情订阅移除（连接关闭），由 L3Hub.mu 保护
+	klineClosed bool      // 已从 K 线订阅移除（连接关闭），由 KlineHub.mu 保护
 }
 
 // WSServer WebSocket 服务器
@@ -40,6 +44,12 @@ type WSServer struct {
 	connectionCount int
 	// 消息队列大小限制
 	maxMessageQueue int
+	// L2 行情订阅（depth 频道），nil 为不支持
+	depth *DepthHub
+	// L3 逐笔行情订阅（l3 频道），nil 为不支持
+	l3 *L3Hub
+	// K 线订阅（kline 频道），nil 为不支持
+	kline *KlineHub
 }
 
 // NewWSServer 创建 WebSocket 服务器
@@ -54,6 +64,34 @@ func NewWSServer() *WSServer {
 	}
 }
 
+// SetDepthHub 启用 depth 频道（须在 Run 之前调用）
+func (s *WSServer) SetDepthHub(h *DepthHub) {
+	s.depth = h
+}
+
+// SetL3Hub 启用 l3 频道（须在 Run 之前调用）
+func (s *WSServer) SetL3Hub(h *L3Hub) {
+	s.l3 = h
+}
+
+// SetKlineHub 启用 kline 频道（须在 Run 之前调用）
+func (s *WSServer) SetKlineHub(h *KlineHub) {
+	s.kline = h
+}
+
+// removeDepth 移除客户端的行情订阅（关闭 client.send 之前调用）
+func (s *WSServer) removeDepth(client *WSClient) {
+	if s.depth != nil {
+		s.depth.RemoveClient(client)
+	}
+	if s.l3 != nil {
+		s.l3.RemoveClient(client)
+	}
+	if s.kline != nil {
+		s.kline.RemoveClient(client)
+	}
+}
+
 // Run 运行 WebSocket 服务器
 func (s *WSServer) Run() {
 	for {
@@ -73,6 +111,7 @@ func (s *WSServer) Run() {
 			log.Printf("[ws] 客户端连接，当前: %d/%d", s.connectionCount, s.maxConnections)
 			
 		case client := <-s.unregister:
+			s.removeDepth(client)
 			s.mu.Lock()
 			if _, ok := s.clients[client]; ok {
 				delete(s.clients, client)
@@ -101,6 +140,7 @@ func (s *WSServer) Run() {
 				s.mu.Lock()
 				for _, client := range clientsToRemove {
 					if _, ok := s.clients[client]; ok {
+						s.removeDepth(client)
 						close(client.send)
 						delete(s.clients, client)
 					}
@@ -119,8 +159,8 @@ func (s *WSServer) BroadcastOrderBookUpdate(pair string, bids, asks []*storage.O
 		"type": "orderbook_update",
 		"pair": pair,
 		"data": map[string]interface{}{
-			"bids": bids,
-			"asks": asks,
+			"bids": publicOrders(bids),
+			"asks": publicOrders(asks),
 		},
 	}
 	
@@ -128,6 +168,17 @@ func (s *WSServer) BroadcastOrderBookUpdate(pair string, bids, asks []*storage.O
 	s.broadcast <- jsonData
 }
 
+// publicOrders 返回订单的对外副本（冰山单隐藏量不外泄）
+func publicOrders(orders []*storage.Order) []*storage.Order {
+	out := make([]*storage.Order, 0, len(orders))
+	for _, o := range orders {
+		if o != nil {
+			out = append(out, o.PublicView())
+		}
+	}
+	return out
+}
+
 // BroadcastTrade 广播成交
 func (s *WSServer) BroadcastTrade(trade *storage.Trade) {
 	msg := map[string]interface{}{
@@ -143,7 +194,29 @@ func (s *WSServer) BroadcastTrade(trade *storage.Trade) {
 func (s *WSServer) BroadcastOrderStatus(order *storage.Order) {
 	msg := map[string]interface{}{
 		"type": "order_status",
-		"data": order,
+		"data": order.PublicView(),
+	}
+	
+	jsonData, _ := json.Marshal(msg)
+	s.broadcast <- jsonData
+}
+
+// BroadcastOrderEvent 推送订单状态迁移（from → to 与累计成交量），type 为 order_event
+func (s *WSServer) BroadcastOrderEvent(ev *storage.OrderEvent) {
+	msg := map[string]interface{}{
+		"type": "order_event",
+		"data": ev,
+	}
+	
+	jsonData, _ := json.Marshal(msg)
+	s.broadcast <- jsonData
+}
+
+// BroadcastMarketState 推送交易对状态变化（熔断暂停、集合竞价、恢复交易、管理员操作），type 为 market_state
+func (s *WSServer) BroadcastMarketState(ch *match.PairStateChange) {
+	msg := map[string]interface{}{
+		"type": "market_state",
+		"data": ch,
 	}
 	
 	jsonData, _ := json.Marshal(msg)
@@ -182,13 +255,12 @@ func (c *WSClient) readPump() {
 			break
 		}
 		
-		// 处理客户端消息（如订阅特定交易对）
-		var msg map[string]interface{}
-		if err := json.Unmarshal(message, &msg); err != nil {
+		// 处理客户端消息（depth、l3、kline 频道订阅，见 DepthHub、L3Hub、KlineHub）
+		var req wsRequest
+		if err := json.Unmarshal(message, &req); err != nil {
 			continue
 		}
-		
-		log.Printf("[ws] 收到消息: %v", msg)
+		c.handleRequest(&req)
 	}
 }
 
@@ -0,0 +1,124 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// NonceReader 链上 nonce 查询（OrderNonceManager.isValidNonce），撮合节点据此交叉校验订单 nonce
+// 生产环境由 NonceManagerReader 经 RPC 调用合约，测试中用 SimulatedNonceChain
+type NonceReader interface {
+	IsValidNonce(ctx context.Context, trader string, nonce uint64) (bool, error)
+}
+
+// isValidNonceABI OrderNonceManager.isValidNonce(address,uint256) returns (bool)
+const isValidNonceABI = `[{"type":"function","name":"isValidNonce","stateMutability":"view",
+"inputs":[{"name":"user","type":"address"},{"name":"nonce","type":"uint256"}],
+"outputs":[{"name":"","type":"bool"}]}]`
+
+// NonceManagerReader 经 RPC 调用 OrderNonceManager 合约的 isValidNonce
+type NonceManagerReader struct {
+	client   *ethclient.Client
+	contract common.Address
+	abi      abi.ABI
+}
+
+// DialNonceManager 连接 rpcURL 并绑定 OrderNonceManager 合约地址
+func DialNonceManager(rpcURL, contractAddr string) (*NonceManagerReader, error) {
+	if !common.IsHexAddress(contractAddr) {
+		return nil, fmt.Errorf("invalid nonce manager address: %q", contractAddr)
+	}
+	parsed, err := abi.JSON(strings.NewReader(isValidNonceABI))
+	if err != nil {
+		return nil, err
+	}
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	return &NonceManagerReader{client: client, contract: common.HexToAddress(contractAddr), abi: parsed}, nil
+}
+
+// IsValidNonce 调用合约 isValidNonce(trader, nonce)
+func (r *NonceManagerReader) IsValidNonce(ctx context.Context, trader string, nonce uint64) (bool, error) {
+	if !common.IsHexAddress(trader) {
+		return false, nil
+	}
+	data, err := r.abi.Pack("isValidNonce", common.HexToAddress(trader), new(big.Int).SetUint64(nonce))
+	if err != nil {
+		return false, err
+	}
+	out, err := r.client.CallContract(ctx, ethereum.CallMsg{To: &r.contract, Data: data}, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := r.abi.Unpack("isValidNonce", out)
+	if err != nil {
+		return false, err
+	}
+	valid, ok := res[0].(bool)
+	if !ok {
+		return false, fmt.Errorf("isValidNonce: unexpected result %T", res[0])
+	}
+	return valid, nil
+}
+
+// Close 关闭 RPC 连接
+func (r *NonceManagerReader) Close() {
+	r.client.Close()
+}
+
+// SimulatedNonceChain 内存模拟的 OrderNonceManager（规则与合约一致：未使用且不低于当前 nonce 为有效，
+// UseNonce 后当前 nonce 推进到 nonce+1），用于测试与本地开发
+type SimulatedNonceChain struct {
+	mu   sync.Mutex
+	next map[string]uint64          // userNonces
+	used map[string]map[uint64]bool // usedNonces
+	Err  error                      // 非 nil 时 IsValidNonce 返回该错误（模拟 RPC 故障）
+}
+
+// NewSimulatedNonceChain 创建空的模拟链
+func NewSimulatedNonceChain() *SimulatedNonceChain {
+	return &SimulatedNonceChain{next: make(map[string]uint64), used: make(map[string]map[uint64]bool)}
+}
+
+// UseNonce 模拟链上结算使用 nonce（合约 useNonce）
+func (c *SimulatedNonceChain) UseNonce(trader string, nonce uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	trader = strings.ToLower(trader)
+	if c.used[trader][nonce] {
+		return fmt.Errorf("OrderNonce: nonce already used")
+	}
+	if nonce < c.next[trader] {
+		return fmt.Errorf("OrderNonce: nonce too low")
+	}
+	if c.used[trader] == nil {
+		c.used[trader] = make(map[uint64]bool)
+	}
+	c.used[trader][nonce] = true
+	c.next[trader] = nonce + 1
+	return nil
+}
+
+// IsValidNonce 见 NonceReader
+func (c *SimulatedNonceChain) IsValidNonce(_ context.Context, trader string, nonce uint64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return false, c.Err
+	}
+	if !common.IsHexAddress(trader) || common.HexToAddress(trader) == (common.Address{}) {
+		return false, nil
+	}
+	trader = strings.ToLower(trader)
+	return !c.used[trader][nonce] && nonce >= c.next[trader], nil
+}
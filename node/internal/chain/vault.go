@@ -0,0 +1,140 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// VaultBackend Vault 查询所需的链接口：ethclient.Client 与 go-ethereum 模拟链（ethclient/simulated）的 Client 均满足
+type VaultBackend interface {
+	ethereum.ContractCaller
+	ethereum.LogFilterer
+	ethereum.BlockNumberReader
+}
+
+// vaultABI Vault.balanceOf(address token, address user) returns (uint256)
+const vaultABI = `[{"type":"function","name":"balanceOf","stateMutability":"view",
+"inputs":[{"name":"token","type":"address"},{"name":"user","type":"address"}],
+"outputs":[{"name":"","type":"uint256"}]}]`
+
+// Vault 事件 topic（见 contracts/src/Vault.sol）
+var (
+	VaultDepositTopic     = crypto.Keccak256Hash([]byte("Deposit(address,address,uint256)"))
+	VaultWithdrawTopic    = crypto.Keccak256Hash([]byte("Withdraw(address,address,uint256)"))
+	VaultTransferOutTopic = crypto.Keccak256Hash([]byte("TransferOut(address,address,address,uint256)"))
+)
+
+// VaultChange 一次 Vault 余额变化涉及的账户（地址小写）：Deposit / Withdraw 为 user，
+// TransferOut（结算转出或托管内划转）为 fromUser 与 to
+type VaultChange struct {
+	User  string
+	Token string
+	Block uint64
+}
+
+// Vault Vault 合约只读客户端：查询托管余额、拉取余额变化事件
+type Vault struct {
+	backend  VaultBackend
+	contract common.Address
+	abi      abi.ABI
+	client   *ethclient.Client // DialVault 创建的连接，Close 时关闭
+}
+
+// NewVault 绑定 Vault 合约地址
+func NewVault(backend VaultBackend, contractAddr string) (*Vault, error) {
+	if !common.IsHexAddress(contractAddr) {
+		return nil, fmt.Errorf("invalid vault address: %q", contractAddr)
+	}
+	parsed, err := abi.JSON(strings.NewReader(vaultABI))
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{backend: backend, contract: common.HexToAddress(contractAddr), abi: parsed}, nil
+}
+
+// DialVault 连接 rpcURL 并绑定 Vault 合约地址
+func DialVault(rpcURL, contractAddr string) (*Vault, error) {
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	v, err := NewVault(client, contractAddr)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	v.client = client
+	return v, nil
+}
+
+// Close 关闭 DialVault 创建的 RPC 连接
+func (v *Vault) Close() {
+	if v.client != nil {
+		v.client.Close()
+	}
+}
+
+// BalanceOf 查询 user 在 Vault 中 token 的托管余额（最小单位）
+func (v *Vault) BalanceOf(ctx context.Context, token, user string) (*big.Int, error) {
+	if !common.IsHexAddress(token) || !common.IsHexAddress(user) {
+		return new(big.Int), nil
+	}
+	data, err := v.abi.Pack("balanceOf", common.HexToAddress(token), common.HexToAddress(user))
+	if err != nil {
+		return nil, err
+	}
+	out, err := v.backend.CallContract(ctx, ethereum.CallMsg{To: &v.contract, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.abi.Unpack("balanceOf", out)
+	if err != nil {
+		return nil, err
+	}
+	bal, ok := res[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("balanceOf: unexpected result %T", res[0])
+	}
+	return bal, nil
+}
+
+// LatestBlock 返回最新区块号
+func (v *Vault) LatestBlock(ctx context.Context) (uint64, error) {
+	return v.backend.BlockNumber(ctx)
+}
+
+// Changes 拉取 [fromBlock, toBlock] 内的 Deposit / Withdraw / TransferOut 事件，返回受影响的账户与代币
+func (v *Vault) Changes(ctx context.Context, fromBlock, toBlock uint64) ([]VaultChange, error) {
+	logs, err := v.backend.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: []common.Address{v.contract},
+		Topics:    [][]common.Hash{{VaultDepositTopic, VaultWithdrawTopic, VaultTransferOutTopic}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	addr := func(h common.Hash) string { return strings.ToLower(common.BytesToAddress(h.Bytes()).Hex()) }
+	var out []VaultChange
+	for _, l := range logs {
+		switch {
+		case l.Topics[0] == VaultTransferOutTopic && len(l.Topics) >= 4:
+			// TransferOut(fromUser indexed, to indexed, token indexed, amount)
+			token := addr(l.Topics[3])
+			out = append(out, VaultChange{User: addr(l.Topics[1]), Token: token, Block: l.BlockNumber})
+			out = append(out, VaultChange{User: addr(l.Topics[2]), Token: token, Block: l.BlockNumber})
+		case len(l.Topics) >= 3:
+			// Deposit / Withdraw(user indexed, token indexed, amount)
+			out = append(out, VaultChange{User: addr(l.Topics[1]), Token: addr(l.Topics[2]), Block: l.BlockNumber})
+		}
+	}
+	return out, nil
+}
@@ -24,6 +24,7 @@ type APIConfig struct {
 	Listen                   string   `yaml:"listen"`                       // 如 ":8080"，空则不开 API
 	RateLimitOrdersPerMinute uint64   `yaml:"rate_limit_orders_per_minute"` // 每 IP 每分钟下单上限，0=不限制（Spam 防护）
 	BlockedTraders           []string `yaml:"blocked_traders"`              // 黑名单：拒绝这些地址的下单/撤单（Spam 防护）
+	AdminToken               string   `yaml:"admin_token"`                  // 管理接口（/api/admin/*）Bearer 令牌，空则不开放
 }
 
 // RelayConfig 中继节点限流与抗 Sybil（Phase 3.3）
@@ -35,12 +36,56 @@ type RelayConfig struct {
 // MatchConfig 撮合节点：交易对与链上代币（Phase 3.2）
 type MatchConfig struct {
 	Pairs map[string]PairTokens `yaml:"pairs"` // pair -> token0(base), token1(quote)
+	// 预写日志：撮合引擎输入按序写入 <data_dir>/journal，重启时回放恢复订单簿（含 maker 成交），默认开启
+	DisableJournal bool `yaml:"disable_journal"`
+	JournalNoSync  bool `yaml:"journal_no_sync"` // 不逐条 fsync：吞吐更高，断电可能丢失最后几条输入
+	// 写快照后被最旧保留快照覆盖的日志段移入该目录（供离线审计从头回放），空=直接删除
+	JournalArchiveDir string `yaml:"journal_archive_dir"`
+	// 引擎快照写入 <data_dir>/snapshots 的间隔（秒），0=默认 300；启动时加载最新快照并回放其后的日志
+	SnapshotIntervalSec int `yaml:"snapshot_interval_sec"`
+	// 每个交易对的撮合输入队列长度，0=默认 1024；队列满时 API 下单返回 429，gossip 新订单被拒绝
+	QueueSize int `yaml:"queue_size"`
+	// 订单签名验证 worker 数（0=CPU 数）与验证结果 LRU 缓存容量（0=默认 65536，按签名哈希缓存）
+	SignatureWorkers   int `yaml:"signature_workers"`
+	SignatureCacheSize int `yaml:"signature_cache_size"`
 }
 
-// PairTokens 交易对对应的链上代币地址
+// PairTokens 交易对对应的链上代币地址与精度（价格/数量按最小单位整数撮合）
 type PairTokens struct {
-	Token0 string `yaml:"token0"`
-	Token1 string `yaml:"token1"`
+	Token0    string `yaml:"token0"`
+	Token1    string `yaml:"token1"`
+	Decimals0 uint8  `yaml:"decimals0"` // base 代币精度，0 或未填=18
+	Decimals1 uint8  `yaml:"decimals1"` // quote 代币精度，0 或未填=18
+	// 自成交防护：cancel_newest | cancel_oldest | cancel_both | decrement_and_cancel，空=不防护；订单可单独覆盖
+	SelfTradePrevention string `yaml:"self_trade_prevention"`
+	// 交易规则（最小单位整数，空或 0=不限制）：价格须为 tick_size 整数倍、数量须为 lot_size 整数倍
+	TickSize    string `yaml:"tick_size"`
+	LotSize     string `yaml:"lot_size"`
+	MinQty      string `yaml:"min_qty"`
+	MaxQty      string `yaml:"max_qty"`
+	MinNotional string `yaml:"min_notional"` // 最小成交额（quote 最小单位）
+	// 限价与最新成交价的最大偏离（万分比），0=不限制
+	MaxPriceDeviationBps uint32 `yaml:"max_price_deviation_bps"`
+	// 手续费（万分比，quote 代币计收）：maker_fee_bps 可为负（返佣，不超过 taker 费率）；fee_tiers 按 trader 近 30 天成交额分档
+	MakerFeeBps int32           `yaml:"maker_fee_bps"`
+	TakerFeeBps int32           `yaml:"taker_fee_bps"`
+	FeeTiers    []FeeTierConfig `yaml:"fee_tiers"`
+	// 撮合模式：continuous（默认，连续撮合）| batch（每 30 秒 Epoch 统一价格批量拍卖）
+	MatchingMode string `yaml:"matching_mode"`
+	// 波动保护（0=不启用）：price_band_bps 单笔 taker 相对最新成交价的成交范围（万分比）；
+	// halt_window_sec 秒内价格变动超过 halt_move_bps 时暂停 halt_cooldown_sec 秒，再集合竞价 reopen_auction_sec 秒后恢复
+	PriceBandBps     uint32 `yaml:"price_band_bps"`
+	HaltMoveBps      uint32 `yaml:"halt_move_bps"`
+	HaltWindowSec    int64  `yaml:"halt_window_sec"`
+	HaltCooldownSec  int64  `yaml:"halt_cooldown_sec"`
+	ReopenAuctionSec int64  `yaml:"reopen_auction_sec"`
+}
+
+// FeeTierConfig 手续费等级：近 30 天成交额（quote 最小单位）>= min_volume 时使用该档费率
+type FeeTierConfig struct {
+	MinVolume   string `yaml:"min_volume"`
+	MakerFeeBps int32  `yaml:"maker_fee_bps"`
+	TakerFeeBps int32  `yaml:"taker_fee_bps"`
 }
 
 // MetricsConfig 贡献指标与证明
@@ -53,6 +98,8 @@ type MetricsConfig struct {
 // 数据保留统一两周；retention_months<=0 表示两周（14 天），>0 表示月数（兼容旧配置）
 type StorageConfig struct {
 	RetentionMonths int `yaml:"retention_months"` // 保留：0 或未填=两周（14天），>0=月数
+	// K 线保留天数（按周期覆盖默认值，如 {"1m": 7, "1d": -1}）：>0=天数，<0=永久保留，未填沿用 storage.DefaultCandleRetentionDays
+	CandleRetentionDays map[string]int `yaml:"candle_retention_days"`
 }
 
 // ChainConfig 链 RPC（可选，用于拉取历史成交）
@@ -63,6 +110,9 @@ type ChainConfig struct {
 	Token0          string   `yaml:"token0"`            // token0 地址（用于 pair 标识）
 	Token1          string   `yaml:"token1"`            // token1 地址
 	RelayerEndpoints []string `yaml:"relayer_endpoints"` // §12.3 多 Relayer：API 地址列表，按轮询选择
+	NonceManager     string   `yaml:"nonce_manager"`     // OrderNonceManager 合约地址（可选），撮合节点经 rpc_url 调用 isValidNonce 交叉校验订单 nonce
+	Vault            string   `yaml:"vault"`             // Vault 合约地址（可选），撮合节点据托管余额拒绝超额订单、撤销余额不足的挂单
+	VaultSyncSec     int      `yaml:"vault_sync_sec"`    // Vault 余额事件同步间隔（秒），0 为默认 5 秒
 }
 
 type NodeConfig struct {
@@ -77,6 +127,8 @@ type NetworkConfig struct {
 	Topics       []string `yaml:"topics"`                 // 订阅的 GossipSub topic
 	UseTor       bool     `yaml:"use_tor"`                // 12.1：是否经 Tor SOCKS 代理出站，隐藏节点 IP
 	TorSocksAddr string   `yaml:"tor_socks_addr"`         // Tor SOCKS5 代理地址，默认 127.0.0.1:9050
+	// PairMatchers 交易对 -> 撮合该交易对的节点 peer ID：仅应用这些节点发布（pubsub 签名）的订单状态迁移，未配置的交易对不接受远端状态
+	PairMatchers map[string][]string `yaml:"pair_matchers"`
 }
 
 // Load 从 path 加载 YAML；若文件不存在返回默认配置
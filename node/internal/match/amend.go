@@ -0,0 +1,155 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 改单错误
+var (
+	ErrAmendOrderNotFound = errors.New("amend: order not resting in book")
+	ErrAmendNoChange      = errors.New("amend: nothing to change")
+	ErrAmendStale         = errors.New("amend: timestamp not newer than order/last amend")
+	ErrAmendFuture        = errors.New("amend: timestamp ahead of engine clock")
+	ErrAmendPostOnly      = errors.New("amend: POST_ONLY order would cross")
+)
+
+// AmendClockSkew 改单签名时间允许超前引擎时钟的秒数，超出则拒绝（防止以远期时间戳抢占后续改单）
+const AmendClockSkew = 30
+
+// AmendResult 改单结果：改价/加量后重新撮合产生的成交、激活的条件单与自成交防护结果
+type AmendResult struct {
+	SubmitResult
+	Order     *storage.Order // 改单后的订单（引擎副本，Amount 为挂单时的剩余量 + 引擎内成交量）
+	OldPrice  string         // 改单前价格
+	SizeDelta *big.Int       // 剩余数量变化（新剩余 - 原剩余），用于更新持久化的 Amount
+	Requeued  bool           // 是否失去时间优先（改价或加量）
+}
+
+// ParseAmendFields 解析改单参数："" 与 "0" 表示不变；非零须为正整数（最小单位）
+func ParseAmendFields(newPrice, newAmount string) (price, amount *big.Int, err error) {
+	parse := func(name, s string) (*big.Int, error) {
+		if s == "" || s == "0" {
+			return nil, nil
+		}
+		v, ok := storage.ParseUnits(s)
+		if !ok || v.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid %s: must be a positive integer in base units", name)
+		}
+		return v, nil
+	}
+	if price, err = parse("newPrice", newPrice); err != nil {
+		return nil, nil, err
+	}
+	if amount, err = parse("newAmount", newAmount); err != nil {
+		return nil, nil, err
+	}
+	if price == nil && amount == nil {
+		return nil, nil, ErrAmendNoChange
+	}
+	return price, amount, nil
+}
+
+// AmendOrder 原子改单（cancel-replace）：newPrice 为新价格，newAmount 为新的剩余（未成交）数量，"0" 表示不变
+//   - 价格不变且仅减少数量：原地减量，保留时间优先
+//   - 改价或加量：移出订单簿后以引擎时钟为排队时间重新提交（可能与对手盘成交），排到新档位队尾
+//
+// ts 为改单签名时间，须晚于订单创建时间与上次改单时间（防重放），且不超过引擎时钟 + AmendClockSkew；sig 为改单签名，
+// 与改单内容一起追加到订单的改单签名链（见 storage.Order.Amends）；改后订单须满足交易对规则（本地与 gossip 改单一致校验），
+// POST_ONLY 改价后会吃单时拒绝且订单不变
+func (e *Engine) AmendOrder(orderID, newPrice, newAmount string, ts int64, sig string) (*AmendResult, error) {
+	price, amount, err := ParseAmendFields(newPrice, newAmount)
+	if err != nil {
+		return nil, err
+	}
+	pair := e.pairOf(orderID)
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return nil, ErrAmendOrderNotFound
+	}
+	if e.pairStateLocked(pair) != PairTrading {
+		return nil, ErrPairNotTrading
+	}
+	if !e.recordLocked(sh, &JournalEvent{Type: EventAmend, OrderID: orderID, Price: newPrice, Amount: newAmount, Ts: ts, Signature: sig}) {
+		return nil, ErrJournalWrite
+	}
+	ob := e.pairs[pair]
+	n, ok := ob.index[orderID]
+	if !ok {
+		return nil, ErrAmendOrderNotFound
+	}
+	o := n.order
+	if ts <= o.AmendedAt || ts < o.CreatedAt {
+		return nil, ErrAmendStale
+	}
+	if ts > e.nowLocked(pair)+AmendClockSkew {
+		return nil, ErrAmendFuture
+	}
+	left := o.Remaining()
+	if price != nil && price.Cmp(n.level.price) == 0 {
+		price = nil
+	}
+	if amount != nil && amount.Cmp(left) == 0 {
+		amount = nil
+	}
+	if price == nil && amount == nil {
+		return nil, ErrAmendNoChange
+	}
+	res := &AmendResult{OldPrice: o.Price, SizeDelta: new(big.Int)}
+	if amount != nil {
+		res.SizeDelta.Sub(amount, left)
+	}
+	o2 := *o
+	o2.AppendAmend(storage.SignedAmend{NewPrice: newPrice, NewAmount: newAmount, Timestamp: ts, Signature: sig})
+	if price != nil {
+		o2.Price = storage.FormatUnits(price)
+	}
+	if amount != nil {
+		o2.Amount = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(o2.Filled), amount))
+	}
+	// 改后的订单与新订单适用相同的交易对规则（tick、lot、数量区间、最小成交额、价格带）
+	var last *big.Int
+	if sh.lastTrade != nil {
+		last = sh.lastTrade.price
+	}
+	if err := checkMarketRules(e.tokens[pair], last, &o2); err != nil {
+		return nil, err
+	}
+
+	if price == nil && res.SizeDelta.Sign() < 0 {
+		// 仅减量：原地修改，队列位置不变
+		o.Amount = o2.Amount
+		o.AmendedAt = ts
+		o.SignedPrice, o.SignedAmount, o.Amends = o2.SignedPrice, o2.SignedAmount, o2.Amends
+		ob.reduce(n)
+		e.refreshHold(o)
+		c := *o
+		res.Order = &c
+		return res, nil
+	}
+
+	o2.QueuedAt = e.nowLocked(pair)
+	if o2.EffectiveTimeInForce() == storage.TimeInForcePostOnly && price != nil {
+		// 改单前检查：拒绝时原订单保持不变
+		p, ok := postOnlyPrice(ob, &o2, price)
+		if !ok {
+			return nil, ErrAmendPostOnly
+		}
+		o2.Price = storage.FormatUnits(p)
+	}
+	// 重新排队期间保留 orderId 占位：未重新入簿（全部成交或撤销）时再移除
+	ob.remove(orderID)
+	e.holdOrderID(orderID)
+	res.Requeued = true
+	e.submitLocked(&o2, &res.SubmitResult)
+	e.releaseOrderID(orderID)
+	if len(res.Trades) > 0 {
+		e.activateTriggersLocked(o2.Pair, &res.SubmitResult)
+	}
+	res.Order = &o2
+	return res, nil
+}
@@ -0,0 +1,119 @@
+package match
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// amendBook 卖盘同价 100：a1 10 先到、a2 10 后到；另有 a3 10@105
+func amendBook() testEngineOption {
+	return withOrders(
+		testOrder("a1", "sell", "100", "10", 1),
+		testOrder("a2", "sell", "100", "10", 2),
+		testOrder("a3", "sell", "105", "10", 3),
+	)
+}
+
+func TestAmendSizeDecreaseKeepsPriority(t *testing.T) {
+	e := newTestEngine(t, amendBook())
+	res, err := e.AmendOrder("a1", "0", "4", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Requeued || res.SizeDelta.Int64() != -6 || res.Order.Amount != "4" {
+		t.Fatalf("amend = %+v, want in-place decrease to 4", res)
+	}
+	trades := e.Submit(testOrder("b1", "buy", "100", "6", 20)).Trades
+	if len(trades) != 2 || trades[0].MakerOrderID != "a1" || trades[0].Amount != "4" || trades[1].MakerOrderID != "a2" {
+		t.Fatalf("trades = %+v, want a1 4 first then a2", trades)
+	}
+}
+
+func TestAmendSizeIncreaseRequeues(t *testing.T) {
+	e := newTestEngine(t, amendBook())
+	res, err := e.AmendOrder("a1", "", "15", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Requeued || res.SizeDelta.Int64() != 5 {
+		t.Fatalf("amend = %+v, want requeue with +5", res)
+	}
+	_, asks := e.GetOrderbook("TKA/TKB")
+	if len(asks) != 3 || asks[0].OrderID != "a2" || asks[1].OrderID != "a1" || asks[1].Amount != "15" {
+		t.Fatalf("asks = %+v, want a2 ahead of a1(15)", asks)
+	}
+}
+
+func TestAmendPriceChangeCrossesAndRequeues(t *testing.T) {
+	e := newTestEngine(t, amendBook())
+	if !e.AddOrder(testOrder("b1", "buy", "99", "5", 4)) {
+		t.Fatal("AddOrder failed")
+	}
+	// a3 改价到 99：与 b1 成交 5，剩余 5 挂在 99，排队时间取引擎时钟而非改单签名时间
+	e.clock = func() int64 { return 20 }
+	res, err := e.AmendOrder("a3", "99", "0", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Requeued || res.OldPrice != "105" || len(res.Trades) != 1 || res.Trades[0].Amount != "5" || res.Trades[0].TakerOrderID != "a3" {
+		t.Fatalf("amend = %+v trades=%+v", res, res.Trades)
+	}
+	if got := e.GetOrder("a3"); got == nil || got.Price != "99" || got.Amount != "5" || got.QueuedAt != 20 || got.AmendedAt != 10 {
+		t.Fatalf("a3 = %+v, want resting 5 left @99 queued at 20", got)
+	}
+}
+
+func TestAmendRejects(t *testing.T) {
+	e := newTestEngine(t, amendBook())
+	if _, err := e.AmendOrder("a1", "0", "0", 10, ""); !errors.Is(err, ErrAmendNoChange) {
+		t.Errorf("no-op amend err = %v", err)
+	}
+	if _, err := e.AmendOrder("a1", "100", "10", 10, ""); !errors.Is(err, ErrAmendNoChange) {
+		t.Errorf("same values err = %v", err)
+	}
+	if _, err := e.AmendOrder("zz", "0", "5", 10, ""); !errors.Is(err, ErrAmendOrderNotFound) {
+		t.Errorf("unknown order err = %v", err)
+	}
+	if _, err := e.AmendOrder("a1", "0", "5", 10, ""); err != nil {
+		t.Fatal(err)
+	}
+	// 重放同一时间戳的改单被拒绝
+	if _, err := e.AmendOrder("a1", "0", "3", 10, ""); !errors.Is(err, ErrAmendStale) {
+		t.Errorf("replayed amend err = %v", err)
+	}
+}
+
+func TestAmendPostOnlyWouldCrossLeavesOrder(t *testing.T) {
+	e := newTestEngine(t, amendBook())
+	if !e.AddOrder(testOrder("b1", "buy", "90", "5", 4, withTIF(storage.TimeInForcePostOnly))) {
+		t.Fatal("AddOrder failed")
+	}
+	if _, err := e.AmendOrder("b1", "100", "0", 10, ""); !errors.Is(err, ErrAmendPostOnly) {
+		t.Fatalf("err = %v, want ErrAmendPostOnly", err)
+	}
+	if got := e.GetOrder("b1"); got == nil || got.Price != "90" || got.AmendedAt != 0 {
+		t.Fatalf("b1 = %+v, want unchanged", got)
+	}
+}
+
+// 改单签名时间不得超前引擎时钟 AmendClockSkew 以上；新订单不得自带改单签名链
+func TestAmendTimestampBoundedByEngineClock(t *testing.T) {
+	e := newTestEngine(t, amendBook(), withClock(func() int64 { return 100 }))
+	if _, err := e.AmendOrder("a1", "0", "5", 100+AmendClockSkew+1, ""); !errors.Is(err, ErrAmendFuture) {
+		t.Fatalf("future amend err = %v, want ErrAmendFuture", err)
+	}
+	if _, err := e.AmendOrder("a1", "0", "5", 100+AmendClockSkew, "0x01"); err != nil {
+		t.Fatal(err)
+	}
+	got := e.GetOrder("a1")
+	if got.AmendedAt != 100+AmendClockSkew || got.SignedAmount != "10" || len(got.Amends) != 1 || got.Amends[0].Signature != "0x01" {
+		t.Fatalf("a1 = %+v, want amend recorded in the signed chain", got)
+	}
+	forged := testOrder("x1", "buy", "90", "5", 5)
+	forged.Amends = []storage.SignedAmend{{NewPrice: "95", Timestamp: 6, Signature: "0x01"}}
+	if res := e.Submit(forged); res.Reason == nil {
+		t.Error("new order carrying amends should be rejected")
+	}
+}
@@ -0,0 +1,437 @@
+package match
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 交易对撮合模式
+const (
+	MatchingContinuous = "continuous" // 连续撮合（默认）：taker 按价格-时间优先依次吃单，成交价为 maker 价
+	MatchingBatch      = "batch"      // 频繁批量拍卖：每个 Epoch 结束时以统一清算价一次性成交
+)
+
+// ValidateMatchingMode 校验交易对撮合模式；批量拍卖不支持自成交防护（拍卖内不区分 maker/taker 先后）
+func ValidateMatchingMode(mode, selfTradePrevention string) error {
+	switch mode {
+	case "", MatchingContinuous:
+		return nil
+	case MatchingBatch:
+		if selfTradePrevention != "" {
+			return fmt.Errorf("invalid matching_mode: self_trade_prevention is not supported in batch mode")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid matching_mode: must be continuous or batch")
+}
+
+// ValidateBatchOrder 校验批量拍卖交易对的订单：仅支持限价单（GTC/GTD/IOC），不支持市价、FOK、POST_ONLY、条件单与自成交防护
+func ValidateBatchOrder(o *storage.Order) error {
+	if o.IsMarket() {
+		return fmt.Errorf("invalid type: batch auction pairs only accept limit orders")
+	}
+	switch o.EffectiveTimeInForce() {
+	case storage.TimeInForceFOK, storage.TimeInForcePostOnly:
+		return fmt.Errorf("invalid timeInForce: batch auction pairs only support GTC, GTD or IOC")
+	}
+	if o.Trigger != "" {
+		return fmt.Errorf("invalid trigger: conditional orders are not supported in batch auction pairs")
+	}
+	if o.SelfTradePrevention != "" {
+		return fmt.Errorf("invalid selfTradePrevention: not supported in batch auction pairs")
+	}
+	return nil
+}
+
+// isBatchLocked 交易对是否为批量拍卖模式（调用方需已持锁）
+func (e *Engine) isBatchLocked(pair string) bool {
+	return e.tokens[pair].MatchingMode == MatchingBatch
+}
+
+// queueAuctionLocked 批量拍卖交易对收单：GTC/GTD 订单直接入簿（可与对手盘交叉，等待 Epoch 清算），
+// IOC 订单进入待清算队列，只参与下一次拍卖（调用方需已锁定 o.Pair 分片）
+func (e *Engine) queueAuctionLocked(o *storage.Order) {
+	if o.EffectiveTimeInForce() != storage.TimeInForceIOC {
+		if e.addLocked(o) {
+			o.Status = takerRestingStatus(storage.MustUnits(o.Filled))
+		} else {
+			o.Status = storage.OrderStatusCancelled
+		}
+		return
+	}
+	o2, ok := restingCopy(o)
+	if !ok || storage.OrderExpiredAt(o, e.nowLocked(o.Pair)) {
+		o.Status = storage.OrderStatusCancelled
+		return
+	}
+	o2.Status = storage.OrderStatusOpen
+	e.removeAuctionIOCLocked(o.Pair, o.OrderID)
+	sh := e.shards[o.Pair]
+	sh.auctionIOC = append(sh.auctionIOC, o2)
+	e.indexOrder(o2, o.Pair)
+	o.Status = takerRestingStatus(storage.MustUnits(o.Filled))
+}
+
+// removeAuctionIOCLocked 从待清算 IOC 队列移除订单（调用方需已锁定该交易对分片）
+func (e *Engine) removeAuctionIOCLocked(pair, orderID string) bool {
+	sh := e.shards[pair]
+	if sh == nil {
+		return false
+	}
+	for i, o := range sh.auctionIOC {
+		if o.OrderID == orderID {
+			sh.auctionIOC = append(sh.auctionIOC[:i:i], sh.auctionIOC[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AuctionResult 一次批量拍卖的结果
+type AuctionResult struct {
+	Pair    string
+	EpochID int64
+	Price   string           // 统一清算价；无成交为空
+	Volume  string           // 成交总量（base 最小单位）
+	Trades  []*storage.Trade // 均以清算价成交，可直接按 Epoch 提交 settleTradesBatch
+	Orders  []*storage.Order // 状态变化的订单副本（有成交，或 IOC 剩余撤销）
+}
+
+// auctionOrder 参与拍卖的订单
+type auctionOrder struct {
+	order *storage.Order
+	price *big.Int
+	left  *big.Int
+	fill  *big.Int
+	book  *bookOrder // 订单簿节点；IOC 队列中的订单为 nil
+}
+
+// BatchPairs 返回批量拍卖模式的交易对（按 pair 升序）
+func (e *Engine) BatchPairs() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var out []string
+	for pair, t := range e.tokens {
+		if t.MatchingMode == MatchingBatch {
+			out = append(out, pair)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// RunAuction 清算交易对 epochID（含）之前收集的订单：排队时间所在 Epoch <= epochID 的挂单与 IOC 订单
+// 以使成交量最大的统一价格成交，边际价位按数量比例分配；IOC 剩余撤销，其余剩余继续挂单参与下一次拍卖
+// 同一 epochID 只清算一次；输入（订单簿与 IOC 队列）相同时各节点结果逐字节一致
+func (e *Engine) RunAuction(pair string, epochID int64) *AuctionResult {
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil || !e.isBatchLocked(pair) {
+		return nil
+	}
+	if sh.auctioned && epochID <= sh.lastAuction {
+		return nil
+	}
+	// 暂停或只撤单期间不清算；恢复后的下一次拍卖一并清算此前收集的订单
+	if e.pairStateLocked(pair) != PairTrading {
+		return nil
+	}
+	if !e.recordLocked(sh, &JournalEvent{Type: EventAuction, Pair: pair, EpochID: epochID}) {
+		return nil
+	}
+	sh.lastAuction, sh.auctioned = epochID, true
+	res := &AuctionResult{Pair: pair, EpochID: epochID}
+	inEpoch := func(o *storage.Order) bool { return EpochID(o.PriorityTime(), EpochDurationSec) <= epochID }
+	e.crossLocked(res, fmt.Sprintf("auction-%d", epochID), (epochID+1)*EpochDurationSec, inEpoch)
+	return res
+}
+
+// crossLocked 以统一价格清算交易对中 include 为真的挂单与 IOC 订单，成交时间为 ts，TradeID 以 idPrefix 开头；
+// 成交与状态变化的订单写入 res（批量拍卖与熔断后复盘集合竞价共用；调用方需已锁定该交易对分片）
+func (e *Engine) crossLocked(res *AuctionResult, idPrefix string, ts int64, include func(*storage.Order) bool) {
+	pair := res.Pair
+	sh := e.shards[pair]
+	var bids, asks []*auctionOrder
+	collect := func(o *storage.Order, n *bookOrder) {
+		a := &auctionOrder{order: o, price: storage.MustUnits(o.Price), left: o.Remaining(), fill: new(big.Int), book: n}
+		if o.Side == "buy" {
+			bids = append(bids, a)
+		} else {
+			asks = append(asks, a)
+		}
+	}
+	if ob, ok := e.pairs[pair]; ok {
+		for _, buy := range []bool{true, false} {
+			s := ob.side(buy)
+			for x := s.head.next[0]; x != nil; x = x.next[0] {
+				for n := x.level.head; n != nil; n = n.next {
+					if include(n.order) {
+						collect(n.order, n)
+					}
+				}
+			}
+		}
+	}
+	var iocs []*storage.Order
+	for _, o := range sh.auctionIOC {
+		if include(o) {
+			collect(o, nil)
+			iocs = append(iocs, o)
+		}
+	}
+	for _, o := range iocs {
+		e.removeAuctionIOCLocked(pair, o.OrderID)
+		e.unindexOrder(o.OrderID)
+	}
+
+	var last *big.Int
+	if sh.lastTrade != nil {
+		last = sh.lastTrade.price
+	}
+	tokens := e.tokens[pair]
+	price, volume := clearAuction(bids, asks, ruleUnits(tokens.Rules.LotSize), last)
+	if volume.Sign() > 0 {
+		res.Price, res.Volume = storage.FormatUnits(price), storage.FormatUnits(volume)
+		res.Trades = e.auctionTradesLocked(pair, idPrefix, price, bids, asks, ts)
+		e.addMatchStats(res.Trades)
+		sh.lastTrade = &lastTrade{price: new(big.Int).Set(price), ts: ts}
+		log.Printf("[auction] pair=%s %s 清算价=%s 成交量=%s 笔数=%d", pair, idPrefix, res.Price, res.Volume, len(res.Trades))
+	}
+	// 回写成交：全部成交移出订单簿，部分成交保留排队位置；IOC 剩余撤销
+	ob := e.pairs[pair]
+	for _, a := range append(bids, asks...) {
+		o := a.order
+		if a.fill.Sign() == 0 && a.book != nil {
+			continue
+		}
+		o.Filled = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(o.Filled), a.fill))
+		switch {
+		case a.fill.Cmp(a.left) == 0:
+			o.Status = storage.OrderStatusFilled
+		case a.book == nil:
+			o.Status = storage.OrderStatusCancelled
+		default:
+			o.Status = storage.OrderStatusPartial
+		}
+		if a.book != nil {
+			if o.Status == storage.OrderStatusFilled {
+				e.unindexOrder(o.OrderID)
+			}
+			// 全部成交移出订单簿；冰山单可见量扣减成交量，耗尽时补充并排到队尾
+			ob.fill(a.book, a.fill, ts)
+			e.refreshHold(o)
+		}
+		c := *o
+		res.Orders = append(res.Orders, &c)
+	}
+	nb, na := ob.Depth()
+	metrics.RecordOrderbookSize(pair, nb, na)
+}
+
+// clearAuction 计算统一清算价与成交量：候选价为所有限价，取成交量 min(需求, 供给) 最大者；
+// 并列时取供需差最小者，再取最接近最新成交价者，最后取较低价。按价格优先分配，边际价位按数量比例分配（见 allocateProRata）
+func clearAuction(bids, asks []*auctionOrder, lot, last *big.Int) (price, volume *big.Int) {
+	volume = new(big.Int)
+	if len(bids) == 0 || len(asks) == 0 {
+		return nil, volume
+	}
+	sortAuctionSide(bids, true)
+	sortAuctionSide(asks, false)
+	seen := make(map[string]bool)
+	var cands []*big.Int
+	for _, a := range append(append([]*auctionOrder{}, bids...), asks...) {
+		if k := a.price.String(); !seen[k] {
+			seen[k] = true
+			cands = append(cands, a.price)
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].Cmp(cands[j]) < 0 })
+	// 供给：价格 <= p 的卖单总量（升序累加）；需求：价格 >= p 的买单总量（降序累加）
+	supply := make([]*big.Int, len(cands))
+	sum, k := new(big.Int), 0
+	for i, p := range cands {
+		for ; k < len(asks) && asks[k].price.Cmp(p) <= 0; k++ {
+			sum.Add(sum, asks[k].left)
+		}
+		supply[i] = new(big.Int).Set(sum)
+	}
+	demand := make([]*big.Int, len(cands))
+	sum, k = new(big.Int), 0
+	for i := len(cands) - 1; i >= 0; i-- {
+		for ; k < len(bids) && bids[k].price.Cmp(cands[i]) >= 0; k++ {
+			sum.Add(sum, bids[k].left)
+		}
+		demand[i] = new(big.Int).Set(sum)
+	}
+	var bestImb, bestDist *big.Int
+	for i, p := range cands {
+		v := minUnits(demand[i], supply[i])
+		if v.Sign() == 0 {
+			continue
+		}
+		imb := new(big.Int).Sub(demand[i], supply[i])
+		imb.Abs(imb)
+		var dist *big.Int
+		if last != nil {
+			dist = new(big.Int).Sub(p, last)
+			dist.Abs(dist)
+		}
+		better := price == nil
+		if !better {
+			switch c := v.Cmp(volume); {
+			case c != 0:
+				better = c > 0
+			case imb.Cmp(bestImb) != 0:
+				better = imb.Cmp(bestImb) < 0
+			case dist != nil && dist.Cmp(bestDist) != 0:
+				better = dist.Cmp(bestDist) < 0
+			}
+		}
+		if better {
+			price, volume, bestImb, bestDist = p, v, imb, dist
+		}
+	}
+	if price == nil {
+		return nil, volume
+	}
+	step := auctionStep(lot, bids, asks)
+	allocateProRata(bids, volume, step, func(p *big.Int) bool { return p.Cmp(price) >= 0 })
+	allocateProRata(asks, volume, step, func(p *big.Int) bool { return p.Cmp(price) <= 0 })
+	return price, volume
+}
+
+// sortAuctionSide 按价格优先（买降序/卖升序）、排队时间、orderID 排序
+func sortAuctionSide(side []*auctionOrder, buy bool) {
+	sort.SliceStable(side, func(i, j int) bool {
+		a, b := side[i], side[j]
+		if c := a.price.Cmp(b.price); c != 0 {
+			return c > 0 == buy
+		}
+		if ta, tb := a.order.PriorityTime(), b.order.PriorityTime(); ta != tb {
+			return ta < tb
+		}
+		return a.order.OrderID < b.order.OrderID
+	})
+}
+
+// auctionStep 按比例分配的最小单位：所有参与订单剩余量均为 lot 整数倍时按 lot 分配，否则按 1
+func auctionStep(lot *big.Int, sides ...[]*auctionOrder) *big.Int {
+	if lot == nil {
+		return big.NewInt(1)
+	}
+	for _, side := range sides {
+		for _, a := range side {
+			if new(big.Int).Rem(a.left, lot).Sign() != 0 {
+				return big.NewInt(1)
+			}
+		}
+	}
+	return lot
+}
+
+// allocateProRata 在一侧按价格优先分配 volume：优于边际价位的订单全部成交；边际价位按剩余量比例分配（以 step 为单位向下取整），
+// 余下的 step 按排队时间逐一补给尚未满额的订单
+func allocateProRata(side []*auctionOrder, volume, step *big.Int, eligible func(*big.Int) bool) {
+	rem := new(big.Int).Set(volume)
+	for i := 0; i < len(side) && rem.Sign() > 0; {
+		if !eligible(side[i].price) {
+			return
+		}
+		j, levelQty := i, new(big.Int)
+		for ; j < len(side) && side[j].price.Cmp(side[i].price) == 0; j++ {
+			levelQty.Add(levelQty, side[j].left)
+		}
+		level := side[i:j]
+		i = j
+		if levelQty.Cmp(rem) <= 0 {
+			for _, a := range level {
+				a.fill.Set(a.left)
+			}
+			rem.Sub(rem, levelQty)
+			continue
+		}
+		remSteps := new(big.Int).Quo(rem, step)
+		levelSteps := new(big.Int).Quo(levelQty, step)
+		given := new(big.Int)
+		for _, a := range level {
+			s := new(big.Int).Quo(a.left, step)
+			s.Mul(s, remSteps).Quo(s, levelSteps)
+			a.fill.Mul(s, step)
+			given.Add(given, s)
+		}
+		for left := new(big.Int).Sub(remSteps, given); left.Sign() > 0; {
+			progressed := false
+			for _, a := range level {
+				if left.Sign() == 0 {
+					break
+				}
+				if a.fill.Cmp(a.left) < 0 {
+					a.fill.Add(a.fill, step)
+					left.Sub(left, big.NewInt(1))
+					progressed = true
+				}
+			}
+			if !progressed {
+				break
+			}
+		}
+		return
+	}
+}
+
+// auctionTradesLocked 将两侧分配结果配对为成交：按分配顺序双指针配对，排队时间较早的一方为 maker（调用方需已持锁）
+func (e *Engine) auctionTradesLocked(pair, idPrefix string, price *big.Int, bids, asks []*auctionOrder, ts int64) []*storage.Trade {
+	tokens := e.tokens[pair]
+	baseDecimals := tokens.BaseDecimals()
+	var trades []*storage.Trade
+	bi, ai := 0, 0
+	bLeft, aLeft := new(big.Int), new(big.Int)
+	for {
+		for bLeft.Sign() == 0 && bi < len(bids) {
+			bLeft.Set(bids[bi].fill)
+			bi++
+		}
+		for aLeft.Sign() == 0 && ai < len(asks) {
+			aLeft.Set(asks[ai].fill)
+			ai++
+		}
+		if bLeft.Sign() == 0 || aLeft.Sign() == 0 {
+			break
+		}
+		bid, ask := bids[bi-1].order, asks[ai-1].order
+		qty := minUnits(bLeft, aLeft)
+		bLeft.Sub(bLeft, qty)
+		aLeft.Sub(aLeft, qty)
+		maker, taker := ask, bid
+		if bid.PriorityTime() < ask.PriorityTime() || bid.PriorityTime() == ask.PriorityTime() && bid.OrderID < ask.OrderID {
+			maker, taker = bid, ask
+		}
+		quote := storage.QuoteAmount(qty, price, baseDecimals)
+		t := &storage.Trade{
+			TradeID:      fmt.Sprintf("%s-%s-%s-%d", idPrefix, taker.OrderID, maker.OrderID, len(trades)+1),
+			Pair:         pair,
+			MakerOrderID: maker.OrderID,
+			TakerOrderID: taker.OrderID,
+			Maker:        maker.Trader,
+			Taker:        taker.Trader,
+			Price:        storage.FormatUnits(price),
+			Amount:       storage.FormatUnits(qty),
+			Timestamp:    ts,
+		}
+		if maker.Side == "sell" {
+			t.TokenIn, t.TokenOut = tokens.Token0, tokens.Token1
+			t.AmountIn, t.AmountOut = storage.FormatUnits(qty), storage.FormatUnits(quote)
+		} else {
+			t.TokenIn, t.TokenOut = tokens.Token1, tokens.Token0
+			t.AmountIn, t.AmountOut = storage.FormatUnits(quote), storage.FormatUnits(qty)
+		}
+		e.applyFeesLocked(t, tokens, quote)
+		trades = append(trades, t)
+	}
+	return trades
+}
@@ -0,0 +1,132 @@
+package match
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// auctionClock 引擎时钟固定在第 0 个 Epoch 内（订单按进入引擎的时间归入 Epoch）
+func auctionClock() int64 { return 1 }
+
+func submitAll(t *testing.T, e *Engine, orders ...*storage.Order) {
+	t.Helper()
+	for _, o := range orders {
+		if res := e.Submit(o); len(res.Trades) != 0 || o.Status != "open" {
+			t.Fatalf("%s: status=%s trades=%d, want queued without trades", o.OrderID, o.Status, len(res.Trades))
+		}
+	}
+}
+
+func TestAuctionUniformClearingPrice(t *testing.T) {
+	e := newTestEngine(t, withBatch(), withClock(auctionClock))
+	// 95: 5 | 100: min(20, 15)=15 | 102、105: 10 → 清算价 100，成交 15
+	submitAll(t, e,
+		testOrder("b1", "buy", "105", "10", 1),
+		testOrder("b2", "buy", "100", "10", 2),
+		testOrder("a1", "sell", "95", "5", 3),
+		testOrder("a2", "sell", "100", "10", 4),
+		testOrder("a3", "sell", "102", "10", 5),
+	)
+	res := e.RunAuction("TKA/TKB", 0)
+	if res == nil || res.Price != "100" || res.Volume != "15" {
+		t.Fatalf("auction = %+v, want price 100 volume 15", res)
+	}
+	total := int64(0)
+	for _, tr := range res.Trades {
+		if tr.Price != "100" || tr.Timestamp != EpochDurationSec {
+			t.Errorf("trade %+v not at clearing price/epoch end", tr)
+		}
+		total += storage.MustUnits(tr.Amount).Int64()
+	}
+	if total != 15 {
+		t.Errorf("traded %d, want 15", total)
+	}
+	bids, asks := e.GetOrderbook("TKA/TKB")
+	if len(bids) != 1 || bids[0].OrderID != "b2" || bids[0].Remaining().Int64() != 5 || len(asks) != 1 || asks[0].OrderID != "a3" {
+		t.Errorf("book after auction: bids=%+v asks=%+v", bids, asks)
+	}
+	if e.RunAuction("TKA/TKB", 0) != nil {
+		t.Error("same epoch cleared twice")
+	}
+}
+
+func TestAuctionProRataTieBreak(t *testing.T) {
+	e := newTestEngine(t, withBatch(), withClock(auctionClock))
+	// 边际价位 40 分配 21：b1 floor(10*21/40)=5、b2 floor(30*21/40)=15，余 1 按排队时间给 b1
+	submitAll(t, e,
+		testOrder("b1", "buy", "100", "10", 1),
+		testOrder("b2", "buy", "100", "30", 2),
+		testOrder("a1", "sell", "100", "21", 3),
+	)
+	res := e.RunAuction("TKA/TKB", 0)
+	filled := map[string]string{}
+	for _, o := range res.Orders {
+		filled[o.OrderID] = o.Filled
+	}
+	if filled["b1"] != "6" || filled["b2"] != "15" || filled["a1"] != "21" {
+		t.Errorf("fills = %v, want b1=6 b2=15 a1=21", filled)
+	}
+}
+
+func TestAuctionIOCAndEpochBoundary(t *testing.T) {
+	e := newTestEngine(t, withBatch(), withClock(auctionClock))
+	submitAll(t, e,
+		testOrder("a1", "sell", "100", "5", 1),
+		testOrder("b1", "buy", "100", "8", 2, withTIF(storage.TimeInForceIOC)),
+	)
+	// 下一个 Epoch 才进入引擎的订单不参与本次清算（回填的 CreatedAt 不能把订单挤进更早的 Epoch）
+	e.clock = func() int64 { return EpochDurationSec + 1 }
+	submitAll(t, e, testOrder("b2", "buy", "110", "5", 1))
+	res := e.RunAuction("TKA/TKB", 0)
+	if res.Volume != "5" {
+		t.Fatalf("volume = %s, want 5", res.Volume)
+	}
+	for _, o := range res.Orders {
+		if o.OrderID == "b1" && (o.Status != "cancelled" || o.Filled != "5") {
+			t.Errorf("IOC b1 = %s filled %s, want cancelled with 5 filled", o.Status, o.Filled)
+		}
+		if o.OrderID == "b2" {
+			t.Error("next-epoch order cleared early")
+		}
+	}
+	if e.GetOrder("b1") != nil {
+		t.Error("IOC remainder still queued")
+	}
+}
+
+func TestAuctionDeterministic(t *testing.T) {
+	run := func() []byte {
+		e := newTestEngine(t, withBatch(), withClock(auctionClock))
+		submitAll(t, e,
+			testOrder("b1", "buy", "104", "7", 1),
+			testOrder("b2", "buy", "101", "9", 2),
+			testOrder("b3", "buy", "101", "4", 3),
+			testOrder("a1", "sell", "99", "6", 4),
+			testOrder("a2", "sell", "101", "11", 5),
+		)
+		data, _ := json.Marshal(e.RunAuction("TKA/TKB", 0))
+		return data
+	}
+	if a, b := run(), run(); !bytes.Equal(a, b) {
+		t.Errorf("auction differs between engines:\n%s\n%s", a, b)
+	}
+}
+
+func TestBatchPairRejectsUnsupportedOrders(t *testing.T) {
+	e := newTestEngine(t, withBatch(), withClock(auctionClock))
+	for _, o := range []*storage.Order{
+		testOrder("f", "buy", "100", "1", 1, withTIF(storage.TimeInForceFOK)),
+		testOrder("p", "buy", "100", "1", 1, withTIF(storage.TimeInForcePostOnly)),
+		{OrderID: "m", Pair: "TKA/TKB", Side: "buy", Type: storage.OrderTypeMarket, Amount: "1", Filled: "0"},
+	} {
+		if e.CheckMarketRules(o) == nil {
+			t.Errorf("%s: expected rules error", o.OrderID)
+		}
+		if e.Submit(o); o.Status != "rejected" {
+			t.Errorf("%s: status = %s, want rejected", o.OrderID, o.Status)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package match
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/chain"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 余额校验错误
+var (
+	// ErrInsufficientBalance 订单所需数量超过 trader 在 Vault 中的可用余额（托管余额减去挂单占用）
+	ErrInsufficientBalance = errors.New("insufficient vault balance")
+	// ErrBalanceUnavailable 无法取得 trader 的 Vault 余额（链上查询失败且无缓存），订单不予接受
+	ErrBalanceUnavailable = errors.New("vault balance unavailable")
+)
+
+// orderHold 入簿订单对代币的占用：卖单占用 base（token0）剩余数量，买单占用剩余数量按限价折算的 quote（token1）
+type orderHold struct {
+	key    balanceKey
+	pair   string
+	order  *storage.Order // 簿内订单（调用方需锁定 pair 分片或持写锁后读取）
+	amount *big.Int
+}
+
+// traderHolds trader 对单个代币的占用合计与按订单 ID 的明细
+type traderHolds struct {
+	total  *big.Int
+	orders map[string]*orderHold
+}
+
+// newOrderHold 按剩余数量计算入簿订单的占用；无占用（数量为 0 或代币未配置）时返回 nil
+func newOrderHold(o *storage.Order, pair string, tokens PairTokens) *orderHold {
+	token, amount := orderReservation(o, tokens, nil)
+	if token == "" || amount.Sign() <= 0 {
+		return nil
+	}
+	return &orderHold{key: balanceKey{strings.ToLower(o.Trader), token}, pair: pair, order: o, amount: amount}
+}
+
+// addHoldLocked 计入订单占用（调用方需持 idxMu）
+func (e *Engine) addHoldLocked(orderID string, h *orderHold) {
+	if h == nil {
+		return
+	}
+	th := e.holds[h.key]
+	if th == nil {
+		th = &traderHolds{total: new(big.Int), orders: make(map[string]*orderHold)}
+		e.holds[h.key] = th
+	}
+	th.total.Add(th.total, h.amount)
+	th.orders[orderID] = h
+}
+
+// releaseHoldLocked 扣除订单占用（调用方需持 idxMu）
+func (e *Engine) releaseHoldLocked(orderID string, h *orderHold) {
+	if h == nil {
+		return
+	}
+	th := e.holds[h.key]
+	if th == nil || th.orders[orderID] != h {
+		return
+	}
+	delete(th.orders, orderID)
+	th.total.Sub(th.total, h.amount)
+	if len(th.orders) == 0 {
+		delete(e.holds, h.key)
+	}
+}
+
+// orderReservation 计算订单剩余部分的占用代币与数量；价格为空或 0 的买单（市价单）按 refPrice 估算，refPrice 为 nil 时不占用
+func orderReservation(o *storage.Order, tokens PairTokens, refPrice *big.Int) (token string, amount *big.Int) {
+	left := o.Remaining()
+	if o.Side != "buy" {
+		return strings.ToLower(tokens.Token0), left
+	}
+	token = strings.ToLower(tokens.Token1)
+	if o.IsMarket() && o.QuoteAmount != "" {
+		return token, storage.MustUnits(o.QuoteAmount)
+	}
+	price := storage.MustUnits(o.Price)
+	if price.Sign() == 0 {
+		if refPrice == nil {
+			return token, new(big.Int)
+		}
+		price = refPrice
+	}
+	return token, storage.QuoteAmount(left, price, tokens.BaseDecimals())
+}
+
+// ReservedBalance 返回 trader 挂单（含待触发条件单）对 token 的占用总量（读订单索引中的计数，不锁定分片）
+func (e *Engine) ReservedBalance(trader, token string) *big.Int {
+	e.idxMu.Lock()
+	defer e.idxMu.Unlock()
+	if th := e.holds[balanceKey{strings.ToLower(trader), strings.ToLower(token)}]; th != nil {
+		return new(big.Int).Set(th.total)
+	}
+	return new(big.Int)
+}
+
+// OrderRequirement 返回新订单需占用的代币与数量；按数量下的市价买单以卖一价（含滑点上限）估算，卖盘为空时不占用
+func (e *Engine) OrderRequirement(o *storage.Order) (token string, amount *big.Int, err error) {
+	sh, unlock := e.lockPair(o.Pair)
+	defer unlock()
+	tokens, ok := e.tokens[o.Pair]
+	if sh == nil || !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownPair, o.Pair)
+	}
+	var ref *big.Int
+	if o.Side == "buy" && o.IsMarket() {
+		if _, best := e.pairs[o.Pair].best(false); best != nil {
+			ref = new(big.Int).Mul(best, big.NewInt(int64(10000+o.MaxSlippageBps)))
+			ref.Quo(ref, big.NewInt(10000))
+		}
+	}
+	token, amount = orderReservation(o, tokens, ref)
+	return token, amount, nil
+}
+
+// AmendRequirement 返回改单使占用增加的代币与数量（改后占用 - 当前占用，不增加时为 0）；newPrice/newAmount 含义同 AmendOrder
+func (e *Engine) AmendRequirement(orderID, newPrice, newAmount string) (token string, delta *big.Int, err error) {
+	price, amount, err := ParseAmendFields(newPrice, newAmount)
+	if err != nil {
+		return "", nil, err
+	}
+	pair := e.pairOf(orderID)
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return "", nil, ErrAmendOrderNotFound
+	}
+	n, ok := e.pairs[pair].index[orderID]
+	if !ok {
+		return "", nil, ErrAmendOrderNotFound
+	}
+	o2 := *n.order
+	if price != nil {
+		o2.Price = storage.FormatUnits(price)
+	}
+	if amount != nil {
+		o2.Amount = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(o2.Filled), amount))
+	}
+	token, before := orderReservation(n.order, e.tokens[pair], nil)
+	_, after := orderReservation(&o2, e.tokens[pair], nil)
+	delta = after.Sub(after, before)
+	if delta.Sign() < 0 {
+		delta.SetInt64(0)
+	}
+	return token, delta, nil
+}
+
+// CancelExcessReservations 当 trader 的 token 托管余额低于挂单占用时，按排队时间从新到旧撤销其挂单直至占用不超过余额
+// 每笔撤单写入日志（与 RemoveOrder 相同），返回被撤销订单的副本（status=cancelled）
+func (e *Engine) CancelExcessReservations(trader, token string, balance *big.Int) []*storage.Order {
+	e.mu.Lock()
+	defer e.unlockWrite()
+	e.idxMu.Lock()
+	var rs []*orderHold
+	reserved := new(big.Int)
+	if th := e.holds[balanceKey{strings.ToLower(trader), strings.ToLower(token)}]; th != nil {
+		reserved.Set(th.total)
+		for _, h := range th.orders {
+			rs = append(rs, h)
+		}
+	}
+	e.idxMu.Unlock()
+	if reserved.Cmp(balance) <= 0 {
+		return nil
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		ti, tj := rs[i].order.PriorityTime(), rs[j].order.PriorityTime()
+		if ti != tj {
+			return ti > tj
+		}
+		return rs[i].order.OrderID > rs[j].order.OrderID
+	})
+	var out []*storage.Order
+	for _, r := range rs {
+		if reserved.Cmp(balance) <= 0 {
+			break
+		}
+		if !e.recordLocked(e.shards[r.pair], &JournalEvent{Type: EventCancel, Pair: r.pair, OrderID: r.order.OrderID}) {
+			break
+		}
+		c := *r.order
+		if e.removeLocked(r.pair, r.order.OrderID) {
+			c.Status = storage.OrderStatusCancelled
+			out = append(out, &c)
+			reserved.Sub(reserved, r.amount)
+		}
+	}
+	return out
+}
+
+// balanceKey 余额缓存键（地址小写）
+type balanceKey struct {
+	trader string
+	token  string
+}
+
+// balanceQueryTimeout 链上余额查询超时
+const balanceQueryTimeout = 3 * time.Second
+
+// BalanceService Vault 余额服务：缓存 trader 在 Vault 中的托管余额，按 Deposit / Withdraw / TransferOut 事件刷新；
+// 可用余额 = 托管余额 - 挂单占用。新订单与加量/改价改单超过可用余额时拒绝，余额下降导致占用超额时撤销挂单（防止虚假深度）
+// 链上查询失败且无缓存时拒绝（ErrBalanceUnavailable），不在无法确认资金时放行
+type BalanceService struct {
+	engine    *Engine
+	vault     *chain.Vault
+	mu        sync.Mutex
+	balances  map[balanceKey]*big.Int
+	locks     map[balanceKey]*keyLock // 按 trader/token 的校验锁，见 Submit
+	nextBlock uint64                  // 下次 Sync 拉取事件的起始区块，0 为尚未初始化
+}
+
+// keyLock trader/token 校验锁，refs 为持有与等待者数量（为 0 时回收）
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewBalanceService 创建余额服务
+func NewBalanceService(engine *Engine, vault *chain.Vault) *BalanceService {
+	return &BalanceService{engine: engine, vault: vault, balances: make(map[balanceKey]*big.Int), locks: make(map[balanceKey]*keyLock)}
+}
+
+// lock 锁定 trader 对 token 的余额校验，返回解锁函数
+func (s *BalanceService) lock(key balanceKey) func() {
+	s.mu.Lock()
+	l := s.locks[key]
+	if l == nil {
+		l = &keyLock{}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, key)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Balance 返回 trader 在 Vault 中 token 的托管余额（缓存未命中时查询链上并缓存）
+func (s *BalanceService) Balance(ctx context.Context, trader, token string) (*big.Int, error) {
+	key := balanceKey{strings.ToLower(trader), strings.ToLower(token)}
+	s.mu.Lock()
+	bal, ok := s.balances[key]
+	s.mu.Unlock()
+	if ok {
+		return new(big.Int).Set(bal), nil
+	}
+	return s.refresh(ctx, key)
+}
+
+// refresh 查询链上余额并更新缓存
+func (s *BalanceService) refresh(ctx context.Context, key balanceKey) (*big.Int, error) {
+	bal, err := s.vault.BalanceOf(ctx, key.token, key.trader)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.balances[key] = bal
+	s.mu.Unlock()
+	return new(big.Int).Set(bal), nil
+}
+
+// Available 返回 trader 对 token 的可用余额（托管余额 - 挂单占用，可能为负）
+func (s *BalanceService) Available(ctx context.Context, trader, token string) (*big.Int, error) {
+	bal, err := s.Balance(ctx, trader, token)
+	if err != nil {
+		return nil, err
+	}
+	return bal.Sub(bal, s.engine.ReservedBalance(trader, token)), nil
+}
+
+// Admit 预检新订单所需数量不超过可用余额（API 与 gossip 入口，尽早拒绝）；不占用余额，入簿时由 Submit 在锁内再次校验。s 为 nil 时不校验
+func (s *BalanceService) Admit(o *storage.Order) error {
+	if s == nil {
+		return nil
+	}
+	token, need, err := s.engine.OrderRequirement(o)
+	if err != nil {
+		return err
+	}
+	return s.admit(o.Trader, token, need)
+}
+
+// AdmitAmend 预检改单增加的占用（加量、买单提价）不超过可用余额（API 改单入口）；不占用余额，改单时由 Amend 在锁内再次校验。s 为 nil 时不校验
+func (s *BalanceService) AdmitAmend(trader, orderID, newPrice, newAmount string) error {
+	if s == nil {
+		return nil
+	}
+	token, need, err := s.engine.AmendRequirement(orderID, newPrice, newAmount)
+	if err != nil {
+		return err
+	}
+	return s.admit(trader, token, need)
+}
+
+// Submit 在 trader/token 校验锁内校验新订单所需数量不超过可用余额，通过后调用 submit 入簿（入簿即建立占用）
+// 校验与占用为一步：同一 trader 对同一代币的并发订单（含不同交易对的撮合 worker）不会重复使用同一笔余额
+// 校验不通过时不调用 submit；s 为 nil 时直接调用 submit
+func (s *BalanceService) Submit(o *storage.Order, submit func() error) error {
+	if s == nil {
+		return submit()
+	}
+	token, need, err := s.engine.OrderRequirement(o)
+	if err != nil {
+		return err
+	}
+	unlock := s.lock(balanceKey{strings.ToLower(o.Trader), token})
+	defer unlock()
+	if err := s.admit(o.Trader, token, need); err != nil {
+		return err
+	}
+	return submit()
+}
+
+// Amend 在 trader/token 校验锁内校验改单增加的占用不超过可用余额，通过后调用 amend 改单；与 Submit 共用校验锁
+// 校验不通过时不调用 amend；s 为 nil 时直接调用 amend
+func (s *BalanceService) Amend(trader, orderID, newPrice, newAmount string, amend func() error) error {
+	if s == nil {
+		return amend()
+	}
+	token, need, err := s.engine.AmendRequirement(orderID, newPrice, newAmount)
+	if err != nil {
+		return err
+	}
+	unlock := s.lock(balanceKey{strings.ToLower(trader), token})
+	defer unlock()
+	if err := s.admit(trader, token, need); err != nil {
+		return err
+	}
+	return amend()
+}
+
+// admit 校验 trader 对 token 的可用余额不低于 need；无法取得余额时拒绝
+func (s *BalanceService) admit(trader, token string, need *big.Int) error {
+	if need.Sign() == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), balanceQueryTimeout)
+	defer cancel()
+	avail, err := s.Available(ctx, trader, token)
+	if err != nil {
+		log.Printf("[balance] 查询 Vault 余额失败，拒绝 trader=%s token=%s: %v", trader, token, err)
+		return fmt.Errorf("%w: trader=%s token=%s: %v", ErrBalanceUnavailable, trader, token, err)
+	}
+	if avail.Cmp(need) < 0 {
+		return fmt.Errorf("%w: trader=%s token=%s need=%s available=%s", ErrInsufficientBalance, trader, token, need, avail)
+	}
+	return nil
+}
+
+// Sync 拉取上次同步后的 Vault 余额变化事件，刷新受影响账户的余额，并撤销占用超过新余额的挂单
+// 首次调用只记录当前区块（此前的余额在查询时按需读取）；返回被撤销订单的副本
+func (s *BalanceService) Sync(ctx context.Context) ([]*storage.Order, error) {
+	latest, err := s.vault.LatestBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	from := s.nextBlock
+	s.mu.Unlock()
+	if from == 0 {
+		s.mu.Lock()
+		s.nextBlock = latest + 1
+		s.mu.Unlock()
+		return nil, nil
+	}
+	if from > latest {
+		return nil, nil
+	}
+	changes, err := s.vault.Changes(ctx, from, latest)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[balanceKey]bool)
+	var out []*storage.Order
+	for _, ch := range changes {
+		key := balanceKey{ch.User, ch.Token}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		bal, err := s.refresh(ctx, key)
+		if err != nil {
+			return out, err
+		}
+		if cancelled := s.engine.CancelExcessReservations(key.trader, key.token, bal); len(cancelled) > 0 {
+			log.Printf("[balance] Vault 余额不足，撤销挂单 trader=%s token=%s balance=%s count=%d", key.trader, key.token, bal, len(cancelled))
+			out = append(out, cancelled...)
+		}
+	}
+	s.mu.Lock()
+	s.nextBlock = latest + 1
+	s.mu.Unlock()
+	return out, nil
+}
+
+// RunBalanceSync 按 interval 周期同步 Vault 余额变化，撤销的挂单交由 onCancelled 持久化与推送
+func RunBalanceSync(ctx context.Context, s *BalanceService, interval time.Duration, onCancelled func([]*storage.Order)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cancelled, err := s.Sync(ctx)
+		if err != nil {
+			log.Printf("[balance] 同步 Vault 余额失败: %v", err)
+		}
+		if len(cancelled) > 0 && onCancelled != nil {
+			onCancelled(cancelled)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package match
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+
+	"github.com/P2P-P2P/p2p/node/internal/chain"
+)
+
+// testVaultCode 最小 Vault 替身（运行时字节码）：存储布局与 Vault.sol 一致（balances 位于 slot 2）
+//   - balanceOf(token, user)：calldata 为 68 字节时返回 balances[user][token]
+//   - 其他调用：calldata = selector | token | user | newBalance | topic0 | amount，
+//     写入 balances[user][token] = newBalance 并发出 log3(amount; topic0, user, token)，模拟 Deposit / Withdraw
+var testVaultCode = hexutil.MustDecode("0x" +
+	"602435600052" + "6002602052" + "6040600020" + "602052" + "600435600052" + "6040600020" + // slot
+	"60443614603f57" + // calldatasize == 68 → balanceOf
+	"604435905560843560005260043560243560643560206000a300" + // sstore + log3
+	"5b5460005260206000f3") // sload + return
+
+type testVault struct {
+	backend *simulated.Backend
+	key     *ecdsa.PrivateKey
+	addr    common.Address
+	bal     map[[2]common.Address]*big.Int
+}
+
+func newTestVault(t *testing.T) *testVault {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.HexToAddress("0x000000000000000000000000000000000000a11e")
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil)},
+		addr:                                  {Code: testVaultCode, Balance: new(big.Int)},
+	})
+	t.Cleanup(func() { backend.Close() })
+	return &testVault{backend: backend, key: key, addr: addr, bal: make(map[[2]common.Address]*big.Int)}
+}
+
+// move 模拟存入（amount > 0，Deposit 事件）或提取（amount < 0，Withdraw 事件），并出块
+func (v *testVault) move(t *testing.T, user, token string, amount int64) {
+	t.Helper()
+	k := [2]common.Address{common.HexToAddress(user), common.HexToAddress(token)}
+	if v.bal[k] == nil {
+		v.bal[k] = new(big.Int)
+	}
+	topic, delta := chain.VaultDepositTopic, big.NewInt(amount)
+	if amount < 0 {
+		topic, delta = chain.VaultWithdrawTopic, big.NewInt(-amount)
+	}
+	v.bal[k].Add(v.bal[k], big.NewInt(amount))
+	data := append([]byte{0, 0, 0, 0}, common.LeftPadBytes(k[1].Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(k[0].Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(v.bal[k].Bytes(), 32)...)
+	data = append(data, topic.Bytes()...)
+	data = append(data, common.LeftPadBytes(delta.Bytes(), 32)...)
+
+	client := v.backend.Client()
+	ctx := context.Background()
+	from := crypto.PubkeyToAddress(v.key.PublicKey)
+	nonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := types.SignTx(types.NewTransaction(nonce, v.addr, new(big.Int), 200000, gasPrice, data), types.LatestSignerForChainID(chainID), v.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	v.backend.Commit()
+}
+
+const (
+	balTrader = "0x00000000000000000000000000000000000000b1"
+	balBase   = "0x000000000000000000000000000000000000000a"
+	balQuote  = "0x000000000000000000000000000000000000000b"
+)
+
+func balanceTestService(t *testing.T) (*testVault, *Engine, *BalanceService) {
+	t.Helper()
+	tv := newTestVault(t)
+	vault, err := chain.NewVault(tv.backend.Client(), tv.addr.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEngine(t, withTokens(balBase, balQuote))
+	return tv, e, NewBalanceService(e, vault)
+}
+
+func TestBalanceAdmissionReservesOpenOrders(t *testing.T) {
+	tv, e, s := balanceTestService(t)
+	tv.move(t, balTrader, balBase, 25)
+	tv.move(t, balTrader, balQuote, 1000)
+
+	if bal, err := s.Balance(context.Background(), balTrader, balBase); err != nil || bal.Int64() != 25 {
+		t.Fatalf("vault balance = %v, %v", bal, err)
+	}
+	a1 := testOrder("a1", "sell", "100", "20", 1, withTrader(balTrader))
+	if err := s.Admit(a1); err != nil {
+		t.Fatal(err)
+	}
+	e.Submit(a1)
+	// 20 已被挂单占用，可用 5
+	if err := s.Admit(testOrder("a2", "sell", "100", "10", 2, withTrader(balTrader))); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("sell over available: err = %v", err)
+	}
+	if err := s.Admit(testOrder("a3", "sell", "100", "5", 3, withTrader(balTrader))); err != nil {
+		t.Errorf("sell within available: %v", err)
+	}
+	// 买单占用 quote：10 × 90 / 10^1 = 90
+	if err := s.Admit(testOrder("b1", "buy", "90", "120", 4, withTrader(balTrader))); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("buy over quote balance: err = %v", err)
+	}
+	if err := s.Admit(testOrder("b2", "buy", "90", "100", 5, withTrader(balTrader))); err != nil {
+		t.Errorf("buy within quote balance: %v", err)
+	}
+}
+
+func TestBalanceDropCancelsNewestOrders(t *testing.T) {
+	tv, e, s := balanceTestService(t)
+	tv.move(t, balTrader, balBase, 30)
+	if _, err := s.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"a1", "a2", "a3"} {
+		o := testOrder(id, "sell", "100", "10", int64(i+1), withTrader(balTrader))
+		if err := s.Admit(o); err != nil {
+			t.Fatal(err)
+		}
+		e.Submit(o)
+	}
+	tv.move(t, balTrader, balBase, -15)
+	cancelled, err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelled) != 2 || cancelled[0].OrderID != "a3" || cancelled[1].OrderID != "a2" {
+		t.Fatalf("cancelled = %v, want a3 then a2", cancelled)
+	}
+	if e.GetOrder("a1") == nil || e.GetOrder("a2") != nil {
+		t.Error("oldest order should keep resting")
+	}
+	if got := e.ReservedBalance(balTrader, balBase); got.Int64() != 10 {
+		t.Errorf("reserved after cancel = %s", got)
+	}
+	// 存入后不撤单，新余额可用于下单
+	tv.move(t, balTrader, balBase, 20)
+	if cancelled, _ := s.Sync(context.Background()); len(cancelled) != 0 {
+		t.Errorf("deposit cancelled %d orders", len(cancelled))
+	}
+	if avail, _ := s.Available(context.Background(), balTrader, balBase); avail.Int64() != 25 {
+		t.Errorf("available after deposit = %s", avail)
+	}
+}
+
+// 挂单占用计数随入簿、部分成交、减量改单与撤单更新
+func TestReservedBalanceTracksBookChanges(t *testing.T) {
+	e := newTestEngine(t, withTokens(balBase, balQuote))
+	e.Submit(testOrder("a1", "sell", "100", "20", 1, withTrader(balTrader)))
+	e.Submit(testOrder("b1", "buy", "90", "10", 2, withTrader(balTrader)))
+	if got := e.ReservedBalance(balTrader, balBase); got.Int64() != 20 {
+		t.Fatalf("reserved base = %s, want 20", got)
+	}
+	if got := e.ReservedBalance(balTrader, balQuote); got.Int64() != 90 {
+		t.Fatalf("reserved quote = %s, want 90", got)
+	}
+	e.Submit(testOrder("t1", "buy", "100", "5", 3, withTrader("0x2")))
+	if got := e.ReservedBalance(balTrader, balBase); got.Int64() != 15 {
+		t.Errorf("reserved after partial fill = %s, want 15", got)
+	}
+	if _, err := e.AmendOrder("a1", "", "8", 4, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.ReservedBalance(balTrader, balBase); got.Int64() != 8 {
+		t.Errorf("reserved after reduce = %s, want 8", got)
+	}
+	e.RemoveOrder(testPair, "a1")
+	e.Submit(testOrder("t2", "sell", "90", "10", 5, withTrader("0x2")))
+	if got := e.ReservedBalance(balTrader, balBase); got.Sign() != 0 {
+		t.Errorf("reserved after cancel = %s, want 0", got)
+	}
+	if got := e.ReservedBalance(balTrader, balQuote); got.Sign() != 0 {
+		t.Errorf("reserved after full fill = %s, want 0", got)
+	}
+}
+
+// 并发提交同一 trader 的两笔订单，合计超过余额：校验与入簿为一步，只有一笔通过
+func TestBalanceSubmitConcurrentOrders(t *testing.T) {
+	tv, e, s := balanceTestService(t)
+	tv.move(t, balTrader, balBase, 25)
+	errs := make(chan error, 2)
+	for i, id := range []string{"a1", "a2"} {
+		o := testOrder(id, "sell", "100", "20", int64(i+1), withTrader(balTrader))
+		go func() {
+			errs <- s.Submit(o, func() error {
+				// 延迟入簿：无校验锁时另一笔订单在此期间通过校验
+				time.Sleep(50 * time.Millisecond)
+				e.Submit(o)
+				return nil
+			})
+		}()
+	}
+	var ok, rejected int
+	for range 2 {
+		switch err := <-errs; {
+		case err == nil:
+			ok++
+		case errors.Is(err, ErrInsufficientBalance):
+			rejected++
+		default:
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	if ok != 1 || rejected != 1 {
+		t.Fatalf("admitted %d, rejected %d; want exactly one admitted", ok, rejected)
+	}
+	if got := e.ReservedBalance(balTrader, balBase); got.Int64() != 20 {
+		t.Errorf("reserved = %s, want 20", got)
+	}
+}
+
+func TestBalanceAdmitRejectsWhenChainUnavailable(t *testing.T) {
+	tv := newTestVault(t)
+	// 无合约代码的地址：余额查询失败
+	vault, err := chain.NewVault(tv.backend.Client(), "0x000000000000000000000000000000000000dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewBalanceService(newTestEngine(t, withTokens(balBase, balQuote)), vault)
+	if err := s.Admit(testOrder("a1", "sell", "100", "20", 1, withTrader(balTrader))); !errors.Is(err, ErrBalanceUnavailable) {
+		t.Errorf("admit on chain error: err = %v, want ErrBalanceUnavailable", err)
+	}
+}
+
+func TestBalanceAdmitAmendIncrease(t *testing.T) {
+	tv, e, s := balanceTestService(t)
+	tv.move(t, balTrader, balBase, 25)
+	tv.move(t, balTrader, balQuote, 100)
+	e.Submit(testOrder("a1", "sell", "100", "20", 1, withTrader(balTrader)))
+	e.Submit(testOrder("b1", "buy", "50", "10", 2, withTrader(balTrader)))
+	// 加量只计增加部分：剩余 20 → 30 需 10，可用 5
+	if err := s.AdmitAmend(balTrader, "a1", "", "30"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("amend over available: err = %v", err)
+	}
+	if err := s.AdmitAmend(balTrader, "a1", "", "25"); err != nil {
+		t.Errorf("amend within available: %v", err)
+	}
+	if err := s.AdmitAmend(balTrader, "a1", "", "5"); err != nil {
+		t.Errorf("reduce: %v", err)
+	}
+	// 买单提价增加 quote 占用：10 × 50 / 10 = 50 → 10 × 120 / 10 = 120，可用 50
+	if err := s.AdmitAmend(balTrader, "b1", "120", ""); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("buy price raise over available: err = %v", err)
+	}
+	if err := s.AdmitAmend(balTrader, "b1", "90", ""); err != nil {
+		t.Errorf("buy price raise within available: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 交易对状态
+const (
+	PairTrading    = "trading"     // 正常撮合
+	PairHalted     = "halted"      // 暂停：拒绝新订单与改单，只允许撤单
+	PairAuction    = "auction"     // 集合竞价：限价 GTC/GTD 订单只挂单不撮合，结束时以统一价格一次性成交后恢复 trading
+	PairCancelOnly = "cancel-only" // 只允许撤单（通常由管理员设置）
+)
+
+// ErrPairNotTrading 交易对不在 trading 状态，拒绝该操作
+var ErrPairNotTrading = errors.New("pair is not open for trading")
+
+// ErrUnknownPair 交易对未配置
+var ErrUnknownPair = errors.New("unknown pair")
+
+// CircuitBreaker 交易对波动保护（万分比与秒，0 表示不启用对应项）
+// - PriceBandBps：单笔 taker 只能在参考价（撮合前最新成交价）上下该幅度内成交，超出部分撤销
+// - HaltMoveBps / HaltWindowSec：HaltWindowSec 秒内最高与最低成交价相差超过 HaltMoveBps 时自动暂停
+// - HaltCooldownSec：自动暂停持续时间，结束后进入集合竞价
+// - ReopenAuctionSec：复盘集合竞价时长，0 表示冷却期结束后立即清算
+type CircuitBreaker struct {
+	PriceBandBps     uint32 `json:"priceBandBps,omitempty"`
+	HaltMoveBps      uint32 `json:"haltMoveBps,omitempty"`
+	HaltWindowSec    int64  `json:"haltWindowSec,omitempty"`
+	HaltCooldownSec  int64  `json:"haltCooldownSec,omitempty"`
+	ReopenAuctionSec int64  `json:"reopenAuctionSec,omitempty"`
+}
+
+// Validate 校验配置：启用自动暂停时须同时设置窗口与冷却时间
+func (c CircuitBreaker) Validate() error {
+	if c.HaltWindowSec < 0 || c.HaltCooldownSec < 0 || c.ReopenAuctionSec < 0 {
+		return fmt.Errorf("invalid circuit breaker: durations must not be negative")
+	}
+	if c.HaltMoveBps > 0 && (c.HaltWindowSec == 0 || c.HaltCooldownSec == 0) {
+		return fmt.Errorf("invalid circuit breaker: halt_move_bps requires halt_window_sec and halt_cooldown_sec")
+	}
+	return nil
+}
+
+// ValidPairState 是否为合法的交易对状态
+func ValidPairState(state string) bool {
+	switch state {
+	case PairTrading, PairHalted, PairAuction, PairCancelOnly:
+		return true
+	}
+	return false
+}
+
+// pairStatus 交易对状态与熔断窗口；分片中为 nil 的交易对为 trading
+type pairStatus struct {
+	state  string
+	since  int64
+	until  int64 // 到期自动流转时间（halted → auction → trading，cancel-only → trading），0 为不自动流转
+	reason string
+	window []priceSample // 熔断窗口内每秒的成交价区间
+}
+
+// priceSample 某一秒的最低与最高成交价
+type priceSample struct {
+	ts     int64
+	lo, hi *big.Int
+}
+
+// PairStateChange 交易对状态变化（熔断、冷却结束进入集合竞价、复盘、管理员操作）
+type PairStateChange struct {
+	Pair    string         `json:"pair"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Until   int64          `json:"until,omitempty"`
+	Reason  string         `json:"reason,omitempty"`
+	Time    int64          `json:"time"`
+	Auction *AuctionResult `json:"-"` // auction → trading 时的集合竞价结果
+}
+
+// pairStateLocked 返回交易对状态（调用方需已锁定该交易对分片）
+func (e *Engine) pairStateLocked(pair string) string {
+	if sh := e.shards[pair]; sh != nil && sh.status != nil {
+		return sh.status.state
+	}
+	return PairTrading
+}
+
+// PairState 返回交易对状态与自动流转时间（0 为不自动流转）
+func (e *Engine) PairState(pair string) (state string, until int64) {
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh != nil && sh.status != nil {
+		return sh.status.state, sh.status.until
+	}
+	return PairTrading, 0
+}
+
+// SetPairState 设置交易对状态（管理员手动暂停/只撤单/集合竞价/恢复）；durationSec > 0 时到期后自动流转：
+// halted → auction → trading，auction → trading（清算），cancel-only → trading
+// 从 auction 恢复 trading 时先以统一价格清算订单簿
+func (e *Engine) SetPairState(pair, state string, durationSec int64, reason string) (*PairStateChange, error) {
+	if !ValidPairState(state) {
+		return nil, fmt.Errorf("invalid state %q: must be trading, halted, auction or cancel-only", state)
+	}
+	if durationSec < 0 {
+		return nil, fmt.Errorf("invalid duration: must not be negative")
+	}
+	e.mu.Lock()
+	defer e.unlockWrite()
+	if _, ok := e.tokens[pair]; !ok {
+		if _, ok := e.pairs[pair]; !ok {
+			return nil, ErrUnknownPair
+		}
+	}
+	if !e.recordLocked(e.shardLocked(pair), &JournalEvent{Type: EventPairState, Pair: pair, State: state, Duration: durationSec, Reason: reason}) {
+		return nil, ErrJournalWrite
+	}
+	return e.setPairStateLocked(pair, state, durationSec, reason), nil
+}
+
+// AdvancePairStates 推进到期的交易对状态（每秒调用），返回此前累计的全部状态变化（含撮合中触发的自动暂停）
+func (e *Engine) AdvancePairStates() []*PairStateChange {
+	e.mu.Lock()
+	defer e.unlockWrite()
+	now := e.clock()
+	for _, pair := range sortedKeys(e.shards) {
+		sh := e.shards[pair]
+		st := sh.status
+		if st == nil || st.until == 0 || now < st.until {
+			continue
+		}
+		next, dur := PairTrading, int64(0)
+		if st.state == PairHalted {
+			next, dur = PairAuction, e.tokens[pair].Breaker.ReopenAuctionSec
+			if dur == 0 {
+				dur = 1 // 冷却结束后至少经过一次推进才清算，使集合竞价状态可被观察
+			}
+		}
+		reason := fmt.Sprintf("%s period ended", st.state)
+		if !e.recordLocked(sh, &JournalEvent{Type: EventPairState, Pair: pair, State: next, Duration: dur, Reason: reason}) {
+			break
+		}
+		e.setPairStateLocked(pair, next, dur, reason)
+	}
+	e.changesMu.Lock()
+	defer e.changesMu.Unlock()
+	out := e.stateChanges
+	e.stateChanges = nil
+	return out
+}
+
+// setPairStateLocked 切换交易对状态并记录变化；auction → trading 时清算订单簿
+// 调用方需已锁定该交易对分片（撮合中触发熔断），或持写锁且分片已存在（管理员操作与到期流转）
+func (e *Engine) setPairStateLocked(pair, state string, durationSec int64, reason string) *PairStateChange {
+	now := e.nowLocked(pair)
+	from := e.pairStateLocked(pair)
+	ch := &PairStateChange{Pair: pair, From: from, To: state, Reason: reason, Time: now}
+	if from == PairAuction && state == PairTrading {
+		ch.Auction = &AuctionResult{Pair: pair}
+		e.crossLocked(ch.Auction, fmt.Sprintf("reopen-%d", now), now, func(*storage.Order) bool { return true })
+	}
+	st := &pairStatus{state: state, since: now, reason: reason}
+	if durationSec > 0 {
+		st.until = now + durationSec
+		ch.Until = st.until
+	}
+	if state == PairTrading {
+		// 恢复交易后重新开始熔断窗口
+		st = nil
+	}
+	e.shards[pair].status = st
+	log.Printf("[breaker] pair=%s %s → %s until=%d reason=%s", pair, from, state, ch.Until, reason)
+	e.changesMu.Lock()
+	e.stateChanges = append(e.stateChanges, ch)
+	e.changesMu.Unlock()
+	return ch
+}
+
+// bandLimitLocked 价格带：taker 本次可成交的最差价格（买为上限、卖为下限）；未配置或无参考价时为 nil（调用方需已锁定该交易对分片）
+func (e *Engine) bandLimitLocked(pair string, buy bool) *big.Int {
+	bps := e.tokens[pair].Breaker.PriceBandBps
+	lt := e.shards[pair].lastTrade
+	if bps == 0 || lt == nil {
+		return nil
+	}
+	factor := int64(10000) - int64(bps)
+	if buy {
+		factor = 10000 + int64(bps)
+	}
+	if factor < 0 {
+		factor = 0
+	}
+	limit := new(big.Int).Mul(lt.price, big.NewInt(factor))
+	return limit.Quo(limit, big.NewInt(10000))
+}
+
+// tripBreakerLocked 记录成交价并检查熔断窗口：窗口内最高价与最低价相差超过 HaltMoveBps 时暂停交易对，返回是否已暂停（调用方需已锁定该交易对分片）
+func (e *Engine) tripBreakerLocked(pair string, price *big.Int, ts int64) bool {
+	cb := e.tokens[pair].Breaker
+	if cb.HaltMoveBps == 0 {
+		return false
+	}
+	sh := e.shards[pair]
+	st := sh.status
+	if st == nil {
+		st = &pairStatus{state: PairTrading}
+		sh.status = st
+	}
+	if n := len(st.window); n > 0 && st.window[n-1].ts == ts {
+		s := &st.window[n-1]
+		if price.Cmp(s.lo) < 0 {
+			s.lo = new(big.Int).Set(price)
+		}
+		if price.Cmp(s.hi) > 0 {
+			s.hi = new(big.Int).Set(price)
+		}
+	} else {
+		st.window = append(st.window, priceSample{ts: ts, lo: new(big.Int).Set(price), hi: new(big.Int).Set(price)})
+	}
+	i := 0
+	for i < len(st.window) && st.window[i].ts <= ts-cb.HaltWindowSec {
+		i++
+	}
+	st.window = st.window[i:]
+	lo, hi := st.window[0].lo, st.window[0].hi
+	for _, s := range st.window[1:] {
+		if s.lo.Cmp(lo) < 0 {
+			lo = s.lo
+		}
+		if s.hi.Cmp(hi) > 0 {
+			hi = s.hi
+		}
+	}
+	// hi / lo > 1 + bps/10000
+	if new(big.Int).Mul(hi, big.NewInt(10000)).Cmp(new(big.Int).Mul(lo, big.NewInt(10000+int64(cb.HaltMoveBps)))) <= 0 {
+		return false
+	}
+	e.setPairStateLocked(pair, PairHalted, cb.HaltCooldownSec,
+		fmt.Sprintf("price moved from %s to %s within %ds", lo, hi, cb.HaltWindowSec))
+	return true
+}
+
+// validateAuctionOrder 集合竞价期间只接受限价 GTC/GTD 订单（不撮合、只挂单）
+func validateAuctionOrder(o *storage.Order) error {
+	if o.IsMarket() || o.Trigger != "" {
+		return fmt.Errorf("%w: only limit orders are accepted during the auction", ErrPairNotTrading)
+	}
+	switch o.EffectiveTimeInForce() {
+	case storage.TimeInForceIOC, storage.TimeInForceFOK, storage.TimeInForcePostOnly:
+		return fmt.Errorf("%w: only GTC or GTD orders are accepted during the auction", ErrPairNotTrading)
+	}
+	return nil
+}
+
+// checkPairStateLocked 按交易对上架与交易状态校验新订单（调用方需已锁定该交易对分片）
+func (e *Engine) checkPairStateLocked(o *storage.Order) error {
+	if _, ok := e.tokens[o.Pair]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPair, o.Pair)
+	}
+	switch state := e.pairStateLocked(o.Pair); state {
+	case PairHalted, PairCancelOnly:
+		return fmt.Errorf("%w: pair %s is %s", ErrPairNotTrading, o.Pair, state)
+	case PairAuction:
+		return validateAuctionOrder(o)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package match
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func TestPriceBandCancelsTakerRemainder(t *testing.T) {
+	var now atomic.Int64
+	now.Store(10)
+	e := newTestEngine(t, withClock(now.Load), withBreaker(CircuitBreaker{PriceBandBps: 100}))
+	e.SetLastTradePrice("TKA/TKB", "100", 1)
+	e.AddOrder(testOrder("a1", "sell", "100", "10", 1))
+	e.AddOrder(testOrder("a2", "sell", "101", "10", 2))
+	e.AddOrder(testOrder("a3", "sell", "102", "10", 3))
+
+	b := testOrder("b1", "buy", "105", "30", 4)
+	res := e.Submit(b)
+	if len(res.Trades) != 2 || res.Trades[1].MakerOrderID != "a2" {
+		t.Fatalf("trades = %+v, want fills against a1, a2 only", res.Trades)
+	}
+	if b.Status != storage.OrderStatusCancelled || b.Filled != "20" {
+		t.Errorf("taker = %s/%s, want cancelled/20", b.Status, b.Filled)
+	}
+	if e.GetOrder("a3") == nil || e.GetOrder("b1") != nil {
+		t.Error("a3 should rest and the taker remainder should not")
+	}
+}
+
+func TestHaltCooldownAuctionReopen(t *testing.T) {
+	var now atomic.Int64
+	now.Store(100)
+	e := newTestEngine(t, withClock(now.Load), withBreaker(CircuitBreaker{HaltMoveBps: 500, HaltWindowSec: 60, HaltCooldownSec: 30, ReopenAuctionSec: 10}))
+	e.AddOrder(testOrder("a1", "sell", "100", "10", 1))
+	e.AddOrder(testOrder("a2", "sell", "110", "10", 2))
+	e.AddOrder(testOrder("a3", "sell", "111", "10", 3))
+
+	b := testOrder("b1", "buy", "111", "30", 4)
+	if res := e.Submit(b); len(res.Trades) != 2 || b.Status != storage.OrderStatusCancelled {
+		t.Fatalf("trades = %d, taker = %s; want halt after second fill", len(res.Trades), b.Status)
+	}
+	if state, until := e.PairState("TKA/TKB"); state != PairHalted || until != 130 {
+		t.Fatalf("state = %s until %d, want halted until 130", state, until)
+	}
+	b2 := testOrder("b2", "buy", "111", "1", 5)
+	if e.Submit(b2); b2.Status != storage.OrderStatusRejected {
+		t.Errorf("order during halt: status = %s", b2.Status)
+	}
+	if _, err := e.AmendOrder("a3", "112", "", 5, ""); !errors.Is(err, ErrPairNotTrading) {
+		t.Errorf("amend during halt: err = %v", err)
+	}
+	if ch := e.AdvancePairStates(); len(ch) != 1 || ch[0].To != PairHalted {
+		t.Fatalf("changes = %+v, want trading → halted", ch)
+	}
+
+	now.Store(130)
+	if ch := e.AdvancePairStates(); len(ch) != 1 || ch[0].To != PairAuction || ch[0].Until != 140 {
+		t.Fatalf("changes = %+v, want halted → auction until 140", ch)
+	}
+	b3 := testOrder("b3", "buy", "112", "5", 6, withTIF(storage.TimeInForceIOC))
+	if e.Submit(b3); b3.Status != storage.OrderStatusRejected {
+		t.Errorf("IOC during auction: status = %s", b3.Status)
+	}
+	b4 := testOrder("b4", "buy", "112", "5", 7)
+	if res := e.Submit(b4); len(res.Trades) != 0 || b4.Status != storage.OrderStatusOpen {
+		t.Fatalf("auction order: trades = %d, status = %s; want resting", len(res.Trades), b4.Status)
+	}
+
+	now.Store(140)
+	ch := e.AdvancePairStates()
+	if len(ch) != 1 || ch[0].To != PairTrading || ch[0].Auction == nil {
+		t.Fatalf("changes = %+v, want auction → trading with cross", ch)
+	}
+	if tr := ch[0].Auction.Trades; len(tr) != 1 || (tr[0].TakerOrderID != "b4" && tr[0].MakerOrderID != "b4") || tr[0].Amount != "5" {
+		t.Errorf("reopen trades = %+v", tr)
+	}
+	if state, _ := e.PairState("TKA/TKB"); state != PairTrading {
+		t.Errorf("state = %s after reopen", state)
+	}
+}
+
+func TestSetPairStateCancelOnly(t *testing.T) {
+	var now atomic.Int64
+	now.Store(100)
+	e := newTestEngine(t, withClock(now.Load), withBreaker(CircuitBreaker{}))
+	e.AddOrder(testOrder("a1", "sell", "100", "10", 1))
+	if _, err := e.SetPairState("TKX/TKY", PairHalted, 0, ""); !errors.Is(err, ErrUnknownPair) {
+		t.Errorf("unknown pair: err = %v", err)
+	}
+	if _, err := e.SetPairState("TKA/TKB", "closed", 0, ""); err == nil {
+		t.Error("invalid state accepted")
+	}
+	ch, err := e.SetPairState("TKA/TKB", PairCancelOnly, 60, "maintenance")
+	if err != nil || ch.From != PairTrading || ch.Until != 160 {
+		t.Fatalf("SetPairState = %+v, %v", ch, err)
+	}
+	if m := e.Markets()[0]; m.State != PairCancelOnly || m.StateUntil != 160 || m.StateReason != "maintenance" {
+		t.Errorf("market = %s/%d/%s", m.State, m.StateUntil, m.StateReason)
+	}
+	if err := e.CheckMarketRules(testOrder("b1", "buy", "100", "1", 2)); !errors.Is(err, ErrPairNotTrading) {
+		t.Errorf("CheckMarketRules: err = %v", err)
+	}
+	if !e.RemoveOrder("TKA/TKB", "a1") {
+		t.Error("cancel rejected in cancel-only")
+	}
+	e.AdvancePairStates()
+	now.Store(160)
+	if ch := e.AdvancePairStates(); len(ch) != 1 || ch[0].To != PairTrading || ch[0].Auction != nil {
+		t.Fatalf("changes = %+v, want cancel-only → trading", ch)
+	}
+}
@@ -0,0 +1,148 @@
+package match
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// PriceLevel L2 价格档位：Amount 为档位内挂单剩余量之和（冰山单只计可见量），Orders 为挂单数；增量中 Amount 为 "0" 表示档位已删除
+type PriceLevel struct {
+	Price  string `json:"price"`
+	Amount string `json:"amount"`
+	Orders int    `json:"orders"`
+}
+
+// DepthUpdate 交易对 L2 增量：Seq 在交易对内从 1 起连续递增，PrevSeq 为上一条增量的序号（客户端据此发现缺口）
+// Reset 为 true 时订单簿被整体替换（订单簿同步、快照加载、下架），Bids/Asks 为全量档位，订阅端丢弃本地订单簿后以其为准
+type DepthUpdate struct {
+	Pair    string       `json:"pair"`
+	Seq     uint64       `json:"seq"`
+	PrevSeq uint64       `json:"prevSeq"`
+	Reset   bool         `json:"reset,omitempty"`
+	Bids    []PriceLevel `json:"bids"`
+	Asks    []PriceLevel `json:"asks"`
+}
+
+// DepthSnapshot 交易对 L2 快照：Seq 为快照已包含的最后一条增量序号，订阅端丢弃 seq <= Seq 的增量，从 prevSeq == Seq 的增量开始应用
+type DepthSnapshot struct {
+	Pair string       `json:"pair"`
+	Seq  uint64       `json:"seq"`
+	Bids []PriceLevel `json:"bids"`
+	Asks []PriceLevel `json:"asks"`
+}
+
+// SetDepthSink 设置 L2 增量接收方：输入改变订单簿档位后，引擎在释放该交易对的锁之前按序号顺序调用 fn
+// fn 在引擎锁内执行，须立即返回且不得回调引擎（放入队列由其他协程处理，见 api.DepthHub）；nil 为不发布（序号照常递增）
+func (e *Engine) SetDepthSink(fn func(*DepthUpdate)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.depthSink = fn
+}
+
+// DepthSnapshot 返回交易对 L2 快照，limit > 0 时每侧只取最优 limit 档；交易对不存在时返回 false
+func (e *Engine) DepthSnapshot(pair string, limit int) (*DepthSnapshot, bool) {
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return nil, false
+	}
+	ob := e.pairs[pair]
+	// 先发布未发布的变化，快照内容与序号一致
+	e.publishBookLocked(ob)
+	return &DepthSnapshot{Pair: pair, Seq: ob.depthSeq, Bids: ob.levels(true, limit), Asks: ob.levels(false, limit)}, true
+}
+
+// publishBookLocked 发布订单簿自上次发布以来的 L3 事件与 L2 档位变化（调用方需已锁定该交易对分片或持写锁）
+func (e *Engine) publishBookLocked(ob *OrderBook) {
+	if ob == nil {
+		return
+	}
+	e.publishL3Locked(ob)
+	if u := ob.depthChanges(e.depthSink != nil); u != nil {
+		e.depthSink(u)
+	}
+}
+
+// unlockWrite 发布写锁期间各交易对的行情变化后释放写锁（改变订单簿的结构性操作以此代替 e.mu.Unlock）
+func (e *Engine) unlockWrite() {
+	for _, pair := range sortedKeys(e.pairs) {
+		e.publishBookLocked(e.pairs[pair])
+	}
+	e.mu.Unlock()
+}
+
+// clearBookLocked 交易对订单簿被移除（下架、快照中不存在）：发布空的全量（L2 与 L3），订阅端清空本地订单簿（调用方需已持写锁）
+func (e *Engine) clearBookLocked(ob *OrderBook) {
+	e.clearL3Locked(ob)
+	if e.depthSink == nil {
+		return
+	}
+	e.depthSink(&DepthUpdate{Pair: ob.Pair, Seq: ob.depthSeq + 1, PrevSeq: ob.depthSeq, Reset: true, Bids: []PriceLevel{}, Asks: []PriceLevel{}})
+}
+
+// depthChanges 取出自上次发布以来的档位变化并推进序号；无变化返回 nil，build 为 false 时只推进序号不生成增量
+func (ob *OrderBook) depthChanges(build bool) *DepthUpdate {
+	if !ob.reset && len(ob.bids.dirty) == 0 && len(ob.asks.dirty) == 0 {
+		return nil
+	}
+	u := &DepthUpdate{Pair: ob.Pair, Seq: ob.depthSeq + 1, PrevSeq: ob.depthSeq, Reset: ob.reset}
+	ob.depthSeq = u.Seq
+	if build {
+		if u.Reset {
+			u.Bids, u.Asks = ob.levels(true, 0), ob.levels(false, 0)
+		} else {
+			u.Bids, u.Asks = ob.bids.changes(), ob.asks.changes()
+		}
+	}
+	ob.reset = false
+	clear(ob.bids.dirty)
+	clear(ob.asks.dirty)
+	if !build {
+		return nil
+	}
+	return u
+}
+
+// touch 标记订单所在档位数量已变化（簿内订单原地成交或减量）
+func (ob *OrderBook) touch(n *bookOrder) {
+	n.level.side.touch(n.level)
+}
+
+// levels 按价格优先顺序返回某侧 L2 档位，limit > 0 时只取前 limit 档
+func (ob *OrderBook) levels(buy bool, limit int) []PriceLevel {
+	s := ob.side(buy)
+	out := make([]PriceLevel, 0, len(s.levels))
+	for x := s.head.next[0]; x != nil && (limit <= 0 || len(out) < limit); x = x.next[0] {
+		out = append(out, x.level.depth())
+	}
+	return out
+}
+
+// changes 按价格优先顺序返回 dirty 档位的当前数量，已删除的档位 Amount 为 "0"
+func (s *bookSide) changes() []PriceLevel {
+	keys := make([]string, 0, len(s.dirty))
+	for key := range s.dirty {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.before(s.dirty[keys[i]], s.dirty[keys[j]]) })
+	out := make([]PriceLevel, 0, len(keys))
+	for _, key := range keys {
+		if lvl, ok := s.levels[key]; ok {
+			out = append(out, lvl.depth())
+		} else {
+			out = append(out, PriceLevel{Price: key, Amount: "0"})
+		}
+	}
+	return out
+}
+
+// depth 汇总档位数量：普通订单计剩余量，冰山单计当前可见量
+func (l *priceLevel) depth() PriceLevel {
+	total := new(big.Int)
+	for n := l.head; n != nil; n = n.next {
+		total.Add(total, n.available(n.order.Remaining()))
+	}
+	return PriceLevel{Price: l.key, Amount: storage.FormatUnits(total), Orders: l.count}
+}
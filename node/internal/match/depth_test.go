@@ -0,0 +1,143 @@
+package match
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 订阅端按序应用引擎发布的增量后，与引擎当前 L2 快照一致；序号连续，冰山单只计可见量
+func TestDepthUpdatesFollowBook(t *testing.T) {
+	e := newTestEngine(t)
+	var updates []*DepthUpdate
+	e.SetDepthSink(func(u *DepthUpdate) { updates = append(updates, u) })
+	// 新建订单簿首次发布全量
+	snap, ok := e.DepthSnapshot("TKA/TKB", 0)
+	if !ok || snap.Seq != 1 || len(snap.Bids) != 0 || len(updates) != 1 || !updates[0].Reset {
+		t.Fatalf("initial snapshot = %+v ok=%v updates=%+v", snap, ok, updates)
+	}
+	book := NewDepthBook(snap)
+
+	e.AddOrder(testOrder("i1", "sell", "100", "30", 1, withDisplay("10")))
+	e.AddOrder(testOrder("a2", "sell", "100", "10", 2))
+	e.AddOrder(testOrder("a3", "sell", "101", "5", 3))
+	e.AddOrder(testOrder("b1", "buy", "90", "7", 4))
+	e.Submit(testOrder("t1", "buy", "100", "12", 5)) // 吃 i1 可见 10（补充后排队尾）与 a2 2
+	e.RemoveOrder("TKA/TKB", "a3")
+	e.CancelTraderBelowNonce("0x1", 1) // 写锁路径：撤销全部 nonce 0 的订单
+
+	for i, u := range updates {
+		if u.Seq != uint64(i+1) || u.PrevSeq != uint64(i) {
+			t.Fatalf("update %d: seq=%d prevSeq=%d, want contiguous", i, u.Seq, u.PrevSeq)
+		}
+		if err := book.Apply(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(updates) != 8 {
+		t.Errorf("%d updates, want reset + one per book-changing input (8)", len(updates))
+	}
+	want, _ := e.DepthSnapshot("TKA/TKB", 0)
+	if got := book.Snapshot(0, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed book = %+v, want %+v", got, want)
+	}
+
+	// 冰山单档位只计可见量
+	e2 := newTestEngine(t, withOrders(testOrder("i1", "sell", "100", "30", 1, withDisplay("10"))))
+	snap, _ = e2.DepthSnapshot("TKA/TKB", 0)
+	if len(snap.Asks) != 1 || snap.Asks[0] != (PriceLevel{Price: "100", Amount: "10", Orders: 1}) {
+		t.Errorf("iceberg level = %+v, want visible 10 only", snap.Asks)
+	}
+
+	// 订单簿同步整体替换：发布全量（Reset），序号延续
+	n := len(updates)
+	e.ReplaceOrderbook("TKA/TKB", []*storage.Order{testOrder("b9", "buy", "95", "3", 9)}, nil)
+	if len(updates) != n+1 || !updates[n].Reset || updates[n].PrevSeq != uint64(n) {
+		t.Fatalf("replace: updates = %+v, want one reset after seq %d", updates[n:], n)
+	}
+	if err := book.Apply(updates[n]); err != nil {
+		t.Fatal(err)
+	}
+	if got := book.Levels(true, 0, nil); len(got) != 1 || got[0].Price != "95" || got[0].Amount != "3" {
+		t.Errorf("after reset bids = %+v", got)
+	}
+	// 缺口：跳过一条增量被拒绝
+	e.AddOrder(testOrder("b10", "buy", "94", "1", 10))
+	e.AddOrder(testOrder("b11", "buy", "93", "1", 11))
+	if err := book.Apply(updates[len(updates)-1]); !errors.Is(err, ErrDepthGap) {
+		t.Errorf("gap: err = %v, want ErrDepthGap", err)
+	}
+}
+
+func TestDepthViewGroupingAndLimit(t *testing.T) {
+	book := NewDepthBook(&DepthSnapshot{
+		Pair: "TKA/TKB",
+		Seq:  5,
+		Bids: []PriceLevel{{"109", "1", 1}, {"105", "2", 1}, {"99", "4", 2}, {"80", "8", 1}},
+		Asks: []PriceLevel{{"111", "1", 1}, {"120", "3", 1}},
+	})
+	// 买盘向下、卖盘向上合并到 10 的整数倍
+	if got := book.Levels(true, 0, big.NewInt(10)); !reflect.DeepEqual(got, []PriceLevel{{"100", "3", 2}, {"90", "4", 2}, {"80", "8", 1}}) {
+		t.Errorf("grouped bids = %+v", got)
+	}
+	if got := book.Levels(false, 0, big.NewInt(10)); !reflect.DeepEqual(got, []PriceLevel{{"120", "4", 2}}) {
+		t.Errorf("grouped asks = %+v", got)
+	}
+
+	top := NewDepthView(2, big.NewInt(10))
+	if snap := top.Snapshot(book); len(snap.Bids) != 2 || snap.Seq != 5 {
+		t.Fatalf("top-2 snapshot = %+v", snap)
+	}
+	full := NewDepthView(0, big.NewInt(10))
+	full.Snapshot(book)
+
+	// 移除 100 档全部挂单：前 2 档下移，80 档进入视图
+	u := &DepthUpdate{Pair: "TKA/TKB", Seq: 6, PrevSeq: 5, Bids: []PriceLevel{{"109", "0", 0}, {"105", "0", 0}}, Asks: []PriceLevel{}}
+	if err := book.Apply(u); err != nil {
+		t.Fatal(err)
+	}
+	d := top.Update(book, u)
+	if d == nil || d.PrevSeq != 5 || d.Seq != 6 {
+		t.Fatalf("top-2 diff = %+v", d)
+	}
+	if !reflect.DeepEqual(d.Bids, []PriceLevel{{"80", "8", 1}, {"100", "0", 0}}) {
+		t.Errorf("top-2 bid diff = %+v", d.Bids)
+	}
+	if d := full.Update(book, u); d == nil || !reflect.DeepEqual(d.Bids, []PriceLevel{{"100", "0", 0}}) {
+		t.Errorf("full grouped diff = %+v", d)
+	}
+
+	// 视图外的变化不下发，下一条增量的 prevSeq 仍为上次下发的序号
+	u = &DepthUpdate{Pair: "TKA/TKB", Seq: 7, PrevSeq: 6, Bids: []PriceLevel{{"70", "1", 1}}}
+	_ = book.Apply(u)
+	if d := top.Update(book, u); d != nil {
+		t.Errorf("change outside top-2 sent: %+v", d)
+	}
+	u = &DepthUpdate{Pair: "TKA/TKB", Seq: 8, PrevSeq: 7, Bids: []PriceLevel{{"99", "5", 3}}}
+	_ = book.Apply(u)
+	if d := top.Update(book, u); d == nil || d.PrevSeq != 6 || !reflect.DeepEqual(d.Bids, []PriceLevel{{"90", "5", 3}}) {
+		t.Errorf("top-2 diff after skipped update = %+v", d)
+	}
+}
+
+func TestParseDepthParams(t *testing.T) {
+	for in, want := range map[string]int{"": 0, "full": 0, "10": 10, "50": 50} {
+		if got, err := ParseDepthLimit(in); err != nil || got != want {
+			t.Errorf("ParseDepthLimit(%q) = %d, %v", in, got, err)
+		}
+	}
+	if _, err := ParseDepthLimit("20"); err == nil {
+		t.Error("depth 20 should be rejected")
+	}
+	if g, err := ParseDepthGroup("100"); err != nil || g.Int64() != 100 {
+		t.Errorf("ParseDepthGroup(100) = %v, %v", g, err)
+	}
+	for _, bad := range []string{"0", "-1", "1.5"} {
+		if _, err := ParseDepthGroup(bad); err == nil {
+			t.Errorf("ParseDepthGroup(%q) should fail", bad)
+		}
+	}
+}
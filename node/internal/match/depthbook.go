@@ -0,0 +1,332 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// ErrDepthGap 增量的 prevSeq 与本地订单簿序号不连续，需重新拉取快照
+var ErrDepthGap = errors.New("depth sequence gap")
+
+// ParseDepthLimit 解析档位数参数："10"、"50"、"full"（空为 full）
+func ParseDepthLimit(s string) (int, error) {
+	switch s {
+	case "", "full":
+		return 0, nil
+	case "10":
+		return 10, nil
+	case "50":
+		return 50, nil
+	}
+	return 0, fmt.Errorf("invalid depth %q: must be 10, 50 or full", s)
+}
+
+// ParseDepthGroup 解析价格合并粒度（价格最小单位的正整数，空为不合并）
+func ParseDepthGroup(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	g, ok := storage.ParseUnits(s)
+	if !ok || g.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid group %q: must be a positive integer in price units", s)
+	}
+	if g.Cmp(big.NewInt(1)) == 0 {
+		return nil, nil
+	}
+	return g, nil
+}
+
+// groupPrice 返回价格所在的合并档位价格：买盘向下取整、卖盘向上取整到 group 的整数倍（合并后不会与对手盘交叉）
+func groupPrice(buy bool, price, group *big.Int) *big.Int {
+	if group == nil {
+		return price
+	}
+	p := new(big.Int).Sub(price, new(big.Int).Mod(price, group))
+	if !buy && p.Cmp(price) != 0 {
+		p.Add(p, group)
+	}
+	return p
+}
+
+// DepthBook 订阅端的 L2 订单簿：由快照初始化、按序号应用增量（api.DepthHub 为每个被订阅的交易对维护一份）
+type DepthBook struct {
+	Pair       string
+	Seq        uint64
+	bids, asks *depthSide
+}
+
+// depthSide 订单簿一侧：按价格优先排序的档位
+type depthSide struct {
+	desc   bool
+	sorted []*depthLevel // 买盘价格降序、卖盘价格升序
+	levels map[string]*depthLevel
+}
+
+type depthLevel struct {
+	price  *big.Int
+	amount *big.Int
+	PriceLevel
+}
+
+// NewDepthBook 由快照创建订阅端订单簿
+func NewDepthBook(snap *DepthSnapshot) *DepthBook {
+	b := &DepthBook{Pair: snap.Pair}
+	b.reset(snap.Seq, snap.Bids, snap.Asks)
+	return b
+}
+
+func (b *DepthBook) reset(seq uint64, bids, asks []PriceLevel) {
+	b.Seq = seq
+	b.bids = &depthSide{desc: true, levels: make(map[string]*depthLevel)}
+	b.asks = &depthSide{levels: make(map[string]*depthLevel)}
+	for _, l := range bids {
+		b.bids.set(l)
+	}
+	for _, l := range asks {
+		b.asks.set(l)
+	}
+}
+
+// Apply 应用一条增量：Reset 增量替换整个订单簿；其余增量须满足 prevSeq == Seq，否则返回 ErrDepthGap 且订单簿不变
+func (b *DepthBook) Apply(u *DepthUpdate) error {
+	if u.Reset {
+		b.reset(u.Seq, u.Bids, u.Asks)
+		return nil
+	}
+	if u.PrevSeq != b.Seq {
+		return fmt.Errorf("%w: %s prevSeq %d, local seq %d", ErrDepthGap, b.Pair, u.PrevSeq, b.Seq)
+	}
+	for _, l := range u.Bids {
+		b.bids.set(l)
+	}
+	for _, l := range u.Asks {
+		b.asks.set(l)
+	}
+	b.Seq = u.Seq
+	return nil
+}
+
+// Levels 按价格优先顺序返回某侧档位：group 非 nil 时按粒度合并（数量与挂单数相加），limit > 0 时只取前 limit 档
+func (b *DepthBook) Levels(buy bool, limit int, group *big.Int) []PriceLevel {
+	out := []PriceLevel{}
+	var amounts []*big.Int
+	var last *big.Int
+	for _, l := range b.side(buy).sorted {
+		g := groupPrice(buy, l.price, group)
+		if last == nil || g.Cmp(last) != 0 {
+			if limit > 0 && len(out) == limit {
+				break
+			}
+			out = append(out, PriceLevel{Price: storage.FormatUnits(g)})
+			amounts = append(amounts, new(big.Int))
+			last = g
+		}
+		amounts[len(amounts)-1].Add(amounts[len(amounts)-1], l.amount)
+		out[len(out)-1].Orders += l.Orders
+	}
+	for i := range out {
+		out[i].Amount = storage.FormatUnits(amounts[i])
+	}
+	return out
+}
+
+// Level 返回合并档位 price（已按 group 取整）的当前数量；不存在时 Amount 为 "0"
+func (b *DepthBook) Level(buy bool, price, group *big.Int) PriceLevel {
+	s := b.side(buy)
+	out := PriceLevel{Price: storage.FormatUnits(price), Amount: "0"}
+	if group == nil {
+		if l, ok := s.levels[out.Price]; ok {
+			out = l.PriceLevel
+		}
+		return out
+	}
+	// 买盘合并档位覆盖 [price, price+group-1]，卖盘覆盖 [price-group+1, price]
+	lo, hi := price, new(big.Int).Add(price, group)
+	hi.Sub(hi, big.NewInt(1))
+	if !buy {
+		lo, hi = new(big.Int).Sub(price, group), price
+		lo.Add(lo, big.NewInt(1))
+	}
+	start := lo
+	if s.desc {
+		start = hi
+	}
+	amount := new(big.Int)
+	for i := s.search(start); i < len(s.sorted); i++ {
+		l := s.sorted[i]
+		if l.price.Cmp(lo) < 0 || l.price.Cmp(hi) > 0 {
+			break
+		}
+		amount.Add(amount, l.amount)
+		out.Orders += l.Orders
+	}
+	out.Amount = storage.FormatUnits(amount)
+	return out
+}
+
+// Snapshot 返回按档位数与粒度裁剪后的快照
+func (b *DepthBook) Snapshot(limit int, group *big.Int) *DepthSnapshot {
+	return &DepthSnapshot{Pair: b.Pair, Seq: b.Seq, Bids: b.Levels(true, limit, group), Asks: b.Levels(false, limit, group)}
+}
+
+func (b *DepthBook) side(buy bool) *depthSide {
+	if buy {
+		return b.bids
+	}
+	return b.asks
+}
+
+// before 判断价格 a 是否应排在 b 之前
+func (s *depthSide) before(a, b *big.Int) bool {
+	c := a.Cmp(b)
+	if s.desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// search 返回第一个不排在 price 之前的档位下标
+func (s *depthSide) search(price *big.Int) int {
+	return sort.Search(len(s.sorted), func(i int) bool { return !s.before(s.sorted[i].price, price) })
+}
+
+// set 写入档位；Amount 为 0 时删除
+func (s *depthSide) set(pl PriceLevel) {
+	price, ok := storage.ParseUnits(pl.Price)
+	if !ok {
+		return
+	}
+	amount, ok := storage.ParseUnits(pl.Amount)
+	if !ok {
+		amount = new(big.Int)
+	}
+	pl.Price = storage.FormatUnits(price)
+	l, exists := s.levels[pl.Price]
+	if amount.Sign() == 0 {
+		if exists {
+			delete(s.levels, pl.Price)
+			i := s.search(price)
+			s.sorted = append(s.sorted[:i], s.sorted[i+1:]...)
+		}
+		return
+	}
+	if exists {
+		l.amount, l.PriceLevel = amount, pl
+		return
+	}
+	l = &depthLevel{price: price, amount: amount, PriceLevel: pl}
+	s.levels[pl.Price] = l
+	i := s.search(price)
+	s.sorted = append(s.sorted, nil)
+	copy(s.sorted[i+1:], s.sorted[i:])
+	s.sorted[i] = l
+}
+
+// DepthView 单个订阅的行情视图：按档位数与价格粒度从 DepthBook 裁剪，记录已下发的档位以便只推送变化
+type DepthView struct {
+	Limit int
+	Group *big.Int
+	Seq   uint64                   // 已下发的最后一条增量（或快照）对应的订单簿序号
+	sent  [2]map[string]PriceLevel // 0=买盘 1=卖盘：已下发的档位
+}
+
+// NewDepthView 创建视图：limit 为每侧档位数（0 为全部），group 为 nil 时不合并价格
+func NewDepthView(limit int, group *big.Int) *DepthView {
+	return &DepthView{Limit: limit, Group: group}
+}
+
+// Snapshot 生成视图快照并以其为已下发状态（订阅与重新同步时调用）
+func (v *DepthView) Snapshot(b *DepthBook) *DepthSnapshot {
+	snap := b.Snapshot(v.Limit, v.Group)
+	v.Seq = snap.Seq
+	for i, levels := range [][]PriceLevel{snap.Bids, snap.Asks} {
+		v.sent[i] = make(map[string]PriceLevel, len(levels))
+		for _, l := range levels {
+			v.sent[i][l.Price] = l
+		}
+	}
+	return snap
+}
+
+// Update 在 b 应用增量 u 之后计算视图的变化：返回的增量 PrevSeq 为上一次下发的序号，视图无变化时返回 nil（序号不推进）
+// u 为 Reset 时应改为下发 Snapshot
+func (v *DepthView) Update(b *DepthBook, u *DepthUpdate) *DepthUpdate {
+	out := &DepthUpdate{Pair: b.Pair, Seq: b.Seq, PrevSeq: v.Seq}
+	for i, buy := range []bool{true, false} {
+		var changed []PriceLevel
+		if v.Limit > 0 {
+			changed = v.diffTop(i, b.Levels(buy, v.Limit, v.Group))
+		} else {
+			changed = v.diffLevels(i, b, buy, u)
+		}
+		if i == 0 {
+			out.Bids = changed
+		} else {
+			out.Asks = changed
+		}
+	}
+	if len(out.Bids) == 0 && len(out.Asks) == 0 {
+		return nil
+	}
+	v.Seq = out.Seq
+	return out
+}
+
+// diffTop 限定档位数的视图：与已下发的前 N 档比较，移出前 N 档的档位以 Amount "0" 下发
+func (v *DepthView) diffTop(side int, levels []PriceLevel) []PriceLevel {
+	changed := []PriceLevel{}
+	next := make(map[string]PriceLevel, len(levels))
+	for _, l := range levels {
+		next[l.Price] = l
+		if prev, ok := v.sent[side][l.Price]; !ok || prev != l {
+			changed = append(changed, l)
+		}
+	}
+	for _, price := range sortedKeys(v.sent[side]) {
+		if _, ok := next[price]; !ok {
+			changed = append(changed, PriceLevel{Price: price, Amount: "0"})
+		}
+	}
+	v.sent[side] = next
+	return changed
+}
+
+// diffLevels 全部档位的视图：只重新计算增量涉及的（合并）档位
+func (v *DepthView) diffLevels(side int, b *DepthBook, buy bool, u *DepthUpdate) []PriceLevel {
+	src := u.Bids
+	if !buy {
+		src = u.Asks
+	}
+	changed := []PriceLevel{}
+	seen := make(map[string]bool, len(src))
+	for _, raw := range src {
+		p, ok := storage.ParseUnits(raw.Price)
+		if !ok {
+			continue
+		}
+		g := groupPrice(buy, p, v.Group)
+		key := storage.FormatUnits(g)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		l := b.Level(buy, g, v.Group)
+		prev, had := v.sent[side][key]
+		if l.Amount == "0" {
+			if had {
+				delete(v.sent[side], key)
+				changed = append(changed, l)
+			}
+			continue
+		}
+		if !had || prev != l {
+			v.sent[side][key] = l
+			changed = append(changed, l)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,158 @@
+package match
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+)
+
+// DefaultQueueSize 每个交易对撮合输入队列的默认长度（config match.queue_size 为 0 时）
+const DefaultQueueSize = 1024
+
+// RetryAfter 队列已满时建议客户端的重试间隔（API 以 Retry-After 返回）
+const RetryAfter = time.Second
+
+var (
+	// ErrBackpressure 交易对撮合输入队列已满，调用方应稍后重试（API 返回 429）
+	ErrBackpressure = errors.New("match queue full")
+	// ErrDispatcherClosed 分派器已关闭（节点退出中，API 返回 503）
+	ErrDispatcherClosed = errors.New("match dispatcher closed")
+)
+
+// Dispatcher 撮合输入分派：每个交易对一个 worker goroutine 与有界队列，同一交易对的输入按入队顺序串行执行，
+// 不同交易对并行（引擎按交易对分片加锁，见 Engine）。队列满时立即返回 ErrBackpressure，不无限堆积；
+// 只为已上架的交易对创建队列与 worker，未上架交易对返回 ErrUnknownPair
+type Dispatcher struct {
+	size    int
+	listed  func(pair string) bool // 交易对是否已上架（通常为 Engine.HasPair），nil 为不检查
+	mu      sync.RWMutex           // 保护 queues 与 closed；入队的发送在锁外进行（阻塞的 SubmitWait 不影响其他交易对）
+	queues  map[string]chan func()
+	closed  bool
+	senders sync.WaitGroup // 进行中的入队，Close 等待其结束后再关闭队列
+	wg      sync.WaitGroup // worker
+}
+
+// NewDispatcher 创建分派器；size 为每个交易对的队列长度，<= 0 时使用 DefaultQueueSize；listed 判断交易对是否已上架，nil 为不检查
+func NewDispatcher(size int, listed func(pair string) bool) *Dispatcher {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &Dispatcher{size: size, listed: listed, queues: make(map[string]chan func())}
+}
+
+// Submit 将 fn 放入交易对队列，由该交易对的 worker 执行；队列满时返回 ErrBackpressure，不阻塞
+func (d *Dispatcher) Submit(pair string, fn func()) error {
+	return d.enqueue(nil, pair, fn)
+}
+
+// SubmitWait 同 Submit，但队列满时最多等待到 ctx 结束（gossip 入口：短暂阻塞订阅协程以减缓拉取），超时返回 ErrBackpressure
+func (d *Dispatcher) SubmitWait(ctx context.Context, pair string, fn func()) error {
+	return d.enqueue(ctx, pair, fn)
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, pair string, fn func()) error {
+	d.mu.RLock()
+	q, ok := d.queues[pair]
+	if !ok {
+		d.mu.RUnlock()
+		// 未上架交易对不建队列与 worker（任意 pair 字符串不能无限创建 goroutine）
+		if d.listed != nil && !d.listed(pair) {
+			return fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+		}
+		d.mu.Lock()
+		q = d.startLocked(pair)
+		d.mu.Unlock()
+		d.mu.RLock()
+	}
+	if d.closed {
+		d.mu.RUnlock()
+		return ErrDispatcherClosed
+	}
+	d.senders.Add(1)
+	d.mu.RUnlock()
+	defer d.senders.Done()
+
+	select {
+	case q <- fn:
+		metrics.RecordQueueDepth(pair, len(q))
+		return nil
+	default:
+	}
+	if ctx != nil {
+		select {
+		case q <- fn:
+			metrics.RecordQueueDepth(pair, len(q))
+			return nil
+		case <-ctx.Done():
+		}
+	}
+	metrics.RecordBackpressure(pair)
+	return fmt.Errorf("%w: %s", ErrBackpressure, pair)
+}
+
+// startLocked 返回交易对队列，不存在则创建并启动 worker（调用方需已持写锁；已关闭时返回 nil）
+func (d *Dispatcher) startLocked(pair string) chan func() {
+	if d.closed {
+		return nil
+	}
+	if q, ok := d.queues[pair]; ok {
+		return q
+	}
+	q := make(chan func(), d.size)
+	d.queues[pair] = q
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for fn := range q {
+			fn()
+			metrics.RecordQueueDepth(pair, len(q))
+		}
+	}()
+	return q
+}
+
+// Saturated 交易对队列是否已满（API 下单在发布前预检，满则返回 429）；预检不占用队列位置，
+// 发布后队列仍可能占满，此时订单在 gossip 入口由 SubmitWait 拒绝并以 rejected 状态异步通知
+func (d *Dispatcher) Saturated(pair string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	q, ok := d.queues[pair]
+	return ok && len(q) >= cap(q)
+}
+
+// Closed 分派器是否已关闭
+func (d *Dispatcher) Closed() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.closed
+}
+
+// QueueLen 返回交易对队列中等待执行的输入数
+func (d *Dispatcher) QueueLen(pair string) int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.queues[pair])
+}
+
+// Close 停止接收新输入，等待进行中的入队结束、各交易对已入队的输入执行完毕（节点退出时，在写最后一次快照之前调用）
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		d.wg.Wait()
+		return
+	}
+	d.closed = true
+	d.mu.Unlock()
+	d.senders.Wait()
+	d.mu.Lock()
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
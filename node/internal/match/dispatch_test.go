@@ -0,0 +1,146 @@
+package match
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func TestDispatcherBackpressureWhenQueueFull(t *testing.T) {
+	d := NewDispatcher(2, nil)
+	block, started := make(chan struct{}), make(chan struct{})
+	if err := d.Submit("TKA/TKB", func() { close(started); <-block }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	for i := 0; i < 2; i++ {
+		if err := d.Submit("TKA/TKB", func() {}); err != nil {
+			t.Fatalf("submit %d: %v", i, err)
+		}
+	}
+	if !d.Saturated("TKA/TKB") {
+		t.Error("queue should be saturated")
+	}
+	if err := d.Submit("TKA/TKB", func() {}); !errors.Is(err, ErrBackpressure) {
+		t.Errorf("full queue: err = %v, want ErrBackpressure", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.SubmitWait(ctx, "TKA/TKB", func() {}); !errors.Is(err, ErrBackpressure) {
+		t.Errorf("SubmitWait timeout: err = %v, want ErrBackpressure", err)
+	}
+	// 其他交易对不受影响
+	done := make(chan struct{})
+	if err := d.Submit("TKC/TKD", func() { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("other pair blocked by saturated queue")
+	}
+	close(block)
+	d.Close()
+	if err := d.Submit("TKA/TKB", func() {}); !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("after Close: err = %v, want ErrDispatcherClosed", err)
+	}
+}
+
+// 未上架交易对不创建队列与 worker
+func TestDispatcherRejectsUnlistedPair(t *testing.T) {
+	e := newTestEngine(t)
+	d := NewDispatcher(0, e.HasPair)
+	defer d.Close()
+	if err := d.Submit("FOO/BAR", func() {}); !errors.Is(err, ErrUnknownPair) {
+		t.Errorf("unlisted pair: err = %v, want ErrUnknownPair", err)
+	}
+	if _, ok := d.queues["FOO/BAR"]; ok {
+		t.Error("queue created for an unlisted pair")
+	}
+	if err := d.Submit(testPair, func() {}); err != nil {
+		t.Errorf("listed pair: %v", err)
+	}
+}
+
+func TestDispatcherPreservesPerPairOrder(t *testing.T) {
+	d := NewDispatcher(0, nil)
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	for i := 0; i < 100; i++ {
+		for _, pair := range []string{"A/B", "C/D"} {
+			pair, i := pair, i
+			if err := d.Submit(pair, func() {
+				mu.Lock()
+				got[pair] = append(got[pair], i)
+				mu.Unlock()
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	d.Close() // 等待已入队输入执行完毕
+	for pair, seq := range got {
+		if len(seq) != 100 {
+			t.Fatalf("%s executed %d inputs, want 100", pair, len(seq))
+		}
+		for i, v := range seq {
+			if v != i {
+				t.Fatalf("%s input %d executed at position %d", pair, v, i)
+			}
+		}
+	}
+}
+
+// 不同交易对并发撮合：成交、订单索引与统计在各交易对独立处理后保持一致（配合 go test -race）
+func TestEngineConcurrentPairs(t *testing.T) {
+	pairs := []string{"AAA/QQQ", "BBB/QQQ", "CCC/QQQ", "DDD/QQQ"}
+	tokens := make(map[string]PairTokens)
+	for _, p := range pairs {
+		tokens[p] = PairTokens{Token0: "0x" + p[:3], Token1: "0xq", Decimals0: 1}
+	}
+	e := NewEngine(tokens)
+	e.SetCurrentPeriod("2026-10-16")
+	d := NewDispatcher(0, nil)
+	const n = 50
+	var wg sync.WaitGroup
+	for pi, pair := range pairs {
+		wg.Add(1)
+		go func(pair string, nonce int64) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				ask := &storage.Order{OrderID: fmt.Sprintf("%s-a%d", pair, i), Trader: "0x1", Pair: pair, Side: "sell", Price: "100", Amount: "10", Filled: "0", Nonce: nonce, CreatedAt: int64(2 * i)}
+				bid := &storage.Order{OrderID: fmt.Sprintf("%s-b%d", pair, i), Trader: "0x2", Pair: pair, Side: "buy", Price: "100", Amount: "4", Filled: "0", Nonce: nonce, CreatedAt: int64(2*i + 1)}
+				for _, o := range []*storage.Order{ask, bid} {
+					o := o
+					if err := d.SubmitWait(context.Background(), pair, func() { e.Submit(o) }); err != nil {
+						t.Error(err)
+					}
+				}
+				e.GetOrderbook(pair)
+				e.OrderCount()
+			}
+		}(pair, int64(pi))
+	}
+	wg.Wait()
+	d.Close()
+	// 买单共 4n 按时间优先吃掉前 4n/10 笔卖单
+	resting := n - 4*n/10
+	for _, pair := range pairs {
+		_, asks := e.GetOrderbook(pair)
+		if len(asks) != resting {
+			t.Errorf("%s: %d resting asks, want %d", pair, len(asks), resting)
+		}
+	}
+	if got := e.OrderCount(); got != len(pairs)*resting {
+		t.Errorf("OrderCount = %d, want %d", got, len(pairs)*resting)
+	}
+	// 每笔买单 4 全部成交
+	if _, volume := e.GetPeriodStats("2026-10-16"); volume.Int64() != int64(4*n*len(pairs)) {
+		t.Errorf("period volume = %s, want %d", volume, 4*n*len(pairs))
+	}
+}
@@ -8,38 +8,96 @@ import (
 	"sync"
 	"time"
 
-	"github.com/P2P-P2P/p2p/node/internal/metrics"
 	"github.com/P2P-P2P/p2p/node/internal/storage"
 )
 
 // PairTokens 交易对对应的链上代币（用于结算）
 type PairTokens struct {
-	Token0 string // base，如 TKA
-	Token1 string // quote，如 TKB
+	Token0    string // base，如 TKA
+	Token1    string // quote，如 TKB
+	Decimals0 uint8  // base 代币精度，0 表示默认 18
+	Decimals1 uint8  // quote 代币精度，0 表示默认 18
+	// SelfTradePrevention 交易对默认自成交防护模式（见 storage.SelfTrade*），空为不防护
+	SelfTradePrevention string
+	// Rules 交易规则（tick/lot、数量上下限、最小成交额、价格带），在下单入口校验
+	Rules MarketRules
+	// Fees maker/taker 费率与成交额等级，撮合时填充 Trade.Fee / MakerFee / FeeToken
+	Fees FeeSchedule
+	// MatchingMode 撮合模式：continuous（默认）| batch（每 Epoch 统一价格批量拍卖，见 RunAuction）
+	MatchingMode string
+	// Breaker 波动保护：价格带与自动暂停（见 breaker.go）
+	Breaker CircuitBreaker
+}
+
+// BaseDecimals 返回 base 代币精度（未配置时为 storage.DefaultTokenDecimals）
+func (t PairTokens) BaseDecimals() uint8 {
+	if t.Decimals0 == 0 {
+		return storage.DefaultTokenDecimals
+	}
+	return t.Decimals0
+}
+
+// QuoteDecimals 返回 quote 代币精度（未配置时为 storage.DefaultTokenDecimals）
+func (t PairTokens) QuoteDecimals() uint8 {
+	if t.Decimals1 == 0 {
+		return storage.DefaultTokenDecimals
+	}
+	return t.Decimals1
 }
 
 // PeriodStats 某周期的撮合统计（贡献证明用）
 type PeriodStats struct {
 	Trades uint64
-	Volume *big.Int // 成交量最小单位（如 amount*1e18 之和）
+	Volume *big.Int // 成交量最小单位（base 最小单位 amount 之和）
+	Fees   map[string]*big.Int // 手续费代币 -> 净手续费（最小单位）
 }
 
 // Engine 单主撮合引擎：按交易对维护订单簿，Price-Time 优先
+//
+// 并发：每个交易对一个分片（pairShard），单交易对输入（下单、撮合、撤单、改单、过期、拍卖）持 mu 读锁并锁定该分片，
+// 不同交易对并行撮合；上架/下架、快照、跨交易对批量撤单等结构性操作持 mu 写锁。订单索引、周期统计、过期堆、
+// 日志序号与状态变化由各自的小锁保护，加锁顺序为 mu → 分片 → 小锁（小锁之间只有 expMu → idxMu）
 type Engine struct {
 	mu            sync.RWMutex
-	pairs         map[string]*OrderBook
+	shards        map[string]*pairShard
+	pairs         map[string]*OrderBook // 与分片同时创建
 	tokens        map[string]PairTokens // pair -> token0, token1
-	orderIDToPair map[string]string     // orderID -> pair，用于撤单
-	// 周期内撮合统计（贡献证明 40% 权重）
-	currentPeriod string
+	idxMu         sync.Mutex
+	orderIndex    map[string]orderRef // orderID -> 所在交易对与归属（签名哈希、trader、nonce），用于撤单与拒绝 orderId 冲突
+	nonceIndex    map[string]nonceRef // trader/nonce -> 所在交易对，拒绝同一 nonce 跨交易对复用
+	// trader/代币 -> 挂单占用合计与明细，随订单索引在入簿、成交、减量、撤单时更新
+	holds         map[balanceKey]*traderHolds
+	// 周期内撮合统计（贡献证明 40% 权重），由 statsMu 保护
+	statsMu        sync.Mutex
+	currentPeriod  string
 	currentTrades  uint64
 	currentVolume  *big.Int
+	currentFees    map[string]*big.Int
 	periodStats    map[string]*PeriodStats // 已结束周期缓存，供证明读取
-	// 性能优化：订单验证缓存（避免重复验证）
-	signatureCache map[string]bool // orderID -> 验证结果
-	cacheMu        sync.RWMutex
-	// 内存优化：订单簿大小限制
+	// 内存优化：订单簿大小限制（达到上限后拒绝新订单）
 	maxOrdersPerPair int
+	// 条件单待触发簿（与分片同时创建；最新成交价见 pairShard.lastTrade）
+	triggers map[string]*triggerBook
+	// 手续费等级：pair -> trader（小写）-> 近 30 天成交额快照（只在写锁下更新）
+	traderVolumes map[string]map[string]*big.Int
+	// 预写日志（由 jmu 保护）：journal 为空时不记录；seq 为最后应用的日志序号，now 为最近一次输入的引擎时钟，replaying 为回放中的事件
+	jmu       sync.Mutex
+	journal   *Journal
+	seq       uint64
+	now       int64
+	replaying *JournalEvent
+	clock     func() int64 // 墙钟（unix 秒），测试可替换
+	// 过期调度（由 expMu 保护）：按 ExpiresAt 排序的最小堆（惰性删除），撮合中发现的过期挂单暂存于 expiredPending，均由 SweepExpired 取出
+	expMu          sync.Mutex
+	expiries       expiryHeap
+	expiredPending []*storage.Order
+	expiryWake     chan struct{}
+	// 待 AdvancePairStates 取出的交易对状态变化（由 changesMu 保护；各交易对当前状态见 pairShard.status）
+	changesMu    sync.Mutex
+	stateChanges []*PairStateChange
+	// L2 增量与 L3 事件接收方（见 depth.go、l3.go；只在写锁下设置），在释放交易对锁之前按序调用
+	depthSink func(*DepthUpdate)
+	l3Sink    func([]*L3Event)
 }
 
 // NewEngine 创建撮合引擎
@@ -48,36 +106,58 @@ func NewEngine(pairTokens map[string]PairTokens) *Engine {
 		pairTokens = make(map[string]PairTokens)
 	}
 	e := &Engine{
+		shards:           make(map[string]*pairShard),
 		pairs:            make(map[string]*OrderBook),
 		tokens:           pairTokens,
-		orderIDToPair:    make(map[string]string),
+		orderIndex:       make(map[string]orderRef),
+		nonceIndex:       make(map[string]nonceRef),
+		holds:            make(map[balanceKey]*traderHolds),
 		currentVolume:    new(big.Int),
+		currentFees:      make(map[string]*big.Int),
 		periodStats:      make(map[string]*PeriodStats),
-		signatureCache:   make(map[string]bool, 1000), // 预分配缓存空间
 		maxOrdersPerPair: 10000,                        // 默认每个交易对最多10000个订单
+		triggers:         make(map[string]*triggerBook),
+		traderVolumes:    make(map[string]map[string]*big.Int),
+		clock:            func() int64 { return time.Now().Unix() },
+		expiryWake:       make(chan struct{}, 1),
 	}
 	return e
 }
 
+// SetMaxOrdersPerPair 设置每个交易对挂单上限（<=0 表示不限制）
+func (e *Engine) SetMaxOrdersPerPair(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.maxOrdersPerPair = n
+}
+
 // SetCurrentPeriod 设置当前统计周期；若与上次不同则保存旧周期统计并清零当前计数（由 runProofCheck 在每 tick 调用）
 func (e *Engine) SetCurrentPeriod(periodStr string) {
 	if periodStr == "" {
 		return
 	}
+	// 持写锁切换周期：进行中的撮合全部完成后才切换，回放时成交归属的周期与实时一致
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
 	if e.currentPeriod == periodStr {
 		return
 	}
+	if !e.recordLocked(nil, &JournalEvent{Type: EventPeriod, Period: periodStr}) {
+		return
+	}
 	if e.currentPeriod != "" {
 		e.periodStats[e.currentPeriod] = &PeriodStats{
 			Trades: e.currentTrades,
 			Volume: new(big.Int).Set(e.currentVolume),
+			Fees:   e.currentFees,
 		}
 	}
 	e.currentPeriod = periodStr
 	e.currentTrades = 0
 	e.currentVolume = new(big.Int)
+	e.currentFees = make(map[string]*big.Int)
 }
 
 // GetPairTokens 返回交易对对应的代币地址（用于签名验证）
@@ -92,8 +172,8 @@ func (e *Engine) GetPairTokens(pair string) *PairTokens {
 
 // GetPeriodStats 返回指定周期的撮合笔数与成交量（最小单位），供贡献证明使用
 func (e *Engine) GetPeriodStats(periodStr string) (trades uint64, volume *big.Int) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
 	vol := new(big.Int)
 	if e.currentPeriod == periodStr {
 		return e.currentTrades, vol.Set(e.currentVolume)
@@ -104,328 +184,347 @@ func (e *Engine) GetPeriodStats(periodStr string) (trades uint64, volume *big.In
 	return 0, vol
 }
 
-// addMatchStats 在 Match 内调用：累加当前周期笔数与成交量（调用方需已持锁）
+// addMatchStats 在 Match 内调用：累加当前周期笔数与成交量（由 statsMu 保护，各交易对分片可并发调用）
 func (e *Engine) addMatchStats(trades []*storage.Trade) {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
 	if len(trades) == 0 || e.currentPeriod == "" {
 		return
 	}
 	e.currentTrades += uint64(len(trades))
 	for _, t := range trades {
-		// 成交量：Amount 转为最小单位（*1e18）累加，与合约 CAP_VOLUME_MATCHED 一致
-		amt := bigNew(t.Amount)
-		if amt.Cmp(big.NewFloat(0)) <= 0 {
+		// 成交量：Amount 已是 base 最小单位整数，直接累加，与合约 CAP_VOLUME_MATCHED 一致
+		amt, ok := storage.ParseUnits(t.Amount)
+		if !ok || amt.Sign() <= 0 {
 			continue
 		}
-		amt.Mul(amt, big.NewFloat(1e18))
-		amtInt := new(big.Int)
-		amt.Int(amtInt)
-		e.currentVolume.Add(e.currentVolume, amtInt)
+		e.currentVolume.Add(e.currentVolume, amt)
+		// 净手续费 = taker 手续费 + maker 手续费（返佣为负）
+		if t.FeeToken != "" {
+			fee, ok := e.currentFees[t.FeeToken]
+			if !ok {
+				fee = new(big.Int)
+				e.currentFees[t.FeeToken] = fee
+			}
+			fee.Add(fee, storage.MustUnits(t.Fee))
+			if mf, ok := new(big.Int).SetString(t.MakerFee, 10); ok {
+				fee.Add(fee, mf)
+			}
+		}
 	}
 }
 
-// OrderBook 单交易对订单簿
-//
-// §12.2 确定性撮合：FIFO/价格优先
-// - Bids：买盘，按价格降序、同价按 CreatedAt 升序（FIFO）
-// - Asks：卖盘，按价格升序、同价按 CreatedAt 升序（FIFO）
-// 撮合时：taker 买则吃 asks 最低价；taker 卖则吃 bids 最高价；同价先到先得
-type OrderBook struct {
-	Pair string
-	Bids []*storage.Order // 买盘，按价格降序、时间升序
-	Asks []*storage.Order // 卖盘，按价格升序、时间升序
-}
-
-// EnsurePair 确保该交易对存在
-func (e *Engine) EnsurePair(pair string) {
+// EnsurePair 确保已上架交易对的订单簿存在；未上架（未配置且未运行时上架）的交易对不建簿，返回 false
+func (e *Engine) EnsurePair(pair string) bool {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	if _, ok := e.pairs[pair]; !ok {
-		e.pairs[pair] = &OrderBook{Pair: pair, Bids: nil, Asks: nil}
+	if _, ok := e.pairs[pair]; ok {
+		return true
+	}
+	if _, ok := e.tokens[pair]; !ok {
+		return false
 	}
+	if !e.recordLocked(nil, &JournalEvent{Type: EventPair, Pair: pair}) {
+		return false
+	}
+	e.shardLocked(pair)
+	return true
 }
 
-// GetOrderbook 返回某交易对的买卖盘副本（供 HTTP API 等只读使用）
+// GetOrderbook 返回某交易对的买卖盘副本（供 HTTP API 等只读使用）；买盘价格降序、卖盘价格升序，同价按时间升序（冰山单补充后排队尾）
 func (e *Engine) GetOrderbook(pair string) (bids, asks []*storage.Order) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-	ob, ok := e.pairs[pair]
-	if !ok {
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
 		return nil, nil
 	}
-	// 内存优化：预分配切片容量，减少内存分配
-	bids = make([]*storage.Order, 0, len(ob.Bids))
-	asks = make([]*storage.Order, 0, len(ob.Asks))
-	for _, o := range ob.Bids {
-		c := *o
-		bids = append(bids, &c)
-	}
-	for _, o := range ob.Asks {
-		c := *o
-		asks = append(asks, &c)
-	}
-	return bids, asks
-}
-
-// IsSignatureValid 检查订单签名是否有效（带缓存）
-func (e *Engine) IsSignatureValid(orderID string, order *storage.Order, pairTokens *PairTokens) (bool, error) {
-	// 检查缓存
-	e.cacheMu.RLock()
-	if cached, ok := e.signatureCache[orderID]; ok {
-		e.cacheMu.RUnlock()
-		metrics.RecordSignatureCacheHit()
-		return cached, nil
-	}
-	e.cacheMu.RUnlock()
-	metrics.RecordSignatureCacheMiss()
-	
-	// 验证签名
-	valid, err := VerifyOrderSignature(order, pairTokens)
-	if err != nil {
-		return false, err
-	}
-	
-	// 更新缓存（限制缓存大小）
-	e.cacheMu.Lock()
-	if len(e.signatureCache) < 10000 {
-		e.signatureCache[orderID] = valid
-	}
-	e.cacheMu.Unlock()
-	
-	return valid, nil
+	ob := e.pairs[pair]
+	// 冰山单只暴露当前可见量（HTTP 订单簿、WS 推送、订单簿同步快照均经由此处）
+	return ob.view(true), ob.view(false)
 }
 
-// ClearSignatureCache 清除签名缓存（定期清理过期缓存）
-func (e *Engine) ClearSignatureCache() {
-	e.cacheMu.Lock()
-	defer e.cacheMu.Unlock()
-	// 保留最近1000个缓存项
-	if len(e.signatureCache) > 1000 {
-		// 简单策略：清空缓存（实际可以保留最近使用的）
-		e.signatureCache = make(map[string]bool, 1000)
+// GetOrder 按 orderID 返回订单簿或触发簿中的订单副本；不存在返回 nil
+func (e *Engine) GetOrder(orderID string) *storage.Order {
+	pair := e.pairOf(orderID)
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return nil
+	}
+	if ob, ok := e.pairs[pair]; ok {
+		if o := ob.Get(orderID); o != nil {
+			c := *o
+			return &c
+		}
+	}
+	if tb, ok := e.triggers[pair]; ok {
+		if n, ok := tb.index[orderID]; ok {
+			c := *n.order
+			return &c
+		}
 	}
+	return nil
 }
 
 // AddOrder 将订单加入订单簿（未撮合部分）；同 orderID 先移除再插入；返回是否插入成功；已过期订单不加入（Replay/过期防护）
+// 订单簿已达 maxOrdersPerPair 时拒绝新订单（不再静默淘汰已有挂单）
+// 按 timeInForce：IOC/FOK 与市价单从不挂单；POST_ONLY 会与对手盘成交时拒绝（或按 PostOnlyReprice 改价后挂单）
+// 未激活条件单放入触发簿（用于重启恢复），不在此激活；未上架交易对（ErrUnknownPair）不建簿，返回 false
 func (e *Engine) AddOrder(o *storage.Order) bool {
-	if o.OrderID == "" || o.Pair == "" || o.Side == "" || o.Price == "" || o.Amount == "" {
+	sh, unlock := e.lockPair(o.Pair)
+	defer unlock()
+	if sh == nil {
 		return false
 	}
-	if storage.OrderExpired(o) {
+	// 不覆盖其他订单占有的同 orderId 订单，不接受已在其他交易对使用的 nonce（拒绝的订单不写日志）
+	if e.claimOrderID(o, o.Pair) != nil {
 		return false
 	}
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	// 同 orderID 先移除（避免重复挂单）
-	if ob, ok := e.pairs[o.Pair]; ok {
-		removeOrderFromBook(ob, o.OrderID)
+	defer e.releaseOrderID(o.OrderID)
+	if !e.recordLocked(sh, &JournalEvent{Type: EventAdd, Order: o}) {
+		return false
 	}
-	ob, ok := e.pairs[o.Pair]
-	if !ok {
-		ob = &OrderBook{Pair: o.Pair}
-		e.pairs[o.Pair] = ob
+	return e.addLocked(o)
+}
+
+// addLocked AddOrder 的持锁实现（调用方需已锁定 o.Pair 分片）
+func (e *Engine) addLocked(o *storage.Order) bool {
+	if o.OrderID == "" || o.Pair == "" || o.Side == "" || o.Price == "" || o.Amount == "" {
+		return false
 	}
-	filled := bigNew(o.Filled)
-	amount := bigNew(o.Amount)
-	left := new(big.Float).Sub(amount, filled)
-	if left.Cmp(big.NewFloat(0)) <= 0 {
+	if storage.OrderExpiredAt(o, e.nowLocked(o.Pair)) {
 		return false
 	}
-	e.orderIDToPair[o.OrderID] = o.Pair
-	o2 := *o
-	o2.Filled = "0"
-	o2.Amount = left.Text('f', 18)
-	// 内存管理优化：限制订单簿大小
-	if o.Side == "buy" {
-		if len(ob.Bids) >= e.maxOrdersPerPair {
-			// 移除最旧的订单（价格最低或时间最晚）
-			if len(ob.Bids) > 0 {
-				ob.Bids = ob.Bids[:len(ob.Bids)-1]
-			}
-		}
-		ob.Bids = append(ob.Bids, &o2)
-		// 算法优化：使用更高效的插入排序（对于已排序列表，插入排序比完整排序更快）
-		e.insertOrderSorted(ob.Bids, true)
-	} else {
-		if len(ob.Asks) >= e.maxOrdersPerPair {
-			if len(ob.Asks) > 0 {
-				ob.Asks = ob.Asks[:len(ob.Asks)-1]
-			}
-		}
-		ob.Asks = append(ob.Asks, &o2)
-		e.insertOrderSorted(ob.Asks, false)
+	// 市价单只作为 taker，不挂单
+	if o.IsMarket() {
+		return false
 	}
-	return true
-}
-
-// insertOrderSorted 将订单插入到已排序的列表中（优化：O(n)插入而非O(n log n)排序）
-func (e *Engine) insertOrderSorted(orders []*storage.Order, isBids bool) {
-	if len(orders) <= 1 {
-		return
+	// 未激活条件单进入触发簿而非订单簿
+	if o.IsPendingTrigger() {
+		return e.parkTriggerLocked(o)
 	}
-	// 找到插入位置
-	newOrder := orders[len(orders)-1]
-	newPrice := bigNew(newOrder.Price)
-	insertIdx := len(orders) - 1
-	
-	for i := len(orders) - 2; i >= 0; i-- {
-		price := bigNew(orders[i].Price)
-		var shouldSwap bool
-		if isBids {
-			shouldSwap = newPrice.Cmp(price) > 0 || (newPrice.Cmp(price) == 0 && newOrder.CreatedAt < orders[i].CreatedAt)
-		} else {
-			shouldSwap = newPrice.Cmp(price) < 0 || (newPrice.Cmp(price) == 0 && newOrder.CreatedAt < orders[i].CreatedAt)
-		}
-		if shouldSwap {
-			orders[i+1], orders[i] = orders[i], orders[i+1]
-			insertIdx = i
-		} else {
-			break
+	switch o.EffectiveTimeInForce() {
+	case storage.TimeInForceIOC, storage.TimeInForceFOK:
+		return false
+	}
+	o2, ok := restingCopy(o)
+	if !ok {
+		return false
+	}
+	ob := e.pairs[o.Pair]
+	price := storage.MustUnits(o2.Price)
+	if o.EffectiveTimeInForce() == storage.TimeInForcePostOnly {
+		if price, ok = postOnlyPrice(ob, o, price); !ok {
+			return false
 		}
+		o2.Price = storage.FormatUnits(price)
 	}
-}
+	// 同 orderID 先移除（避免重复挂单）
+	replaced := ob.remove(o.OrderID)
+	if !replaced && e.maxOrdersPerPair > 0 && ob.Len() >= e.maxOrdersPerPair {
+		log.Printf("[match] pair=%s 订单簿已满（%d），拒绝 orderId=%s", o.Pair, e.maxOrdersPerPair, o.OrderID)
+		return false
+	}
+	ob.insert(o2, price)
+	e.indexOrder(o2, o.Pair)
+	e.scheduleExpiryLocked(o2)
+	return true
 }
 
 // ReplaceOrderbook 用给定买卖盘替换某交易对的订单簿（用于 1.2 订单簿同步）；跳过已过期订单
-func (e *Engine) ReplaceOrderbook(pair string, bids, asks []*storage.Order) {
+// 同步快照不含冰山单隐藏量，本地无该订单时只能恢复可见部分；未上架（未配置且未运行时上架）的交易对不建簿，返回 false
+func (e *Engine) ReplaceOrderbook(pair string, bids, asks []*storage.Order) bool {
 	if pair == "" {
-		return
+		return false
 	}
 	e.mu.Lock()
-	defer e.mu.Unlock()
-	// 清除该 pair 下原有订单的 orderIDToPair
-	if ob, ok := e.pairs[pair]; ok {
-		for _, o := range ob.Bids {
-			delete(e.orderIDToPair, o.OrderID)
-		}
-		for _, o := range ob.Asks {
-			delete(e.orderIDToPair, o.OrderID)
-		}
+	defer e.unlockWrite()
+	if _, ok := e.tokens[pair]; !ok {
+		return false
 	}
-	ob := &OrderBook{Pair: pair}
-	for _, o := range bids {
-		if o == nil || o.OrderID == "" || storage.OrderExpired(o) {
-			continue
-		}
-		amount := bigNew(o.Amount)
-		filled := bigNew(o.Filled)
-		left := new(big.Float).Sub(amount, filled)
-		if left.Cmp(big.NewFloat(0)) <= 0 {
-			continue
-		}
-		o2 := *o
-		o2.Filled = "0"
-		o2.Amount = left.Text('f', 18)
-		ob.Bids = append(ob.Bids, &o2)
-		e.orderIDToPair[o.OrderID] = pair
+	if !e.recordLocked(e.shardLocked(pair), &JournalEvent{Type: EventReplaceBook, Pair: pair, Bids: bids, Asks: asks}) {
+		return false
 	}
-	for _, o := range asks {
-		if o == nil || o.OrderID == "" || storage.OrderExpired(o) {
-			continue
+	// 清除该 pair 下原有订单的索引
+	old := e.pairs[pair]
+	for id := range old.index {
+		e.unindexOrder(id)
+	}
+	ob := newOrderBook(pair)
+	// 整体替换：沿用行情序号（新订单簿下一次发布全量）
+	ob.depthSeq, ob.l3Seq = old.depthSeq, old.l3Seq
+	load := func(orders []*storage.Order, side string) {
+		resting := make([]*storage.Order, 0, len(orders))
+		for _, o := range orders {
+			if o == nil || o.OrderID == "" || storage.OrderExpiredAt(o, e.nowLocked(pair)) {
+				continue
+			}
+			// 同 orderId 属于其他订单或在其他交易对、nonce 已在其他交易对使用：不覆盖（持写锁，校验与登记之间无并发输入）
+			if e.CheckOrderOwner(o) != nil {
+				continue
+			}
+			o2, ok := restingCopy(o)
+			if !ok {
+				continue
+			}
+			o2.Side = side
+			resting = append(resting, o2)
 		}
-		amount := bigNew(o.Amount)
-		filled := bigNew(o.Filled)
-		left := new(big.Float).Sub(amount, filled)
-		if left.Cmp(big.NewFloat(0)) <= 0 {
-			continue
+		// 按排队时间升序插入，使各档位队列直接尾部追加
+		sort.SliceStable(resting, func(i, j int) bool {
+			return resting[i].PriorityTime() < resting[j].PriorityTime()
+		})
+		for _, o2 := range resting {
+			// 快照中的冰山单只含可见量：本地已有同一订单时沿用本地剩余量（含隐藏量）与可见量
+			var prev *bookOrder
+			if o2.IsIceberg() {
+				if n, ok := old.index[o2.OrderID]; ok && n.visible != nil {
+					prev = n
+					o2.Amount = storage.FormatUnits(n.order.Remaining())
+				}
+			}
+			ob.remove(o2.OrderID)
+			ob.insert(o2, storage.MustUnits(o2.Price))
+			if prev != nil {
+				n := ob.index[o2.OrderID]
+				n.visible = minUnits(prev.visible, o2.Remaining())
+			}
+			e.indexOrder(o2, pair)
+			e.scheduleExpiryLocked(o2)
 		}
-		o2 := *o
-		o2.Filled = "0"
-		o2.Amount = left.Text('f', 18)
-		ob.Asks = append(ob.Asks, &o2)
-		e.orderIDToPair[o.OrderID] = pair
 	}
-	// 算法优化：使用稳定的排序算法，减少比较次数
-	e.sortOrdersOptimized(ob.Bids, true)
-	e.sortOrdersOptimized(ob.Asks, false)
+	load(bids, "buy")
+	load(asks, "sell")
 	e.pairs[pair] = ob
+	return true
 }
 
-// sortOrdersOptimized 优化的排序函数（使用稳定的排序算法）
-func (e *Engine) sortOrdersOptimized(orders []*storage.Order, isBids bool) {
-	if len(orders) <= 1 {
-		return
-	}
-	// 使用稳定的排序，保持相同价格的订单按时间顺序
-	sort.SliceStable(orders, func(i, j int) bool {
-		pi, pj := bigNew(orders[i].Price), bigNew(orders[j].Price)
-		cmp := pi.Cmp(pj)
-		if cmp != 0 {
-			if isBids {
-				return cmp > 0 // 买盘：价格降序
-			}
-			return cmp < 0 // 卖盘：价格升序
+// RemoveOrder 从订单簿移除订单（撤单）；若 pair 为空则按 orderID 查找；同时覆盖触发簿中的待触发条件单
+func (e *Engine) RemoveOrder(pair, orderID string) bool {
+	ev := &JournalEvent{Type: EventCancel, Pair: pair, OrderID: orderID}
+	if pair == "" {
+		pair = e.pairOf(orderID)
+	}
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		// 未知交易对或订单不在索引中：持写锁在所有交易对中查找
+		e.mu.Lock()
+		defer e.unlockWrite()
+		if !e.recordLocked(nil, ev) {
+			return false
 		}
-		return orders[i].CreatedAt < orders[j].CreatedAt // 同价按时间升序
-	})
+		return e.removeLocked(pair, orderID)
+	}
+	if !e.recordLocked(sh, ev) {
+		return false
+	}
+	return e.removeLocked(pair, orderID)
 }
 
-// RemoveOrder 从订单簿移除订单（撤单）；若 pair 为空则按 orderID 查找
-func (e *Engine) RemoveOrder(pair, orderID string) bool {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+// removeLocked 从订单簿、触发簿或待清算拍卖队列移除订单；调用方需已锁定 pair 分片并写入日志，
+// pair 为空时在所有交易对中查找（调用方需已持写锁）
+func (e *Engine) removeLocked(pair, orderID string) bool {
 	if pair == "" {
-		pair = e.orderIDToPair[orderID]
-		delete(e.orderIDToPair, orderID)
+		pair = e.pairOf(orderID)
+	}
+	removeFrom := func(p string) bool {
+		ok := false
+		if ob, exists := e.pairs[p]; exists && ob.remove(orderID) {
+			ok = true
+		}
+		if tb, exists := e.triggers[p]; exists && tb.remove(orderID) {
+			ok = true
+		}
+		if e.removeAuctionIOCLocked(p, orderID) {
+			ok = true
+		}
+		return ok
 	}
 	if pair == "" {
-		for p, ob := range e.pairs {
-			if removeOrderFromBook(ob, orderID) {
+		for p := range e.shards {
+			if removeFrom(p) {
+				e.unindexOrder(orderID)
 				return true
 			}
-			_ = p
 		}
 		return false
 	}
-	ob, ok := e.pairs[pair]
-	if !ok {
-		return false
-	}
-	ok = removeOrderFromBook(ob, orderID)
+	ok := removeFrom(pair)
 	if ok {
-		delete(e.orderIDToPair, orderID)
+		e.unindexOrder(orderID)
 	}
 	return ok
 }
 
-func removeOrderFromBook(ob *OrderBook, orderID string) bool {
-	// 内存优化：使用更高效的删除方式（避免不必要的内存分配）
-	remove := func(orders []*storage.Order) []*storage.Order {
-		for i, o := range orders {
-			if o.OrderID == orderID {
-				// 使用切片技巧快速删除
-				return append(orders[:i], orders[i+1:]...)
-			}
-		}
-		return orders
+// Match 用 taker 订单与对手盘撮合，返回成交列表并更新订单簿内订单的 filled/status
+//
+// 全程使用最小单位整数运算（见 storage/units.go）：相同订单簿与 taker 输入在任意节点产生逐字节一致的成交
+// 市价单：吃对手盘直至 Amount 或 quote 预算（仅买单）用尽、或超出滑点上限，剩余部分撤销（status=cancelled），不挂单
+// timeInForce：IOC 剩余撤销；FOK 无法全部成交时拒绝（status=rejected，订单簿不变）；POST_ONLY 不吃单
+// Match 不挂单，剩余部分挂单见 Submit；成交穿越触发价时激活条件单，其成交追加在返回列表之后
+// 自成交防护撤销/减量的挂单不在返回值中，需要推送订单状态时使用 Submit；未上架交易对（ErrUnknownPair）不建簿，返回空
+func (e *Engine) Match(taker *storage.Order) (trades []*storage.Trade) {
+	sh, unlock := e.lockPair(taker.Pair)
+	defer unlock()
+	if sh == nil {
+		return nil
+	}
+	if !e.recordLocked(sh, &JournalEvent{Type: EventMatch, Order: taker}) {
+		return nil
+	}
+	if e.pairStateLocked(taker.Pair) != PairTrading {
+		return nil
+	}
+	trades, _ = e.matchLocked(taker)
+	if len(trades) > 0 {
+		res := &SubmitResult{}
+		e.activateTriggersLocked(taker.Pair, res)
+		trades = append(trades, res.Trades...)
 	}
-	before := len(ob.Bids) + len(ob.Asks)
-	ob.Bids = remove(ob.Bids)
-	ob.Asks = remove(ob.Asks)
-	return len(ob.Bids)+len(ob.Asks) < before
+	return trades
 }
 
-// Match 用 taker 订单与对手盘撮合，返回成交列表并更新订单簿内订单的 filled/status
-func (e *Engine) Match(taker *storage.Order) (trades []*storage.Trade) {
+// matchLocked Match 的持锁实现（调用方需已锁定 taker.Pair 分片）
+// 同一 trader 的 taker 与挂单相遇时按自成交防护模式处理，不产生成交；prevented 为被撤销或减量的挂单副本
+// 指标与日志暂存于分片，释放锁后上报（见 lockPair）
+func (e *Engine) matchLocked(taker *storage.Order) (trades []*storage.Trade, prevented []*storage.Order) {
+	rep := matchReport{pair: taker.Pair, taker: taker.OrderID}
 	t0 := time.Now()
-	defer func() { metrics.RecordMatch(len(trades), time.Since(t0)) }()
-	if taker.OrderID == "" || taker.Pair == "" || taker.Side == "" || taker.Price == "" || taker.Amount == "" {
-		return nil
+	defer func() {
+		rep.trades, rep.elapsed = len(trades), time.Since(t0)
+		e.reportLocked(rep)
+	}()
+	if taker.OrderID == "" || taker.Pair == "" || taker.Side == "" {
+		return nil, nil
 	}
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	ob, ok := e.pairs[taker.Pair]
-	if !ok {
-		ob = &OrderBook{Pair: taker.Pair}
-		e.pairs[taker.Pair] = ob
+	market := taker.IsMarket()
+	// takerPrice 为限价（市价单为滑点上限价，无上限时为 nil）；budget 为市价买单 quote 预算（nil 为不限）
+	var takerPrice, budget *big.Int
+	if market {
+		var err error
+		if budget, err = ValidateMarketOrder(taker); err != nil {
+			return nil, nil
+		}
+	} else {
+		p, ok := storage.ParseUnits(taker.Price)
+		if !ok || p.Sign() <= 0 || taker.Amount == "" {
+			return nil, nil
+		}
+		takerPrice = p
 	}
+	ob := e.pairs[taker.Pair]
 	tokens := e.tokens[taker.Pair]
-	takerLeft := bigNew(taker.Amount)
-	takerFilled := bigNew(taker.Filled)
-	takerLeft.Sub(takerLeft, takerFilled)
-	if takerLeft.Cmp(big.NewFloat(0)) <= 0 {
-		return nil
+	baseDecimals := tokens.BaseDecimals()
+	takerLeft := taker.Remaining()
+	takerFilled := storage.MustUnits(taker.Filled)
+	// 按预算的市价买单可不指定 base 数量
+	unbounded := market && storage.MustUnits(taker.Amount).Sign() == 0
+	if takerLeft.Sign() <= 0 && !unbounded {
+		return nil, nil
 	}
-	now := time.Now().Unix()
+	// 成交时间取引擎时钟（写入日志、回放时复现），不取客户端可控的订单时间字段，保证多节点结果一致
+	ts := e.nowLocked(taker.Pair)
 	// 确定性 TradeID：相同输入产生相同 ID，便于多节点共识时结果一致（清单 1.2 撮合结果不一致）
 	tradeSeq := 0
 	genTradeID := func(makerOrderID string) string {
@@ -433,137 +532,192 @@ func (e *Engine) Match(taker *storage.Order) (trades []*storage.Trade) {
 		return fmt.Sprintf("%s-%s-%d", taker.OrderID, makerOrderID, tradeSeq)
 	}
 
-	if taker.Side == "buy" {
-		// taker 买，吃卖盘（asks 最低价优先）
-		for len(ob.Asks) > 0 && takerLeft.Cmp(big.NewFloat(0)) > 0 {
-			maker := ob.Asks[0]
-			makerPrice := bigNew(maker.Price)
-			takerPrice := bigNew(taker.Price)
-			if takerPrice.Cmp(makerPrice) < 0 {
-				break
-			}
-			makerLeft := bigNew(maker.Amount)
-			makerFilled := bigNew(maker.Filled)
-			makerLeft.Sub(makerLeft, makerFilled)
-			if makerLeft.Cmp(big.NewFloat(0)) <= 0 {
-				ob.Asks = ob.Asks[1:]
-				continue
-			}
-			// 成交量 = min(takerLeft, makerLeft)
-			qty := new(big.Float).Set(takerLeft)
-			if makerLeft.Cmp(qty) < 0 {
-				qty.Set(makerLeft)
-			}
-			price := makerPrice
-			amountIn := qty
-			amountOut := new(big.Float).Mul(qty, price)
-			t := &storage.Trade{
-				TradeID:      genTradeID(maker.OrderID),
-				Pair:         taker.Pair,
-				MakerOrderID: maker.OrderID,
-				TakerOrderID: taker.OrderID,
-				Maker:        maker.Trader,
-				Taker:        taker.Trader,
-				TokenIn:      tokens.Token0,
-				TokenOut:     tokens.Token1,
-				AmountIn:     amountIn.Text('f', 18),
-				AmountOut:    amountOut.Text('f', 18),
-				Price:        price.Text('f', 18),
-				Amount:       qty.Text('f', 18),
-				Timestamp:    now,
-			}
-			trades = append(trades, t)
-			takerLeft.Sub(takerLeft, qty)
-			takerFilled.Add(takerFilled, qty)
-			makerFilled.Add(makerFilled, qty)
-			maker.Filled = makerFilled.Text('f', 18)
-			if makerLeft.Cmp(qty) == 0 {
-				maker.Status = "filled"
-				ob.Asks = ob.Asks[1:]
-			} else {
-				maker.Status = "partial"
-			}
+	takerBuy := taker.Side == "buy"
+	if market && taker.MaxSlippageBps > 0 {
+		if _, bestPrice := ob.best(!takerBuy); bestPrice != nil {
+			takerPrice = slippageLimitPrice(bestPrice, takerBuy, taker.MaxSlippageBps)
 		}
-		taker.Filled = takerFilled.Text('f', 18)
-		if takerLeft.Cmp(big.NewFloat(0)) <= 0 {
-			taker.Status = "filled"
+	}
+	// 价格带：限价收紧到参考价上下 PriceBandBps 内；原限价可继续成交的剩余部分在撮合后撤销，不挂单
+	limitPrice := takerPrice
+	if band := e.bandLimitLocked(taker.Pair, takerBuy); band != nil &&
+		(takerPrice == nil || takerBuy && band.Cmp(takerPrice) < 0 || !takerBuy && band.Cmp(takerPrice) > 0) {
+		takerPrice = band
+	}
+	tif := taker.EffectiveTimeInForce()
+	stp := e.selfTradeModeLocked(taker)
+	switch tif {
+	case storage.TimeInForcePostOnly:
+		// 只做 maker：会吃单则拒绝或改价；不产生成交，挂单由 Submit/AddOrder 完成
+		if p, ok := postOnlyPrice(ob, taker, takerPrice); !ok {
+			taker.Status = storage.OrderStatusRejected
 		} else {
-			taker.Status = "partial"
+			taker.Price = storage.FormatUnits(p)
+			taker.Status = takerRestingStatus(takerFilled)
 		}
-	} else {
-		// taker 卖，吃买盘（bids 最高价优先）；maker 买 Token0 用 Token1，故 tokenIn=Token1, tokenOut=Token0
-		for len(ob.Bids) > 0 && takerLeft.Cmp(big.NewFloat(0)) > 0 {
-			maker := ob.Bids[0]
-			makerPrice := bigNew(maker.Price)
-			takerPrice := bigNew(taker.Price)
-			if takerPrice.Cmp(makerPrice) > 0 {
-				break
+		return nil, nil
+	case storage.TimeInForceFOK:
+		// 全部成交或拒绝：预检对手盘可成交量，不足（或启用自成交防护且会遇到自己的挂单）则不做任何修改
+		self := ""
+		if stp != "" {
+			self = taker.Trader
+		}
+		if !ob.canFill(!takerBuy, takerPrice, takerLeft, self) {
+			taker.Status = storage.OrderStatusRejected
+			return nil, nil
+		}
+	}
+	budgetExhausted, takerCancelled := false, false
+	for unbounded || takerLeft.Sign() > 0 {
+		// taker 买吃卖盘最低价；taker 卖吃买盘最高价
+		node := ob.bestNode(!takerBuy)
+		if node == nil {
+			break
+		}
+		maker, makerPrice := node.order, node.level.price
+		if takerPrice != nil && (takerBuy && takerPrice.Cmp(makerPrice) < 0 || !takerBuy && takerPrice.Cmp(makerPrice) > 0) {
+			break
+		}
+		makerLeft := maker.Remaining()
+		if makerLeft.Sign() <= 0 {
+			ob.remove(maker.OrderID)
+			e.unindexOrder(maker.OrderID)
+			continue
+		}
+		if storage.OrderExpiredAt(maker, e.nowLocked(taker.Pair)) {
+			// 已过期但尚未被调度器移除的挂单：不参与撮合，移除后交由 SweepExpired 上报
+			expired := e.expireLocked(maker.OrderID)
+			e.expMu.Lock()
+			e.expiredPending = append(e.expiredPending, expired)
+			e.expMu.Unlock()
+			e.wakeExpiry()
+			continue
+		}
+		if stp != "" && sameTrader(maker, taker) {
+			// 自成交防护：不成交，按模式撤销/减量，以订单状态更新代替成交推送
+			st := resolveSelfTrade(stp, takerLeft, makerLeft, unbounded)
+			if st.decrement != nil {
+				decrementOrder(taker, st.decrement)
+				takerLeft.Sub(takerLeft, st.decrement)
+				if !st.cancelMaker {
+					decrementOrder(maker, st.decrement)
+					ob.reduce(node)
+					e.refreshHold(maker)
+				}
 			}
-			makerLeft := bigNew(maker.Amount)
-			makerFilled := bigNew(maker.Filled)
-			makerLeft.Sub(makerLeft, makerFilled)
-			if makerLeft.Cmp(big.NewFloat(0)) <= 0 {
-				ob.Bids = ob.Bids[1:]
-				continue
+			if st.cancelMaker {
+				maker.Status = storage.OrderStatusCancelled
+				ob.remove(maker.OrderID)
+				e.unindexOrder(maker.OrderID)
 			}
-			qty := new(big.Float).Set(takerLeft)
-			if makerLeft.Cmp(qty) < 0 {
-				qty.Set(makerLeft)
+			c := *maker
+			prevented = append(prevented, &c)
+			if st.cancelTaker {
+				takerCancelled = true
+				break
 			}
-			price := makerPrice
-			amountIn := qty
-			amountOut := new(big.Float).Mul(qty, price)
-			t := &storage.Trade{
-				TradeID:      genTradeID(maker.OrderID),
-				Pair:         taker.Pair,
-				MakerOrderID: maker.OrderID,
-				TakerOrderID: taker.OrderID,
-				Maker:        maker.Trader,
-				Taker:        taker.Trader,
-				TokenIn:      tokens.Token1,
-				TokenOut:     tokens.Token0,
-				AmountIn:     amountOut.Text('f', 18),
-				AmountOut:    amountIn.Text('f', 18),
-				Price:        price.Text('f', 18),
-				Amount:       qty.Text('f', 18),
-				Timestamp:    now,
+			continue
+		}
+		// 成交量 = min(takerLeft, maker 可成交量)，成交价为 maker 价；冰山单每轮只成交可见部分
+		makerAvail := node.available(makerLeft)
+		qty := makerAvail
+		if !unbounded {
+			qty = minUnits(takerLeft, makerAvail)
+		}
+		price := makerPrice
+		if budget != nil {
+			// 预算可买数量 = budget * 10^base精度 / price（向下取整，保证 quote <= budget）
+			affordable := new(big.Int).Mul(budget, storage.Pow10(baseDecimals))
+			affordable.Quo(affordable, price)
+			if affordable.Sign() <= 0 {
+				budgetExhausted = true
+				break
 			}
-			trades = append(trades, t)
+			qty = minUnits(qty, affordable)
+		}
+		quote := storage.QuoteAmount(qty, price, baseDecimals)
+		t := &storage.Trade{
+			TradeID:      genTradeID(maker.OrderID),
+			Pair:         taker.Pair,
+			MakerOrderID: maker.OrderID,
+			TakerOrderID: taker.OrderID,
+			Maker:        maker.Trader,
+			Taker:        taker.Trader,
+			Price:        storage.FormatUnits(price),
+			Amount:       storage.FormatUnits(qty),
+			Timestamp:    ts,
+		}
+		if takerBuy {
+			// maker 卖 Token0 换 Token1
+			t.TokenIn, t.TokenOut = tokens.Token0, tokens.Token1
+			t.AmountIn, t.AmountOut = storage.FormatUnits(qty), storage.FormatUnits(quote)
+		} else {
+			// maker 买 Token0 用 Token1，故 tokenIn=Token1, tokenOut=Token0
+			t.TokenIn, t.TokenOut = tokens.Token1, tokens.Token0
+			t.AmountIn, t.AmountOut = storage.FormatUnits(quote), storage.FormatUnits(qty)
+		}
+		e.applyFeesLocked(t, tokens, quote)
+		trades = append(trades, t)
+		if !unbounded {
 			takerLeft.Sub(takerLeft, qty)
-			takerFilled.Add(takerFilled, qty)
-			makerFilled.Add(makerFilled, qty)
-			maker.Filled = makerFilled.Text('f', 18)
-			if makerLeft.Cmp(qty) == 0 {
-				maker.Status = "filled"
-				ob.Bids = ob.Bids[1:]
-			} else {
-				maker.Status = "partial"
-			}
 		}
-		taker.Filled = takerFilled.Text('f', 18)
-		if takerLeft.Cmp(big.NewFloat(0)) <= 0 {
-			taker.Status = "filled"
+		takerFilled.Add(takerFilled, qty)
+		if budget != nil {
+			budget.Sub(budget, quote)
+		}
+		maker.Filled = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(maker.Filled), qty))
+		if makerLeft.Cmp(qty) == 0 {
+			maker.Status = storage.OrderStatusFilled
+			e.unindexOrder(maker.OrderID)
 		} else {
-			taker.Status = "partial"
+			maker.Status = storage.OrderStatusPartial
+		}
+		ob.fill(node, qty, ts)
+		e.refreshHold(maker)
+		if e.tripBreakerLocked(taker.Pair, price, ts) {
+			// 熔断：交易对已暂停，taker 剩余部分撤销
+			takerCancelled = unbounded || takerLeft.Sign() > 0
+			break
 		}
 	}
-
-	// 清理已完全成交的档位
-	ob.Bids = trimFilled(ob.Bids)
-	ob.Asks = trimFilled(ob.Asks)
+	if !takerCancelled && (unbounded || takerLeft.Sign() > 0) && takerPrice != limitPrice {
+		// 价格带截断：对手盘在原限价内仍有挂单时撤销剩余，避免挂单与对手盘交叉
+		if _, best := ob.best(!takerBuy); best != nil && (limitPrice == nil || takerBuy && limitPrice.Cmp(best) >= 0 || !takerBuy && limitPrice.Cmp(best) <= 0) {
+			takerCancelled = true
+		}
+	}
+	taker.Filled = storage.FormatUnits(takerFilled)
+	switch {
+	case takerCancelled:
+		// 自成交防护撤销 taker 剩余部分（已成交部分保留）
+		taker.Status = storage.OrderStatusCancelled
+	case market:
+		// 市价单不挂单：数量或预算用尽为 filled，否则剩余撤销
+		if takerFilled.Sign() > 0 && (budgetExhausted || !unbounded && takerLeft.Sign() <= 0) {
+			taker.Status = storage.OrderStatusFilled
+		} else {
+			taker.Status = storage.OrderStatusCancelled
+		}
+	case takerLeft.Sign() <= 0:
+		taker.Status = storage.OrderStatusFilled
+	case tif == storage.TimeInForceIOC:
+		// 立即成交，剩余撤销
+		taker.Status = storage.OrderStatusCancelled
+	default:
+		taker.Status = takerRestingStatus(takerFilled)
+	}
 
 	if len(trades) > 0 {
-		log.Printf("[match] pair=%s taker=%s 成交 %d 笔", taker.Pair, taker.OrderID, len(trades))
 		e.addMatchStats(trades)
+		// 记录最新成交价，作为条件单触发基准
+		last := trades[len(trades)-1]
+		e.shards[taker.Pair].lastTrade = &lastTrade{price: storage.MustUnits(last.Price), ts: last.Timestamp}
 	}
-	
+
 	// 性能监控：记录订单簿大小
-	if ob, ok := e.pairs[taker.Pair]; ok {
-		metrics.RecordOrderbookSize(taker.Pair, len(ob.Bids), len(ob.Asks))
-	}
-	metrics.RecordOrderProcessed()
-	
-	return trades
+	rep.processed = true
+	rep.bids, rep.asks = ob.Depth()
+	return trades, prevented
 }
 
 // MatchBatch §12.2 Epoch 内批量撮合：对多笔 taker 按 pair+CreatedAt+OrderID 确定性排序后依次撮合
@@ -591,23 +745,83 @@ func (e *Engine) MatchBatch(takers []*storage.Order) (trades []*storage.Trade) {
 	return trades
 }
 
-func trimFilled(orders []*storage.Order) []*storage.Order {
-	out := orders[:0]
-	for _, o := range orders {
-		if o.Status != "filled" {
-			out = append(out, o)
-		}
+// restingCopy 校验价格与剩余数量后生成入簿副本：Amount 为剩余量、Filled 归零、Price 规范化为最小单位整数
+func restingCopy(o *storage.Order) (*storage.Order, bool) {
+	price, ok := storage.ParseUnits(o.Price)
+	if !ok || price.Sign() <= 0 {
+		return nil, false
+	}
+	if _, ok := storage.ParseUnits(o.Amount); !ok {
+		return nil, false
+	}
+	left := o.Remaining()
+	if left.Sign() <= 0 {
+		return nil, false
 	}
-	return out
+	o2 := *o
+	o2.Price = storage.FormatUnits(price)
+	o2.Amount = storage.FormatUnits(left)
+	o2.Filled = "0"
+	return &o2, true
 }
 
-func bigNew(s string) *big.Float {
-	if s == "" {
-		return big.NewFloat(0)
+// takerRestingStatus 未完全成交且可挂单的订单状态：无成交为 open，部分成交为 partial
+func takerRestingStatus(filled *big.Int) string {
+	if filled.Sign() > 0 {
+		return storage.OrderStatusPartial
 	}
-	f, _ := new(big.Float).SetString(s)
-	if f == nil {
-		return big.NewFloat(0)
+	return storage.OrderStatusOpen
+}
+
+// ValidateMarketOrder 校验市价单参数并返回 quote 预算（未设置预算返回 nil）
+// 市价单无限价；须指定 amount（base 数量）或 quoteAmount（quote 预算，仅买单）至少一项为正
+func ValidateMarketOrder(o *storage.Order) (*big.Int, error) {
+	if o.Price != "" && o.Price != "0" {
+		return nil, fmt.Errorf("invalid price: market orders must not set a limit price")
+	}
+	amount := new(big.Int)
+	if o.Amount != "" {
+		v, ok := storage.ParseUnits(o.Amount)
+		if !ok {
+			return nil, fmt.Errorf("invalid amount: must be a non-negative integer in base units")
+		}
+		amount = v
+	}
+	if o.QuoteAmount == "" {
+		if amount.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid amount: market orders require amount or quoteAmount")
+		}
+		return nil, nil
+	}
+	if o.Side != "buy" {
+		return nil, fmt.Errorf("invalid quoteAmount: only allowed for market buy orders")
+	}
+	budget, ok := storage.ParseUnits(o.QuoteAmount)
+	if !ok || budget.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid quoteAmount: must be a positive integer in base units")
+	}
+	return budget, nil
+}
+
+// slippageLimitPrice 按撮合开始时对手盘最优价与滑点上限（万分比）计算最差可成交价
+// 买单上限 = best * (10000 + bps) / 10000（向下取整）；卖单下限 = best * (10000 - bps) / 10000（向上取整）
+func slippageLimitPrice(best *big.Int, buy bool, bps uint32) *big.Int {
+	const denom = 10000
+	if buy {
+		p := new(big.Int).Mul(best, big.NewInt(denom+int64(bps)))
+		return p.Quo(p, big.NewInt(denom))
+	}
+	if bps >= denom {
+		return new(big.Int)
+	}
+	p := new(big.Int).Mul(best, big.NewInt(denom-int64(bps)))
+	p.Add(p, big.NewInt(denom-1))
+	return p.Quo(p, big.NewInt(denom))
+}
+
+func minUnits(a, b *big.Int) *big.Int {
+	if a.Cmp(b) <= 0 {
+		return new(big.Int).Set(a)
 	}
-	return f
+	return new(big.Int).Set(b)
 }
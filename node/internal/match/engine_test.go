@@ -1,6 +1,12 @@
 package match
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/P2P-P2P/p2p/node/internal/storage"
@@ -25,10 +31,10 @@ func TestReplaceOrderbook(t *testing.T) {
 
 	// 用 ReplaceOrderbook 替换
 	newBids := []*storage.Order{
-		{OrderID: "b2", Trader: "0x3", Pair: "TKA/TKB", Side: "buy", Price: "0.9", Amount: "200", Filled: "0", Status: "open", CreatedAt: 3, ExpiresAt: 0},
+		{OrderID: "b2", Trader: "0x3", Pair: "TKA/TKB", Side: "buy", Price: "9", Amount: "200", Filled: "0", Status: "open", CreatedAt: 3, ExpiresAt: 0},
 	}
 	newAsks := []*storage.Order{
-		{OrderID: "a2", Trader: "0x4", Pair: "TKA/TKB", Side: "sell", Price: "1.1", Amount: "100", Filled: "0", Status: "open", CreatedAt: 4, ExpiresAt: 0},
+		{OrderID: "a2", Trader: "0x4", Pair: "TKA/TKB", Side: "sell", Price: "11", Amount: "100", Filled: "0", Status: "open", CreatedAt: 4, ExpiresAt: 0},
 	}
 	e.ReplaceOrderbook("TKA/TKB", newBids, newAsks)
 
@@ -104,3 +110,260 @@ func TestMatchDeterministicTradeID(t *testing.T) {
 		t.Errorf("expected TradeID %q, got %q", expectedPrefix, trades[0].TradeID)
 	}
 }
+
+// TestMatchFixedPointDeterministic 定点整数撮合：0.1+0.2 不漂移，两个引擎相同输入产生逐字节一致的成交
+func TestMatchFixedPointDeterministic(t *testing.T) {
+	pairTokens := map[string]PairTokens{
+		"TKA/TKB": {Token0: "0xa", Token1: "0xb", Decimals0: 18, Decimals1: 6},
+	}
+	run := func() []byte {
+		e := NewEngine(pairTokens)
+		// 0.1 与 0.2 个 TKA，价格 1.5 TKB（quote 6 位精度）
+		a1 := &storage.Order{OrderID: "a1", Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "1500000", Amount: "100000000000000000", Filled: "0", CreatedAt: 1}
+		a2 := &storage.Order{OrderID: "a2", Trader: "0x3", Pair: "TKA/TKB", Side: "sell", Price: "1500000", Amount: "200000000000000000", Filled: "0", CreatedAt: 2}
+		if !e.AddOrder(a1) || !e.AddOrder(a2) {
+			t.Fatal("AddOrder failed")
+		}
+		taker := &storage.Order{OrderID: "t1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Price: "1500000", Amount: "300000000000000000", Filled: "0", CreatedAt: 3}
+		trades := e.Match(taker)
+		if len(trades) != 2 {
+			t.Fatalf("expected 2 trades, got %d", len(trades))
+		}
+		if taker.Filled != "300000000000000000" || taker.Status != "filled" {
+			t.Errorf("taker filled=%s status=%s", taker.Filled, taker.Status)
+		}
+		if trades[0].AmountOut != "150000" || trades[1].AmountOut != "300000" {
+			t.Errorf("quote amounts: %s %s", trades[0].AmountOut, trades[1].AmountOut)
+		}
+		data, err := json.Marshal(trades)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	first, second := run(), run()
+	if !bytes.Equal(first, second) {
+		t.Errorf("trades differ between engines:\n%s\n%s", first, second)
+	}
+}
+
+func TestMatchPeriodVolumeInteger(t *testing.T) {
+	e := NewEngine(map[string]PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	e.SetCurrentPeriod("p1")
+	ask := &storage.Order{OrderID: "m1", Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "1000000000000000000", Amount: "100000000000000000", Filled: "0", CreatedAt: 1}
+	if !e.AddOrder(ask) {
+		t.Fatal("AddOrder failed")
+	}
+	taker := &storage.Order{OrderID: "t1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Price: "1000000000000000000", Amount: "100000000000000000", Filled: "0", CreatedAt: 2}
+	e.Match(taker)
+	n, vol := e.GetPeriodStats("p1")
+	if n != 1 || vol.String() != "100000000000000000" {
+		t.Errorf("period stats: trades=%d volume=%s", n, vol)
+	}
+}
+
+func TestAddOrderRejectsDecimalStrings(t *testing.T) {
+	e := NewEngine(map[string]PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	o := &storage.Order{OrderID: "x", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Price: "1.5", Amount: "100", Filled: "0", CreatedAt: 1}
+	if e.AddOrder(o) {
+		t.Error("expected AddOrder to reject decimal price")
+	}
+}
+
+// marketBook 卖盘（0x2）：a1 10@100、a2 10@101、a3 10@110
+func marketBook() testEngineOption {
+	return withOrders(
+		testOrder("a1", "sell", "100", "10", 1, withTrader("0x2")),
+		testOrder("a2", "sell", "101", "10", 2, withTrader("0x2")),
+		testOrder("a3", "sell", "110", "10", 3, withTrader("0x2")),
+	)
+}
+
+func TestMatchMarketOrderAmount(t *testing.T) {
+	e := newTestEngine(t, marketBook())
+	taker := &storage.Order{OrderID: "m1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Type: storage.OrderTypeMarket, Amount: "25", Filled: "0", CreatedAt: 10}
+	trades := e.Match(taker)
+	if len(trades) != 3 || trades[2].Amount != "5" || trades[2].Price != "110" {
+		t.Fatalf("trades = %+v", trades)
+	}
+	if taker.Filled != "25" || taker.Status != "filled" {
+		t.Errorf("taker filled=%s status=%s, want 25 filled", taker.Filled, taker.Status)
+	}
+	if e.AddOrder(taker) {
+		t.Error("market order must never rest")
+	}
+	// 对手盘不足：剩余撤销
+	taker2 := &storage.Order{OrderID: "m2", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Type: storage.OrderTypeMarket, Amount: "100", Filled: "0", CreatedAt: 11}
+	e.Match(taker2)
+	if taker2.Filled != "5" || taker2.Status != "cancelled" {
+		t.Errorf("taker2 filled=%s status=%s, want 5 cancelled", taker2.Filled, taker2.Status)
+	}
+	if _, asks := e.GetOrderbook("TKA/TKB"); len(asks) != 0 {
+		t.Errorf("asks left = %d, want 0", len(asks))
+	}
+}
+
+func TestMatchMarketOrderQuoteBudgetAndSlippage(t *testing.T) {
+	e := newTestEngine(t, marketBook())
+	// 预算 150：a1 全部（quote 100），a2 剩余预算 50 可买 floor(50*10/101)=4（quote 40）
+	taker := &storage.Order{OrderID: "m1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Type: storage.OrderTypeMarket, QuoteAmount: "150", CreatedAt: 10}
+	trades := e.Match(taker)
+	if len(trades) != 2 || trades[0].AmountOut != "100" || trades[1].Amount != "4" || trades[1].AmountOut != "40" {
+		t.Fatalf("trades = %+v %+v", trades[0], trades[len(trades)-1])
+	}
+	if taker.Filled != "14" || taker.Status != "filled" {
+		t.Errorf("taker filled=%s status=%s, want 14 filled", taker.Filled, taker.Status)
+	}
+	// 滑点上限 500bps：最优价 101 → 上限 106，不吃 110
+	taker2 := &storage.Order{OrderID: "m2", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Type: storage.OrderTypeMarket, Amount: "20", MaxSlippageBps: 500, CreatedAt: 11}
+	trades = e.Match(taker2)
+	if len(trades) != 1 || trades[0].Amount != "6" || taker2.Status != "cancelled" {
+		t.Errorf("slippage-capped trades=%d filled=%s status=%s", len(trades), taker2.Filled, taker2.Status)
+	}
+}
+
+func TestValidateMarketOrder(t *testing.T) {
+	cases := []struct {
+		o  storage.Order
+		ok bool
+	}{
+		{storage.Order{Side: "buy", Amount: "10"}, true},
+		{storage.Order{Side: "buy", QuoteAmount: "10"}, true},
+		{storage.Order{Side: "sell", QuoteAmount: "10"}, false},
+		{storage.Order{Side: "sell", Amount: "0"}, false},
+		{storage.Order{Side: "sell", Amount: "10", Price: "5"}, false},
+		{storage.Order{Side: "sell", Amount: "1.5"}, false},
+	}
+	for i, c := range cases {
+		if _, err := ValidateMarketOrder(&c.o); (err == nil) != c.ok {
+			t.Errorf("case %d: err=%v want ok=%v", i, err, c.ok)
+		}
+	}
+}
+
+// 他人以受害者的 orderId 下单：AddOrder / Submit 均拒绝（Reason 为 ErrOrderIDConflict），受害者挂单不受影响
+func TestOrderIDHijackRejected(t *testing.T) {
+	e := newTestEngine(t, tifBook()) // a1 10@100 由 0x1 挂出（nonce 0）
+	hijack := testOrder("a1", "sell", "200", "1", 20)
+	hijack.Trader = "0x2"
+	if e.AddOrder(hijack) {
+		t.Error("AddOrder must not replace another trader's order")
+	}
+	res := e.Submit(hijack)
+	if hijack.Status != storage.OrderStatusRejected || !errors.Is(res.Reason, storage.ErrOrderIDConflict) {
+		t.Fatalf("status=%s reason=%v, want rejected with ErrOrderIDConflict", hijack.Status, res.Reason)
+	}
+	// 同一 trader 不同 nonce 同样视为冲突
+	replay := testOrder("a1", "sell", "200", "1", 21)
+	replay.Nonce = 5
+	if res := e.Submit(replay); !errors.Is(res.Reason, storage.ErrOrderIDConflict) {
+		t.Errorf("different nonce: reason=%v, want ErrOrderIDConflict", res.Reason)
+	}
+	if o := e.GetOrder("a1"); o == nil || o.Trader != "0x1" || o.Price != "100" || o.Amount != "10" {
+		t.Fatalf("victim order changed: %+v", o)
+	}
+	// 订单属主自己的同 ID 订单照常替换
+	if !e.AddOrder(testOrder("a1", "sell", "102", "10", 22)) {
+		t.Error("owner replacing own order should succeed")
+	}
+	if res := e.Submit(testOrder("x1", "buy", "100", "1", 23)); res.Reason != nil {
+		t.Errorf("valid order: reason=%v", res.Reason)
+	}
+	// 同 trader、nonce 但签名内容不同（签名哈希不同）同样视为冲突
+	signed := testOrder("s1", "sell", "110", "1", 24)
+	signed.Nonce, signed.SignHash = 9, "0x01"
+	if res := e.Submit(signed); res.Reason != nil {
+		t.Fatalf("signed order: reason=%v", res.Reason)
+	}
+	forged := testOrder("s1", "sell", "300", "1", 25)
+	forged.Nonce, forged.SignHash = 9, "0x02"
+	if res := e.Submit(forged); !errors.Is(res.Reason, storage.ErrOrderIDConflict) {
+		t.Errorf("different sign hash: reason=%v, want ErrOrderIDConflict", res.Reason)
+	}
+}
+
+// 同一 orderId 或同一 trader+nonce 不得出现在两个交易对；未入簿订单的占位在处理结束后释放
+func TestOrderIDClaimAcrossPairs(t *testing.T) {
+	tokens := map[string]PairTokens{
+		"TKA/TKB": {Token0: "0xa", Token1: "0xb", Decimals0: 1},
+		"TKC/TKB": {Token0: "0xc", Token1: "0xb", Decimals0: 1},
+	}
+	e := NewEngine(tokens)
+	o := testOrder("o1", "sell", "100", "10", 1, withNonce(3))
+	if res := e.Submit(o); res.Reason != nil {
+		t.Fatalf("submit: %v", res.Reason)
+	}
+	other := testOrder("o1", "sell", "100", "10", 2, withOrderPair("TKC/TKB"), withNonce(3))
+	if res := e.Submit(other); !errors.Is(res.Reason, storage.ErrOrderIDConflict) {
+		t.Errorf("same orderId on second pair: reason=%v, want ErrOrderIDConflict", res.Reason)
+	}
+	reuse := testOrder("o2", "sell", "100", "10", 3, withOrderPair("TKC/TKB"), withNonce(3))
+	if err := e.CheckOrderOwner(reuse); !errors.Is(err, storage.ErrNonceUsed) {
+		t.Errorf("CheckOrderOwner nonce reuse: err=%v, want ErrNonceUsed", err)
+	}
+	if res := e.Submit(reuse); !errors.Is(res.Reason, storage.ErrNonceUsed) {
+		t.Errorf("same nonce on second pair: reason=%v, want ErrNonceUsed", res.Reason)
+	}
+	if e.AddOrder(reuse) {
+		t.Error("AddOrder must reject nonce used on another pair")
+	}
+	if p := e.pairOf("o1"); p != "TKA/TKB" {
+		t.Fatalf("o1 indexed on %q", p)
+	}
+	// 全部成交的 taker 不入簿：占位释放，nonce 随挂单撤销后可在其他交易对使用
+	taker := testOrder("t1", "buy", "100", "10", 4, withTIF(storage.TimeInForceIOC), withTrader("0x2"), withNonce(1))
+	if res := e.Submit(taker); len(res.Trades) != 1 {
+		t.Fatalf("taker trades = %d", len(res.Trades))
+	}
+	if n := e.indexSize(); n != 0 {
+		t.Errorf("index size = %d, want 0", n)
+	}
+	if res := e.Submit(reuse); res.Reason != nil {
+		t.Errorf("nonce after order left the book: reason=%v", res.Reason)
+	}
+}
+
+// 同一 orderId 并发提交到两个交易对：只有一个交易对接受，索引指向挂单所在交易对（配合 go test -race）
+func TestOrderIDClaimConcurrent(t *testing.T) {
+	tokens := map[string]PairTokens{
+		"TKA/TKB": {Token0: "0xa", Token1: "0xb", Decimals0: 1},
+		"TKC/TKB": {Token0: "0xc", Token1: "0xb", Decimals0: 1},
+	}
+	for i := 0; i < 50; i++ {
+		e := NewEngine(tokens)
+		id := fmt.Sprintf("o%d", i)
+		var wg sync.WaitGroup
+		var accepted int32
+		for _, pair := range []string{"TKA/TKB", "TKC/TKB"} {
+			o := testOrder(id, "sell", "100", "10", 1)
+			o.Pair = pair
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if res := e.Submit(o); res.Reason == nil {
+					atomic.AddInt32(&accepted, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if accepted != 1 {
+			t.Fatalf("%s accepted on %d pairs, want 1", id, accepted)
+		}
+		pair := e.pairOf(id)
+		if _, asks := e.GetOrderbook(pair); len(asks) != 1 || asks[0].OrderID != id {
+			t.Fatalf("%s indexed on %s but not resting there", id, pair)
+		}
+	}
+}
+
+// TestTradeTimestampFromEngineClock 成交时间取引擎时钟，客户端回填或超前的 CreatedAt 不影响成交时间
+func TestTradeTimestampFromEngineClock(t *testing.T) {
+	e := newTestEngine(t, withClock(func() int64 { return 1000 }))
+	e.AddOrder(testOrder("a1", "sell", "100", "5", 1))
+	for _, createdAt := range []int64{1, 999999} {
+		res := e.Submit(testOrder(fmt.Sprintf("b%d", createdAt), "buy", "100", "1", createdAt))
+		if len(res.Trades) != 1 || res.Trades[0].Timestamp != 1000 {
+			t.Errorf("createdAt=%d: trades = %+v, want timestamp 1000", createdAt, res.Trades)
+		}
+	}
+}
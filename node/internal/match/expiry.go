@@ -0,0 +1,234 @@
+package match
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// expiryMaxWait 无待过期订单时调度器的最长等待（兜底，正常由新订单唤醒）
+const expiryMaxWait = time.Minute
+
+// expiryEntry 过期调度项：订单在 at 之后（now > at）过期
+type expiryEntry struct {
+	at      int64
+	orderID string
+}
+
+// expiryHeap 按 ExpiresAt、orderID 升序的最小堆；订单成交/撤销后不主动删除，出堆时再校验（惰性删除）
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int { return len(h) }
+func (h expiryHeap) Less(i, j int) bool {
+	if h[i].at != h[j].at {
+		return h[i].at < h[j].at
+	}
+	return h[i].orderID < h[j].orderID
+}
+func (h expiryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)   { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// scheduleExpiryLocked 登记挂单或待触发条件单的过期时间；成为最早过期项时唤醒调度器（调用方需已锁定 o.Pair 分片，订单已登记索引）
+// 堆中项超过在簿订单数两倍时剔除订单已不在索引中的失效项，避免大量撤单后堆无限增长
+func (e *Engine) scheduleExpiryLocked(o *storage.Order) {
+	if o.ExpiresAt <= 0 {
+		return
+	}
+	e.expMu.Lock()
+	defer e.expMu.Unlock()
+	if len(e.expiries) > 2*e.indexSize()+1024 {
+		kept := e.expiries[:0]
+		for _, ent := range e.expiries {
+			if ent.orderID != o.OrderID && e.pairOf(ent.orderID) != "" {
+				kept = append(kept, ent)
+			}
+		}
+		e.expiries = kept
+		heap.Init(&e.expiries)
+	}
+	heap.Push(&e.expiries, expiryEntry{at: o.ExpiresAt, orderID: o.OrderID})
+	if e.expiries[0].orderID == o.OrderID {
+		e.wakeExpiry()
+	}
+}
+
+// rebuildExpiriesLocked 按订单簿与触发簿中的订单重建过期堆（快照加载后调用；调用方需已持写锁）
+func (e *Engine) rebuildExpiriesLocked() {
+	e.expMu.Lock()
+	defer e.expMu.Unlock()
+	e.expiries = e.expiries[:0]
+	add := func(index map[string]*bookOrder) {
+		for id, n := range index {
+			if n.order.ExpiresAt > 0 {
+				e.expiries = append(e.expiries, expiryEntry{at: n.order.ExpiresAt, orderID: id})
+			}
+		}
+	}
+	for _, ob := range e.pairs {
+		add(ob.index)
+	}
+	for _, tb := range e.triggers {
+		add(tb.index)
+	}
+	heap.Init(&e.expiries)
+}
+
+// wakeExpiry 非阻塞唤醒过期调度器
+func (e *Engine) wakeExpiry() {
+	select {
+	case e.expiryWake <- struct{}{}:
+	default:
+	}
+}
+
+// restingLocked 按 orderID 查找订单簿或触发簿中的订单（调用方需已锁定订单所在交易对分片）
+func (e *Engine) restingLocked(orderID string) *storage.Order {
+	pair := e.pairOf(orderID)
+	if pair == "" {
+		return nil
+	}
+	if ob, ok := e.pairs[pair]; ok {
+		if o := ob.Get(orderID); o != nil {
+			return o
+		}
+	}
+	if tb, ok := e.triggers[pair]; ok {
+		if n, ok := tb.index[orderID]; ok {
+			return n.order
+		}
+	}
+	return nil
+}
+
+// expireLocked 从订单簿或触发簿移除订单，返回 status=expired 的副本；不写日志、不校验过期时间（调用方需已锁定订单所在交易对分片）
+func (e *Engine) expireLocked(orderID string) *storage.Order {
+	o := e.restingLocked(orderID)
+	if o == nil {
+		return nil
+	}
+	pair := e.pairOf(orderID)
+	c := *o
+	c.Status = storage.OrderStatusExpired
+	if ob, ok := e.pairs[pair]; ok {
+		ob.remove(orderID)
+	}
+	if tb, ok := e.triggers[pair]; ok {
+		tb.remove(orderID)
+	}
+	e.unindexOrder(orderID)
+	return &c
+}
+
+// ExpireOrder 移除已过期（ExpiresAt 早于引擎时钟）的挂单或待触发条件单；未过期或不存在返回 nil
+// 返回被移除订单的副本（status=expired），供持久化与推送
+func (e *Engine) ExpireOrder(orderID string) *storage.Order {
+	pair := e.pairOf(orderID)
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return nil
+	}
+	o := e.restingLocked(orderID)
+	if o == nil || o.ExpiresAt <= 0 || !e.recordLocked(sh, &JournalEvent{Type: EventExpire, Pair: pair, OrderID: orderID}) {
+		return nil
+	}
+	if !storage.OrderExpiredAt(o, e.nowLocked(pair)) {
+		return nil
+	}
+	return e.expireLocked(orderID)
+}
+
+// NextExpiry 返回最早的待过期时间（ExpiresAt，可能为已失效的堆项）；无待过期订单返回 false
+func (e *Engine) NextExpiry() (int64, bool) {
+	e.expMu.Lock()
+	defer e.expMu.Unlock()
+	if len(e.expiredPending) > 0 {
+		return 0, true
+	}
+	if len(e.expiries) == 0 {
+		return 0, false
+	}
+	return e.expiries[0].at, true
+}
+
+// SweepExpired 移除所有已过期的挂单与待触发条件单（含撮合中发现的过期挂单），返回 status=expired 的副本并计入指标
+// 每个订单只锁定其所在交易对分片（经 ExpireOrder 写入日志），不会长时间阻塞撮合
+func (e *Engine) SweepExpired() []*storage.Order {
+	e.expMu.Lock()
+	out := e.expiredPending
+	e.expiredPending = nil
+	e.expMu.Unlock()
+	for {
+		now := e.clock()
+		e.expMu.Lock()
+		if len(e.expiries) == 0 || e.expiries[0].at >= now {
+			e.expMu.Unlock()
+			break
+		}
+		ent := heap.Pop(&e.expiries).(expiryEntry)
+		e.expMu.Unlock()
+		// 堆项已失效（订单已成交/撤销，或以新的过期时间重新挂单）时跳过
+		sh, unlock := e.lockPair(e.pairOf(ent.orderID))
+		stale := sh == nil
+		if !stale {
+			o := e.restingLocked(ent.orderID)
+			stale = o == nil || o.ExpiresAt != ent.at
+		}
+		unlock()
+		if stale {
+			continue
+		}
+		if c := e.ExpireOrder(ent.orderID); c != nil {
+			out = append(out, c)
+		}
+	}
+	for _, o := range out {
+		metrics.RecordOrderExpired(o.Pair)
+	}
+	return out
+}
+
+// RunExpirySweeper 过期调度器：在最早的 ExpiresAt 到达时移除过期订单并回调 onExpired（在调度器 goroutine 中调用）
+// 新订单成为最早过期项或撮合中发现过期挂单时立即唤醒；ctx 取消后退出
+func RunExpirySweeper(ctx context.Context, e *Engine, onExpired func([]*storage.Order)) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		wait := expiryMaxWait
+		if at, ok := e.NextExpiry(); ok {
+			// OrderExpiredAt 为 now > ExpiresAt，即 ExpiresAt+1 秒起过期
+			wait = time.Until(time.Unix(at+1, 0))
+			if wait < 0 {
+				wait = 0
+			}
+			if wait > expiryMaxWait {
+				wait = expiryMaxWait
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.expiryWake:
+		case <-timer.C:
+		}
+		if expired := e.SweepExpired(); len(expired) > 0 && onExpired != nil {
+			onExpired(expired)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package match
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func TestSweepExpiredRemovesDueOrders(t *testing.T) {
+	var now atomic.Int64
+	now.Store(50)
+	e := newTestEngine(t, withClock(now.Load))
+	e.AddOrder(testOrder("a1", "sell", "100", "10", 1, withExpiry(100)))
+	e.AddOrder(testOrder("a2", "sell", "101", "10", 1, withExpiry(200)))
+	e.AddOrder(testOrder("a3", "sell", "102", "10", 1))
+	e.AddOrder(testOrder("c1", "sell", "103", "10", 1, withExpiry(90)))
+	e.RemoveOrder("TKA/TKB", "c1")
+	e.AddOrder(testOrder("s1", "buy", "110", "10", 1, withExpiry(100), withTrigger(storage.TriggerStop, "105")))
+
+	if got := e.SweepExpired(); len(got) != 0 {
+		t.Fatalf("swept %d orders before expiry", len(got))
+	}
+	if at, ok := e.NextExpiry(); !ok || at != 90 {
+		t.Errorf("NextExpiry = %d, %v; want stale entry 90", at, ok)
+	}
+	now.Store(100) // ExpiresAt 当秒仍有效
+	if got := e.SweepExpired(); len(got) != 0 {
+		t.Fatalf("swept %d orders at ExpiresAt", len(got))
+	}
+	now.Store(101)
+	got := e.SweepExpired()
+	if len(got) != 2 || got[0].OrderID != "a1" || got[1].OrderID != "s1" {
+		t.Fatalf("swept = %v, want a1, s1", got)
+	}
+	for _, o := range got {
+		if o.Status != storage.OrderStatusExpired {
+			t.Errorf("%s status = %s", o.OrderID, o.Status)
+		}
+	}
+	if e.GetOrder("a1") != nil || e.PendingTriggerCount("TKA/TKB") != 0 {
+		t.Error("expired orders still in engine")
+	}
+	if e.GetOrder("a2") == nil || e.GetOrder("a3") == nil {
+		t.Error("unexpired orders removed")
+	}
+	if at, ok := e.NextExpiry(); !ok || at != 200 {
+		t.Errorf("NextExpiry = %d, %v; want 200", at, ok)
+	}
+}
+
+func TestExpiredMakerNotMatched(t *testing.T) {
+	var now atomic.Int64
+	now.Store(50)
+	e := newTestEngine(t, withClock(now.Load))
+	e.AddOrder(testOrder("a1", "sell", "100", "10", 1, withExpiry(100)))
+	e.AddOrder(testOrder("a2", "sell", "101", "10", 1))
+	now.Store(101)
+	res := e.Submit(testOrder("b1", "buy", "101", "5", 2))
+	if len(res.Trades) != 1 || res.Trades[0].MakerOrderID != "a2" {
+		t.Fatalf("trades = %+v, want one fill against a2", res.Trades)
+	}
+	got := e.SweepExpired()
+	if len(got) != 1 || got[0].OrderID != "a1" || got[0].Status != storage.OrderStatusExpired {
+		t.Fatalf("swept = %v, want a1 expired during matching", got)
+	}
+}
+
+func TestRunExpirySweeperWakesOnNewOrder(t *testing.T) {
+	var now atomic.Int64
+	now.Store(50)
+	e := newTestEngine(t, withClock(now.Load))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expired := make(chan []*storage.Order, 1)
+	go RunExpirySweeper(ctx, e, func(orders []*storage.Order) { expired <- orders })
+
+	e.AddOrder(testOrder("a1", "sell", "100", "10", 1, withExpiry(60)))
+	now.Store(61)
+	e.AddOrder(testOrder("a2", "sell", "101", "10", 1, withExpiry(70))) // 唤醒调度器：a1 已到期
+	select {
+	case got := <-expired:
+		if len(got) != 1 || got[0].OrderID != "a1" {
+			t.Fatalf("expired = %v, want a1", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sweeper did not expire a1")
+	}
+}
@@ -0,0 +1,155 @@
+package match
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// FeeTierWindow 手续费等级统计窗口：trader 近 30 天成交额（quote 最小单位，maker 与 taker 均计入）
+const FeeTierWindow = 30 * 24 * time.Hour
+
+// maxFeeBps 费率上限（与 Settlement.setFeeBps 一致，10%）
+const maxFeeBps = 1000
+
+// FeeSchedule 交易对手续费（万分比）：手续费以 quote 代币计收，按成交 quote 金额 × bps / 10000 向零取整
+// MakerBps 可为负（maker 返佣），但返佣不得超过 taker 费率，保证每笔净手续费非负
+type FeeSchedule struct {
+	MakerBps int32     `json:"makerBps"`
+	TakerBps int32     `json:"takerBps"`
+	Tiers    []FeeTier `json:"tiers,omitempty"`
+}
+
+// FeeTier 成交额等级：近 30 天成交额 >= MinVolume 的 trader 使用该档费率（取满足条件的最高一档）
+type FeeTier struct {
+	MinVolume string `json:"minVolume"` // quote 最小单位
+	MakerBps  int32  `json:"makerBps"`
+	TakerBps  int32  `json:"takerBps"`
+}
+
+// Validate 校验费率配置：taker 费率 [0, 1000]，maker 返佣不超过同档 taker 费率，等级 minVolume 为正整数且互不相同
+func (f FeeSchedule) Validate() error {
+	check := func(name string, maker, taker int32) error {
+		if taker < 0 || taker > maxFeeBps || maker > maxFeeBps {
+			return fmt.Errorf("invalid %s: fee bps must be within [0, %d]", name, maxFeeBps)
+		}
+		if maker < -taker {
+			return fmt.Errorf("invalid %s: maker rebate %d exceeds taker fee %d", name, -maker, taker)
+		}
+		return nil
+	}
+	if err := check("fee", f.MakerBps, f.TakerBps); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(f.Tiers))
+	for i, t := range f.Tiers {
+		v, ok := storage.ParseUnits(t.MinVolume)
+		if !ok || v.Sign() <= 0 {
+			return fmt.Errorf("invalid fee_tiers[%d]: min_volume must be a positive integer in base units", i)
+		}
+		if seen[v.String()] {
+			return fmt.Errorf("invalid fee_tiers[%d]: duplicate min_volume %s", i, v)
+		}
+		seen[v.String()] = true
+		if err := check(fmt.Sprintf("fee_tiers[%d]", i), t.MakerBps, t.TakerBps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rates 按 trader 近 30 天成交额返回 maker/taker 费率；volume 为 nil 视为 0
+func (f FeeSchedule) rates(volume *big.Int) (maker, taker int32) {
+	maker, taker = f.MakerBps, f.TakerBps
+	var best *big.Int
+	for _, t := range f.Tiers {
+		v := storage.MustUnits(t.MinVolume)
+		if volume == nil || volume.Cmp(v) < 0 || best != nil && v.Cmp(best) <= 0 {
+			continue
+		}
+		best, maker, taker = v, t.MakerBps, t.TakerBps
+	}
+	return maker, taker
+}
+
+// feeAmount 计算 quote × bps / 10000（向零取整，bps 为负时结果为负即返佣）
+func feeAmount(quote *big.Int, bps int32) *big.Int {
+	f := new(big.Int).Mul(quote, big.NewInt(int64(bps)))
+	return f.Quo(f, big.NewInt(10000))
+}
+
+// applyFeesLocked 按交易对费率与 trader 等级填充成交手续费：Fee 为 taker 手续费，MakerFee 为 maker 手续费（负为返佣），
+// FeeToken 为 quote 代币；等级使用最近一次 SetTraderVolumes 的快照，相同输入在各节点结果一致（调用方需已持锁）
+func (e *Engine) applyFeesLocked(t *storage.Trade, tokens PairTokens, quote *big.Int) {
+	vols := e.traderVolumes[t.Pair]
+	makerBps, _ := tokens.Fees.rates(vols[strings.ToLower(t.Maker)])
+	_, takerBps := tokens.Fees.rates(vols[strings.ToLower(t.Taker)])
+	t.FeeToken = tokens.Token1
+	t.Fee = storage.FormatUnits(feeAmount(quote, takerBps))
+	t.MakerFee = feeAmount(quote, makerBps).String()
+}
+
+// SetTraderVolumes 设置交易对各 trader 近 30 天成交额快照（quote 最小单位，地址不区分大小写），用于手续费等级
+func (e *Engine) SetTraderVolumes(pair string, volumes map[string]*big.Int) {
+	m := make(map[string]*big.Int, len(volumes))
+	logged := make(map[string]string, len(volumes))
+	for trader, v := range volumes {
+		m[strings.ToLower(trader)] = new(big.Int).Set(v)
+		logged[strings.ToLower(trader)] = v.String()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.recordLocked(nil, &JournalEvent{Type: EventTraderVolumes, Pair: pair, Volumes: logged}) {
+		return
+	}
+	e.traderVolumes[pair] = m
+}
+
+// GetPeriodFees 返回指定周期按手续费代币汇总的净手续费（taker 手续费 + maker 手续费 - 返佣，最小单位），供 FeeDistributor 对账
+func (e *Engine) GetPeriodFees(periodStr string) map[string]string {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	var fees map[string]*big.Int
+	if e.currentPeriod == periodStr {
+		fees = e.currentFees
+	} else if p, ok := e.periodStats[periodStr]; ok {
+		fees = p.Fees
+	}
+	out := make(map[string]string, len(fees))
+	for token, v := range fees {
+		out[token] = v.String()
+	}
+	return out
+}
+
+// RefreshFeeTiers 从成交表统计配置了费率等级的交易对的 trader 近 30 天成交额并写入引擎
+// 成交额只取本节点撮合引擎产生的成交（Tx.InsertTrade 写入），gossip 与链上同步的成交不计入，peer 伪造的成交无法抬高费率等级；
+// 窗口截止于 now 所在 UTC 日的零点，同一天内撮合同一交易对、处理相同订单流的节点得到相同等级
+func RefreshFeeTiers(engine *Engine, store *storage.DB, now time.Time) error {
+	if engine == nil || store == nil {
+		return nil
+	}
+	until := now.UTC().Truncate(24 * time.Hour)
+	since := until.Add(-FeeTierWindow)
+	engine.mu.RLock()
+	pairs := make(map[string]string)
+	for pair, t := range engine.tokens {
+		if len(t.Fees.Tiers) > 0 {
+			pairs[pair] = t.Token1
+		}
+	}
+	engine.mu.RUnlock()
+	for pair, quoteToken := range pairs {
+		vols, err := store.TraderQuoteVolumes(pair, quoteToken, since.Unix(), until.Unix()-1)
+		if err != nil {
+			return fmt.Errorf("trader volumes %s: %w", pair, err)
+		}
+		engine.SetTraderVolumes(pair, vols)
+		log.Printf("[fees] pair=%s 已更新 %d 个 trader 的手续费等级（截至 %s）", pair, len(vols), until.Format("2006-01-02"))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package match
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// testFees base 精度 1：maker -2bps（返佣）、taker 10bps；近 30 天成交额 >= 1000000 的 trader taker 5bps、maker -3bps
+var testFees = FeeSchedule{MakerBps: -2, TakerBps: 10, Tiers: []FeeTier{{MinVolume: "1000000", MakerBps: -3, TakerBps: 5}}}
+
+// feeBook 卖盘：a1（0x2）1000@1000
+func feeBook() testEngineOption {
+	return withOrders(testOrder("a1", "sell", "1000", "1000", 1, withTrader("0x2")))
+}
+
+func TestTradeFeesMakerRebate(t *testing.T) {
+	e := newTestEngine(t, withFees(testFees), feeBook())
+	e.SetCurrentPeriod("p1")
+	// quote = 100 * 1000 / 10 = 10000：taker 10bps = 10，maker -2bps = -2
+	trades := e.Match(testOrder("b1", "buy", "1000", "100", 2))
+	if len(trades) != 1 {
+		t.Fatalf("trades = %d", len(trades))
+	}
+	if tr := trades[0]; tr.Fee != "10" || tr.MakerFee != "-2" || tr.FeeToken != "0xb" {
+		t.Errorf("fee=%s makerFee=%s feeToken=%s, want 10 -2 0xb", tr.Fee, tr.MakerFee, tr.FeeToken)
+	}
+	if fees := e.GetPeriodFees("p1"); fees["0xb"] != "8" {
+		t.Errorf("period fees = %v, want 0xb=8", fees)
+	}
+	e.SetCurrentPeriod("p2")
+	if fees := e.GetPeriodFees("p1"); fees["0xb"] != "8" {
+		t.Errorf("closed period fees = %v, want 0xb=8", fees)
+	}
+}
+
+func TestTradeFeesVolumeTier(t *testing.T) {
+	e := newTestEngine(t, withFees(testFees), feeBook())
+	e.SetTraderVolumes("TKA/TKB", map[string]*big.Int{"0X1": big.NewInt(1000000), "0x2": big.NewInt(999999)})
+	tr := e.Match(testOrder("b1", "buy", "1000", "100", 2))[0]
+	// taker 0x1 达到等级（5bps），maker 0x2 未达到（-2bps）
+	if tr.Fee != "5" || tr.MakerFee != "-2" {
+		t.Errorf("fee=%s makerFee=%s, want 5 -2", tr.Fee, tr.MakerFee)
+	}
+}
+
+func TestFeeScheduleValidate(t *testing.T) {
+	bad := []FeeSchedule{
+		{TakerBps: -1},
+		{TakerBps: 1001},
+		{MakerBps: -5, TakerBps: 3},
+		{TakerBps: 5, Tiers: []FeeTier{{MinVolume: "0", TakerBps: 1}}},
+		{TakerBps: 5, Tiers: []FeeTier{{MinVolume: "10", TakerBps: 1}, {MinVolume: "10", TakerBps: 2}}},
+	}
+	for i, f := range bad {
+		if err := f.Validate(); err == nil {
+			t.Errorf("case %d: expected error for %+v", i, f)
+		}
+	}
+	if err := (FeeSchedule{MakerBps: -1, TakerBps: 1}).Validate(); err != nil {
+		t.Errorf("valid schedule: %v", err)
+	}
+}
+
+func TestTraderQuoteVolumesFeedsTiers(t *testing.T) {
+	db, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// 0x1 作为 taker 买（quote 为 amountOut）与 maker 买（quote 为 amountIn）各 600000
+	trades := []*storage.Trade{
+		{TradeID: "t1", Pair: "TKA/TKB", Maker: "0x2", Taker: "0x1", TokenIn: "0xa", TokenOut: "0xb", AmountIn: "6000", AmountOut: "600000", Price: "1000", Amount: "6000", Timestamp: 100},
+		{TradeID: "t2", Pair: "TKA/TKB", Maker: "0x1", Taker: "0x3", TokenIn: "0xb", TokenOut: "0xa", AmountIn: "600000", AmountOut: "6000", Price: "1000", Amount: "6000", Timestamp: 200},
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range trades {
+		if err := tx.InsertTrade(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// gossip 成交不计入，也不能覆盖本地撮合的同 ID 成交
+	if err := db.InsertTrades([]*storage.Trade{
+		{TradeID: "t1", Pair: "TKA/TKB", Maker: "0x2", Taker: "0x1", TokenIn: "0xa", TokenOut: "0xb", AmountIn: "1", AmountOut: "1", Price: "1000", Amount: "1", Timestamp: 100},
+		{TradeID: "g1", Pair: "TKA/TKB", Maker: "0x4", Taker: "0x3", TokenIn: "0xa", TokenOut: "0xb", AmountIn: "99000", AmountOut: "9900000", Price: "1000", Amount: "99000", Timestamp: 300},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	vols, err := db.TraderQuoteVolumes("TKA/TKB", "0xb", 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vols["0x1"].String() != "1200000" || vols["0x2"].String() != "600000" || vols["0x3"].String() != "600000" || vols["0x4"] != nil {
+		t.Fatalf("volumes = %v", vols)
+	}
+	e := newTestEngine(t, withFees(testFees), feeBook())
+	e.SetTraderVolumes("TKA/TKB", vols)
+	if tr := e.Match(testOrder("b1", "buy", "1000", "100", 2))[0]; tr.Fee != "5" {
+		t.Errorf("fee = %s, want tier rate 5", tr.Fee)
+	}
+}
@@ -0,0 +1,126 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// testPair 测试交易对：Decimals0=1，即 quote = amount * price / 10
+const testPair = "TKA/TKB"
+
+// testEngineConfig newTestEngine 的交易对配置、引擎时钟与初始挂单
+type testEngineConfig struct {
+	tokens PairTokens
+	clock  func() int64
+	orders []*storage.Order
+}
+
+// testEngineOption 调整 newTestEngine 的配置
+type testEngineOption func(*testEngineConfig)
+
+// withTokens 交易对 base/quote 代币地址
+func withTokens(token0, token1 string) testEngineOption {
+	return func(c *testEngineConfig) { c.tokens.Token0, c.tokens.Token1 = token0, token1 }
+}
+
+// withBatch 批量拍卖撮合模式
+func withBatch() testEngineOption {
+	return func(c *testEngineConfig) { c.tokens.MatchingMode = MatchingBatch }
+}
+
+// withBreaker 波动保护配置
+func withBreaker(cb CircuitBreaker) testEngineOption {
+	return func(c *testEngineConfig) { c.tokens.Breaker = cb }
+}
+
+// withFees 手续费配置
+func withFees(fs FeeSchedule) testEngineOption {
+	return func(c *testEngineConfig) { c.tokens.Fees = fs }
+}
+
+// withRules 交易规则
+func withRules(r MarketRules) testEngineOption {
+	return func(c *testEngineConfig) { c.tokens.Rules = r }
+}
+
+// withSTP 交易对默认自成交防护模式
+func withSTP(mode string) testEngineOption {
+	return func(c *testEngineConfig) { c.tokens.SelfTradePrevention = mode }
+}
+
+// withClock 引擎时钟（unix 秒）
+func withClock(clock func() int64) testEngineOption {
+	return func(c *testEngineConfig) { c.clock = clock }
+}
+
+// withOrders 创建引擎后按顺序 AddOrder 的初始挂单
+func withOrders(orders ...*storage.Order) testEngineOption {
+	return func(c *testEngineConfig) { c.orders = append(c.orders, orders...) }
+}
+
+// newTestEngine 只含 testPair 的引擎；任一初始挂单入簿失败时终止测试
+func newTestEngine(t *testing.T, opts ...testEngineOption) *Engine {
+	t.Helper()
+	c := &testEngineConfig{tokens: PairTokens{Token0: "0xa", Token1: "0xb", Decimals0: 1}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	e := NewEngine(map[string]PairTokens{testPair: c.tokens})
+	if c.clock != nil {
+		e.clock = c.clock
+	}
+	for _, o := range c.orders {
+		if !e.AddOrder(o) {
+			t.Fatalf("AddOrder %s failed", o.OrderID)
+		}
+	}
+	return e
+}
+
+// orderOption 调整 testOrder 生成的订单
+type orderOption func(*storage.Order)
+
+// withTIF 有效期类型
+func withTIF(tif string) orderOption {
+	return func(o *storage.Order) { o.TimeInForce = tif }
+}
+
+// withTrader 下单地址（默认 0x1）
+func withTrader(trader string) orderOption {
+	return func(o *storage.Order) { o.Trader = trader }
+}
+
+// withOrderPair 交易对（默认 testPair）
+func withOrderPair(pair string) orderOption {
+	return func(o *storage.Order) { o.Pair = pair }
+}
+
+// withTrigger 条件单类型与触发价
+func withTrigger(trigger, triggerPrice string) orderOption {
+	return func(o *storage.Order) { o.Trigger, o.TriggerPrice = trigger, triggerPrice }
+}
+
+// withDisplay 冰山单可见量
+func withDisplay(amount string) orderOption {
+	return func(o *storage.Order) { o.DisplayAmount = amount }
+}
+
+// withExpiry 过期时间
+func withExpiry(expiresAt int64) orderOption {
+	return func(o *storage.Order) { o.ExpiresAt = expiresAt }
+}
+
+// withNonce 订单 nonce
+func withNonce(nonce int64) orderOption {
+	return func(o *storage.Order) { o.Nonce = nonce }
+}
+
+// testOrder testPair 上 trader 0x1 的限价单
+func testOrder(id, side, price, amount string, createdAt int64, opts ...orderOption) *storage.Order {
+	o := &storage.Order{OrderID: id, Trader: "0x1", Pair: testPair, Side: side, Price: price, Amount: amount, Filled: "0", CreatedAt: createdAt}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
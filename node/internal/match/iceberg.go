@@ -0,0 +1,93 @@
+package match
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// ValidateIceberg 校验冰山单参数：displayAmount 须为正且不超过 amount，仅限可挂单的限价单（非 IOC/FOK）
+func ValidateIceberg(o *storage.Order) error {
+	if o.DisplayAmount == "" {
+		return nil
+	}
+	display, ok := storage.ParseUnits(o.DisplayAmount)
+	if !ok || display.Sign() <= 0 {
+		return fmt.Errorf("invalid displayAmount: must be a positive integer in base units")
+	}
+	if o.IsMarket() {
+		return fmt.Errorf("invalid displayAmount: only limit orders can be iceberg")
+	}
+	switch o.EffectiveTimeInForce() {
+	case storage.TimeInForceIOC, storage.TimeInForceFOK:
+		return fmt.Errorf("invalid displayAmount: IOC/FOK orders never rest")
+	}
+	if amount, ok := storage.ParseUnits(o.Amount); ok && display.Cmp(amount) > 0 {
+		return fmt.Errorf("invalid displayAmount: must not exceed amount")
+	}
+	return nil
+}
+
+// available 返回节点本轮可成交量：普通订单为剩余量，冰山单为当前可见量
+func (n *bookOrder) available(left *big.Int) *big.Int {
+	if n.visible == nil {
+		return left
+	}
+	return minUnits(n.visible, left)
+}
+
+// fill 记录簿内订单成交 qty（调用方已累加 Filled）：全部成交时移出订单簿；冰山单扣减可见量，可见部分成交完且仍有隐藏量时
+// 按 DisplayAmount 补充并排到同价位队尾，排队时间记为本次成交时间 ts（重启恢复/同步后队列顺序一致）
+// L3 事件：execute（Amount 为成交后可见剩余量）；补充可见量时 execute 的 Amount 为 0，随后以 add 在队尾重新出现
+func (ob *OrderBook) fill(n *bookOrder, qty *big.Int, ts int64) {
+	ob.touch(n)
+	price := n.level.key
+	left := n.order.Remaining()
+	if left.Sign() <= 0 {
+		ob.unlink(n)
+		ob.record(L3Execute, n.order, price, left, qty)
+		return
+	}
+	if n.visible == nil {
+		ob.record(L3Execute, n.order, price, left, qty)
+		return
+	}
+	n.visible.Sub(n.visible, minUnits(qty, n.visible))
+	ob.record(L3Execute, n.order, price, n.visible, qty)
+	if n.visible.Sign() > 0 {
+		return
+	}
+	n.visible = minUnits(storage.MustUnits(n.order.DisplayAmount), left)
+	if ts > n.order.QueuedAt {
+		n.order.QueuedAt = ts
+	}
+	n.level.side.requeue(n)
+	ob.record(L3Add, n.order, price, n.visible, nil)
+}
+
+// reduce 记录簿内订单原地减量（调用方已修改 Amount，如自成交防护、改单减量）：冰山单可见量不超过剩余量，队列位置不变
+func (ob *OrderBook) reduce(n *bookOrder) {
+	ob.touch(n)
+	left := n.order.Remaining()
+	if n.visible != nil {
+		n.visible = minUnits(n.visible, left)
+	}
+	ob.record(L3Reduce, n.order, n.level.key, n.available(left), nil)
+}
+
+// view 按价格-时间优先顺序返回某侧订单的对外副本：冰山单 Amount 为 Filled + 当前可见量，隐藏量不外泄
+func (ob *OrderBook) view(buy bool) []*storage.Order {
+	s := ob.side(buy)
+	out := make([]*storage.Order, 0, s.orders)
+	for x := s.head.next[0]; x != nil; x = x.next[0] {
+		for n := x.level.head; n != nil; n = n.next {
+			c := *n.order
+			if n.visible != nil {
+				c.Amount = storage.FormatUnits(new(big.Int).Add(storage.MustUnits(c.Filled), n.visible))
+			}
+			out = append(out, &c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// icebergBook 卖盘同价 100：冰山单 i1（总量 30，展示 10）先到，普通单 a2 10 后到
+func icebergBook() testEngineOption {
+	return withOrders(testOrder("i1", "sell", "100", "30", 1, withDisplay("10")), testOrder("a2", "sell", "100", "10", 2))
+}
+
+func TestIcebergHiddenSizeNotExposed(t *testing.T) {
+	e := newTestEngine(t, icebergBook())
+	_, asks := e.GetOrderbook("TKA/TKB")
+	if len(asks) != 2 || asks[0].OrderID != "i1" || asks[0].Amount != "10" {
+		t.Fatalf("asks = %+v, want i1 showing 10", asks)
+	}
+	snap := OrdersToLevelSnapshot("TKA/TKB", nil, asks)
+	if len(snap.Asks) != 1 || snap.Asks[0][1] != "20" {
+		t.Errorf("level snapshot = %v, want [100 20]", snap.Asks)
+	}
+}
+
+func TestIcebergReplenishGoesToBackOfQueue(t *testing.T) {
+	e := newTestEngine(t, icebergBook())
+	// 吃掉 i1 可见的 10 后 i1 补充并排到 a2 之后，剩余 5 成交 a2
+	trades := e.Submit(testOrder("b1", "buy", "100", "15", 10)).Trades
+	if len(trades) != 2 || trades[0].MakerOrderID != "i1" || trades[0].Amount != "10" ||
+		trades[1].MakerOrderID != "a2" || trades[1].Amount != "5" {
+		t.Fatalf("trades = %+v, want i1 10 then a2 5", trades)
+	}
+	_, asks := e.GetOrderbook("TKA/TKB")
+	if len(asks) != 2 || asks[0].OrderID != "a2" || asks[1].OrderID != "i1" || asks[1].Amount != "20" || asks[1].Filled != "10" {
+		t.Fatalf("asks = %v, want [a2 i1] with i1 showing 10 of remaining 20", orderIDs(asks))
+	}
+	// 隐藏部分成交同样生成普通成交记录：a2 5 + i1 10 + i1 补充后的 10
+	trades = e.Submit(testOrder("b2", "buy", "100", "30", 11)).Trades
+	if len(trades) != 3 || trades[1].MakerOrderID != "i1" || trades[2].MakerOrderID != "i1" || trades[2].Amount != "10" {
+		t.Fatalf("trades = %+v", trades)
+	}
+	if _, asks := e.GetOrderbook("TKA/TKB"); len(asks) != 0 {
+		t.Errorf("asks = %v, want empty", orderIDs(asks))
+	}
+}
+
+func TestReplaceOrderbookKeepsLocalIcebergReserve(t *testing.T) {
+	e := newTestEngine(t, icebergBook())
+	bids, asks := e.GetOrderbook("TKA/TKB")
+	e.ReplaceOrderbook("TKA/TKB", bids, asks)
+	// 本地已有 i1：保留隐藏量，可成交 30
+	o := testOrder("b1", "buy", "100", "40", 10)
+	e.Submit(o)
+	if o.Filled != "40" {
+		t.Errorf("filled = %s, want 40 (hidden reserve kept)", o.Filled)
+	}
+
+	// 本地无该订单：快照只恢复可见部分
+	e2 := newTestEngine(t)
+	e2.ReplaceOrderbook("TKA/TKB", bids, asks)
+	o2 := testOrder("b1", "buy", "100", "40", 10)
+	e2.Submit(o2)
+	if o2.Filled != "20" {
+		t.Errorf("filled = %s, want 20 (visible only)", o2.Filled)
+	}
+}
+
+func TestValidateIceberg(t *testing.T) {
+	cases := []struct {
+		o  storage.Order
+		ok bool
+	}{
+		{storage.Order{}, true},
+		{storage.Order{Amount: "30", DisplayAmount: "10"}, true},
+		{storage.Order{Amount: "30", DisplayAmount: "0"}, false},
+		{storage.Order{Amount: "30", DisplayAmount: "40"}, false},
+		{storage.Order{Amount: "30", DisplayAmount: "10", TimeInForce: storage.TimeInForceIOC}, false},
+		{storage.Order{Type: storage.OrderTypeMarket, Amount: "30", DisplayAmount: "10"}, false},
+	}
+	for i, c := range cases {
+		if err := ValidateIceberg(&c.o); (err == nil) != c.ok {
+			t.Errorf("case %d: err=%v want ok=%v", i, err, c.ok)
+		}
+	}
+}
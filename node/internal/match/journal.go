@@ -0,0 +1,389 @@
+package match
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 日志事件类型：撮合引擎的每种状态输入对应一种事件（见 Engine.ApplyEvent）
+const (
+	EventSubmit        = "submit"         // Submit 新订单
+	EventAdd           = "add"            // AddOrder 直接挂单（恢复/同步）
+	EventMatch         = "match"          // Match 仅撮合不挂单
+	EventCancel        = "cancel"         // RemoveOrder 撤单
+	EventAmend         = "amend"          // AmendOrder 改单
+	EventExpire        = "expire"         // ExpireOrder 过期移除
+	EventReplaceBook   = "replace_book"   // ReplaceOrderbook 订单簿同步
+	EventPair          = "pair"           // EnsurePair 新建交易对订单簿
+	EventAuction       = "auction"        // RunAuction 批量拍卖清算
+	EventLastPrice     = "last_price"     // SetLastTradePrice 最新成交价
+	EventTraderVolumes = "trader_volumes" // SetTraderVolumes 手续费等级快照
+	EventPeriod        = "period"         // SetCurrentPeriod 切换统计周期
+	EventPairState     = "pair_state"     // SetPairState / AdvancePairStates 交易对状态切换
+	EventListPair      = "list_pair"      // ListPair 运行时上架交易对
+	EventDelistPair    = "delist_pair"    // DelistPair 运行时下架交易对
+	EventCancelAll     = "cancel_all"     // CancelTraderBelowNonce 按 nonce 批量撤单
+)
+
+// JournalEvent 预写日志记录：Seq 连续递增，Time 为引擎处理该输入时的时钟（unix 秒），
+// 订单过期判断等依赖时间的逻辑以 Time 为准，回放时按原值复现
+type JournalEvent struct {
+	Seq     uint64            `json:"seq"`
+	Type    string            `json:"type"`
+	Time    int64             `json:"time"`
+	Pair    string            `json:"pair,omitempty"`
+	OrderID string            `json:"orderId,omitempty"`
+	Order   *storage.Order    `json:"order,omitempty"`
+	Bids    []*storage.Order  `json:"bids,omitempty"`
+	Asks    []*storage.Order  `json:"asks,omitempty"`
+	Price   string            `json:"price,omitempty"`  // amend 新价格 / last_price 成交价
+	Amount  string            `json:"amount,omitempty"` // amend 新剩余数量
+	Ts      int64             `json:"ts,omitempty"`     // amend 签名时间 / last_price 成交时间
+	EpochID int64             `json:"epochId,omitempty"`
+	Period  string            `json:"period,omitempty"`
+	Volumes map[string]string `json:"volumes,omitempty"`
+	// pair_state：目标状态、持续秒数（到期自动流转）与原因
+	State    string `json:"state,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// list_pair：交易对参数
+	Market *PairTokens `json:"market,omitempty"`
+	// cancel_all：trader 与 nonce 上限（撤销 nonce < Nonce 的订单）
+	Trader string `json:"trader,omitempty"`
+	Nonce  int64  `json:"nonce,omitempty"`
+	// amend：改单签名（回放时一并追加到订单的改单签名链）
+	Signature string `json:"signature,omitempty"`
+}
+
+// journalSegmentSize 单个日志段上限，超过后新开一段
+const journalSegmentSize = 64 << 20
+
+// journalHeaderSize 记录头：4 字节负载长度 + 4 字节 CRC32C（大端）
+const journalHeaderSize = 8
+
+// journalMaxRecord 单条记录负载上限（订单簿同步事件可能较大），超过视为损坏
+const journalMaxRecord = 64 << 20
+
+var journalCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrJournalCorrupt 日志中间段损坏或序号不连续（尾部残缺记录不算，打开时自动截断）
+var ErrJournalCorrupt = errors.New("journal corrupt")
+
+// Journal 撮合引擎预写日志：目录下按起始序号命名的段文件 journal-<seq>.log，
+// 每条记录为 [长度][CRC32C][JSON 负载]，追加写入并默认逐条 fsync
+type Journal struct {
+	mu         sync.Mutex
+	dir        string
+	f          *os.File
+	size       int64
+	seq        uint64 // 最后一条记录的序号
+	noSync     bool
+	archiveDir string // 非空时 Prune 将旧段移入该目录而非删除（离线审计回放）
+}
+
+// OpenJournal 打开（不存在则创建）日志目录：校验全部记录，截断最后一段尾部的残缺记录（写入中途崩溃），
+// 之后的追加从最后一条记录的下一序号开始；noSync 为 true 时不逐条 fsync（吞吐更高，断电可能丢失最后几条）
+func OpenJournal(dir string, noSync bool) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	segs, err := journalSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{dir: dir, noSync: noSync}
+	var tail int64
+	for i, s := range segs {
+		last := i == len(segs)-1
+		if j.seq == 0 && s.start > 0 {
+			j.seq = s.start - 1
+		}
+		good, err := scanSegment(s.path, last, func(ev *JournalEvent) error {
+			if ev.Seq != j.seq+1 {
+				return fmt.Errorf("%w: %s seq %d after %d", ErrJournalCorrupt, filepath.Base(s.path), ev.Seq, j.seq)
+			}
+			j.seq = ev.Seq
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		tail = good
+	}
+	if len(segs) == 0 {
+		return j, j.rotate()
+	}
+	path := segs[len(segs)-1].path
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if st, err := f.Stat(); err == nil && st.Size() > tail {
+		log.Printf("[journal] %s 尾部 %d 字节残缺，已截断", filepath.Base(path), st.Size()-tail)
+		if err := f.Truncate(tail); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(tail, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	j.f, j.size = f, tail
+	return j, nil
+}
+
+// Dir 返回日志目录
+func (j *Journal) Dir() string { return j.dir }
+
+// LastSeq 返回最后一条已写入记录的序号（空日志为 0）
+func (j *Journal) LastSeq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Append 分配下一序号并写入记录；返回 nil 后记录已持久化（noSync 时已写入页缓存）
+// 写入失败时回退到写入前的长度，序号不前进，调用方不得应用该输入
+func (j *Journal) Append(ev *JournalEvent) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return fmt.Errorf("journal closed")
+	}
+	ev.Seq = j.seq + 1
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, journalHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, journalCRC))
+	copy(buf[journalHeaderSize:], payload)
+	if _, err := j.f.Write(buf); err == nil && !j.noSync {
+		err = j.f.Sync()
+	}
+	if err != nil {
+		_ = j.f.Truncate(j.size)
+		_, _ = j.f.Seek(j.size, io.SeekStart)
+		return fmt.Errorf("journal append: %w", err)
+	}
+	j.seq = ev.Seq
+	j.size += int64(len(buf))
+	if j.size >= journalSegmentSize {
+		if err := j.rotate(); err != nil {
+			log.Printf("[journal] 新建日志段失败，继续写入当前段: %v", err)
+		}
+	}
+	return nil
+}
+
+// rotate 关闭当前段并以下一序号新建段（调用方需已持锁或处于初始化）
+func (j *Journal) rotate() error {
+	path := filepath.Join(j.dir, fmt.Sprintf("journal-%020d.log", j.seq+1))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if j.f != nil {
+		_ = j.f.Close()
+	}
+	j.f, j.size = f, 0
+	return nil
+}
+
+// SetArchiveDir 设置旧段归档目录：非空时 Prune 将段文件移入该目录保留，为空则直接删除
+func (j *Journal) SetArchiveDir(dir string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.archiveDir = dir
+}
+
+// Prune 清理最后一条记录序号 <= upto 的日志段（即已被快照完全覆盖的段），当前写入段始终保留；
+// 返回清理的段数。设置了归档目录时移入归档目录，否则删除
+func (j *Journal) Prune(upto uint64) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	segs, err := journalSegments(j.dir)
+	if err != nil {
+		return 0, err
+	}
+	if j.archiveDir != "" {
+		if err := os.MkdirAll(j.archiveDir, 0755); err != nil {
+			return 0, err
+		}
+	}
+	n := 0
+	for i := 0; i+1 < len(segs); i++ {
+		if segs[i+1].start-1 > upto {
+			break
+		}
+		if j.archiveDir != "" {
+			err = os.Rename(segs[i].path, filepath.Join(j.archiveDir, filepath.Base(segs[i].path)))
+		} else {
+			err = os.Remove(segs[i].path)
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Sync 将已追加的记录刷盘（noSync 模式下写快照前调用）
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	return j.f.Sync()
+}
+
+// Close 刷盘并关闭日志
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Sync()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	j.f = nil
+	return err
+}
+
+// ReadJournal 按序读取 dir 中 seq > afterSeq 的记录；最后一段尾部的残缺记录被忽略（视为未写完），
+// 其余位置的校验失败、序号不连续或首条记录晚于 afterSeq+1（所需段已被 Prune 清理）返回 ErrJournalCorrupt；fn 返回错误时停止
+func ReadJournal(dir string, afterSeq uint64, fn func(ev *JournalEvent) error) error {
+	segs, err := journalSegments(dir)
+	if err != nil {
+		return err
+	}
+	var prev uint64
+	for i, s := range segs {
+		// 跳过完全位于 afterSeq 之前的段
+		if i+1 < len(segs) && segs[i+1].start <= afterSeq+1 {
+			continue
+		}
+		_, err := scanSegment(s.path, i == len(segs)-1, func(ev *JournalEvent) error {
+			if prev != 0 && ev.Seq != prev+1 {
+				return fmt.Errorf("%w: %s seq %d after %d", ErrJournalCorrupt, filepath.Base(s.path), ev.Seq, prev)
+			}
+			if prev == 0 && ev.Seq > afterSeq+1 {
+				return fmt.Errorf("%w: %s starts at seq %d, need %d", ErrJournalCorrupt, filepath.Base(s.path), ev.Seq, afterSeq+1)
+			}
+			prev = ev.Seq
+			if ev.Seq <= afterSeq {
+				return nil
+			}
+			return fn(ev)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type journalSegment struct {
+	path  string
+	start uint64
+}
+
+// journalSegments 列出日志段，按起始序号升序
+func journalSegments(dir string) ([]journalSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var segs []journalSegment
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || !strings.HasPrefix(name, "journal-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "journal-"), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, journalSegment{path: filepath.Join(dir, name), start: start})
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].start < segs[j].start })
+	return segs, nil
+}
+
+// scanSegment 逐条校验并解码段内记录，返回最后一条完整记录的结束偏移
+// tolerateTail 为 true 时段尾残缺或校验失败的记录视为写入中断，停止扫描而不报错
+func scanSegment(path string, tolerateTail bool, fn func(ev *JournalEvent) error) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var off int64
+	for int(off) < len(data) {
+		rest := data[off:]
+		// bad 为记录损坏原因；tail 表示损坏可解释为段尾写入中断：记录延伸到文件末尾，或其后只有文件系统补零
+		bad, tail := "", false
+		var payload []byte
+		if len(rest) < journalHeaderSize {
+			bad, tail = "truncated header", true
+		} else if n := binary.BigEndian.Uint32(rest[0:4]); n == 0 || n > journalMaxRecord {
+			bad, tail = "invalid record length", allZero(rest)
+		} else if int(n) > len(rest)-journalHeaderSize {
+			bad, tail = "truncated record", true
+		} else {
+			payload = rest[journalHeaderSize : journalHeaderSize+int(n)]
+			tail = allZero(rest[journalHeaderSize+int(n):])
+			if crc32.Checksum(payload, journalCRC) != binary.BigEndian.Uint32(rest[4:8]) {
+				bad = "checksum mismatch"
+			}
+		}
+		var ev JournalEvent
+		if bad == "" {
+			if err := json.Unmarshal(payload, &ev); err != nil {
+				bad = "invalid payload"
+			}
+		}
+		if bad != "" {
+			// 中间损坏（其后还有非零数据）不能静默截断
+			if tolerateTail && tail {
+				return off, nil
+			}
+			return off, fmt.Errorf("%w: %s at offset %d: %s", ErrJournalCorrupt, filepath.Base(path), off, bad)
+		}
+		if err := fn(&ev); err != nil {
+			return off, err
+		}
+		off += int64(journalHeaderSize + len(payload))
+	}
+	return off, nil
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
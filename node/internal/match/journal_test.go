@@ -0,0 +1,172 @@
+package match
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func journalTestEngine(t *testing.T, dir string) (*Engine, *Journal) {
+	t.Helper()
+	j, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	e := newTestEngine(t)
+	if _, err := ReplayJournal(e, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	e.SetJournal(j)
+	return e, j
+}
+
+func bookJSON(t *testing.T, e *Engine) string {
+	t.Helper()
+	bids, asks := e.GetOrderbook("TKA/TKB")
+	data, err := json.Marshal([][]*storage.Order{bids, asks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestJournalReplayRestoresMakerFills(t *testing.T) {
+	dir := t.TempDir()
+	e, j := journalTestEngine(t, dir)
+	e.EnsurePair("TKA/TKB")
+	e.Submit(testOrder("a1", "sell", "100", "10", 1))
+	e.Submit(testOrder("a2", "sell", "101", "10", 2))
+	e.Submit(testOrder("b1", "buy", "100", "4", 3))
+	e.Submit(testOrder("b2", "buy", "99", "5", 4))
+	e.RemoveOrder("", "b2")
+	if _, err := e.AmendOrder("a2", "102", "0", 5, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := bookJSON(t, e)
+	if j.LastSeq() != 7 || e.LastSeq() != 7 {
+		t.Fatalf("journal seq = %d engine seq = %d, want 7", j.LastSeq(), e.LastSeq())
+	}
+	j.Close()
+
+	var trades []*storage.Trade
+	e2 := newTestEngine(t)
+	n, err := ReplayJournal(e2, dir, func(ev *JournalEvent, tr []*storage.Trade) { trades = append(trades, tr...) })
+	if err != nil || n != 7 {
+		t.Fatalf("replayed %d events: %v", n, err)
+	}
+	if got := bookJSON(t, e2); got != want {
+		t.Errorf("replayed book differs:\n got %s\nwant %s", got, want)
+	}
+	// a1 作为 maker 部分成交 4，重启后剩余 6（从订单表恢复时会丢失此成交）
+	if o := e2.GetOrder("a1"); o == nil || o.Remaining().Int64() != 6 {
+		t.Errorf("a1 after replay = %+v, want remaining 6", o)
+	}
+	if len(trades) != 1 || trades[0].TradeID != "b1-a1-1" || trades[0].Amount != "4" {
+		t.Errorf("replayed trades = %+v", trades)
+	}
+}
+
+func TestJournalTornTailTruncated(t *testing.T) {
+	dir := t.TempDir()
+	e, j := journalTestEngine(t, dir)
+	e.Submit(testOrder("a1", "sell", "100", "10", 1))
+	e.Submit(testOrder("a2", "sell", "101", "10", 2))
+	j.Close()
+	segs, _ := journalSegments(dir)
+	path := segs[len(segs)-1].path
+	st, _ := os.Stat(path)
+	// 模拟写入中途崩溃：截掉最后一条记录的末尾 3 字节
+	if err := os.Truncate(path, st.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	e2, j2 := journalTestEngine(t, dir)
+	if j2.LastSeq() != 1 || e2.GetOrder("a1") == nil || e2.GetOrder("a2") != nil {
+		t.Fatalf("seq = %d, want only a1 restored", j2.LastSeq())
+	}
+	// 截断后继续追加，序号接续
+	e2.Submit(testOrder("a3", "sell", "102", "10", 3))
+	if j2.LastSeq() != 2 {
+		t.Errorf("seq after append = %d, want 2", j2.LastSeq())
+	}
+}
+
+func TestJournalMidSegmentCorruption(t *testing.T) {
+	dir := t.TempDir()
+	e, j := journalTestEngine(t, dir)
+	e.Submit(testOrder("a1", "sell", "100", "10", 1))
+	e.Submit(testOrder("a2", "sell", "101", "10", 2))
+	j.Close()
+	segs, _ := journalSegments(dir)
+	data, _ := os.ReadFile(segs[0].path)
+	data[journalHeaderSize+5] ^= 0xff
+	if err := os.WriteFile(segs[0].path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenJournal(dir, false); !errors.Is(err, ErrJournalCorrupt) {
+		t.Errorf("open corrupted journal: err = %v, want ErrJournalCorrupt", err)
+	}
+}
+
+// 中间记录的长度字段损坏（为 0 或超过上限）时报错，段尾的文件系统补零视为写入中断
+func TestJournalMidSegmentBadLength(t *testing.T) {
+	dir := t.TempDir()
+	e, j := journalTestEngine(t, dir)
+	e.Submit(testOrder("a1", "sell", "100", "10", 1))
+	e.Submit(testOrder("a2", "sell", "101", "10", 2))
+	j.Close()
+	segs, _ := journalSegments(dir)
+	path := segs[0].path
+	data, _ := os.ReadFile(path)
+	for _, n := range []uint32{0, journalMaxRecord + 1} {
+		bad := append([]byte(nil), data...)
+		binary.BigEndian.PutUint32(bad[0:4], n)
+		if err := os.WriteFile(path, bad, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenJournal(dir, false); !errors.Is(err, ErrJournalCorrupt) {
+			t.Errorf("length %d: err = %v, want ErrJournalCorrupt", n, err)
+		}
+	}
+	if err := os.WriteFile(path, append(data, make([]byte, 32)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j2, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatalf("zero-filled tail: %v", err)
+	}
+	defer j2.Close()
+	if j2.LastSeq() != 2 {
+		t.Errorf("seq = %d, want 2", j2.LastSeq())
+	}
+}
+
+func TestJournalReplayExpiryUsesRecordedClock(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 记录时未过期的订单回放时仍按记录时间判断，与回放当下时间无关
+	o := testOrder("a1", "sell", "100", "10", 1, withExpiry(1000))
+	for _, ev := range []*JournalEvent{
+		{Type: EventSubmit, Time: 500, Order: o},
+		{Type: EventExpire, Time: 900, OrderID: "a1"},
+	} {
+		if err := j.Append(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+	e := newTestEngine(t)
+	if _, err := ReplayJournal(e, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e.GetOrder("a1") == nil {
+		t.Error("order expired during replay despite recorded clock")
+	}
+}
@@ -0,0 +1,299 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"strings"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// L3 事件类型
+const (
+	L3Add     = "add"     // 订单进入订单簿（冰山单补充可见量后重新排到队尾亦为 add）
+	L3Execute = "execute" // 簿内订单成交 Qty，Amount 为成交后可见剩余量（0 表示移出订单簿）
+	L3Reduce  = "reduce"  // 簿内订单原地减量（改单减量、自成交防护），队列位置不变
+	L3Cancel  = "cancel"  // 订单移出订单簿（撤单、过期、自成交防护撤销、nonce 作废等）
+	L3Reset   = "reset"   // 订单簿被新建或整体替换（订单簿同步、快照加载、下架），Bids/Asks 为全量
+)
+
+// l3ChecksumLevels 校验和覆盖的每侧档位数
+const l3ChecksumLevels = 10
+
+// ErrL3Gap 事件序号与本地订单簿不连续，需重新订阅取得快照
+var ErrL3Gap = errors.New("l3 sequence gap")
+
+// ErrL3Checksum 应用事件后本地订单簿与引擎的校验和不一致，需重新订阅取得快照
+var ErrL3Checksum = errors.New("l3 checksum mismatch")
+
+// L3Order 簿内订单的对外视图：Amount 为当前可见剩余量（冰山单隐藏量不外泄），不含 trader
+type L3Order struct {
+	OrderID string `json:"orderId"`
+	Side    string `json:"side"`
+	Price   string `json:"price"`
+	Amount  string `json:"amount"`
+}
+
+// L3Event 逐笔行情事件：Seq 在交易对内从 1 起逐条递增（reset 除外，订阅端收到 reset 时以其序号为准），
+// Checksum 为事件生效后订单簿最优 10 档的 CRC32（见 L3Checksum），订阅端据此校验本地重建结果
+type L3Event struct {
+	Pair     string    `json:"pair"`
+	Seq      uint64    `json:"seq"`
+	Type     string    `json:"type"`
+	OrderID  string    `json:"orderId,omitempty"`
+	Side     string    `json:"side,omitempty"`
+	Price    string    `json:"price,omitempty"`
+	Amount   string    `json:"amount,omitempty"`
+	Qty      string    `json:"qty,omitempty"`
+	Checksum uint32    `json:"checksum"`
+	Bids     []L3Order `json:"bids,omitempty"` // 仅 reset：按价格-时间优先顺序的全量
+	Asks     []L3Order `json:"asks,omitempty"`
+}
+
+// L3Snapshot 交易对逐笔快照：Seq 为快照已包含的最后一条事件序号，订阅端从 seq == Seq+1 的事件开始应用
+type L3Snapshot struct {
+	Pair     string    `json:"pair"`
+	Seq      uint64    `json:"seq"`
+	Checksum uint32    `json:"checksum"`
+	Bids     []L3Order `json:"bids"`
+	Asks     []L3Order `json:"asks"`
+}
+
+// L3Checksum 计算最优档位校验和：买卖盘各取前 10 个非空档位，按 买1价:买1量:卖1价:卖1量:买2价:... 交替拼接（一侧不足时跳过）后取 CRC32-IEEE
+func L3Checksum(bids, asks []PriceLevel) uint32 {
+	var b strings.Builder
+	for i := 0; i < l3ChecksumLevels && (i < len(bids) || i < len(asks)); i++ {
+		for _, side := range [][]PriceLevel{bids, asks} {
+			if i < len(side) {
+				if b.Len() > 0 {
+					b.WriteByte(':')
+				}
+				b.WriteString(side[i].Price)
+				b.WriteByte(':')
+				b.WriteString(side[i].Amount)
+			}
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(b.String()))
+}
+
+// SetL3Sink 设置 L3 事件接收方：引擎在释放交易对的锁之前按序号顺序以批次调用 fn（一次输入产生的全部事件）
+// fn 在引擎锁内执行，须立即返回且不得回调引擎（见 L3Feed）；nil 为不记录事件。设置前的订单簿状态由 L3Snapshot 取得
+func (e *Engine) SetL3Sink(fn func([]*L3Event)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.l3Sink = fn
+	for _, ob := range e.pairs {
+		ob.l3 = fn != nil
+		ob.l3Events = nil
+	}
+}
+
+// L3Snapshot 返回交易对逐笔快照；交易对不存在时返回 false
+func (e *Engine) L3Snapshot(pair string) (*L3Snapshot, bool) {
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return nil, false
+	}
+	ob := e.pairs[pair]
+	// 先发布未发布的事件，快照内容与序号一致
+	e.publishBookLocked(ob)
+	return ob.l3Snapshot(), true
+}
+
+// publishL3Locked 发布订单簿自上次发布以来的事件；订单簿新建或被整体替换时改为发布一条 reset（调用方需已锁定该交易对分片或持写锁，
+// 且须在 depthChanges 清除 reset 标记之前调用）
+func (e *Engine) publishL3Locked(ob *OrderBook) {
+	events := ob.l3Events
+	ob.l3Events = nil
+	if e.l3Sink != nil && ob.reset {
+		ob.l3Seq++
+		snap := ob.l3Snapshot()
+		events = []*L3Event{{Pair: ob.Pair, Seq: snap.Seq, Type: L3Reset, Checksum: snap.Checksum, Bids: snap.Bids, Asks: snap.Asks}}
+	}
+	ob.l3 = e.l3Sink != nil
+	if ob.l3 && len(events) > 0 {
+		e.l3Sink(events)
+	}
+}
+
+// clearL3Locked 交易对订单簿被移除：发布空的 reset（调用方需已持写锁）
+func (e *Engine) clearL3Locked(ob *OrderBook) {
+	if e.l3Sink == nil {
+		return
+	}
+	ob.l3Seq++
+	e.l3Sink([]*L3Event{{Pair: ob.Pair, Seq: ob.l3Seq, Type: L3Reset, Checksum: L3Checksum(nil, nil)}})
+}
+
+// record 记录一条事件（订单簿已变更之后调用）：amount 为订单变更后的可见剩余量，qty 仅 execute 使用
+// 未启用 L3 或订单簿待发布 reset 时不记录
+func (ob *OrderBook) record(typ string, o *storage.Order, price string, amount, qty *big.Int) {
+	if !ob.l3 || ob.reset {
+		return
+	}
+	ob.l3Seq++
+	ev := &L3Event{
+		Pair:     ob.Pair,
+		Seq:      ob.l3Seq,
+		Type:     typ,
+		OrderID:  o.OrderID,
+		Side:     o.Side,
+		Price:    price,
+		Amount:   storage.FormatUnits(amount),
+		Checksum: ob.checksum(),
+	}
+	if qty != nil {
+		ev.Qty = storage.FormatUnits(qty)
+	}
+	ob.l3Events = append(ob.l3Events, ev)
+}
+
+// checksum 计算当前最优档位校验和（跳过可见量为 0 的档位，如冰山单补充可见量的中间状态）
+func (ob *OrderBook) checksum() uint32 {
+	var sides [2][]PriceLevel
+	for i, buy := range []bool{true, false} {
+		for x := ob.side(buy).head.next[0]; x != nil && len(sides[i]) < l3ChecksumLevels; x = x.next[0] {
+			if l := x.level.depth(); l.Amount != "0" {
+				sides[i] = append(sides[i], l)
+			}
+		}
+	}
+	return L3Checksum(sides[0], sides[1])
+}
+
+// l3Snapshot 返回当前逐笔快照
+func (ob *OrderBook) l3Snapshot() *L3Snapshot {
+	snap := &L3Snapshot{Pair: ob.Pair, Seq: ob.l3Seq, Checksum: ob.checksum()}
+	for _, buy := range []bool{true, false} {
+		s := ob.side(buy)
+		out := make([]L3Order, 0, s.orders)
+		for x := s.head.next[0]; x != nil; x = x.next[0] {
+			for n := x.level.head; n != nil; n = n.next {
+				out = append(out, L3Order{OrderID: n.order.OrderID, Side: n.order.Side, Price: x.level.key, Amount: storage.FormatUnits(n.available(n.order.Remaining()))})
+			}
+		}
+		if buy {
+			snap.Bids = out
+		} else {
+			snap.Asks = out
+		}
+	}
+	return snap
+}
+
+// L3Book 订阅端按逐笔事件重建的订单簿：由快照初始化，按序号应用事件并以校验和核对（其他节点经 L3 流协议订阅时使用）
+// 只维护订单与档位数量，不维护档位内的队列顺序
+type L3Book struct {
+	Pair   string
+	Seq    uint64
+	orders map[string]L3Order
+	depth  *DepthBook
+}
+
+// NewL3Book 由快照创建订阅端订单簿
+func NewL3Book(snap *L3Snapshot) *L3Book {
+	b := &L3Book{Pair: snap.Pair}
+	b.reset(snap.Seq, snap.Bids, snap.Asks)
+	return b
+}
+
+func (b *L3Book) reset(seq uint64, bids, asks []L3Order) {
+	b.Seq = seq
+	b.orders = make(map[string]L3Order, len(bids)+len(asks))
+	b.depth = NewDepthBook(&DepthSnapshot{Pair: b.Pair, Seq: seq})
+	for _, list := range [][]L3Order{bids, asks} {
+		for _, o := range list {
+			b.add(o)
+		}
+	}
+}
+
+// Apply 应用一条事件：reset 替换整个订单簿；其余事件须满足 seq == Seq+1，否则返回 ErrL3Gap 且订单簿不变；
+// 应用后校验和不一致返回 ErrL3Checksum（订单簿已变更，应重新订阅）
+func (b *L3Book) Apply(ev *L3Event) error {
+	if ev.Type == L3Reset {
+		b.reset(ev.Seq, ev.Bids, ev.Asks)
+	} else {
+		if ev.Seq != b.Seq+1 {
+			return fmt.Errorf("%w: %s seq %d, local seq %d", ErrL3Gap, b.Pair, ev.Seq, b.Seq)
+		}
+		b.Seq = ev.Seq
+		switch ev.Type {
+		case L3Add:
+			b.remove(ev.OrderID)
+			b.add(L3Order{OrderID: ev.OrderID, Side: ev.Side, Price: ev.Price, Amount: ev.Amount})
+		case L3Execute, L3Reduce, L3Cancel:
+			b.remove(ev.OrderID)
+			if ev.Type != L3Cancel {
+				b.add(L3Order{OrderID: ev.OrderID, Side: ev.Side, Price: ev.Price, Amount: ev.Amount})
+			}
+		default:
+			return fmt.Errorf("unknown l3 event type %q", ev.Type)
+		}
+	}
+	if got := b.Checksum(); got != ev.Checksum {
+		return fmt.Errorf("%w: %s seq %d checksum %d, local %d", ErrL3Checksum, b.Pair, ev.Seq, ev.Checksum, got)
+	}
+	return nil
+}
+
+// Order 返回簿内订单
+func (b *L3Book) Order(orderID string) (L3Order, bool) {
+	o, ok := b.orders[orderID]
+	return o, ok
+}
+
+// Levels 按价格优先顺序返回某侧 L2 档位（可见量之和），limit > 0 时只取前 limit 档
+func (b *L3Book) Levels(buy bool, limit int) []PriceLevel {
+	return b.depth.Levels(buy, limit, nil)
+}
+
+// Checksum 计算本地订单簿最优档位校验和，与事件中的 Checksum 比较
+func (b *L3Book) Checksum() uint32 {
+	return L3Checksum(b.Levels(true, l3ChecksumLevels), b.Levels(false, l3ChecksumLevels))
+}
+
+// add 加入订单并累加档位数量；可见量为 0 的订单不在簿内
+func (b *L3Book) add(o L3Order) {
+	amount, ok := storage.ParseUnits(o.Amount)
+	if !ok || amount.Sign() <= 0 {
+		return
+	}
+	b.orders[o.OrderID] = o
+	b.adjust(o, amount, 1)
+}
+
+// remove 移除订单并扣减档位数量
+func (b *L3Book) remove(orderID string) {
+	o, ok := b.orders[orderID]
+	if !ok {
+		return
+	}
+	delete(b.orders, orderID)
+	b.adjust(o, new(big.Int).Neg(storage.MustUnits(o.Amount)), -1)
+}
+
+// adjust 档位数量增加 delta、挂单数增加 orders
+func (b *L3Book) adjust(o L3Order, delta *big.Int, orders int) {
+	s := b.depth.side(o.Side == "buy")
+	price, ok := storage.ParseUnits(o.Price)
+	if !ok {
+		return
+	}
+	key := storage.FormatUnits(price)
+	l := PriceLevel{Price: key, Amount: "0"}
+	amount := new(big.Int).Set(delta)
+	if cur, ok := s.levels[key]; ok {
+		amount.Add(amount, cur.amount)
+		l.Orders = cur.Orders
+	}
+	l.Orders += orders
+	if amount.Sign() > 0 {
+		l.Amount = storage.FormatUnits(amount)
+	}
+	s.set(l)
+}
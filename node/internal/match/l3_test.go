@@ -0,0 +1,150 @@
+package match
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 订阅端按序应用逐笔事件重建的订单簿与引擎一致：序号逐条连续，每条事件的校验和均可核对，冰山单只暴露可见量
+func TestL3EventsRebuildBook(t *testing.T) {
+	e := newTestEngine(t)
+	var events []*L3Event
+	e.SetL3Sink(func(batch []*L3Event) { events = append(events, batch...) })
+	snap, ok := e.L3Snapshot("TKA/TKB")
+	if !ok || len(events) != 1 || events[0].Type != L3Reset || events[0].Seq != snap.Seq {
+		t.Fatalf("initial snapshot = %+v events = %+v, want one reset", snap, events)
+	}
+	book := NewL3Book(snap)
+	events = nil
+
+	e.AddOrder(testOrder("i1", "sell", "100", "30", 1, withDisplay("10")))
+	e.AddOrder(testOrder("a2", "sell", "100", "10", 2))
+	e.AddOrder(testOrder("a3", "sell", "101", "5", 3))
+	e.AddOrder(testOrder("b1", "buy", "90", "7", 4))
+	e.Submit(testOrder("t1", "buy", "100", "12", 5)) // 吃 i1 可见 10（补充后排队尾）与 a2 2
+	if _, err := e.AmendOrder("b1", "", "4", 6, ""); err != nil {
+		t.Fatal(err)
+	}
+	e.Submit(testOrder("t2", "buy", "101", "8", 7)) // a2 剩余 8 全部成交
+	e.RemoveOrder("TKA/TKB", "a3")
+	e.CancelTraderBelowNonce("0x1", 1) // 写锁路径
+
+	var types []string
+	for i, ev := range events {
+		if ev.Seq != snap.Seq+uint64(i)+1 {
+			t.Fatalf("event %d: seq=%d, want contiguous after %d", i, ev.Seq, snap.Seq)
+		}
+		if err := book.Apply(ev); err != nil {
+			t.Fatalf("event %d (%+v): %v", i, ev, err)
+		}
+		types = append(types, ev.Type+":"+ev.OrderID)
+	}
+	want := []string{
+		"add:i1", "add:a2", "add:a3", "add:b1",
+		"execute:i1", "add:i1", "execute:a2",
+		"reduce:b1",
+		"execute:a2",
+		"cancel:a3",
+		"cancel:b1", "cancel:i1",
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("events = %v\nwant %v", types, want)
+	}
+	if ev := events[4]; ev.Qty != "10" || ev.Amount != "0" {
+		t.Errorf("iceberg execute = %+v, want qty 10 amount 0", ev)
+	}
+	if ev := events[5]; ev.Amount != "10" {
+		t.Errorf("iceberg replenish = %+v, want visible 10 only", ev)
+	}
+	if _, ok := book.Order("a2"); ok {
+		t.Error("fully filled a2 still in rebuilt book")
+	}
+	got, _ := e.L3Snapshot("TKA/TKB")
+	if book.Seq != got.Seq || book.Checksum() != got.Checksum {
+		t.Errorf("rebuilt seq=%d checksum=%d, engine %+v", book.Seq, book.Checksum(), got)
+	}
+
+	// 订单簿同步整体替换：一条 reset 携带全量，序号延续
+	n := len(events)
+	e.ReplaceOrderbook("TKA/TKB", []*storage.Order{testOrder("b9", "buy", "95", "3", 9)}, nil)
+	if len(events) != n+1 || events[n].Type != L3Reset || events[n].Seq != book.Seq+1 || len(events[n].Bids) != 1 {
+		t.Fatalf("replace: events = %+v, want one reset after seq %d", events[n:], book.Seq)
+	}
+	if err := book.Apply(events[n]); err != nil {
+		t.Fatal(err)
+	}
+	depth, _ := e.DepthSnapshot("TKA/TKB", 0)
+	if got := book.Levels(true, 0); !reflect.DeepEqual(got, depth.Bids) {
+		t.Errorf("after reset bids = %+v, want %+v", got, depth.Bids)
+	}
+
+	// 缺口与校验和不一致均被拒绝
+	e.AddOrder(testOrder("b10", "buy", "94", "1", 10))
+	e.AddOrder(testOrder("b11", "buy", "93", "1", 11))
+	if err := book.Apply(events[len(events)-1]); !errors.Is(err, ErrL3Gap) {
+		t.Errorf("gap: err = %v, want ErrL3Gap", err)
+	}
+	bad := *events[len(events)-2]
+	bad.Checksum++
+	if err := book.Apply(&bad); !errors.Is(err, ErrL3Checksum) {
+		t.Errorf("checksum: err = %v, want ErrL3Checksum", err)
+	}
+}
+
+func TestL3ChecksumFormat(t *testing.T) {
+	bids := []PriceLevel{{"100", "5", 1}, {"99", "2", 1}}
+	asks := []PriceLevel{{"101", "3", 2}}
+	// 买1:卖1:买2 交替拼接
+	if got, want := L3Checksum(bids, asks), L3Checksum([]PriceLevel{{"100", "5", 9}, {"99", "2", 9}}, []PriceLevel{{"101", "3", 9}}); got != want {
+		t.Errorf("checksum depends on order counts: %d != %d", got, want)
+	}
+	if L3Checksum(bids, asks) == L3Checksum(asks, bids) {
+		t.Error("checksum should distinguish sides")
+	}
+}
+
+// 订阅从快照之后的第一条事件开始收到；积压时通道关闭且 Lagged 为 true
+func TestL3FeedSubscribe(t *testing.T) {
+	e := newTestEngine(t)
+	f := NewL3Feed(e)
+	e.AddOrder(testOrder("b1", "buy", "90", "7", 1))
+
+	sub, err := f.Subscribe("TKA/TKB", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.Snapshot.Bids) != 1 {
+		t.Fatalf("snapshot = %+v", sub.Snapshot)
+	}
+	book := NewL3Book(sub.Snapshot)
+	e.AddOrder(testOrder("b2", "buy", "91", "1", 2))
+	f.drain()
+	batch := <-sub.C
+	if len(batch) != 1 || batch[0].OrderID != "b2" {
+		t.Fatalf("batch = %+v", batch)
+	}
+	if err := book.Apply(batch[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不读取：第二批放不进容量 1 的通道，订阅被断开
+	e.AddOrder(testOrder("b3", "buy", "92", "1", 3))
+	e.AddOrder(testOrder("b4", "buy", "93", "1", 4))
+	f.drain()
+	if batch := <-sub.C; len(batch) != 1 || batch[0].OrderID != "b3" {
+		t.Fatalf("queued batch = %+v", batch)
+	}
+	if _, open := <-sub.C; open {
+		t.Fatal("lagging subscription not closed")
+	}
+	if !sub.Lagged() {
+		t.Error("Lagged() = false after overflow")
+	}
+	sub.Close()
+	if _, err := f.Subscribe("NOPE/X", 1); !errors.Is(err, ErrUnknownPair) {
+		t.Errorf("unknown pair: err = %v", err)
+	}
+}
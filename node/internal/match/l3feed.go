@@ -0,0 +1,160 @@
+package match
+
+import (
+	"context"
+	"sync"
+
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+)
+
+// L3Feed L3 逐笔行情分发（WS l3 频道与 libp2p L3 流协议共用）：
+//   - 引擎按交易对序号顺序调用 Publish，Publish 只入队，不在引擎锁内做任何计算
+//   - Subscribe 在交易对锁内取快照并将订阅登记入同一队列，Run 协程按队列顺序推送：订阅恰好从快照之后的第一条事件开始收到
+//   - 订阅的事件通道积压满时关闭通道（Lagged 为 true），订阅方重新 Subscribe 取得新快照
+type L3Feed struct {
+	engine *Engine
+
+	mu      sync.Mutex // 保护 pending
+	pending []l3Item
+	wake    chan struct{}
+
+	smu  sync.Mutex // 保护 subs 与 L3Subscription.closed/lagged
+	subs map[string]map[*L3Subscription]struct{}
+}
+
+// l3Item 队列元素：一批事件或一个待登记的订阅
+type l3Item struct {
+	events []*L3Event
+	sub    *L3Subscription
+}
+
+// L3Subscription 单个交易对订阅：先应用 Snapshot，再按序应用 C 中的事件批次；C 关闭表示订阅结束
+type L3Subscription struct {
+	Pair     string
+	Snapshot *L3Snapshot
+	C        <-chan []*L3Event
+
+	c      chan []*L3Event
+	feed   *L3Feed
+	closed bool
+	lagged bool
+}
+
+// NewL3Feed 创建逐笔行情分发并设置为引擎的 L3 事件接收方
+func NewL3Feed(e *Engine) *L3Feed {
+	f := &L3Feed{
+		engine: e,
+		wake:   make(chan struct{}, 1),
+		subs:   make(map[string]map[*L3Subscription]struct{}),
+	}
+	e.SetL3Sink(f.Publish)
+	return f
+}
+
+// Publish 接收引擎事件批次（见 Engine.SetL3Sink）：只入队并唤醒 Run 协程
+func (f *L3Feed) Publish(events []*L3Event) {
+	f.enqueue(l3Item{events: events})
+}
+
+func (f *L3Feed) enqueue(it l3Item) {
+	f.mu.Lock()
+	f.pending = append(f.pending, it)
+	f.mu.Unlock()
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 处理入队的事件直至 ctx 结束
+func (f *L3Feed) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.wake:
+		}
+		f.drain()
+	}
+}
+
+// drain 按序登记订阅、推送事件
+func (f *L3Feed) drain() {
+	f.mu.Lock()
+	batch := f.pending
+	f.pending = nil
+	f.mu.Unlock()
+	f.smu.Lock()
+	defer f.smu.Unlock()
+	for _, it := range batch {
+		if it.sub != nil {
+			if !it.sub.closed {
+				if f.subs[it.sub.Pair] == nil {
+					f.subs[it.sub.Pair] = make(map[*L3Subscription]struct{})
+				}
+				f.subs[it.sub.Pair][it.sub] = struct{}{}
+			}
+			continue
+		}
+		if len(it.events) == 0 {
+			continue
+		}
+		for sub := range f.subs[it.events[0].Pair] {
+			select {
+			case sub.c <- it.events:
+			default:
+				// 积压：断开订阅，由订阅方重新取快照
+				sub.lagged = true
+				f.closeLocked(sub)
+				metrics.RecordL3Resync(sub.Pair)
+			}
+		}
+	}
+}
+
+// Subscribe 订阅交易对逐笔行情，buffer 为可积压的事件批次数；交易对不存在返回 ErrUnknownPair
+func (f *L3Feed) Subscribe(pair string, buffer int) (*L3Subscription, error) {
+	if buffer <= 0 {
+		buffer = 1
+	}
+	sh, unlock := f.engine.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return nil, ErrUnknownPair
+	}
+	ob := f.engine.pairs[pair]
+	// 先发布未发布的事件（入队在订阅之前），快照之后的事件均排在订阅之后
+	f.engine.publishBookLocked(ob)
+	c := make(chan []*L3Event, buffer)
+	sub := &L3Subscription{Pair: pair, Snapshot: ob.l3Snapshot(), C: c, c: c, feed: f}
+	f.enqueue(l3Item{sub: sub})
+	return sub, nil
+}
+
+// Close 取消订阅并关闭事件通道（可重复调用）
+func (s *L3Subscription) Close() {
+	s.feed.smu.Lock()
+	defer s.feed.smu.Unlock()
+	s.feed.closeLocked(s)
+}
+
+// Lagged 订阅是否因积压被断开（C 关闭后调用）
+func (s *L3Subscription) Lagged() bool {
+	s.feed.smu.Lock()
+	defer s.feed.smu.Unlock()
+	return s.lagged
+}
+
+func (f *L3Feed) closeLocked(s *L3Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.c)
+	if subs, ok := f.subs[s.Pair]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(f.subs, s.Pair)
+		}
+	}
+}
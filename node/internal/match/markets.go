@@ -0,0 +1,282 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/P2P-P2P/p2p/node/internal/config"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// ErrPairExists 交易对已上架
+var ErrPairExists = errors.New("pair already listed")
+
+// HasPair 交易对是否已上架（配置文件或运行时上架）；未上架交易对的订单在 API 与 gossip 入口被拒绝
+func (e *Engine) HasPair(pair string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.tokens[pair]
+	return ok
+}
+
+// PairNames 返回已上架的交易对，按名称排序
+func (e *Engine) PairNames() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return sortedKeys(e.tokens)
+}
+
+// ListPair 运行时上架交易对（写入日志，回放时复现）；已上架返回 ErrPairExists
+func (e *Engine) ListPair(pair string, t PairTokens) error {
+	if pair == "" {
+		return fmt.Errorf("pair required")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.tokens[pair]; ok {
+		return ErrPairExists
+	}
+	if !e.recordLocked(nil, &JournalEvent{Type: EventListPair, Pair: pair, Market: &t}) {
+		return ErrJournalWrite
+	}
+	e.tokens[pair] = t
+	e.shardLocked(pair)
+	log.Printf("[markets] 上架交易对 pair=%s token0=%s token1=%s", pair, t.Token0, t.Token1)
+	return nil
+}
+
+// DelistPair 运行时下架交易对：撤销全部挂单、待触发条件单与待清算拍卖订单，移除订单簿与交易对状态
+// 返回被撤销订单的副本（status=cancelled），供持久化与推送；交易对未上架且无订单簿时返回 ErrUnknownPair
+func (e *Engine) DelistPair(pair string) ([]*storage.Order, error) {
+	e.mu.Lock()
+	defer e.unlockWrite()
+	_, listed := e.tokens[pair]
+	_, hasBook := e.pairs[pair]
+	if !listed && !hasBook {
+		return nil, ErrUnknownPair
+	}
+	if !e.recordLocked(nil, &JournalEvent{Type: EventDelistPair, Pair: pair}) {
+		return nil, ErrJournalWrite
+	}
+	var out []*storage.Order
+	cancel := func(o *storage.Order) {
+		c := *o
+		c.Status = storage.OrderStatusCancelled
+		out = append(out, &c)
+		e.unindexOrder(o.OrderID)
+	}
+	if ob, ok := e.pairs[pair]; ok {
+		for _, id := range sortedKeys(ob.index) {
+			cancel(ob.index[id].order)
+		}
+		e.clearBookLocked(ob)
+	}
+	if tb, ok := e.triggers[pair]; ok {
+		for _, id := range sortedKeys(tb.index) {
+			cancel(tb.index[id].order)
+		}
+	}
+	if sh, ok := e.shards[pair]; ok {
+		for _, o := range sh.auctionIOC {
+			cancel(o)
+		}
+	}
+	delete(e.shards, pair)
+	delete(e.pairs, pair)
+	delete(e.triggers, pair)
+	delete(e.traderVolumes, pair)
+	delete(e.tokens, pair)
+	log.Printf("[markets] 下架交易对 pair=%s，撤销 %d 笔订单", pair, len(out))
+	return out, nil
+}
+
+// MarketRegistry 交易对注册表：运行时上架、下架、暂停与只撤单，持久化到 SQLite（markets 表），
+// 并把本地交易对同步到节点注册表（由其广播给其他节点的路由）
+type MarketRegistry struct {
+	mu       sync.Mutex
+	engine   *Engine
+	store    *storage.DB
+	registry *Registry
+}
+
+// NewMarketRegistry 创建交易对注册表；store 为 nil 时不持久化，registry 为 nil 时不广播
+func NewMarketRegistry(engine *Engine, store *storage.DB, registry *Registry) *MarketRegistry {
+	return &MarketRegistry{engine: engine, store: store, registry: registry}
+}
+
+// Load 按存储中的注册记录覆盖配置文件：上架运行时新增的交易对，移除已下架的交易对
+// 须在 Restore 之前调用（此时引擎尚未设置日志，不重复写入）；快照中已下架交易对的订单由回放的下架事件清除
+func (m *MarketRegistry) Load() error {
+	if m.store == nil {
+		return nil
+	}
+	markets, err := m.store.ListMarkets()
+	if err != nil {
+		return err
+	}
+	for _, mk := range markets {
+		switch mk.Status {
+		case storage.MarketListed:
+			if mk.Config == "" || m.engine.HasPair(mk.Pair) {
+				continue
+			}
+			var pt config.PairTokens
+			if err := yaml.Unmarshal([]byte(mk.Config), &pt); err != nil {
+				return fmt.Errorf("market %s: %w", mk.Pair, err)
+			}
+			t, err := pairTokensFromConfig(mk.Pair, pt)
+			if err != nil {
+				return err
+			}
+			if err := m.engine.ListPair(mk.Pair, t); err != nil {
+				return fmt.Errorf("market %s: %w", mk.Pair, err)
+			}
+		case storage.MarketDelisted:
+			if _, err := m.engine.DelistPair(mk.Pair); err != nil && !errors.Is(err, ErrUnknownPair) {
+				return fmt.Errorf("market %s: %w", mk.Pair, err)
+			}
+		}
+	}
+	m.syncLocalPairs()
+	return nil
+}
+
+// RestoreStates 恢复存储中记录的交易状态（管理员暂停/只撤单等），须在 Restore 之后调用
+// 快照与日志已恢复为相同状态时跳过，已到期的状态不再恢复
+func (m *MarketRegistry) RestoreStates() error {
+	if m.store == nil {
+		return nil
+	}
+	markets, err := m.store.ListMarkets()
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, mk := range markets {
+		if mk.Status != storage.MarketListed || mk.State == "" || mk.State == PairTrading || !m.engine.HasPair(mk.Pair) {
+			continue
+		}
+		if mk.StateUntil > 0 && mk.StateUntil <= now {
+			continue
+		}
+		if state, _ := m.engine.PairState(mk.Pair); state == mk.State {
+			continue
+		}
+		var dur int64
+		if mk.StateUntil > 0 {
+			dur = mk.StateUntil - now
+		}
+		if _, err := m.engine.SetPairState(mk.Pair, mk.State, dur, mk.StateReason); err != nil {
+			return fmt.Errorf("market %s: %w", mk.Pair, err)
+		}
+	}
+	return nil
+}
+
+// List 运行时上架交易对：校验参数后加入撮合引擎，登记到 markets 表并广播本地交易对
+func (m *MarketRegistry) List(pair string, pt config.PairTokens) error {
+	if pair == "" || pt.Token0 == "" || pt.Token1 == "" {
+		return fmt.Errorf("pair, token0 and token1 required")
+	}
+	t, err := pairTokensFromConfig(pair, pt)
+	if err != nil {
+		return err
+	}
+	cfg, err := yaml.Marshal(pt)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.engine.ListPair(pair, t); err != nil {
+		return err
+	}
+	if m.store != nil {
+		if err := m.store.UpsertMarket(&storage.Market{Pair: pair, Status: storage.MarketListed, Config: string(cfg), UpdatedAt: time.Now().Unix()}); err != nil {
+			return fmt.Errorf("persist market %s: %w", pair, err)
+		}
+	}
+	m.syncLocalPairs()
+	return nil
+}
+
+// Delist 运行时下架交易对：撤销全部订单并落库（订单事件经存储回调推送），登记为 delisted 并广播本地交易对
+// 返回被撤销订单的副本
+func (m *MarketRegistry) Delist(pair string) ([]*storage.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cancelled, err := m.engine.DelistPair(pair)
+	if err != nil {
+		return nil, err
+	}
+	if m.store != nil {
+		if err := m.persistDelist(pair, cancelled); err != nil {
+			return cancelled, fmt.Errorf("persist delist %s: %w", pair, err)
+		}
+	}
+	m.syncLocalPairs()
+	return cancelled, nil
+}
+
+// persistDelist 在一个事务中撤销订单（已成交等终态订单跳过），并将注册记录置为 delisted（保留上架参数）
+func (m *MarketRegistry) persistDelist(pair string, cancelled []*storage.Order) error {
+	tx, err := m.store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, o := range cancelled {
+		if err := tx.CloseOrder(o.OrderID, storage.OrderStatusCancelled); err != nil && !errors.Is(err, storage.ErrInvalidOrderTransition) {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	mk, err := m.store.GetMarket(pair)
+	if err != nil {
+		return err
+	}
+	if mk == nil {
+		mk = &storage.Market{Pair: pair}
+	}
+	mk.Status, mk.UpdatedAt = storage.MarketDelisted, time.Now().Unix()
+	return m.store.UpsertMarket(mk)
+}
+
+// SetState 设置交易对交易状态（halted / cancel-only / auction / trading，见 Engine.SetPairState）并持久化
+func (m *MarketRegistry) SetState(pair, state string, durationSec int64, reason string) (*PairStateChange, error) {
+	ch, err := m.engine.SetPairState(pair, state, durationSec, reason)
+	if err != nil {
+		return nil, err
+	}
+	m.RecordState(ch)
+	return ch, nil
+}
+
+// RecordState 持久化交易对状态变化（含熔断自动暂停与到期流转），供重启后 RestoreStates 恢复
+func (m *MarketRegistry) RecordState(ch *PairStateChange) {
+	if m.store == nil || ch == nil {
+		return
+	}
+	state := ch.To
+	if state == PairTrading {
+		state = ""
+	}
+	if err := m.store.SetMarketState(ch.Pair, state, ch.Until, ch.Reason, ch.Time); err != nil {
+		log.Printf("[markets] 记录交易对状态失败 pair=%s: %v", ch.Pair, err)
+	}
+}
+
+// syncLocalPairs 将引擎当前上架的交易对同步到节点注册表并立即广播
+func (m *MarketRegistry) syncLocalPairs() {
+	if m.registry == nil {
+		return
+	}
+	m.registry.SetLocalPairs(m.engine.PairNames())
+}
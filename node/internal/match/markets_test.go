@@ -0,0 +1,124 @@
+package match
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/config"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func TestMarketRegistryListDelistPersisted(t *testing.T) {
+	db, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	e := newTestEngine(t)
+	m := NewMarketRegistry(e, db, nil)
+
+	// 未上架交易对：入口拒绝、不建簿
+	if err := e.CheckMarketRules(testOrder("x1", "sell", "100", "10", 1, withOrderPair("FOO/BAR"))); !errors.Is(err, ErrUnknownPair) {
+		t.Errorf("CheckMarketRules unknown pair: err = %v", err)
+	}
+	x2 := testOrder("x2", "sell", "100", "10", 1, withOrderPair("FOO/BAR"))
+	if e.Submit(x2); x2.Status != storage.OrderStatusRejected {
+		t.Errorf("Submit unknown pair: status = %s", x2.Status)
+	}
+	if e.EnsurePair("FOO/BAR") {
+		t.Error("EnsurePair created a book for an unlisted pair")
+	}
+	if e.AddOrder(testOrder("x3", "sell", "100", "10", 1, withOrderPair("FOO/BAR"))) {
+		t.Error("AddOrder accepted an order on an unlisted pair")
+	}
+	if trades := e.Match(testOrder("x4", "buy", "100", "10", 1, withOrderPair("FOO/BAR"))); len(trades) != 0 {
+		t.Errorf("Match on unlisted pair = %+v", trades)
+	}
+	if e.ReplaceOrderbook("FOO/BAR", []*storage.Order{testOrder("x5", "buy", "90", "10", 1, withOrderPair("FOO/BAR"))}, nil) {
+		t.Error("ReplaceOrderbook accepted a book sync for an unlisted pair")
+	}
+	if _, ok := e.shards["FOO/BAR"]; ok || e.GetOrder("x3") != nil || e.GetOrder("x5") != nil {
+		t.Error("unlisted pair created a shard")
+	}
+
+	if err := m.List("FOO/BAR", config.PairTokens{Token0: "0xf", Token1: "0xb"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.List("FOO/BAR", config.PairTokens{Token0: "0xf", Token1: "0xb"}); !errors.Is(err, ErrPairExists) {
+		t.Errorf("list twice: err = %v", err)
+	}
+	if err := m.List("BAD/PAIR", config.PairTokens{Token0: "0xf"}); err == nil {
+		t.Error("listed pair without token1")
+	}
+	o := testOrder("f1", "sell", "100", "10", 1, withOrderPair("FOO/BAR"))
+	if err := db.InsertOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	if e.Submit(o); o.Status != storage.OrderStatusOpen {
+		t.Fatalf("order on listed pair: status = %s", o.Status)
+	}
+	if _, err := m.SetState("TKA/TKB", PairCancelOnly, 0, "maintenance"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启：新引擎只有配置文件中的交易对，由注册记录补齐上架与状态
+	e2 := newTestEngine(t)
+	m2 := NewMarketRegistry(e2, db, nil)
+	if err := m2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.RestoreStates(); err != nil {
+		t.Fatal(err)
+	}
+	if got := e2.PairNames(); len(got) != 2 || got[0] != "FOO/BAR" {
+		t.Errorf("pairs after reload = %v", got)
+	}
+	if state, _ := e2.PairState("TKA/TKB"); state != PairCancelOnly {
+		t.Errorf("TKA/TKB state after reload = %s", state)
+	}
+
+	cancelled, err := m.Delist("FOO/BAR")
+	if err != nil || len(cancelled) != 1 || cancelled[0].OrderID != "f1" {
+		t.Fatalf("Delist = %v, %v", cancelled, err)
+	}
+	if got, _ := db.GetOrder("f1"); got.Status != storage.OrderStatusCancelled {
+		t.Errorf("delisted order status = %s", got.Status)
+	}
+	if e.HasPair("FOO/BAR") || e.GetOrder("f1") != nil {
+		t.Error("delisted pair still in engine")
+	}
+	e3 := newTestEngine(t)
+	if err := NewMarketRegistry(e3, db, nil).Load(); err != nil {
+		t.Fatal(err)
+	}
+	if e3.HasPair("FOO/BAR") {
+		t.Error("delisted pair listed again after reload")
+	}
+}
+
+func TestListDelistPairReplay(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEngine(t)
+	e.SetJournal(j)
+	if err := e.ListPair("FOO/BAR", PairTokens{Token0: "0xf", Token1: "0xb", Decimals0: 1}); err != nil {
+		t.Fatal(err)
+	}
+	e.Submit(testOrder("f1", "sell", "100", "10", 1, withOrderPair("FOO/BAR")))
+	e.Submit(testOrder("a1", "sell", "100", "10", 1, withOrderPair("TKA/TKB")))
+	if _, err := e.DelistPair("TKA/TKB"); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	e2 := newTestEngine(t)
+	if _, err := ReplayJournal(e2, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e2.GetOrder("f1") == nil || e2.GetOrder("a1") != nil || e2.HasPair("TKA/TKB") {
+		t.Errorf("replayed pairs = %v, f1 resting = %v", e2.PairNames(), e2.GetOrder("f1") != nil)
+	}
+}
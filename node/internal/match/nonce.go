@@ -0,0 +1,140 @@
+package match
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/chain"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// CancelTraderBelowNonce 撤销 trader 在所有交易对中 nonce < below 的挂单、待触发条件单与待清算拍卖订单（一次持锁，原子完成）
+// 返回被撤销订单的副本（status=cancelled），供持久化与推送
+func (e *Engine) CancelTraderBelowNonce(trader string, below int64) []*storage.Order {
+	if trader == "" {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.unlockWrite()
+	if !e.recordLocked(nil, &JournalEvent{Type: EventCancelAll, Trader: trader, Nonce: below}) {
+		return nil
+	}
+	hit := func(o *storage.Order) bool {
+		return o.Nonce < below && strings.EqualFold(o.Trader, trader)
+	}
+	var out []*storage.Order
+	cancel := func(o *storage.Order) {
+		c := *o
+		c.Status = storage.OrderStatusCancelled
+		out = append(out, &c)
+		e.unindexOrder(o.OrderID)
+	}
+	for _, pair := range sortedKeys(e.pairs) {
+		ob := e.pairs[pair]
+		for _, id := range sortedKeys(ob.index) {
+			if o := ob.index[id].order; hit(o) {
+				ob.remove(id)
+				cancel(o)
+			}
+		}
+	}
+	for _, pair := range sortedKeys(e.triggers) {
+		tb := e.triggers[pair]
+		for _, id := range sortedKeys(tb.index) {
+			if o := tb.index[id].order; hit(o) {
+				tb.remove(id)
+				cancel(o)
+			}
+		}
+	}
+	for _, pair := range sortedKeys(e.shards) {
+		for _, o := range append([]*storage.Order(nil), e.shards[pair].auctionIOC...) {
+			if hit(o) {
+				e.removeAuctionIOCLocked(pair, o.OrderID)
+				cancel(o)
+			}
+		}
+	}
+	if len(out) > 0 {
+		log.Printf("[match] 批量撤单 trader=%s nonce<%d，撤销 %d 笔订单", trader, below, len(out))
+	}
+	return out
+}
+
+// nonceCheckTimeout 链上 nonce 查询超时
+const nonceCheckTimeout = 3 * time.Second
+
+// ErrNonceUnavailable 链上 nonce 查询失败，无法确认 nonce 有效，订单不予接受（可重试）
+var ErrNonceUnavailable = errors.New("nonce check unavailable")
+
+// NonceGuard 订单 nonce 校验：本地存储记录每个 trader 已使用的最大 nonce 与批量撤单下限（权威），
+// 可选经链上 OrderNonceManager.isValidNonce 交叉校验（链上返回无效则拒绝，RPC 失败返回 ErrNonceUnavailable）。
+// 与链上一致，nonce 须严格递增：同一 trader 在不同交易对的订单由各自的 worker 并行入簿，较大的 nonce 先被占用后
+// 较小的 nonce 即被拒绝，客户端须跨交易对串行使用 nonce（上一笔订单入簿后再提交下一笔）
+type NonceGuard struct {
+	store *storage.DB
+	chain chain.NonceReader
+}
+
+// NewNonceGuard 创建 nonce 校验器；store 为 nil 时不做本地校验，reader 为 nil 时不查链
+func NewNonceGuard(store *storage.DB, reader chain.NonceReader) *NonceGuard {
+	return &NonceGuard{store: store, chain: reader}
+}
+
+// Check 只读校验订单 nonce（API 入口与 gossip 准入预检）；已使用、低于下限或链上无效返回 storage.ErrNonceUsed，
+// 链上查询失败返回 ErrNonceUnavailable
+func (g *NonceGuard) Check(o *storage.Order) error {
+	if g == nil {
+		return nil
+	}
+	if g.store != nil {
+		if err := g.store.CheckNonce(o.Trader, o.Nonce); err != nil {
+			return err
+		}
+	}
+	return g.checkChain(o)
+}
+
+// Use 校验并占用订单 nonce；同一 nonce 只能被一个订单占用
+func (g *NonceGuard) Use(o *storage.Order) error {
+	if g == nil {
+		return nil
+	}
+	if err := g.checkChain(o); err != nil {
+		return err
+	}
+	return g.Claim(o)
+}
+
+// Claim 只按本地记录占用订单 nonce，不再查链（准入时已经 Check 交叉校验）；由本节点在订单入簿前调用，
+// 转发给其他节点的订单不会消耗 nonce。已使用或低于批量撤单下限返回 storage.ErrNonceUsed
+func (g *NonceGuard) Claim(o *storage.Order) error {
+	if g == nil || g.store == nil {
+		return nil
+	}
+	return g.store.UseNonce(o.Trader, o.Nonce)
+}
+
+// checkChain 链上交叉校验
+func (g *NonceGuard) checkChain(o *storage.Order) error {
+	if g.chain == nil {
+		return nil
+	}
+	if o.Nonce < 0 {
+		return fmt.Errorf("%w: negative nonce %d", storage.ErrNonceUsed, o.Nonce)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), nonceCheckTimeout)
+	defer cancel()
+	valid, err := g.chain.IsValidNonce(ctx, o.Trader, uint64(o.Nonce))
+	if err != nil {
+		return fmt.Errorf("%w: trader=%s nonce=%d: %v", ErrNonceUnavailable, o.Trader, o.Nonce, err)
+	}
+	if !valid {
+		return fmt.Errorf("%w: trader=%s nonce=%d rejected by chain", storage.ErrNonceUsed, o.Trader, o.Nonce)
+	}
+	return nil
+}
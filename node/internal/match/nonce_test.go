@@ -0,0 +1,125 @@
+package match
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/P2P-P2P/p2p/node/internal/chain"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+const nonceTrader = "0x1111111111111111111111111111111111111111"
+
+func TestNonceGuardWithSimulatedChain(t *testing.T) {
+	db, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sim := chain.NewSimulatedNonceChain()
+	g := NewNonceGuard(db, sim)
+
+	if err := g.Use(testOrder("o1", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(1))); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(testOrder("o2", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(1))); !errors.Is(err, storage.ErrNonceUsed) {
+		t.Errorf("reused nonce: err = %v", err)
+	}
+	// 链上已结算使用的 nonce 即使本地未记录也拒绝
+	if err := sim.UseNonce(nonceTrader, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Use(testOrder("o3", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(5))); !errors.Is(err, storage.ErrNonceUsed) {
+		t.Errorf("nonce below chain nonce: err = %v", err)
+	}
+	if err := g.Use(testOrder("o4", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(8))); err != nil {
+		t.Errorf("nonce above chain nonce: %v", err)
+	}
+	// RPC 故障时无法确认 nonce 有效：返回可重试错误且不占用 nonce
+	sim.Err = errors.New("rpc down")
+	if err := g.Check(testOrder("o5", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(9))); !errors.Is(err, ErrNonceUnavailable) {
+		t.Errorf("chain error on check: err = %v, want ErrNonceUnavailable", err)
+	}
+	if err := g.Use(testOrder("o6", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(9))); !errors.Is(err, ErrNonceUnavailable) {
+		t.Errorf("chain error on use: err = %v, want ErrNonceUnavailable", err)
+	}
+	if n, _ := db.GetTraderNonce(nonceTrader); n.MaxUsed != 8 {
+		t.Errorf("maxUsed after chain error = %d, want 8", n.MaxUsed)
+	}
+	// Claim 只按本地记录占用（准入时已查链），链上故障不影响；重复占用仍拒绝
+	if err := g.Claim(testOrder("o7", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(10))); err != nil {
+		t.Errorf("claim: %v", err)
+	}
+	if err := g.Claim(testOrder("o8", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(10))); !errors.Is(err, storage.ErrNonceUsed) {
+		t.Errorf("reclaimed nonce: err = %v", err)
+	}
+}
+
+func TestCancelTraderBelowNonceAcrossPairs(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := map[string]PairTokens{
+		"TKA/TKB": {Token0: "0xa", Token1: "0xb", Decimals0: 1},
+		"TKC/TKD": {Token0: "0xc", Token1: "0xd", Decimals0: 1},
+	}
+	e := NewEngine(pairs)
+	e.SetJournal(j)
+	e.Submit(testOrder("a1", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(1)))
+	c1 := testOrder("c1", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(2))
+	c1.Pair = "TKC/TKD"
+	e.Submit(c1)
+	e.Submit(testOrder("s1", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(3), withTrigger(storage.TriggerStop, "90")))
+	e.Submit(testOrder("a2", "sell", "100", "10", 1, withTrader(nonceTrader), withNonce(10)))
+	e.Submit(testOrder("x1", "sell", "100", "10", 1, withTrader("0x2222222222222222222222222222222222222222")))
+
+	cancelled := e.CancelTraderBelowNonce("0x1111111111111111111111111111111111111111", 10)
+	if len(cancelled) != 3 {
+		t.Fatalf("cancelled = %d orders, want a1, c1, s1", len(cancelled))
+	}
+	for _, o := range cancelled {
+		if o.Status != storage.OrderStatusCancelled || e.GetOrder(o.OrderID) != nil {
+			t.Errorf("%s: status = %s, still resting = %v", o.OrderID, o.Status, e.GetOrder(o.OrderID) != nil)
+		}
+	}
+	if e.GetOrder("a2") == nil || e.GetOrder("x1") == nil {
+		t.Error("orders at or above nonce, or of other traders, should rest")
+	}
+	j.Close()
+
+	e2 := NewEngine(pairs)
+	if _, err := ReplayJournal(e2, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e2.GetOrder("a1") != nil || e2.GetOrder("s1") != nil || e2.GetOrder("a2") == nil {
+		t.Error("replayed cancel-all differs")
+	}
+}
+
+func TestVerifyCancelAllSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	hash, err := typedDataHash(cancelAllTypedData(addr, 42, 1700000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := "0x" + hex.EncodeToString(sig)
+	if valid, err := VerifyCancelAllSignature(addr, 42, signature, 1700000000); err != nil || !valid {
+		t.Fatalf("expected valid cancel-all signature, got valid=%v err=%v", valid, err)
+	}
+	if valid, _ := VerifyCancelAllSignature(addr, 43, signature, 1700000000); valid {
+		t.Error("tampered nonce should invalidate signature")
+	}
+}
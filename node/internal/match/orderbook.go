@@ -0,0 +1,337 @@
+package match
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// OrderBook 单交易对订单簿
+//
+// §12.2 确定性撮合：FIFO/价格优先
+// - 买卖两侧各为按价格排序的档位跳表（买盘价格降序、卖盘价格升序）
+// - 每个档位内为侵入式 FIFO 双向链表，同价按进入引擎的顺序排队（先到先得），新订单总是追加到队尾
+// - orderID 索引直接定位链表节点：插入/撤单 O(log n)，取最优价 O(1)
+// 撮合时：taker 买则吃 asks 最低价；taker 卖则吃 bids 最高价；同价先到先得
+type OrderBook struct {
+	Pair  string
+	bids  *bookSide
+	asks  *bookSide
+	index map[string]*bookOrder // orderID -> 簿内节点
+	// L2 行情（见 depth.go）：depthSeq 为最后发布的增量序号，reset 表示订单簿新建或被整体替换、下一次发布全量（L2 与 L3）
+	depthSeq uint64
+	reset    bool
+	// L3 逐笔行情（见 l3.go）：l3 为是否记录事件，l3Seq 为最后一条事件序号，l3Events 为尚未发布的事件
+	l3       bool
+	l3Seq    uint64
+	l3Events []*L3Event
+}
+
+// bookOrder 簿内订单节点（侵入式 FIFO 链表）
+type bookOrder struct {
+	order      *storage.Order
+	level      *priceLevel
+	prev, next *bookOrder
+	visible    *big.Int // 冰山单当前可见剩余量；普通订单为 nil
+}
+
+// priceLevel 单一价格档位：同价订单按时间排队
+type priceLevel struct {
+	side       *bookSide
+	price      *big.Int
+	key        string // 规范化价格字符串
+	head, tail *bookOrder
+	count      int
+}
+
+// skiplistMaxHeight 跳表最大层数（2^24 个档位以内期望 O(log n)）
+const skiplistMaxHeight = 24
+
+type skipNode struct {
+	level *priceLevel
+	next  []*skipNode
+}
+
+// bookSide 订单簿一侧：价格档位跳表 + 价格索引
+type bookSide struct {
+	desc   bool // true=买盘（价格降序）
+	head   *skipNode
+	height int
+	levels map[string]*priceLevel
+	orders int
+	seed   uint64              // 层高伪随机状态（固定种子，跳表形状在各节点可复现）
+	dirty  map[string]*big.Int // 自上次发布 L2 增量以来数量变化的档位：价格 key -> 价格
+}
+
+// newOrderBook 创建空订单簿；首次发布 L2/L3 时为全量（Reset），订阅端不依赖此前同名交易对的序号
+func newOrderBook(pair string) *OrderBook {
+	return &OrderBook{
+		Pair:  pair,
+		bids:  newBookSide(true),
+		asks:  newBookSide(false),
+		index: make(map[string]*bookOrder),
+		reset: true,
+	}
+}
+
+func newBookSide(desc bool) *bookSide {
+	return &bookSide{
+		desc:   desc,
+		head:   &skipNode{next: make([]*skipNode, skiplistMaxHeight)},
+		height: 1,
+		levels: make(map[string]*priceLevel),
+		seed:   0x9E3779B97F4A7C15,
+		dirty:  make(map[string]*big.Int),
+	}
+}
+
+// side 返回订单所在一侧
+func (ob *OrderBook) side(buy bool) *bookSide {
+	if buy {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+// Len 返回簿内订单总数
+func (ob *OrderBook) Len() int {
+	return ob.bids.orders + ob.asks.orders
+}
+
+// Depth 返回买卖盘订单数
+func (ob *OrderBook) Depth() (bids, asks int) {
+	return ob.bids.orders, ob.asks.orders
+}
+
+// Has 判断 orderID 是否在簿内
+func (ob *OrderBook) Has(orderID string) bool {
+	_, ok := ob.index[orderID]
+	return ok
+}
+
+// Get 按 orderID 返回簿内订单（原对象，调用方需持引擎锁）
+func (ob *OrderBook) Get(orderID string) *storage.Order {
+	if n, ok := ob.index[orderID]; ok {
+		return n.order
+	}
+	return nil
+}
+
+// insert 将已规范化（restingCopy）的订单追加到对应档位队尾 O(1)
+// 冰山单初始可见量为 min(DisplayAmount, 剩余量)
+func (ob *OrderBook) insert(o *storage.Order, price *big.Int) {
+	n := ob.side(o.Side == "buy").push(o, price)
+	if o.IsIceberg() {
+		n.visible = minUnits(storage.MustUnits(o.DisplayAmount), o.Remaining())
+	}
+	ob.index[o.OrderID] = n
+	ob.record(L3Add, n.order, n.level.key, n.available(o.Remaining()), nil)
+}
+
+// remove 按 orderID 移除订单（撤单）；档位清空时删除档位
+func (ob *OrderBook) remove(orderID string) bool {
+	n, ok := ob.index[orderID]
+	if !ok {
+		return false
+	}
+	price := n.level.key
+	ob.unlink(n)
+	ob.record(L3Cancel, n.order, price, new(big.Int), nil)
+	return true
+}
+
+// unlink 将节点移出订单簿与索引
+func (ob *OrderBook) unlink(n *bookOrder) {
+	delete(ob.index, n.order.OrderID)
+	n.level.side.unlink(n)
+}
+
+// best 返回某侧最优价档位的队首订单与档位价格；空盘返回 nil
+func (ob *OrderBook) best(buy bool) (*storage.Order, *big.Int) {
+	n := ob.bestNode(buy)
+	if n == nil {
+		return nil, nil
+	}
+	return n.order, n.level.price
+}
+
+// bestNode 返回某侧最优价档位的队首节点；空盘返回 nil
+func (ob *OrderBook) bestNode(buy bool) *bookOrder {
+	first := ob.side(buy).head.next[0]
+	if first == nil {
+		return nil
+	}
+	return first.level.head
+}
+
+// canFill 判断某侧在 limit 价格（含）以内的挂单总量是否 >= want；limit 为 nil 表示不限价（FOK 预检）
+// self 非空时（启用自成交防护），在凑足数量前遇到该 trader 的挂单即返回 false
+func (ob *OrderBook) canFill(buy bool, limit, want *big.Int, self string) bool {
+	s := ob.side(buy)
+	left := new(big.Int).Set(want)
+	for x := s.head.next[0]; x != nil && left.Sign() > 0; x = x.next[0] {
+		if limit != nil && s.before(limit, x.level.price) {
+			break
+		}
+		for n := x.level.head; n != nil && left.Sign() > 0; n = n.next {
+			if self != "" && strings.EqualFold(n.order.Trader, self) {
+				return false
+			}
+			left.Sub(left, n.order.Remaining())
+		}
+	}
+	return left.Sign() <= 0
+}
+
+// orders 按价格-时间优先顺序返回某侧订单（原对象，调用方需持引擎锁）
+func (ob *OrderBook) orders(buy bool) []*storage.Order {
+	s := ob.side(buy)
+	out := make([]*storage.Order, 0, s.orders)
+	for x := s.head.next[0]; x != nil; x = x.next[0] {
+		for n := x.level.head; n != nil; n = n.next {
+			out = append(out, n.order)
+		}
+	}
+	return out
+}
+
+// push 将订单追加到 price 档位队尾（按到达顺序排队 O(1)，不按客户端可控的时间字段插队）
+func (s *bookSide) push(o *storage.Order, price *big.Int) *bookOrder {
+	lvl := s.levelFor(price)
+	n := &bookOrder{order: o, level: lvl, prev: lvl.tail}
+	if lvl.tail != nil {
+		lvl.tail.next = n
+	} else {
+		lvl.head = n
+	}
+	lvl.tail = n
+	lvl.count++
+	s.orders++
+	s.touch(lvl)
+	return n
+}
+
+// requeue 将节点移到所在价格档位队尾（失去时间优先，如冰山单补充可见量）
+func (s *bookSide) requeue(n *bookOrder) {
+	price := n.level.price
+	s.unlink(n)
+	lvl := s.levelFor(price)
+	n.level = lvl
+	n.prev = lvl.tail
+	if lvl.tail != nil {
+		lvl.tail.next = n
+	} else {
+		lvl.head = n
+	}
+	lvl.tail = n
+	lvl.count++
+	s.orders++
+}
+
+// unlink 将节点移出所在档位；档位清空时删除档位
+func (s *bookSide) unlink(n *bookOrder) {
+	lvl := n.level
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		lvl.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		lvl.tail = n.prev
+	}
+	n.prev, n.next, n.level = nil, nil, nil
+	lvl.count--
+	s.orders--
+	s.touch(lvl)
+	if lvl.count == 0 {
+		s.deleteLevel(lvl)
+	}
+}
+
+// touch 标记档位数量已变化（下单、撤单、成交与原地减量），由 depthChanges 发布
+func (s *bookSide) touch(lvl *priceLevel) {
+	s.dirty[lvl.key] = lvl.price
+}
+
+// before 判断价格 a 是否应排在 b 之前
+func (s *bookSide) before(a, b *big.Int) bool {
+	c := a.Cmp(b)
+	if s.desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// randomHeight 生成跳表层高（xorshift64，p=1/4）
+func (s *bookSide) randomHeight() int {
+	h := 1
+	for h < skiplistMaxHeight {
+		s.seed ^= s.seed << 13
+		s.seed ^= s.seed >> 7
+		s.seed ^= s.seed << 17
+		if s.seed&3 != 0 {
+			break
+		}
+		h++
+	}
+	return h
+}
+
+// levelFor 返回价格对应档位，不存在则插入跳表
+func (s *bookSide) levelFor(price *big.Int) *priceLevel {
+	key := storage.FormatUnits(price)
+	if lvl, ok := s.levels[key]; ok {
+		return lvl
+	}
+	var update [skiplistMaxHeight]*skipNode
+	x := s.head
+	for i := s.height - 1; i >= 0; i-- {
+		for x.next[i] != nil && s.before(x.next[i].level.price, price) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	h := s.randomHeight()
+	if h > s.height {
+		for i := s.height; i < h; i++ {
+			update[i] = s.head
+		}
+		s.height = h
+	}
+	lvl := &priceLevel{side: s, price: new(big.Int).Set(price), key: key}
+	node := &skipNode{level: lvl, next: make([]*skipNode, h)}
+	for i := 0; i < h; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	s.levels[key] = lvl
+	return lvl
+}
+
+// deleteLevel 从跳表与价格索引中删除档位
+func (s *bookSide) deleteLevel(lvl *priceLevel) {
+	var update [skiplistMaxHeight]*skipNode
+	x := s.head
+	for i := s.height - 1; i >= 0; i-- {
+		for x.next[i] != nil && s.before(x.next[i].level.price, lvl.price) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	target := x.next[0]
+	if target == nil || target.level != lvl {
+		return
+	}
+	for i := 0; i < len(target.next); i++ {
+		if update[i].next[i] == target {
+			update[i].next[i] = target.next[i]
+		}
+	}
+	for s.height > 1 && s.head.next[s.height-1] == nil {
+		s.height--
+	}
+	delete(s.levels, lvl.key)
+}
@@ -210,7 +210,10 @@ func (m *OrderbookSyncManager) applySync(syncMsg *OrderbookSync) {
 	}
 	syncStart := time.Now()
 	log.Printf("[sync] 应用同步数据 pair=%s bids=%d asks=%d", syncMsg.Pair, len(syncMsg.Bids), len(syncMsg.Asks))
-	m.engine.ReplaceOrderbook(syncMsg.Pair, syncMsg.Bids, syncMsg.Asks)
+	if !m.engine.ReplaceOrderbook(syncMsg.Pair, syncMsg.Bids, syncMsg.Asks) {
+		log.Printf("[sync] 交易对未上架，忽略同步数据 pair=%s", syncMsg.Pair)
+		return
+	}
 	m.mu.Lock()
 	m.syncedPairs[syncMsg.Pair] = true
 	m.lastSyncTime[syncMsg.Pair] = time.Now().Unix()
@@ -291,37 +294,39 @@ func OrdersToLevelSnapshot(pair string, bids, asks []*storage.Order) *storage.Or
 
 	agg := func(orders []*storage.Order) []storage.OrderbookLevel {
 		type level struct {
-			price string
-			qty   *big.Float
+			price *big.Int
+			qty   *big.Int
 		}
-		m := make(map[string]*big.Float)
+		// 按规范化价格聚合（"0100" 与 "100" 视为同一档位）
+		m := make(map[string]*level)
 		for _, o := range orders {
 			if o == nil || o.Price == "" {
 				continue
 			}
-			amt := bigNew(o.Amount)
-			filled := bigNew(o.Filled)
-			left := new(big.Float).Sub(amt, filled)
-			if left.Cmp(big.NewFloat(0)) <= 0 {
+			price, ok := storage.ParseUnits(o.Price)
+			if !ok {
+				continue
+			}
+			left := o.Remaining()
+			if left.Sign() <= 0 {
 				continue
 			}
-			if m[o.Price] == nil {
-				m[o.Price] = new(big.Float)
+			key := storage.FormatUnits(price)
+			if m[key] == nil {
+				m[key] = &level{price: price, qty: new(big.Int)}
 			}
-			m[o.Price].Add(m[o.Price], left)
+			m[key].qty.Add(m[key].qty, left)
 		}
-		var levels []level
-		for p, q := range m {
-			levels = append(levels, level{price: p, qty: q})
+		levels := make([]*level, 0, len(m))
+		for _, l := range m {
+			levels = append(levels, l)
 		}
 		sort.Slice(levels, func(i, j int) bool {
-			pi, pj := bigNew(levels[i].price), bigNew(levels[j].price)
-			return pi.Cmp(pj) < 0
+			return levels[i].price.Cmp(levels[j].price) < 0
 		})
 		out := make([]storage.OrderbookLevel, 0, len(levels))
 		for _, l := range levels {
-			q := l.qty.Text('f', 18)
-			out = append(out, storage.OrderbookLevel{l.price, q})
+			out = append(out, storage.OrderbookLevel{storage.FormatUnits(l.price), storage.FormatUnits(l.qty)})
 		}
 		return out
 	}
@@ -329,7 +334,7 @@ func OrdersToLevelSnapshot(pair string, bids, asks []*storage.Order) *storage.Or
 	// bids: 价格降序
 	bidLevels := agg(bids)
 	sort.Slice(bidLevels, func(i, j int) bool {
-		pi, pj := bigNew(bidLevels[i][0]), bigNew(bidLevels[j][0])
+		pi, pj := storage.MustUnits(bidLevels[i][0]), storage.MustUnits(bidLevels[j][0])
 		return pi.Cmp(pj) > 0
 	})
 	snap.Bids = bidLevels
@@ -337,7 +342,7 @@ func OrdersToLevelSnapshot(pair string, bids, asks []*storage.Order) *storage.Or
 	// asks: 价格升序
 	askLevels := agg(asks)
 	sort.Slice(askLevels, func(i, j int) bool {
-		pi, pj := bigNew(askLevels[i][0]), bigNew(askLevels[j][0])
+		pi, pj := storage.MustUnits(askLevels[i][0]), storage.MustUnits(askLevels[j][0])
 		return pi.Cmp(pj) < 0
 	})
 	snap.Asks = askLevels
@@ -0,0 +1,172 @@
+package match
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func orderIDs(orders []*storage.Order) []string {
+	ids := make([]string, 0, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.OrderID)
+	}
+	return ids
+}
+
+func TestOrderBookPriceTimePriority(t *testing.T) {
+	ob := newOrderBook("TKA/TKB")
+	for _, o := range []*storage.Order{
+		testOrder("b1", "buy", "9", "10", 3),
+		testOrder("b2", "buy", "10", "10", 2),
+		testOrder("b3", "buy", "9", "10", 1), // CreatedAt 更早但后到，仍排在 b1 之后
+		testOrder("a1", "sell", "12", "10", 1),
+		testOrder("a2", "sell", "11", "10", 2),
+		testOrder("a3", "sell", "11", "10", 3),
+	} {
+		ob.insert(o, storage.MustUnits(o.Price))
+	}
+	if got := fmt.Sprint(orderIDs(ob.orders(true))); got != "[b2 b1 b3]" {
+		t.Errorf("bids order = %s, want [b2 b1 b3]", got)
+	}
+	if got := fmt.Sprint(orderIDs(ob.orders(false))); got != "[a2 a3 a1]" {
+		t.Errorf("asks order = %s, want [a2 a3 a1]", got)
+	}
+	best, price := ob.best(false)
+	if best == nil || best.OrderID != "a2" || price.Cmp(big.NewInt(11)) != 0 {
+		t.Errorf("best ask = %v @ %v, want a2 @ 11", best, price)
+	}
+	if nb, na := ob.Depth(); nb != 3 || na != 3 {
+		t.Errorf("Depth = %d/%d, want 3/3", nb, na)
+	}
+}
+
+func TestOrderBookRemoveDeletesEmptyLevel(t *testing.T) {
+	ob := newOrderBook("TKA/TKB")
+	for _, o := range []*storage.Order{
+		testOrder("a1", "sell", "11", "10", 1),
+		testOrder("a2", "sell", "11", "10", 2),
+		testOrder("a3", "sell", "12", "10", 3),
+	} {
+		ob.insert(o, storage.MustUnits(o.Price))
+	}
+	if !ob.remove("a1") || ob.remove("a1") {
+		t.Fatal("remove a1 should succeed exactly once")
+	}
+	if best, _ := ob.best(false); best == nil || best.OrderID != "a2" {
+		t.Fatalf("best ask after removing a1 = %v, want a2", best)
+	}
+	ob.remove("a2")
+	if _, ok := ob.asks.levels["11"]; ok {
+		t.Error("empty price level 11 should be deleted")
+	}
+	if best, price := ob.best(false); best == nil || best.OrderID != "a3" || price.Cmp(big.NewInt(12)) != 0 {
+		t.Errorf("best ask = %v @ %v, want a3 @ 12", best, price)
+	}
+	ob.remove("a3")
+	if best, _ := ob.best(false); best != nil || ob.Len() != 0 || len(ob.index) != 0 {
+		t.Errorf("book should be empty, best=%v len=%d", best, ob.Len())
+	}
+}
+
+func TestAddOrderRejectsWhenBookFull(t *testing.T) {
+	e := NewEngine(map[string]PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	e.SetMaxOrdersPerPair(2)
+	if !e.AddOrder(testOrder("b1", "buy", "9", "10", 1)) || !e.AddOrder(testOrder("b2", "buy", "8", "10", 2)) {
+		t.Fatal("AddOrder within limit failed")
+	}
+	if e.AddOrder(testOrder("b3", "buy", "10", "10", 3)) {
+		t.Error("AddOrder should reject when book is full")
+	}
+	// 同 orderID 替换不占新额度
+	if !e.AddOrder(testOrder("b1", "buy", "7", "10", 4)) {
+		t.Error("AddOrder replacing existing orderID should succeed")
+	}
+	bids, _ := e.GetOrderbook("TKA/TKB")
+	if got := fmt.Sprint(orderIDs(bids)); got != "[b2 b1]" {
+		t.Errorf("bids = %s, want [b2 b1]", got)
+	}
+}
+
+const benchRestingOrders = 100000
+
+// benchBook 构造含 n 笔挂单的订单簿（1000 个价格档位）
+func benchBook(n int) (*OrderBook, []*storage.Order) {
+	ob := newOrderBook("TKA/TKB")
+	orders := make([]*storage.Order, n)
+	for i := 0; i < n; i++ {
+		o := testOrder(fmt.Sprintf("o%d", i), "sell", fmt.Sprint(1000+(i*7919)%1000), "10", int64(i))
+		orders[i] = o
+		ob.insert(o, storage.MustUnits(o.Price))
+	}
+	return ob, orders
+}
+
+func BenchmarkOrderBookInsertCancel100k(b *testing.B) {
+	ob, _ := benchBook(benchRestingOrders)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := testOrder("bench", "sell", fmt.Sprint(1000+i%1000), "10", int64(benchRestingOrders+i))
+		ob.insert(o, storage.MustUnits(o.Price))
+		ob.remove("bench")
+	}
+}
+
+func BenchmarkOrderBookBest100k(b *testing.B) {
+	ob, _ := benchBook(benchRestingOrders)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if o, _ := ob.best(false); o == nil {
+			b.Fatal("empty book")
+		}
+	}
+}
+
+func BenchmarkEngineMatch100k(b *testing.B) {
+	e := NewEngine(map[string]PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	e.SetMaxOrdersPerPair(0)
+	_, orders := benchBook(benchRestingOrders)
+	for _, o := range orders {
+		e.AddOrder(o)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// 吃掉一笔最优卖单后补回，保持簿内深度不变
+		taker := testOrder(fmt.Sprintf("t%d", i), "buy", "2000", "10", int64(benchRestingOrders+i))
+		trades := e.Match(taker)
+		if len(trades) != 1 {
+			b.Fatalf("trades = %d, want 1", len(trades))
+		}
+		refill := testOrder(fmt.Sprintf("r%d", i), "sell", trades[0].Price, "10", int64(benchRestingOrders+i))
+		e.AddOrder(refill)
+	}
+}
+
+// BenchmarkSortedSliceInsertCancel100k 旧实现（有序切片 + 线性查找）的基线，用于对比
+func BenchmarkSortedSliceInsertCancel100k(b *testing.B) {
+	_, orders := benchBook(benchRestingOrders)
+	asks := append([]*storage.Order(nil), orders...)
+	sort.SliceStable(asks, func(i, j int) bool {
+		return storage.MustUnits(asks[i].Price).Cmp(storage.MustUnits(asks[j].Price)) < 0
+	})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := testOrder("bench", "sell", fmt.Sprint(1000+i%1000), "10", int64(benchRestingOrders+i))
+		p := storage.MustUnits(o.Price)
+		idx := sort.Search(len(asks), func(j int) bool {
+			return storage.MustUnits(asks[j].Price).Cmp(p) > 0
+		})
+		asks = append(asks, nil)
+		copy(asks[idx+1:], asks[idx:])
+		asks[idx] = o
+		for j, x := range asks {
+			if x.OrderID == "bench" {
+				asks = append(asks[:j], asks[j+1:]...)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package match
+
+import (
+	"fmt"
+
+	"github.com/P2P-P2P/p2p/node/internal/config"
+)
+
+// PairTokensFromConfig 将配置中的交易对转换为撮合引擎参数并校验（自成交防护、交易规则、撮合模式、手续费）
+// 节点启动与离线日志回放工具共用，保证回放时引擎参数与线上一致
+func PairTokensFromConfig(pairs map[string]config.PairTokens) (map[string]PairTokens, error) {
+	out := make(map[string]PairTokens, len(pairs))
+	for pair, pt := range pairs {
+		t, err := pairTokensFromConfig(pair, pt)
+		if err != nil {
+			return nil, err
+		}
+		out[pair] = t
+	}
+	return out, nil
+}
+
+// pairTokensFromConfig 转换并校验单个交易对配置（启动配置与运行时上架共用）
+func pairTokensFromConfig(pair string, pt config.PairTokens) (PairTokens, error) {
+	if err := ValidateSelfTradePrevention(pt.SelfTradePrevention); err != nil {
+		return PairTokens{}, fmt.Errorf("pair=%s: %w", pair, err)
+	}
+	rules := MarketRules{TickSize: pt.TickSize, LotSize: pt.LotSize, MinQty: pt.MinQty, MaxQty: pt.MaxQty, MinNotional: pt.MinNotional, MaxPriceDeviationBps: pt.MaxPriceDeviationBps}
+	if err := rules.Validate(); err != nil {
+		return PairTokens{}, fmt.Errorf("pair=%s: %w", pair, err)
+	}
+	if err := ValidateMatchingMode(pt.MatchingMode, pt.SelfTradePrevention); err != nil {
+		return PairTokens{}, fmt.Errorf("pair=%s: %w", pair, err)
+	}
+	fees := FeeSchedule{MakerBps: pt.MakerFeeBps, TakerBps: pt.TakerFeeBps}
+	for _, tier := range pt.FeeTiers {
+		fees.Tiers = append(fees.Tiers, FeeTier{MinVolume: tier.MinVolume, MakerBps: tier.MakerFeeBps, TakerBps: tier.TakerFeeBps})
+	}
+	if err := fees.Validate(); err != nil {
+		return PairTokens{}, fmt.Errorf("pair=%s: %w", pair, err)
+	}
+	breaker := CircuitBreaker{PriceBandBps: pt.PriceBandBps, HaltMoveBps: pt.HaltMoveBps, HaltWindowSec: pt.HaltWindowSec, HaltCooldownSec: pt.HaltCooldownSec, ReopenAuctionSec: pt.ReopenAuctionSec}
+	if err := breaker.Validate(); err != nil {
+		return PairTokens{}, fmt.Errorf("pair=%s: %w", pair, err)
+	}
+	return PairTokens{Token0: pt.Token0, Token1: pt.Token1, Decimals0: pt.Decimals0, Decimals1: pt.Decimals1, SelfTradePrevention: pt.SelfTradePrevention, Rules: rules, Fees: fees, MatchingMode: pt.MatchingMode, Breaker: breaker}, nil
+}
@@ -3,6 +3,7 @@ package match
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -18,8 +19,9 @@ type MatchNodeRegistration struct {
 
 // Registry 节点注册表：处理节点注册与发现
 type Registry struct {
-	router     *Router
+	router      *Router
 	localPeerID string
+	mu          sync.RWMutex
 	localPairs  []string
 	publish     func(topic string, data []byte) error
 }
@@ -59,9 +61,12 @@ func (r *Registry) broadcastRegistration() {
 		return
 	}
 
+	r.mu.RLock()
+	pairs := r.localPairs
+	r.mu.RUnlock()
 	reg := MatchNodeRegistration{
 		PeerID:    r.localPeerID,
-		Pairs:     r.localPairs,
+		Pairs:     pairs,
 		Capacity:  r.getCurrentCapacity(),
 		Timestamp: time.Now().Unix(),
 	}
@@ -78,7 +83,7 @@ func (r *Registry) broadcastRegistration() {
 		return
 	}
 
-	log.Printf("[registry] 广播注册信息 peerID=%s pairs=%v capacity=%d", r.localPeerID, r.localPairs, reg.Capacity)
+	log.Printf("[registry] 广播注册信息 peerID=%s pairs=%v capacity=%d", r.localPeerID, pairs, reg.Capacity)
 }
 
 // HandleRegistration 处理收到的注册消息
@@ -111,6 +116,23 @@ func (r *Registry) getCurrentCapacity() int {
 	return 0
 }
 
+// SetLocalPairs 更新本地负责的交易对（运行时上架/下架后调用）并立即广播，其他节点的路由随之更新
+func (r *Registry) SetLocalPairs(pairs []string) {
+	r.mu.Lock()
+	r.localPairs = append([]string(nil), pairs...)
+	r.mu.Unlock()
+	if r.publish != nil {
+		r.broadcastRegistration()
+	}
+}
+
+// LocalPairs 返回本地负责的交易对
+func (r *Registry) LocalPairs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.localPairs...)
+}
+
 // UpdateCapacity 更新本地节点负载（由撮合引擎调用）
 func (r *Registry) UpdateCapacity(capacity int) {
 	// 立即广播更新
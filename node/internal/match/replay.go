@@ -0,0 +1,177 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// ErrJournalWrite 输入写入预写日志失败，引擎未应用该输入
+var ErrJournalWrite = errors.New("journal write failed")
+
+// SetJournal 设置预写日志：此后每个改变引擎状态的输入先写日志再应用，写入失败的输入被拒绝
+// 需在回放（ReplayJournal）完成之后、开始接收订单之前调用
+func (e *Engine) SetJournal(j *Journal) {
+	e.jmu.Lock()
+	defer e.jmu.Unlock()
+	e.journal = j
+}
+
+// LastSeq 返回引擎最后应用的日志序号（未启用日志时为 0）
+func (e *Engine) LastSeq() uint64 {
+	e.jmu.Lock()
+	defer e.jmu.Unlock()
+	return e.seq
+}
+
+// recordLocked 在应用输入前推进引擎时钟并写入日志；回放时沿用事件中的时钟与序号，不重复写入
+// sh 为输入所属交易对的分片（调用方已锁定），其时钟供本次输入的 nowLocked 使用；引擎级输入传 nil（调用方需已持写锁）
+// 不同交易对的输入并发写入日志：日志序号只保证同一交易对内的先后，跨交易对的输入互不影响，回放按序号应用结果一致
+// 返回 false 表示日志写入失败，调用方须放弃该输入
+func (e *Engine) recordLocked(sh *pairShard, ev *JournalEvent) bool {
+	e.jmu.Lock()
+	r, j := e.replaying, e.journal
+	e.replaying = nil
+	e.jmu.Unlock()
+	now := e.clock()
+	if r != nil {
+		now = r.Time
+	} else if j != nil {
+		ev.Time = now
+		if err := j.Append(ev); err != nil {
+			log.Printf("[journal] 写入 %s 失败，拒绝该输入: %v", ev.Type, err)
+			return false
+		}
+	}
+	if sh != nil {
+		sh.now = now
+	}
+	e.jmu.Lock()
+	e.now = now
+	switch {
+	case r != nil:
+		e.seq = r.Seq
+	case j != nil && ev.Seq > e.seq:
+		e.seq = ev.Seq
+	}
+	e.jmu.Unlock()
+	return true
+}
+
+// nowLocked 引擎时钟：交易对当前输入的处理时间（回放时为日志记录的时间），用于过期判断与成交时间兜底（调用方需已锁定该分片）
+func (e *Engine) nowLocked(pair string) int64 {
+	if sh := e.shards[pair]; sh != nil && sh.now != 0 {
+		return sh.now
+	}
+	return e.clock()
+}
+
+// ApplyEvent 将一条日志事件应用到引擎（回放用，不再写入日志），返回该事件产生的成交
+// 事件须按序号连续应用，且回放期间不得有其他输入并发进入引擎
+func (e *Engine) ApplyEvent(ev *JournalEvent) ([]*storage.Trade, error) {
+	e.jmu.Lock()
+	if ev.Seq != e.seq+1 && e.seq != 0 {
+		e.jmu.Unlock()
+		return nil, fmt.Errorf("%w: apply seq %d after %d", ErrJournalCorrupt, ev.Seq, e.seq)
+	}
+	e.replaying = ev
+	e.jmu.Unlock()
+	defer func() {
+		e.jmu.Lock()
+		e.replaying = nil
+		e.seq = ev.Seq
+		e.jmu.Unlock()
+	}()
+	switch ev.Type {
+	case EventSubmit:
+		if ev.Order == nil {
+			return nil, fmt.Errorf("%w: seq %d: submit without order", ErrJournalCorrupt, ev.Seq)
+		}
+		return e.Submit(ev.Order).Trades, nil
+	case EventAdd:
+		if ev.Order == nil {
+			return nil, fmt.Errorf("%w: seq %d: add without order", ErrJournalCorrupt, ev.Seq)
+		}
+		e.AddOrder(ev.Order)
+	case EventMatch:
+		if ev.Order == nil {
+			return nil, fmt.Errorf("%w: seq %d: match without order", ErrJournalCorrupt, ev.Seq)
+		}
+		return e.Match(ev.Order), nil
+	case EventCancel:
+		e.RemoveOrder(ev.Pair, ev.OrderID)
+	case EventAmend:
+		res, err := e.AmendOrder(ev.OrderID, ev.Price, ev.Amount, ev.Ts, ev.Signature)
+		if err != nil || res == nil {
+			// 原输入被拒绝时同样被拒绝，状态不变
+			return nil, nil
+		}
+		return res.Trades, nil
+	case EventExpire:
+		e.ExpireOrder(ev.OrderID)
+	case EventReplaceBook:
+		e.ReplaceOrderbook(ev.Pair, ev.Bids, ev.Asks)
+	case EventPair:
+		e.EnsurePair(ev.Pair)
+	case EventAuction:
+		if res := e.RunAuction(ev.Pair, ev.EpochID); res != nil {
+			return res.Trades, nil
+		}
+	case EventLastPrice:
+		e.SetLastTradePrice(ev.Pair, ev.Price, ev.Ts)
+	case EventTraderVolumes:
+		vols := make(map[string]*big.Int, len(ev.Volumes))
+		for trader, v := range ev.Volumes {
+			vols[trader] = storage.MustUnits(v)
+		}
+		e.SetTraderVolumes(ev.Pair, vols)
+	case EventPeriod:
+		e.SetCurrentPeriod(ev.Period)
+	case EventListPair:
+		if ev.Market == nil {
+			return nil, fmt.Errorf("%w: seq %d: list_pair without market", ErrJournalCorrupt, ev.Seq)
+		}
+		// 已由存储中的注册记录上架时跳过
+		_ = e.ListPair(ev.Pair, *ev.Market)
+	case EventDelistPair:
+		_, _ = e.DelistPair(ev.Pair)
+	case EventCancelAll:
+		e.CancelTraderBelowNonce(ev.Trader, ev.Nonce)
+	case EventPairState:
+		ch, err := e.SetPairState(ev.Pair, ev.State, ev.Duration, ev.Reason)
+		if err != nil {
+			return nil, nil
+		}
+		if ch.Auction != nil {
+			return ch.Auction.Trades, nil
+		}
+	default:
+		return nil, fmt.Errorf("%w: seq %d: unknown event type %q", ErrJournalCorrupt, ev.Seq, ev.Type)
+	}
+	return nil, nil
+}
+
+// ReplayJournal 将日志中序号大于引擎 LastSeq 的事件依次应用到引擎，返回应用的事件数
+// onEvent 非 nil 时对每个事件回调其产生的成交（离线审计工具据此重新推导全部成交）
+func ReplayJournal(e *Engine, dir string, onEvent func(ev *JournalEvent, trades []*storage.Trade)) (int, error) {
+	n := 0
+	err := ReadJournal(dir, e.LastSeq(), func(ev *JournalEvent) error {
+		trades, err := e.ApplyEvent(ev)
+		if err != nil {
+			return err
+		}
+		n++
+		if onEvent != nil {
+			onEvent(ev, trades)
+		}
+		return nil
+	})
+	// 回放产生的交易对状态变化在停机前已发布，不再由 AdvancePairStates 重复上报
+	e.changesMu.Lock()
+	e.stateChanges = nil
+	e.changesMu.Unlock()
+	return n, err
+}
@@ -17,7 +17,7 @@ func TestRestoreOrdersFromStore(t *testing.T) {
 
 	// 插入 open 订单
 	o1 := &storage.Order{OrderID: "r1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Price: "1", Amount: "100", Filled: "0", Status: "open", Nonce: 1, CreatedAt: 1, ExpiresAt: 0}
-	o2 := &storage.Order{OrderID: "r2", Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "1.1", Amount: "50", Filled: "0", Status: "open", Nonce: 2, CreatedAt: 2, ExpiresAt: 0}
+	o2 := &storage.Order{OrderID: "r2", Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "11", Amount: "50", Filled: "0", Status: "open", Nonce: 2, CreatedAt: 2, ExpiresAt: 0}
 	if err := store.InsertOrder(o1); err != nil {
 		t.Fatal(err)
 	}
@@ -58,7 +58,7 @@ func TestRestoreAndMatch(t *testing.T) {
 	pairTokens := map[string]PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}}
 
 	// 1. 插入 maker 卖单到 storage（模拟节点重启前持久化的订单）
-	maker := &storage.Order{OrderID: "m1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "1.0", Amount: "100", Filled: "0", Status: "open", Nonce: 1, CreatedAt: 1, ExpiresAt: 0}
+	maker := &storage.Order{OrderID: "m1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "100", Filled: "0", Status: "open", Nonce: 1, CreatedAt: 1, ExpiresAt: 0}
 	if err := store.InsertOrder(maker); err != nil {
 		t.Fatal(err)
 	}
@@ -73,8 +73,8 @@ func TestRestoreAndMatch(t *testing.T) {
 		t.Fatalf("restore: expected 1 ask m1, got bids=%d asks=%v", len(bids), asks)
 	}
 
-	// 3. 撮合 taker 买单（价格 1.0 可吃卖盘）
-	taker := &storage.Order{OrderID: "t1", Trader: "0x2", Pair: "TKA/TKB", Side: "buy", Price: "1.0", Amount: "50", Filled: "0", Status: "open", Nonce: 2, CreatedAt: 2, ExpiresAt: 0}
+	// 3. 撮合 taker 买单（价格 10 可吃卖盘）
+	taker := &storage.Order{OrderID: "t1", Trader: "0x2", Pair: "TKA/TKB", Side: "buy", Price: "10", Amount: "50", Filled: "0", Status: "open", Nonce: 2, CreatedAt: 2, ExpiresAt: 0}
 	trades := engine.Match(taker)
 	if len(trades) != 1 {
 		t.Fatalf("expected 1 trade, got %d", len(trades))
@@ -88,3 +88,34 @@ func TestRestoreAndMatch(t *testing.T) {
 		t.Errorf("trade amount: %s (parsed=%.0f)", tr.Amount, amt)
 	}
 }
+
+// TestRestoreOrdersFromStorePriorityUncapped 全部挂单均恢复（不受盘口查询条数限制），同价按排队时间（改单后 QueuedAt）排序
+func TestRestoreOrdersFromStorePriorityUncapped(t *testing.T) {
+	store, err := storage.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	amended := &storage.Order{OrderID: "q1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Filled: "0", Status: "open", CreatedAt: 1, AmendedAt: 700, QueuedAt: 700}
+	if err := store.InsertOrder(amended); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 600; i++ {
+		o := &storage.Order{OrderID: "o" + strconv.Itoa(i), Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "1", Filled: "0", Status: "open", CreatedAt: int64(2 + i)}
+		if err := store.InsertOrder(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := NewEngine(map[string]PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb"}})
+	st, err := Restore(engine, "", nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Source != RestoreSourceStore || st.Orders != 601 {
+		t.Fatalf("restore stats = %+v, want 601 orders from store", st)
+	}
+	_, asks := engine.GetOrderbook("TKA/TKB")
+	if asks[0].OrderID != "o0" || asks[len(asks)-1].OrderID != "q1" {
+		t.Errorf("queue head=%s tail=%s, want o0 first and amended q1 last", asks[0].OrderID, asks[len(asks)-1].OrderID)
+	}
+}
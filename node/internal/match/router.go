@@ -53,6 +53,23 @@ func (r *Router) RegisterNode(peerID string, pairs []string, capacity int) {
 		UpdatedAt: time.Now().Unix(),
 	}
 
+	// 节点不再负责的交易对（已下架）从映射中移除
+	listed := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		listed[pair] = true
+	}
+	for pair, nodes := range r.pairToNodes {
+		if listed[pair] {
+			continue
+		}
+		for i, n := range nodes {
+			if n == peerID {
+				r.pairToNodes[pair] = append(nodes[:i:i], nodes[i+1:]...)
+				break
+			}
+		}
+	}
+
 	// 更新交易对到节点的映射
 	for _, pair := range pairs {
 		if pair == "" {
@@ -228,6 +245,13 @@ func (r *Router) RouteOrder(order *storage.Order) (needForward bool, targetPeerI
 	return true, targetPeerID, nil
 }
 
+// HasPair 是否有已注册的其他撮合节点负责该交易对
+func (r *Router) HasPair(pair string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.pairToNodes[pair]) > 0
+}
+
 // IsLocalPair 检查交易对是否由本地节点负责
 func (r *Router) IsLocalPair(pair string) bool {
 	if pair == "" {
@@ -0,0 +1,200 @@
+package match
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// MarketRules 交易对交易规则（价格/数量均为最小单位整数字符串，空或 "0" 表示不限制）
+// - TickSize：价格（含触发价）须为其整数倍
+// - LotSize：数量（剩余量、冰山展示量）须为其整数倍
+// - MinQty / MaxQty：单笔剩余数量上下限
+// - MinNotional：剩余数量 × 价格的 quote 金额下限（市价单按 quoteAmount 检查）
+// - MaxPriceDeviationBps：限价与最新成交价的最大偏离（万分比），无成交记录时不检查
+type MarketRules struct {
+	TickSize             string `json:"tickSize,omitempty"`
+	LotSize              string `json:"lotSize,omitempty"`
+	MinQty               string `json:"minQty,omitempty"`
+	MaxQty               string `json:"maxQty,omitempty"`
+	MinNotional          string `json:"minNotional,omitempty"`
+	MaxPriceDeviationBps uint32 `json:"maxPriceDeviationBps,omitempty"`
+}
+
+// Validate 校验规则配置本身：各项须为非负整数，MaxQty 不小于 MinQty
+func (r MarketRules) Validate() error {
+	for _, f := range []struct{ name, v string }{
+		{"tick_size", r.TickSize}, {"lot_size", r.LotSize}, {"min_qty", r.MinQty}, {"max_qty", r.MaxQty}, {"min_notional", r.MinNotional},
+	} {
+		if f.v == "" {
+			continue
+		}
+		if _, ok := storage.ParseUnits(f.v); !ok {
+			return fmt.Errorf("invalid %s: must be a non-negative integer in base units", f.name)
+		}
+	}
+	if minQ, maxQ := ruleUnits(r.MinQty), ruleUnits(r.MaxQty); minQ != nil && maxQ != nil && maxQ.Cmp(minQ) < 0 {
+		return fmt.Errorf("invalid max_qty: must not be less than min_qty")
+	}
+	return nil
+}
+
+// ruleUnits 解析规则项；未设置或为 0 返回 nil（不限制）
+func ruleUnits(s string) *big.Int {
+	v, ok := storage.ParseUnits(s)
+	if !ok || v.Sign() <= 0 {
+		return nil
+	}
+	return v
+}
+
+// checkMultiple 校验 v 是否为 step 的整数倍（step 为 nil 时不检查）
+func checkMultiple(name string, v, step *big.Int, stepName string) error {
+	if step == nil || v == nil {
+		return nil
+	}
+	if new(big.Int).Rem(v, step).Sign() != 0 {
+		return fmt.Errorf("invalid %s: %s is not a multiple of %s %s", name, v, stepName, step)
+	}
+	return nil
+}
+
+// CheckMarketRules 按交易对规则校验订单（API 下单与 gossip 入口调用，不参与撮合）；返回的错误即拒绝原因
+// 批量拍卖交易对同时校验订单类型（见 ValidateBatchOrder）
+// 数量按剩余量（Amount - Filled）检查，改单时传入改后的订单副本即可
+func (e *Engine) CheckMarketRules(o *storage.Order) error {
+	sh, unlock := e.lockPair(o.Pair)
+	if sh == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownPair, o.Pair)
+	}
+	tokens := e.tokens[o.Pair]
+	var last *big.Int
+	if sh.lastTrade != nil {
+		last = sh.lastTrade.price
+	}
+	stateErr := e.checkPairStateLocked(o)
+	unlock()
+	if stateErr != nil {
+		return stateErr
+	}
+	return checkMarketRules(tokens, last, o)
+}
+
+// checkMarketRules CheckMarketRules 的实现；last 为最新成交价（nil 为无成交记录）
+func checkMarketRules(tokens PairTokens, last *big.Int, o *storage.Order) error {
+	if tokens.MatchingMode == MatchingBatch {
+		if err := ValidateBatchOrder(o); err != nil {
+			return err
+		}
+	}
+	r := tokens.Rules
+	tick, lot := ruleUnits(r.TickSize), ruleUnits(r.LotSize)
+	qty := o.Remaining()
+	if o.IsMarket() && qty.Sign() == 0 {
+		// 仅按 quote 预算下单的市价买单无 base 数量
+		qty = nil
+	}
+	if qty != nil {
+		if err := checkMultiple("amount", qty, lot, "lot size"); err != nil {
+			return err
+		}
+		if minQ := ruleUnits(r.MinQty); minQ != nil && qty.Cmp(minQ) < 0 {
+			return fmt.Errorf("invalid amount: %s is below min quantity %s", qty, minQ)
+		}
+		if maxQ := ruleUnits(r.MaxQty); maxQ != nil && qty.Cmp(maxQ) > 0 {
+			return fmt.Errorf("invalid amount: %s exceeds max quantity %s", qty, maxQ)
+		}
+	}
+	if o.DisplayAmount != "" {
+		if err := checkMultiple("displayAmount", storage.MustUnits(o.DisplayAmount), lot, "lot size"); err != nil {
+			return err
+		}
+	}
+	if o.TriggerPrice != "" {
+		if err := checkMultiple("triggerPrice", storage.MustUnits(o.TriggerPrice), tick, "tick size"); err != nil {
+			return err
+		}
+	}
+	minNotional := ruleUnits(r.MinNotional)
+	if o.IsMarket() {
+		if budget, ok := storage.ParseUnits(o.QuoteAmount); ok && minNotional != nil && budget.Cmp(minNotional) < 0 {
+			return fmt.Errorf("invalid quoteAmount: %s is below min notional %s", budget, minNotional)
+		}
+		return nil
+	}
+	price, ok := storage.ParseUnits(o.Price)
+	if !ok {
+		return nil
+	}
+	if err := checkMultiple("price", price, tick, "tick size"); err != nil {
+		return err
+	}
+	if minNotional != nil {
+		if notional := storage.QuoteAmount(qty, price, tokens.BaseDecimals()); notional.Cmp(minNotional) < 0 {
+			return fmt.Errorf("invalid amount: notional %s is below min notional %s", notional, minNotional)
+		}
+	}
+	// 价格带：未激活条件单的限价以触发时行情为准，不按当前成交价检查
+	if r.MaxPriceDeviationBps > 0 && last != nil && !o.IsPendingTrigger() {
+		diff := new(big.Int).Sub(price, last)
+		diff.Abs(diff).Mul(diff, big.NewInt(10000))
+		if diff.Cmp(new(big.Int).Mul(last, big.NewInt(int64(r.MaxPriceDeviationBps)))) > 0 {
+			return fmt.Errorf("invalid price: %s deviates more than %d bps from last price %s", price, r.MaxPriceDeviationBps, last)
+		}
+	}
+	return nil
+}
+
+// MarketInfo 交易对信息与交易规则（/api/markets，供客户端下单前预校验）
+type MarketInfo struct {
+	Pair                string      `json:"pair"`
+	Token0              string      `json:"token0"`
+	Token1              string      `json:"token1"`
+	Decimals0           uint8       `json:"decimals0"`
+	Decimals1           uint8       `json:"decimals1"`
+	SelfTradePrevention string      `json:"selfTradePrevention,omitempty"`
+	MatchingMode        string      `json:"matchingMode"`
+	Rules               MarketRules `json:"rules"`
+	LastPrice           string      `json:"lastPrice,omitempty"` // 最新成交价（价格带基准），无成交时为空
+	// State 交易对状态：trading | halted | auction | cancel-only；StateUntil 为自动流转时间（0 为不自动流转）
+	State          string         `json:"state"`
+	StateUntil     int64          `json:"stateUntil,omitempty"`
+	StateReason    string         `json:"stateReason,omitempty"`
+	CircuitBreaker CircuitBreaker `json:"circuitBreaker"`
+}
+
+// Markets 返回所有已配置交易对的信息，按 pair 升序
+func (e *Engine) Markets() []MarketInfo {
+	unlock := e.lockAllPairs()
+	defer unlock()
+	out := make([]MarketInfo, 0, len(e.tokens))
+	for pair, t := range e.tokens {
+		m := MarketInfo{
+			Pair:                pair,
+			Token0:              t.Token0,
+			Token1:              t.Token1,
+			Decimals0:           t.BaseDecimals(),
+			Decimals1:           t.QuoteDecimals(),
+			SelfTradePrevention: t.SelfTradePrevention,
+			MatchingMode:        MatchingContinuous,
+			Rules:               t.Rules,
+			State:               PairTrading,
+			CircuitBreaker:      t.Breaker,
+		}
+		sh := e.shards[pair]
+		if st := sh.status; st != nil {
+			m.State, m.StateUntil, m.StateReason = st.state, st.until, st.reason
+		}
+		if t.MatchingMode != "" {
+			m.MatchingMode = t.MatchingMode
+		}
+		if lt := sh.lastTrade; lt != nil {
+			m.LastPrice = storage.FormatUnits(lt.price)
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Pair < out[j].Pair })
+	return out
+}
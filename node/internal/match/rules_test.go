@@ -0,0 +1,89 @@
+package match
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// testRules base 精度 1：tick 5、lot 2、数量 [4, 100]、最小成交额 50、价格带 10%
+var testRules = MarketRules{TickSize: "5", LotSize: "2", MinQty: "4", MaxQty: "100", MinNotional: "50", MaxPriceDeviationBps: 1000}
+
+func TestCheckMarketRules(t *testing.T) {
+	e := newTestEngine(t, withRules(testRules))
+	cases := []struct {
+		name    string
+		order   *storage.Order
+		wantErr string
+	}{
+		{"ok", testOrder("o", "buy", "100", "10", 1), ""},
+		{"tick", testOrder("o", "buy", "101", "10", 1), "tick size"},
+		{"lot", testOrder("o", "buy", "100", "11", 1), "lot size"},
+		{"min qty", testOrder("o", "buy", "200", "2", 1), "below min quantity"},
+		{"max qty", testOrder("o", "buy", "100", "102", 1), "exceeds max quantity"},
+		// 4 * 100 / 10 = 40 < 50
+		{"min notional", testOrder("o", "buy", "100", "4", 1), "below min notional"},
+		{"market budget", &storage.Order{OrderID: "m", Pair: "TKA/TKB", Side: "buy", Type: storage.OrderTypeMarket, QuoteAmount: "10"}, "below min notional"},
+	}
+	for _, c := range cases {
+		err := e.CheckMarketRules(c.order)
+		if c.wantErr == "" && err != nil || c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestCheckMarketRulesPriceBand(t *testing.T) {
+	e := newTestEngine(t, withRules(testRules))
+	// 无成交记录时不检查价格带
+	if err := e.CheckMarketRules(testOrder("o", "buy", "200", "10", 1)); err != nil {
+		t.Fatalf("no last price: err = %v", err)
+	}
+	e.SetLastTradePrice("TKA/TKB", "100", 1)
+	if err := e.CheckMarketRules(testOrder("o", "sell", "110", "10", 1)); err != nil {
+		t.Errorf("within band: err = %v", err)
+	}
+	if err := e.CheckMarketRules(testOrder("o", "sell", "115", "10", 1)); err == nil || !strings.Contains(err.Error(), "deviates") {
+		t.Errorf("outside band: err = %v", err)
+	}
+	stop := testOrder("o", "buy", "150", "10", 1, withTrigger(storage.TriggerStop, "145"))
+	if err := e.CheckMarketRules(stop); err != nil {
+		t.Errorf("pending trigger: err = %v", err)
+	}
+	if m := e.Markets(); len(m) != 1 || m[0].LastPrice != "100" || m[0].Rules.TickSize != "5" {
+		t.Errorf("markets = %+v", m)
+	}
+}
+
+func TestMarketRulesValidate(t *testing.T) {
+	if err := (MarketRules{TickSize: "0.1"}).Validate(); err == nil {
+		t.Error("decimal tick size accepted")
+	}
+	if err := (MarketRules{MinQty: "10", MaxQty: "5"}).Validate(); err == nil {
+		t.Error("max_qty < min_qty accepted")
+	}
+	if err := (MarketRules{TickSize: "1", MaxQty: "0"}).Validate(); err != nil {
+		t.Errorf("valid rules: %v", err)
+	}
+}
+
+func TestAmendOrderChecksMarketRules(t *testing.T) {
+	e := newTestEngine(t, withRules(testRules), withOrders(testOrder("a1", "sell", "100", "10", 1)))
+	for _, c := range []struct{ price, amount string }{
+		{"103", "0"}, // 价格不是 tick 的整数倍
+		{"0", "7"},   // 数量不是 lot 的整数倍
+		{"0", "2"},   // 减量到最小数量以下
+		{"0", "200"}, // 超过最大数量
+	} {
+		if _, err := e.AmendOrder("a1", c.price, c.amount, 10, ""); err == nil {
+			t.Errorf("amend %s/%s accepted", c.price, c.amount)
+		}
+	}
+	if got := e.GetOrder("a1"); got.Price != "100" || got.Amount != "10" || got.AmendedAt != 0 {
+		t.Fatalf("a1 = %+v, want unchanged", got)
+	}
+	if _, err := e.AmendOrder("a1", "105", "6", 10, ""); err != nil {
+		t.Fatal(err)
+	}
+}
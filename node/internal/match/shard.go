@@ -0,0 +1,291 @@
+package match
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// pairShard 交易对分片：同一交易对的输入持引擎读锁并锁定分片后串行处理，不同交易对互不阻塞
+// 订单簿与触发簿（e.pairs / e.triggers）与分片同时创建、只在引擎写锁下增删，其内容同样由分片锁保护
+type pairShard struct {
+	mu          sync.Mutex
+	now         int64            // 当前输入的引擎时钟（见 recordLocked）
+	lastTrade   *lastTrade       // 最新成交（条件单触发基准与价格带参考价），nil 为尚无成交
+	auctionIOC  []*storage.Order // 批量拍卖待清算 IOC 订单
+	lastAuction int64            // 最近一次清算的 Epoch（auctioned 为 false 时尚未清算）
+	auctioned   bool
+	status      *pairStatus   // 交易对状态与熔断窗口，nil 为 trading
+	reports     []matchReport // 持锁期间累积的撮合指标与日志，释放分片锁后上报
+}
+
+// matchReport 一次撮合的指标与日志：持锁期间收集，释放锁后上报，避免日志与 Prometheus 写入延长临界区
+type matchReport struct {
+	pair       string
+	taker      string
+	trades     int
+	elapsed    time.Duration
+	processed  bool // 撮合完整执行（订单簿大小与处理订单数只在此时上报）
+	bids, asks int
+}
+
+// flushReports 输出撮合日志并更新 Prometheus 指标（调用方不得持引擎锁）
+func flushReports(reports []matchReport) {
+	for _, r := range reports {
+		metrics.RecordMatch(r.trades, r.elapsed)
+		if !r.processed {
+			continue
+		}
+		if r.trades > 0 {
+			log.Printf("[match] pair=%s taker=%s 成交 %d 笔", r.pair, r.taker, r.trades)
+		}
+		metrics.RecordOrderbookSize(r.pair, r.bids, r.asks)
+		metrics.RecordOrderProcessed()
+	}
+}
+
+// reportLocked 暂存撮合指标，由 lockPair 返回的解锁函数在释放锁后上报（调用方需已锁定该交易对分片）
+func (e *Engine) reportLocked(r matchReport) {
+	if sh := e.shards[r.pair]; sh != nil {
+		sh.reports = append(sh.reports, r)
+	}
+}
+
+// shardLocked 返回交易对分片，不存在则连同订单簿与触发簿一起创建（调用方需已持写锁）
+func (e *Engine) shardLocked(pair string) *pairShard {
+	sh, ok := e.shards[pair]
+	if !ok {
+		sh = &pairShard{}
+		e.shards[pair] = sh
+	}
+	if _, ok := e.pairs[pair]; !ok {
+		e.pairs[pair] = newOrderBook(pair)
+	}
+	if _, ok := e.triggers[pair]; !ok {
+		e.triggers[pair] = newTriggerBook()
+	}
+	return sh
+}
+
+// lockPair 持读锁并锁定交易对分片，返回分片与解锁函数（解锁后上报期间累积的撮合指标与日志）
+// 已上架交易对的分片在首次访问时于写锁下创建；未上架且无订单簿的交易对（ErrUnknownPair）返回 nil 且不持锁（解锁函数为空操作），
+// 任何输入都不会为其建簿
+func (e *Engine) lockPair(pair string) (*pairShard, func()) {
+	for {
+		e.mu.RLock()
+		sh, ok := e.shards[pair]
+		_, listed := e.tokens[pair]
+		if ok {
+			sh.mu.Lock()
+			return sh, func() {
+				reports := sh.reports
+				sh.reports = nil
+				e.publishBookLocked(e.pairs[pair])
+				sh.mu.Unlock()
+				e.mu.RUnlock()
+				flushReports(reports)
+			}
+		}
+		e.mu.RUnlock()
+		if pair == "" || !listed {
+			return nil, func() {}
+		}
+		e.mu.Lock()
+		e.shardLocked(pair)
+		e.mu.Unlock()
+	}
+}
+
+// lockAllPairs 持读锁并按交易对名称顺序锁定全部分片（跨交易对只读查询），返回解锁函数
+// 单交易对输入只锁定一个分片，按固定顺序加锁不会死锁
+func (e *Engine) lockAllPairs() func() {
+	e.mu.RLock()
+	names := sortedKeys(e.shards)
+	for _, pair := range names {
+		e.shards[pair].mu.Lock()
+	}
+	return func() {
+		for _, pair := range names {
+			e.shards[pair].mu.Unlock()
+		}
+		e.mu.RUnlock()
+	}
+}
+
+// orderRef 订单索引项：所在交易对与归属（orderId 绑定首次出现的已签名订单，见 storage.ErrOrderIDConflict）
+// resting 为 false 表示 Submit/AddOrder 处理期间的占位（claimOrderID），订单未入簿时由 releaseOrderID 移除；
+// hold 为入簿订单对代币的占用（占位与无占用的订单为 nil）
+type orderRef struct {
+	pair     string
+	trader   string
+	nonce    int64
+	signHash string
+	resting  bool
+	hold     *orderHold
+}
+
+// nonceRef trader 的某个 nonce 所在交易对与引用它的索引项数
+type nonceRef struct {
+	pair   string
+	orders int
+}
+
+func nonceKey(trader string, nonce int64) string {
+	return strings.ToLower(trader) + "/" + strconv.FormatInt(nonce, 10)
+}
+
+// owner 以 storage.Order 形式返回索引项归属（供 storage.CheckOrderOwner 比较）
+func (r orderRef) owner() *storage.Order {
+	return &storage.Order{Trader: r.trader, Nonce: r.nonce, SignHash: r.signHash}
+}
+
+// checkClaimLocked 校验 o 可在 pair 占用其 orderId：同 ID 已有订单须为同一签名订单且在同一交易对，
+// 同一 trader 的 nonce 不得已在其他交易对使用（调用方需持 idxMu）
+func (e *Engine) checkClaimLocked(o *storage.Order, pair string) error {
+	if ref, ok := e.orderIndex[o.OrderID]; ok {
+		if err := storage.CheckOrderOwner(o, ref.owner()); err != nil {
+			return err
+		}
+		if ref.pair != pair {
+			return fmt.Errorf("%w: orderId=%s already on %s", storage.ErrOrderIDConflict, o.OrderID, ref.pair)
+		}
+		return nil
+	}
+	if n, ok := e.nonceIndex[nonceKey(o.Trader, o.Nonce)]; ok && n.pair != pair {
+		return fmt.Errorf("%w: trader=%s nonce=%d already used on %s", storage.ErrNonceUsed, o.Trader, o.Nonce, n.pair)
+	}
+	return nil
+}
+
+// putRefLocked 写入索引项并维护 nonce 索引与挂单占用（调用方需持 idxMu）
+func (e *Engine) putRefLocked(orderID string, ref orderRef) {
+	if old, ok := e.orderIndex[orderID]; ok {
+		e.releaseHoldLocked(orderID, old.hold)
+	} else {
+		key := nonceKey(ref.trader, ref.nonce)
+		n := e.nonceIndex[key]
+		n.pair = ref.pair
+		n.orders++
+		e.nonceIndex[key] = n
+	}
+	e.orderIndex[orderID] = ref
+	e.addHoldLocked(orderID, ref.hold)
+}
+
+// deleteRefLocked 移除索引项并维护 nonce 索引（调用方需持 idxMu）
+func (e *Engine) deleteRefLocked(orderID string) {
+	ref, ok := e.orderIndex[orderID]
+	if !ok {
+		return
+	}
+	delete(e.orderIndex, orderID)
+	e.releaseHoldLocked(orderID, ref.hold)
+	key := nonceKey(ref.trader, ref.nonce)
+	if n := e.nonceIndex[key]; n.orders > 1 {
+		n.orders--
+		e.nonceIndex[key] = n
+	} else {
+		delete(e.nonceIndex, key)
+	}
+}
+
+// indexOrder 登记入簿订单（o 为簿内副本）所在交易对、归属与按剩余数量计算的占用（订单索引由 idxMu 保护，可在任意分片锁内调用）
+func (e *Engine) indexOrder(o *storage.Order, pair string) {
+	hold := newOrderHold(o, pair, e.tokens[pair])
+	e.idxMu.Lock()
+	signHash := o.SignHash
+	if ref, ok := e.orderIndex[o.OrderID]; ok && signHash == "" {
+		signHash = ref.signHash
+	}
+	e.putRefLocked(o.OrderID, orderRef{pair: pair, trader: o.Trader, nonce: o.Nonce, signHash: signHash, resting: true, hold: hold})
+	e.idxMu.Unlock()
+}
+
+// refreshHold 簿内订单部分成交或减量后按剩余数量更新其占用；订单已不在簿内时为空操作（调用方需已锁定其交易对分片）
+func (e *Engine) refreshHold(o *storage.Order) {
+	e.idxMu.Lock()
+	ref, ok := e.orderIndex[o.OrderID]
+	e.idxMu.Unlock()
+	if ok && ref.resting {
+		e.indexOrder(o, ref.pair)
+	}
+}
+
+// CheckOrderOwner 只读校验新订单的 orderId 未被引擎中其他签名订单或其他交易对占用、nonce 未在其他交易对使用（入口预检）
+// 返回 storage.ErrOrderIDConflict 或 storage.ErrNonceUsed；入簿前由 claimOrderID 在同一临界区内再次校验并占位
+func (e *Engine) CheckOrderOwner(o *storage.Order) error {
+	e.idxMu.Lock()
+	defer e.idxMu.Unlock()
+	return e.checkClaimLocked(o, o.Pair)
+}
+
+// claimOrderID 在 idxMu 内原子地校验并占用 orderId（Submit、AddOrder 持分片锁调用）：
+// 不同交易对的分片锁互不排斥，校验与登记须在同一临界区内，否则同一 orderId 可同时通过两个交易对的校验
+// 占位在处理结束时由 releaseOrderID 移除（订单已入簿时保留）
+func (e *Engine) claimOrderID(o *storage.Order, pair string) error {
+	e.idxMu.Lock()
+	defer e.idxMu.Unlock()
+	if err := e.checkClaimLocked(o, pair); err != nil {
+		return err
+	}
+	if _, ok := e.orderIndex[o.OrderID]; !ok {
+		e.putRefLocked(o.OrderID, orderRef{pair: pair, trader: o.Trader, nonce: o.Nonce, signHash: o.SignHash})
+	}
+	return nil
+}
+
+// holdOrderID 将入簿订单的索引项转为占位（改单重新排队、条件单激活后重新撮合期间保留 orderId 归属）
+func (e *Engine) holdOrderID(orderID string) {
+	e.idxMu.Lock()
+	if ref, ok := e.orderIndex[orderID]; ok {
+		e.releaseHoldLocked(orderID, ref.hold)
+		ref.resting, ref.hold = false, nil
+		e.orderIndex[orderID] = ref
+	}
+	e.idxMu.Unlock()
+}
+
+// releaseOrderID 移除未入簿订单的占位（订单已入簿、进入触发簿或拍卖 IOC 队列时保留）
+func (e *Engine) releaseOrderID(orderID string) {
+	e.idxMu.Lock()
+	if ref, ok := e.orderIndex[orderID]; ok && !ref.resting {
+		e.deleteRefLocked(orderID)
+	}
+	e.idxMu.Unlock()
+}
+
+// unindexOrder 移除订单索引
+func (e *Engine) unindexOrder(orderID string) {
+	e.idxMu.Lock()
+	e.deleteRefLocked(orderID)
+	e.idxMu.Unlock()
+}
+
+// pairOf 按 orderID 返回订单所在交易对；不在簿内返回空串
+func (e *Engine) pairOf(orderID string) string {
+	e.idxMu.Lock()
+	defer e.idxMu.Unlock()
+	return e.orderIndex[orderID].pair
+}
+
+// indexSize 返回订单索引大小（订单簿、触发簿与拍卖 IOC 队列中的订单数）
+func (e *Engine) indexSize() int {
+	e.idxMu.Lock()
+	defer e.idxMu.Unlock()
+	return len(e.orderIndex)
+}
+
+// resetIndex 清空订单索引（快照加载，调用方需已持写锁）
+func (e *Engine) resetIndex() {
+	e.idxMu.Lock()
+	e.orderIndex = make(map[string]orderRef)
+	e.nonceIndex = make(map[string]nonceRef)
+	e.holds = make(map[balanceKey]*traderHolds)
+	e.idxMu.Unlock()
+}
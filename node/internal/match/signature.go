@@ -25,52 +25,144 @@ var (
 			{Name: "version", Type: "string"},
 			{Name: "chainId", Type: "uint256"},
 		},
+		// Order 限价单：nonce 纳入签名（Replay 防护与 orderId 归属均以签名内容为准），side 区分买卖
 		"Order": {
 			{Name: "orderId", Type: "string"},
 			{Name: "userAddress", Type: "address"},
+			{Name: "nonce", Type: "uint256"},
 			{Name: "tokenIn", Type: "address"},
 			{Name: "tokenOut", Type: "address"},
+			{Name: "side", Type: "string"},
 			{Name: "amountIn", Type: "uint256"},
 			{Name: "amountOut", Type: "uint256"},
 			{Name: "price", Type: "uint256"},
 			{Name: "timestamp", Type: "uint256"},
 			{Name: "expiresAt", Type: "uint256"},
+			// 条件单与有效期：普通订单 trigger 为空、triggerPrice 为 0；timeInForce 未设置时按 GTC 签名
+			{Name: "timeInForce", Type: "string"},
+			{Name: "trigger", Type: "string"},
+			{Name: "triggerPrice", Type: "uint256"},
+			// 冰山单每次展示数量：普通订单为 0
+			{Name: "displayAmount", Type: "uint256"},
+			// 撮合行为：POST_ONLY 改价与自成交防护模式（空为使用交易对配置）
+			{Name: "postOnlyReprice", Type: "bool"},
+			{Name: "selfTradePrevention", Type: "string"},
+		},
+		// MarketOrder 市价单：无限价，签名覆盖 nonce、方向、base 数量、quote 预算与滑点上限
+		"MarketOrder": {
+			{Name: "orderId", Type: "string"},
+			{Name: "userAddress", Type: "address"},
+			{Name: "nonce", Type: "uint256"},
+			{Name: "tokenIn", Type: "address"},
+			{Name: "tokenOut", Type: "address"},
+			{Name: "side", Type: "string"},
+			{Name: "amount", Type: "uint256"},
+			{Name: "quoteAmount", Type: "uint256"},
+			{Name: "maxSlippageBps", Type: "uint256"},
+			{Name: "timestamp", Type: "uint256"},
+			{Name: "expiresAt", Type: "uint256"},
+			{Name: "selfTradePrevention", Type: "string"},
 		},
 	}
 )
 
-// VerifyOrderSignature 验证订单签名（EIP-712）
-// pairTokens 为 nil 时，tokenIn/tokenOut 使用空字符串（向后兼容）
+// VerifyOrderSignature 验证订单签名（EIP-712）；通过时将签名哈希写入 order.SignHash（orderId 归属绑定），否则清空
+// pairTokens 为 nil 时，tokenIn/tokenOut 使用空字符串（向后兼容）；市价单使用 MarketOrder 类型
 func VerifyOrderSignature(order *storage.Order, pairTokens *PairTokens) (bool, error) {
+	order.SignHash = ""
 	if order.Signature == "" {
 		return false, fmt.Errorf("missing signature")
 	}
-	
-	// 构造 TypedData
-	amountIn := new(big.Int)
-	amountIn.SetString(order.Amount, 10)
-	
-	price := new(big.Int)
-	price.SetString(order.Price, 10)
-	
-	// 从 pair 解析 tokenIn/tokenOut
+	hash, err := OrderSigningHash(order, pairTokens)
+	if err != nil {
+		return false, err
+	}
+	sig, err := parseSignature(order.Signature)
+	if err != nil {
+		return false, err
+	}
+	signer, err := recoverSigner(hash, sig)
+	if err != nil {
+		return false, err
+	}
+	if signer != common.HexToAddress(order.Trader) {
+		return false, nil
+	}
+	order.SignHash = hash.Hex()
+	return true, nil
+}
+
+// VerifyAmendedOrder 验证可能已改单的订单（结算与审计据此校验成交订单）：未改单时等同 VerifyOrderSignature；
+// 改单后按 SignedPrice/SignedAmount 还原原始订单验证其签名，再逐条验证 Amends 中的改单签名（时间严格递增，最后一条为 AmendedAt），
+// 且现价为最近一次改价（POST_ONLY 改价除外）、剩余数量不超过最近一次改量。通过时 SignHash 为原始订单的签名哈希，否则清空
+func VerifyAmendedOrder(order *storage.Order, pairTokens *PairTokens) (bool, error) {
+	if len(order.Amends) == 0 {
+		return VerifyOrderSignature(order, pairTokens)
+	}
+	order.SignHash = ""
+	orig := *order
+	orig.Price, orig.Amount = order.SignedPrice, order.SignedAmount
+	if valid, err := VerifyOrderSignature(&orig, pairTokens); err != nil || !valid {
+		return false, err
+	}
+	price, ok := storage.ParseUnits(orig.Price)
+	if !ok {
+		return false, fmt.Errorf("invalid signedPrice: %q", orig.Price)
+	}
+	var left *big.Int
+	var last int64
+	for _, a := range order.Amends {
+		if a.Timestamp < order.CreatedAt || last != 0 && a.Timestamp <= last {
+			return false, nil
+		}
+		valid, err := VerifyAmendSignature(order.OrderID, order.Trader, a.NewPrice, a.NewAmount, a.Signature, a.Timestamp)
+		if err != nil || !valid {
+			return false, err
+		}
+		p, amt, err := ParseAmendFields(a.NewPrice, a.NewAmount)
+		if err != nil {
+			return false, err
+		}
+		if p != nil {
+			price = p
+		}
+		if amt != nil {
+			left = amt
+		}
+		last = a.Timestamp
+	}
+	if last != order.AmendedAt {
+		return false, nil
+	}
+	if !order.PostOnlyReprice && storage.MustUnits(order.Price).Cmp(price) != 0 {
+		return false, nil
+	}
+	if left != nil && order.Remaining().Cmp(left) > 0 || left == nil && storage.MustUnits(order.Amount).Cmp(storage.MustUnits(order.SignedAmount)) > 0 {
+		return false, nil
+	}
+	order.SignHash = orig.SignHash
+	return true, nil
+}
+
+// OrderSigningHash 返回订单的 EIP-712 签名哈希（Go 客户端与工具据此签名，与 VerifyOrderSignature 校验的哈希一致）
+func OrderSigningHash(order *storage.Order, pairTokens *PairTokens) (common.Hash, error) {
+	typedData, err := orderTypedData(order, pairTokens)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return typedDataHash(typedData)
+}
+
+// orderTypedData 构造订单的 EIP-712 TypedData（限价单为 Order，市价单为 MarketOrder）
+func orderTypedData(order *storage.Order, pairTokens *PairTokens) (apitypes.TypedData, error) {
+	// 从 pair 解析 tokenIn/tokenOut（买卖单均为 tokenIn=base、tokenOut=quote）
 	tokenIn := ""
 	tokenOut := ""
 	if pairTokens != nil {
-		if order.Side == "buy" {
-			// 买单：买入 tokenOut（quote），卖出 tokenIn（base）
-			tokenIn = pairTokens.Token0
-			tokenOut = pairTokens.Token1
-		} else {
-			// 卖单：卖出 tokenIn（base），买入 tokenOut（quote）
-			tokenIn = pairTokens.Token0
-			tokenOut = pairTokens.Token1
-		}
+		tokenIn = pairTokens.Token0
+		tokenOut = pairTokens.Token1
 	}
 	
-	// 计算 amountOut = amountIn * price（以最小单位计算）
-	amountOut := new(big.Int).Mul(amountIn, price)
-	
 	// expiresAt 从订单的 ExpiresAt 字段获取
 	expiresAt := order.ExpiresAt
 	if expiresAt == 0 {
@@ -78,60 +170,171 @@ func VerifyOrderSignature(order *storage.Order, pairTokens *PairTokens) (bool, e
 		expiresAt = order.CreatedAt + 7*24*3600
 	}
 	
-	typedData := apitypes.TypedData{
+	if order.IsMarket() {
+		// 市价单：amount/quoteAmount 可为空（视为 0），非法值报错
+		amount, quoteAmount := new(big.Int), new(big.Int)
+		if order.Amount != "" {
+			v, ok := storage.ParseUnits(order.Amount)
+			if !ok {
+				return apitypes.TypedData{}, fmt.Errorf("invalid amount: %q", order.Amount)
+			}
+			amount = v
+		}
+		if order.QuoteAmount != "" {
+			v, ok := storage.ParseUnits(order.QuoteAmount)
+			if !ok {
+				return apitypes.TypedData{}, fmt.Errorf("invalid quoteAmount: %q", order.QuoteAmount)
+			}
+			quoteAmount = v
+		}
+		return apitypes.TypedData{
+			Types:       orderTypes,
+			PrimaryType: "MarketOrder",
+			Domain:      domainSeparator,
+			Message: apitypes.TypedDataMessage{
+				"orderId":             order.OrderID,
+				"userAddress":         order.Trader,
+				"nonce":               fmt.Sprintf("%d", order.Nonce),
+				"tokenIn":             tokenIn,
+				"tokenOut":            tokenOut,
+				"side":                order.Side,
+				"amount":              amount.String(),
+				"quoteAmount":         quoteAmount.String(),
+				"maxSlippageBps":      fmt.Sprintf("%d", order.MaxSlippageBps),
+				"timestamp":           fmt.Sprintf("%d", order.CreatedAt),
+				"expiresAt":           fmt.Sprintf("%d", expiresAt),
+				"selfTradePrevention": order.SelfTradePrevention,
+			},
+		}, nil
+	}
+	
+	// 构造 TypedData（amount/price 为最小单位整数，非法值直接报错而非静默当作 0）
+	amountIn, ok := storage.ParseUnits(order.Amount)
+	if !ok {
+		return apitypes.TypedData{}, fmt.Errorf("invalid amount: %q", order.Amount)
+	}
+	
+	price, ok := storage.ParseUnits(order.Price)
+	if !ok {
+		return apitypes.TypedData{}, fmt.Errorf("invalid price: %q", order.Price)
+	}
+	
+	// amountOut = amountIn * price / 10^baseDecimals（quote 最小单位，与撮合结算的 storage.QuoteAmount 及前端一致）
+	baseDecimals := storage.DefaultTokenDecimals
+	if pairTokens != nil {
+		baseDecimals = pairTokens.BaseDecimals()
+	}
+	amountOut := storage.QuoteAmount(amountIn, price, baseDecimals)
+	
+	// 条件单触发价（普通订单为 0）
+	triggerPrice := new(big.Int)
+	if order.TriggerPrice != "" {
+		v, ok := storage.ParseUnits(order.TriggerPrice)
+		if !ok {
+			return apitypes.TypedData{}, fmt.Errorf("invalid triggerPrice: %q", order.TriggerPrice)
+		}
+		triggerPrice = v
+	}
+	
+	// 冰山单展示数量（普通订单为 0）
+	displayAmount := new(big.Int)
+	if order.DisplayAmount != "" {
+		v, ok := storage.ParseUnits(order.DisplayAmount)
+		if !ok {
+			return apitypes.TypedData{}, fmt.Errorf("invalid displayAmount: %q", order.DisplayAmount)
+		}
+		displayAmount = v
+	}
+	
+	return apitypes.TypedData{
 		Types:       orderTypes,
 		PrimaryType: "Order",
 		Domain:      domainSeparator,
 		Message: apitypes.TypedDataMessage{
-			"orderId":     order.OrderID,
-			"userAddress": order.Trader,
-			"tokenIn":     tokenIn,
-			"tokenOut":    tokenOut,
-			"amountIn":    amountIn.String(),
-			"amountOut":   amountOut.String(),
-			"price":       price.String(),
-			"timestamp":   fmt.Sprintf("%d", order.CreatedAt),
-			"expiresAt":   fmt.Sprintf("%d", expiresAt),
+			"orderId":             order.OrderID,
+			"userAddress":         order.Trader,
+			"nonce":               fmt.Sprintf("%d", order.Nonce),
+			"tokenIn":             tokenIn,
+			"tokenOut":            tokenOut,
+			"side":                order.Side,
+			"amountIn":            amountIn.String(),
+			"amountOut":           amountOut.String(),
+			"price":               price.String(),
+			"timestamp":           fmt.Sprintf("%d", order.CreatedAt),
+			"expiresAt":           fmt.Sprintf("%d", expiresAt),
+			"timeInForce":         order.EffectiveTimeInForce(),
+			"trigger":             order.Trigger,
+			"triggerPrice":        triggerPrice.String(),
+			"displayAmount":       displayAmount.String(),
+			"postOnlyReprice":     order.PostOnlyReprice,
+			"selfTradePrevention": order.SelfTradePrevention,
 		},
-	}
-	
-	// 计算 EIP-712 哈希
-	hash, err := typedData.HashStruct("Order", typedData.Message)
+	}, nil
+}
+
+// typedDataHash 计算 EIP-712 签名哈希：keccak256("\x19\x01" + domainHash + structHash)
+func typedDataHash(typedData apitypes.TypedData) (common.Hash, error) {
+	hash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
 	if err != nil {
-		return false, err
+		return common.Hash{}, err
 	}
 	
-	domainHash, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	domainHash, err := typedData.HashStruct("EIP712Domain", domainMap(typedData.Domain))
 	if err != nil {
-		return false, err
+		return common.Hash{}, err
 	}
 	
 	// \x19\x01 + domainHash + structHash
 	rawData := []byte(fmt.Sprintf("\x19\x01%s%s", string(domainHash), string(hash)))
-	finalHash := crypto.Keccak256Hash(rawData)
-	
-	// 解析签名
-	sig := common.FromHex(order.Signature)
+	return crypto.Keccak256Hash(rawData), nil
+}
+
+// domainMap 返回 EIP-712 域的消息副本：Domain.Map() 直接引用共享的 chainId，而 HashStruct 编码整数时会原地截断（math.U256），
+// 并发验证签名须各用一份拷贝
+func domainMap(domain apitypes.TypedDataDomain) apitypes.TypedDataMessage {
+	m := domain.Map()
+	if domain.ChainId != nil {
+		m["chainId"] = (*math.HexOrDecimal256)(new(big.Int).Set((*big.Int)(domain.ChainId)))
+	}
+	return m
+}
+
+// verifyTypedDataSignature 校验签名是否由 userAddress 对 typedData 签出
+func verifyTypedDataSignature(typedData apitypes.TypedData, userAddress, signature string) (bool, error) {
+	finalHash, err := typedDataHash(typedData)
+	if err != nil {
+		return false, err
+	}
+	sig, err := parseSignature(signature)
+	if err != nil {
+		return false, err
+	}
+	recoveredAddr, err := recoverSigner(finalHash, sig)
+	if err != nil {
+		return false, err
+	}
+	return recoveredAddr == common.HexToAddress(userAddress), nil
+}
+
+// parseSignature 解析 65 字节签名并将 v 调整为 0/1（以太坊签名格式 v 为 27/28）
+func parseSignature(signature string) ([]byte, error) {
+	sig := common.FromHex(signature)
 	if len(sig) != 65 {
-		return false, fmt.Errorf("invalid signature length: %d", len(sig))
+		return nil, fmt.Errorf("invalid signature length: %d", len(sig))
 	}
-	
-	// 调整 v 值（以太坊签名格式）
 	if sig[64] >= 27 {
 		sig[64] -= 27
 	}
-	
-	// 恢复公钥
-	pubKey, err := crypto.SigToPub(finalHash.Bytes(), sig)
+	return sig, nil
+}
+
+// recoverSigner 由签名哈希与签名恢复签名者地址（ecrecover）
+func recoverSigner(hash common.Hash, sig []byte) (common.Address, error) {
+	pubKey, err := crypto.SigToPub(hash.Bytes(), sig)
 	if err != nil {
-		return false, err
+		return common.Address{}, err
 	}
-	
-	// 验证地址
-	recoveredAddr := crypto.PubkeyToAddress(*pubKey)
-	expectedAddr := common.HexToAddress(order.Trader)
-	
-	return recoveredAddr == expectedAddr, nil
+	return crypto.PubkeyToAddress(*pubKey), nil
 }
 
 // VerifyCancelSignature 验证取消订单签名
@@ -169,7 +372,7 @@ func VerifyCancelSignature(orderID, userAddress, signature string, timestamp int
 		return false, err
 	}
 	
-	domainHash, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	domainHash, err := typedData.HashStruct("EIP712Domain", domainMap(typedData.Domain))
 	if err != nil {
 		return false, err
 	}
@@ -196,3 +399,82 @@ func VerifyCancelSignature(orderID, userAddress, signature string, timestamp int
 	
 	return recoveredAddr == expectedAddr, nil
 }
+
+// VerifyAmendSignature 验证改单签名（AmendOrder：改价和/或改剩余数量，"0" 表示该项不变）
+func VerifyAmendSignature(orderID, userAddress, newPrice, newAmount, signature string, timestamp int64) (bool, error) {
+	if signature == "" {
+		return false, fmt.Errorf("missing signature")
+	}
+	return verifyTypedDataSignature(amendTypedData(orderID, userAddress, newPrice, newAmount, timestamp), userAddress, signature)
+}
+
+// amendTypedData 构造改单的 EIP-712 TypedData（空值按 0 即不变签名）
+func amendTypedData(orderID, userAddress, newPrice, newAmount string, timestamp int64) apitypes.TypedData {
+	uintOrZero := func(s string) string {
+		if s == "" {
+			return "0"
+		}
+		return s
+	}
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"AmendOrder": {
+				{Name: "orderId", Type: "string"},
+				{Name: "userAddress", Type: "address"},
+				{Name: "newPrice", Type: "uint256"},
+				{Name: "newAmount", Type: "uint256"},
+				{Name: "timestamp", Type: "uint256"},
+			},
+		},
+		PrimaryType: "AmendOrder",
+		Domain:      domainSeparator,
+		Message: apitypes.TypedDataMessage{
+			"orderId":     orderID,
+			"userAddress": userAddress,
+			"newPrice":    uintOrZero(newPrice),
+			"newAmount":   uintOrZero(newAmount),
+			"timestamp":   fmt.Sprintf("%d", timestamp),
+		},
+	}
+}
+
+// VerifyCancelAllSignature 验证批量撤单签名（CancelAllBelowNonce：撤销 userAddress 在所有交易对中 nonce 小于 nonce 的订单）
+func VerifyCancelAllSignature(userAddress string, nonce int64, signature string, timestamp int64) (bool, error) {
+	if signature == "" {
+		return false, fmt.Errorf("missing signature")
+	}
+	if nonce < 0 {
+		return false, fmt.Errorf("invalid nonce: %d", nonce)
+	}
+	return verifyTypedDataSignature(cancelAllTypedData(userAddress, nonce, timestamp), userAddress, signature)
+}
+
+// cancelAllTypedData 构造批量撤单的 EIP-712 TypedData
+func cancelAllTypedData(userAddress string, nonce, timestamp int64) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"CancelAllBelowNonce": {
+				{Name: "userAddress", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "timestamp", Type: "uint256"},
+			},
+		},
+		PrimaryType: "CancelAllBelowNonce",
+		Domain:      domainSeparator,
+		Message: apitypes.TypedDataMessage{
+			"userAddress": userAddress,
+			"nonce":       fmt.Sprintf("%d", nonce),
+			"timestamp":   fmt.Sprintf("%d", timestamp),
+		},
+	}
+}
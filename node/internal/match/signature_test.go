@@ -6,6 +6,7 @@ import (
 	"math/big"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 	"github.com/P2P-P2P/p2p/node/internal/storage"
@@ -27,6 +28,7 @@ func TestVerifyOrderSignature(t *testing.T) {
 		Side:      "buy",
 		Price:     "1000000000000000000",
 		Amount:    "500000000000000000",
+		Nonce:     7,
 		CreatedAt: 1700000000,
 		ExpiresAt: 1700086400,
 	}
@@ -35,7 +37,11 @@ func TestVerifyOrderSignature(t *testing.T) {
 	amountIn.SetString(order.Amount, 10)
 	price := new(big.Int)
 	price.SetString(order.Price, 10)
-	amountOut := new(big.Int).Mul(amountIn, price)
+	// amountOut 为 quote 最小单位：0.5 base × 1.0 价格 = 0.5 quote
+	amountOut := storage.QuoteAmount(amountIn, price, storage.DefaultTokenDecimals)
+	if amountOut.String() != "500000000000000000" {
+		t.Fatalf("amountOut = %s", amountOut)
+	}
 	tokenIn, tokenOut := pairTokens.Token0, pairTokens.Token1
 
 	typedData := apitypes.TypedData{
@@ -43,15 +49,23 @@ func TestVerifyOrderSignature(t *testing.T) {
 		PrimaryType: "Order",
 		Domain:      domainSeparator,
 		Message: apitypes.TypedDataMessage{
-			"orderId":     order.OrderID,
-			"userAddress": order.Trader,
-			"tokenIn":     tokenIn,
-			"tokenOut":    tokenOut,
-			"amountIn":    amountIn.String(),
-			"amountOut":   amountOut.String(),
-			"price":       price.String(),
-			"timestamp":   "1700000000",
-			"expiresAt":   "1700086400",
+			"orderId":             order.OrderID,
+			"userAddress":         order.Trader,
+			"nonce":               "7",
+			"tokenIn":             tokenIn,
+			"tokenOut":            tokenOut,
+			"side":                "buy",
+			"amountIn":            amountIn.String(),
+			"amountOut":           amountOut.String(),
+			"price":               price.String(),
+			"timestamp":           "1700000000",
+			"expiresAt":           "1700086400",
+			"timeInForce":         "GTC",
+			"trigger":             "",
+			"triggerPrice":        "0",
+			"displayAmount":       "0",
+			"postOnlyReprice":     false,
+			"selfTradePrevention": "",
 		},
 	}
 	hash, err := typedData.HashStruct("Order", typedData.Message)
@@ -79,6 +93,22 @@ func TestVerifyOrderSignature(t *testing.T) {
 	if !valid {
 		t.Error("expected valid signature")
 	}
+	if order.SignHash != finalHash.Hex() {
+		t.Errorf("SignHash = %s, want %s", order.SignHash, finalHash.Hex())
+	}
+	// nonce 与方向在签名内：中继篡改 nonce（重放为新订单）或翻转买卖方向后签名失效
+	order.Nonce = 8
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered nonce should invalidate signature")
+	}
+	order.Nonce = 7
+	order.Side = "sell"
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered side should invalidate signature")
+	}
+	if order.SignHash != "" {
+		t.Errorf("SignHash after failed verification = %s, want empty", order.SignHash)
+	}
 }
 
 func TestVerifyOrderSignature_missingSig(t *testing.T) {
@@ -124,3 +154,272 @@ func TestVerifyCancelSignature(t *testing.T) {
 		t.Error("expected valid cancel signature")
 	}
 }
+
+// TestVerifyMarketOrderSignature 市价单使用 MarketOrder 类型签名；篡改预算后签名失效
+func TestVerifyMarketOrderSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	pairTokens := &PairTokens{Token0: "0x1111111111111111111111111111111111111111", Token1: "0x2222222222222222222222222222222222222222"}
+	order := &storage.Order{
+		OrderID:        "order_mkt_1",
+		Trader:         addr.Hex(),
+		Pair:           "TKA/TKB",
+		Side:           "buy",
+		Type:           storage.OrderTypeMarket,
+		QuoteAmount:    "2000000000000000000",
+		MaxSlippageBps: 50,
+		Nonce:          3,
+		CreatedAt:      1700000000,
+		ExpiresAt:      1700086400,
+	}
+
+	typedData := apitypes.TypedData{
+		Types:       orderTypes,
+		PrimaryType: "MarketOrder",
+		Domain:      domainSeparator,
+		Message: apitypes.TypedDataMessage{
+			"orderId":             order.OrderID,
+			"userAddress":         order.Trader,
+			"nonce":               "3",
+			"tokenIn":             pairTokens.Token0,
+			"tokenOut":            pairTokens.Token1,
+			"side":                "buy",
+			"amount":              "0",
+			"quoteAmount":         "2000000000000000000",
+			"maxSlippageBps":      "50",
+			"timestamp":           "1700000000",
+			"expiresAt":           "1700086400",
+			"selfTradePrevention": "",
+		},
+	}
+	hash, err := typedData.HashStruct("MarketOrder", typedData.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	domainHash, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawData := []byte(fmt.Sprintf("\x19\x01%s%s", string(domainHash), string(hash)))
+	sig, err := crypto.Sign(crypto.Keccak256Hash(rawData).Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	order.Signature = "0x" + hex.EncodeToString(sig)
+
+	valid, err := VerifyOrderSignature(order, pairTokens)
+	if err != nil || !valid {
+		t.Fatalf("expected valid market order signature, got valid=%v err=%v", valid, err)
+	}
+	order.QuoteAmount = "3000000000000000000"
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered quoteAmount should invalidate signature")
+	}
+	order.QuoteAmount = "2000000000000000000"
+	order.Nonce = 4
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered nonce should invalidate market order signature")
+	}
+	order.Nonce = 3
+	order.SelfTradePrevention = storage.SelfTradeCancelOldest
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered selfTradePrevention should invalidate market order signature")
+	}
+}
+
+// TestVerifyTriggerOrderSignature 条件单触发价纳入 Order 签名；篡改触发价或触发类型后签名失效
+func TestVerifyTriggerOrderSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairTokens := &PairTokens{Token0: "0x1111111111111111111111111111111111111111", Token1: "0x2222222222222222222222222222222222222222"}
+	order := &storage.Order{
+		OrderID:      "order_stop_1",
+		Trader:       crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Pair:         "TKA/TKB",
+		Side:         "sell",
+		Price:        "950",
+		Amount:       "10",
+		Trigger:      storage.TriggerStop,
+		TriggerPrice: "960",
+		CreatedAt:    1700000000,
+	}
+	typedData, err := orderTypedData(order, pairTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := typedData.Message["triggerPrice"]; got != "960" {
+		t.Fatalf("triggerPrice in message = %v", got)
+	}
+	hash, err := typedDataHash(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Signature = "0x" + hex.EncodeToString(sig)
+	if valid, err := VerifyOrderSignature(order, pairTokens); err != nil || !valid {
+		t.Fatalf("expected valid trigger order signature, got valid=%v err=%v", valid, err)
+	}
+	order.TriggerPrice = "900"
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered triggerPrice should invalidate signature")
+	}
+	order.TriggerPrice = "960"
+	order.Trigger = storage.TriggerTakeProfit
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered trigger type should invalidate signature")
+	}
+}
+
+// TestVerifyIcebergOrderSignature 冰山单展示数量纳入 Order 签名；篡改或去掉 displayAmount 后签名失效
+func TestVerifyIcebergOrderSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairTokens := &PairTokens{Token0: "0x1111111111111111111111111111111111111111", Token1: "0x2222222222222222222222222222222222222222"}
+	order := &storage.Order{
+		OrderID:       "order_iceberg_1",
+		Trader:        crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Pair:          "TKA/TKB",
+		Side:          "sell",
+		Price:         "950",
+		Amount:        "100",
+		DisplayAmount: "10",
+		CreatedAt:     1700000000,
+	}
+	hash, err := OrderSigningHash(order, pairTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Signature = "0x" + hex.EncodeToString(sig)
+	if valid, err := VerifyOrderSignature(order, pairTokens); err != nil || !valid {
+		t.Fatalf("expected valid iceberg order signature, got valid=%v err=%v", valid, err)
+	}
+	for _, display := range []string{"50", ""} {
+		order.DisplayAmount = display
+		if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+			t.Errorf("displayAmount=%q: tampered displayAmount should invalidate signature", display)
+		}
+	}
+}
+
+// TestVerifyOrderSignatureCoversMatchingFlags postOnlyReprice 与 selfTradePrevention 纳入 Order 签名，转发节点无法改写撮合行为
+func TestVerifyOrderSignatureCoversMatchingFlags(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairTokens := &PairTokens{Token0: "0x1111111111111111111111111111111111111111", Token1: "0x2222222222222222222222222222222222222222"}
+	order := &storage.Order{
+		OrderID:             "order_flags_1",
+		Trader:              crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Pair:                "TKA/TKB",
+		Side:                "buy",
+		Price:               "950",
+		Amount:              "10",
+		TimeInForce:         storage.TimeInForcePostOnly,
+		PostOnlyReprice:     true,
+		SelfTradePrevention: storage.SelfTradeCancelNewest,
+		CreatedAt:           1700000000,
+	}
+	hash, err := OrderSigningHash(order, pairTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Signature = "0x" + hex.EncodeToString(sig)
+	if valid, err := VerifyOrderSignature(order, pairTokens); err != nil || !valid {
+		t.Fatalf("expected valid signature, got valid=%v err=%v", valid, err)
+	}
+	order.PostOnlyReprice = false
+	if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+		t.Error("tampered postOnlyReprice should invalidate signature")
+	}
+	order.PostOnlyReprice = true
+	for _, mode := range []string{"", storage.SelfTradeDecrementAndCancel} {
+		order.SelfTradePrevention = mode
+		if valid, _ := VerifyOrderSignature(order, pairTokens); valid {
+			t.Errorf("selfTradePrevention=%q: tampered mode should invalidate signature", mode)
+		}
+	}
+}
+
+// TestVerifyAmendedOrder 改单后的订单按原始签名加改单签名链验证：仅凭原始签名无法验证，篡改或删去改单签名后失效
+func TestVerifyAmendedOrder(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trader := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	token0, token1 := "0x1111111111111111111111111111111111111111", "0x2222222222222222222222222222222222222222"
+	pairTokens := &PairTokens{Token0: token0, Token1: token1, Decimals0: 1}
+	sign := func(hash common.Hash, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := crypto.Sign(hash.Bytes(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "0x" + hex.EncodeToString(sig)
+	}
+	signAmend := func(newPrice, newAmount string, ts int64) string {
+		return sign(typedDataHash(amendTypedData("a1", trader, newPrice, newAmount, ts)))
+	}
+
+	e := newTestEngine(t, withTokens(token0, token1), withClock(func() int64 { return 100 }))
+	o := testOrder("a1", "sell", "100", "10", 1, withTrader(trader))
+	o.Signature = sign(OrderSigningHash(o, pairTokens))
+	if res := e.Submit(o); res.Reason != nil {
+		t.Fatalf("submit: %v", res.Reason)
+	}
+	if _, err := e.AmendOrder("a1", "0", "6", 50, signAmend("0", "6", 50)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AmendOrder("a1", "105", "0", 60, signAmend("105", "0", 60)); err != nil {
+		t.Fatal(err)
+	}
+	amended := e.GetOrder("a1")
+	if amended.Price != "105" || amended.SignedPrice != "100" || amended.SignedAmount != "10" || len(amended.Amends) != 2 {
+		t.Fatalf("amended = %+v", amended)
+	}
+	plain := *amended
+	if valid, _ := VerifyOrderSignature(&plain, pairTokens); valid {
+		t.Error("original signature alone must not verify the amended order")
+	}
+	if valid, err := VerifyAmendedOrder(amended, pairTokens); err != nil || !valid {
+		t.Fatalf("amended order: valid=%v err=%v", valid, err)
+	}
+	if amended.SignHash == "" {
+		t.Error("SignHash not set to the original order's hash")
+	}
+
+	tampered := *amended
+	tampered.Amends = append([]storage.SignedAmend(nil), amended.Amends...)
+	tampered.Amends[1].NewPrice, tampered.Price = "110", "110"
+	if valid, _ := VerifyAmendedOrder(&tampered, pairTokens); valid {
+		t.Error("tampered amend price should invalidate the order")
+	}
+	dropped := *amended
+	dropped.Amends = amended.Amends[:1]
+	if valid, _ := VerifyAmendedOrder(&dropped, pairTokens); valid {
+		t.Error("dropping the last amend should invalidate the order")
+	}
+}
@@ -0,0 +1,506 @@
+package match
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// 快照文件格式：[8 字节魔数][2 字节版本][8 字节日志序号][8 字节负载长度][4 字节 CRC32C][负载]（大端），
+// 负载为 snapshotState 的 gob 编码；格式变更时提升 snapshotVersion，旧版本快照不再加载（回退为日志回放）
+const (
+	snapshotMagic      = "P2PSNAP\x00"
+	snapshotVersion    = 1
+	snapshotHeaderSize = 8 + 2 + 8 + 8 + 4
+	// snapshotKeep 保留最近的快照个数（最新快照损坏时回退到上一个）
+	snapshotKeep = 2
+)
+
+// ErrSnapshotCorrupt 快照校验失败或版本不支持
+var ErrSnapshotCorrupt = errors.New("snapshot corrupt")
+
+// snapshotState 引擎某一日志序号时的完整状态（交易对配置与挂单上限不在其中，启动时由配置提供）
+type snapshotState struct {
+	Seq           uint64
+	Now           int64
+	Books         []snapshotBook
+	Triggers      []snapshotOrders
+	AuctionIOC    []snapshotOrders
+	LastTrades    []snapshotLastTrade
+	LastAuction   map[string]int64
+	TraderVolumes map[string]map[string]string
+	CurrentPeriod string
+	CurrentTrades uint64
+	CurrentVolume string
+	CurrentFees   map[string]string
+	Periods       []snapshotPeriod
+	PairStates    []snapshotPairState
+}
+
+// snapshotBook 订单簿：买卖盘按价格优先、档位内按队列顺序排列
+type snapshotBook struct {
+	Pair string
+	Bids []snapshotOrder
+	Asks []snapshotOrder
+}
+
+// snapshotOrder 簿内订单（入簿副本）与冰山单当前可见量（普通订单为空）
+type snapshotOrder struct {
+	Order   storage.Order
+	Visible string
+}
+
+type snapshotOrders struct {
+	Pair   string
+	Orders []storage.Order
+}
+
+type snapshotLastTrade struct {
+	Pair  string
+	Price string
+	Ts    int64
+}
+
+type snapshotPeriod struct {
+	Period string
+	Trades uint64
+	Volume string
+	Fees   map[string]string
+}
+
+// snapshotPairState 交易对状态与熔断窗口（每秒成交价区间）
+type snapshotPairState struct {
+	Pair   string
+	State  string
+	Since  int64
+	Until  int64
+	Reason string
+	Window []snapshotPriceSample
+}
+
+type snapshotPriceSample struct {
+	Ts     int64
+	Lo, Hi string
+}
+
+// SnapshotInfo 快照概况（启动日志与指标用）
+type SnapshotInfo struct {
+	Path   string
+	Seq    uint64
+	Orders int // 订单簿、触发簿与拍卖 IOC 队列中的订单总数
+}
+
+// WriteSnapshot 将引擎当前状态写入 dir 下的 snapshot-<seq>.bin：持锁复制状态，释放锁后编码，
+// 经临时文件 fsync 后原子重命名；成功后只保留最近 snapshotKeep 个快照，
+// 并清理已被最旧保留快照覆盖的日志段（设置了归档目录时移入归档目录，见 Journal.SetArchiveDir）
+func (e *Engine) WriteSnapshot(dir string) (*SnapshotInfo, error) {
+	st, orders, journal := e.snapshotState()
+	// 快照覆盖的日志须先落盘，否则崩溃后日志可能落后于快照
+	if journal != nil {
+		if err := journal.Sync(); err != nil {
+			return nil, fmt.Errorf("sync journal: %w", err)
+		}
+	}
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(st); err != nil {
+		return nil, fmt.Errorf("encode snapshot: %w", err)
+	}
+	header := make([]byte, snapshotHeaderSize)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[8:10], snapshotVersion)
+	binary.BigEndian.PutUint64(header[10:18], st.Seq)
+	binary.BigEndian.PutUint64(header[18:26], uint64(body.Len()))
+	binary.BigEndian.PutUint32(header[26:30], crc32.Checksum(body.Bytes(), journalCRC))
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("snapshot-%020d.bin", st.Seq))
+	tmp, err := os.CreateTemp(dir, ".snapshot-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(header); err == nil {
+		if _, err = tmp.Write(body.Bytes()); err == nil {
+			err = tmp.Sync()
+		}
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	if snaps, err := listSnapshots(dir); err == nil {
+		if len(snaps) > snapshotKeep {
+			for _, old := range snaps[:len(snaps)-snapshotKeep] {
+				_ = os.Remove(old.path)
+			}
+			snaps = snaps[len(snaps)-snapshotKeep:]
+		}
+		// 最新快照损坏时回退到最旧的保留快照，其后的日志须保留
+		if journal != nil && len(snaps) > 0 {
+			if n, err := journal.Prune(snaps[0].seq); err != nil {
+				log.Printf("[journal] 清理日志段失败: %v", err)
+			} else if n > 0 {
+				log.Printf("[journal] 已清理 %d 个被快照覆盖的日志段（seq<=%d）", n, snaps[0].seq)
+			}
+		}
+	}
+	return &SnapshotInfo{Path: path, Seq: st.Seq, Orders: orders}, nil
+}
+
+// snapshotState 持写锁复制引擎状态（各交易对进行中的输入全部完成，状态与日志序号一致）；返回状态、订单总数与当前日志
+// 空订单簿与空触发簿不写入（加载时按交易对配置重建）
+func (e *Engine) snapshotState() (*snapshotState, int, *Journal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jmu.Lock()
+	seq, now, journal := e.seq, e.now, e.journal
+	e.jmu.Unlock()
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	st := &snapshotState{
+		Seq:           seq,
+		Now:           now,
+		LastAuction:   make(map[string]int64),
+		TraderVolumes: make(map[string]map[string]string, len(e.traderVolumes)),
+		CurrentPeriod: e.currentPeriod,
+		CurrentTrades: e.currentTrades,
+		CurrentVolume: e.currentVolume.String(),
+		CurrentFees:   unitsMapString(e.currentFees),
+	}
+	orders := 0
+	for _, pair := range sortedKeys(e.pairs) {
+		ob := e.pairs[pair]
+		if ob.Len() == 0 {
+			continue
+		}
+		b := snapshotBook{Pair: pair}
+		for _, buy := range []bool{true, false} {
+			var list []snapshotOrder
+			eachBookNode(ob.side(buy), func(n *bookOrder) {
+				so := snapshotOrder{Order: *n.order}
+				if n.visible != nil {
+					so.Visible = n.visible.String()
+				}
+				list = append(list, so)
+			})
+			if buy {
+				b.Bids = list
+			} else {
+				b.Asks = list
+			}
+			orders += len(list)
+		}
+		st.Books = append(st.Books, b)
+	}
+	for _, pair := range sortedKeys(e.triggers) {
+		tb := e.triggers[pair]
+		if tb.Len() == 0 {
+			continue
+		}
+		so := snapshotOrders{Pair: pair}
+		for _, s := range []*bookSide{tb.rising, tb.falling} {
+			eachBookNode(s, func(n *bookOrder) { so.Orders = append(so.Orders, *n.order) })
+		}
+		orders += len(so.Orders)
+		st.Triggers = append(st.Triggers, so)
+	}
+	for _, pair := range sortedKeys(e.shards) {
+		sh := e.shards[pair]
+		if len(sh.auctionIOC) > 0 {
+			so := snapshotOrders{Pair: pair}
+			for _, o := range sh.auctionIOC {
+				so.Orders = append(so.Orders, *o)
+			}
+			orders += len(so.Orders)
+			st.AuctionIOC = append(st.AuctionIOC, so)
+		}
+		if lt := sh.lastTrade; lt != nil {
+			st.LastTrades = append(st.LastTrades, snapshotLastTrade{Pair: pair, Price: lt.price.String(), Ts: lt.ts})
+		}
+		if sh.auctioned {
+			st.LastAuction[pair] = sh.lastAuction
+		}
+	}
+	for pair, vols := range e.traderVolumes {
+		st.TraderVolumes[pair] = unitsMapString(vols)
+	}
+	for _, period := range sortedKeys(e.periodStats) {
+		p := e.periodStats[period]
+		st.Periods = append(st.Periods, snapshotPeriod{Period: period, Trades: p.Trades, Volume: p.Volume.String(), Fees: unitsMapString(p.Fees)})
+	}
+	for _, pair := range sortedKeys(e.shards) {
+		ps := e.shards[pair].status
+		if ps == nil {
+			continue
+		}
+		sp := snapshotPairState{Pair: pair, State: ps.state, Since: ps.since, Until: ps.until, Reason: ps.reason}
+		for _, s := range ps.window {
+			sp.Window = append(sp.Window, snapshotPriceSample{Ts: s.ts, Lo: s.lo.String(), Hi: s.hi.String()})
+		}
+		st.PairStates = append(st.PairStates, sp)
+	}
+	return st, orders, journal
+}
+
+// LoadSnapshot 用快照文件替换引擎状态（须在回放日志与接收订单之前调用）；交易对配置沿用引擎当前配置
+func (e *Engine) LoadSnapshot(path string) (*SnapshotInfo, error) {
+	st, err := readSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.unlockWrite()
+	old := e.pairs
+	e.shards = make(map[string]*pairShard)
+	e.pairs = make(map[string]*OrderBook)
+	e.triggers = make(map[string]*triggerBook)
+	e.resetIndex()
+	e.traderVolumes = make(map[string]map[string]*big.Int)
+	orders := 0
+	for _, b := range st.Books {
+		e.shardLocked(b.Pair)
+		ob := e.pairs[b.Pair]
+		for _, list := range [][]snapshotOrder{b.Bids, b.Asks} {
+			for i := range list {
+				o := list[i].Order
+				// 按快照顺序逐个入簿：同排队时间的订单保持原队列先后
+				ob.insert(&o, storage.MustUnits(o.Price))
+				if list[i].Visible != "" {
+					ob.index[o.OrderID].visible = storage.MustUnits(list[i].Visible)
+				}
+				e.indexOrder(&o, b.Pair)
+				orders++
+			}
+		}
+	}
+	for _, t := range st.Triggers {
+		e.shardLocked(t.Pair)
+		tb := e.triggers[t.Pair]
+		for i := range t.Orders {
+			o := t.Orders[i]
+			tb.add(&o)
+			e.indexOrder(&o, t.Pair)
+			orders++
+		}
+	}
+	for _, q := range st.AuctionIOC {
+		sh := e.shardLocked(q.Pair)
+		for i := range q.Orders {
+			o := q.Orders[i]
+			sh.auctionIOC = append(sh.auctionIOC, &o)
+			e.indexOrder(&o, q.Pair)
+			orders++
+		}
+	}
+	for _, lt := range st.LastTrades {
+		e.shardLocked(lt.Pair).lastTrade = &lastTrade{price: storage.MustUnits(lt.Price), ts: lt.Ts}
+	}
+	for pair, epoch := range st.LastAuction {
+		sh := e.shardLocked(pair)
+		sh.lastAuction, sh.auctioned = epoch, true
+	}
+	for pair, vols := range st.TraderVolumes {
+		e.traderVolumes[pair] = unitsMapBig(vols)
+	}
+	// 订单簿整体替换：沿用行情序号，释放写锁时发布全量；快照中不存在的交易对发布空的全量
+	for pair, ob := range e.pairs {
+		if prev, ok := old[pair]; ok {
+			ob.depthSeq, ob.l3Seq = prev.depthSeq, prev.l3Seq
+		}
+	}
+	for _, pair := range sortedKeys(old) {
+		if _, ok := e.pairs[pair]; !ok {
+			e.clearBookLocked(old[pair])
+		}
+	}
+	e.statsMu.Lock()
+	e.periodStats = make(map[string]*PeriodStats)
+	for _, p := range st.Periods {
+		e.periodStats[p.Period] = &PeriodStats{Trades: p.Trades, Volume: storage.MustUnits(p.Volume), Fees: unitsMapBig(p.Fees)}
+	}
+	for _, sp := range st.PairStates {
+		ps := &pairStatus{state: sp.State, since: sp.Since, until: sp.Until, reason: sp.Reason}
+		for _, s := range sp.Window {
+			ps.window = append(ps.window, priceSample{ts: s.Ts, lo: storage.MustUnits(s.Lo), hi: storage.MustUnits(s.Hi)})
+		}
+		e.shardLocked(sp.Pair).status = ps
+	}
+	e.currentPeriod = st.CurrentPeriod
+	e.currentTrades = st.CurrentTrades
+	e.currentVolume = storage.MustUnits(st.CurrentVolume)
+	e.currentFees = unitsMapBig(st.CurrentFees)
+	e.statsMu.Unlock()
+	e.jmu.Lock()
+	e.seq, e.now = st.Seq, st.Now
+	e.jmu.Unlock()
+	e.rebuildExpiriesLocked()
+	return &SnapshotInfo{Path: path, Seq: st.Seq, Orders: orders}, nil
+}
+
+// LoadLatestSnapshot 加载 dir 中序号最大的可用快照；最新快照损坏时依次回退到更早的快照，无可用快照返回 nil
+func LoadLatestSnapshot(e *Engine, dir string) (*SnapshotInfo, error) {
+	snaps, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snaps) - 1; i >= 0; i-- {
+		info, err := e.LoadSnapshot(snaps[i].path)
+		if err == nil {
+			return info, nil
+		}
+		log.Printf("[snapshot] 跳过 %s: %v", filepath.Base(snaps[i].path), err)
+	}
+	return nil, nil
+}
+
+// readSnapshot 读取并校验快照文件
+func readSnapshot(path string) (*snapshotState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < snapshotHeaderSize || string(data[:8]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrSnapshotCorrupt)
+	}
+	if v := binary.BigEndian.Uint16(data[8:10]); v != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrSnapshotCorrupt, v)
+	}
+	body := data[snapshotHeaderSize:]
+	if uint64(len(body)) != binary.BigEndian.Uint64(data[18:26]) || crc32.Checksum(body, journalCRC) != binary.BigEndian.Uint32(data[26:30]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	var st snapshotState
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&st); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	if st.Seq != binary.BigEndian.Uint64(data[10:18]) {
+		return nil, fmt.Errorf("%w: seq mismatch", ErrSnapshotCorrupt)
+	}
+	return &st, nil
+}
+
+type snapshotFile struct {
+	path string
+	seq  uint64
+}
+
+// listSnapshots 列出快照文件，按序号升序
+func listSnapshots(dir string) ([]snapshotFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []snapshotFile
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || !strings.HasPrefix(name, "snapshot-") || !strings.HasSuffix(name, ".bin") {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "snapshot-"), ".bin"), 10, 64)
+		if err != nil {
+			continue
+		}
+		out = append(out, snapshotFile{path: filepath.Join(dir, name), seq: seq})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].seq < out[j].seq })
+	return out, nil
+}
+
+// eachBookNode 按价格优先、档位内队列顺序遍历一侧的订单
+func eachBookNode(s *bookSide, fn func(n *bookOrder)) {
+	for x := s.head.next[0]; x != nil; x = x.next[0] {
+		for n := x.level.head; n != nil; n = n.next {
+			fn(n)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unitsMapString(m map[string]*big.Int) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v.String()
+	}
+	return out
+}
+
+func unitsMapBig(m map[string]string) map[string]*big.Int {
+	out := make(map[string]*big.Int, len(m))
+	for k, v := range m {
+		if n, ok := new(big.Int).SetString(v, 10); ok {
+			out[k] = n
+		}
+	}
+	return out
+}
+
+// DefaultSnapshotInterval 默认快照间隔
+const DefaultSnapshotInterval = 5 * time.Minute
+
+// RunSnapshots 每 interval 写一次快照（引擎序号未变化时跳过），阻塞直至 ctx 结束；退出时的最后一次快照由调用方写入
+func RunSnapshots(ctx context.Context, e *Engine, dir string, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSnapshotInterval
+	}
+	last := e.LastSeq()
+	write := func() {
+		if seq := e.LastSeq(); seq == last {
+			return
+		}
+		info, err := e.WriteSnapshot(dir)
+		if err != nil {
+			log.Printf("[snapshot] 写入失败: %v", err)
+			return
+		}
+		last = info.Seq
+		metrics.RecordSnapshot(info.Seq)
+		log.Printf("[snapshot] 已写入 %s（seq=%d，订单 %d）", filepath.Base(info.Path), info.Seq, info.Orders)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			write()
+		}
+	}
+}
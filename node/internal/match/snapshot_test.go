@@ -0,0 +1,192 @@
+package match
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func snapshotTestPairs() map[string]PairTokens {
+	return map[string]PairTokens{"TKA/TKB": {Token0: "0xa", Token1: "0xb", Decimals0: 1, Fees: FeeSchedule{TakerBps: 10}}}
+}
+
+// engineStateJSON 订单簿（含冰山单剩余量）、触发簿数量与周期统计，用于比较两个引擎状态
+func engineStateJSON(t *testing.T, e *Engine) string {
+	t.Helper()
+	bids, asks := e.GetOrderbook("TKA/TKB")
+	var full []*storage.Order
+	for _, o := range append(bids, asks...) {
+		full = append(full, e.GetOrder(o.OrderID))
+	}
+	trades, volume := e.GetPeriodStats("p1")
+	data, err := json.Marshal(map[string]interface{}{
+		"bids": bids, "asks": asks, "full": full, "triggers": e.PendingTriggerCount("TKA/TKB"),
+		"trades": trades, "volume": volume.String(), "fees": e.GetPeriodFees("p1"), "seq": e.LastSeq(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSnapshotPlusJournalTailRestoresState(t *testing.T) {
+	dir := t.TempDir()
+	journalDir, snapDir := filepath.Join(dir, "journal"), filepath.Join(dir, "snapshots")
+	j, err := OpenJournal(journalDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(snapshotTestPairs())
+	if _, err := Restore(e, snapDir, j, nil); err != nil {
+		t.Fatal(err)
+	}
+	e.SetCurrentPeriod("p1")
+	e.Submit(testOrder("a1", "sell", "100", "10", 1, withDisplay("3")))
+	e.Submit(testOrder("a2", "sell", "100", "5", 1))
+	e.Submit(testOrder("b1", "buy", "100", "2", 2))
+	e.Submit(testOrder("s1", "buy", "105", "1", 3, withTrigger(storage.TriggerStop, "104")))
+	info, err := e.WriteSnapshot(snapDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Seq != 5 || info.Orders != 3 {
+		t.Fatalf("snapshot = %+v, want seq 5 with 3 orders", info)
+	}
+	// 快照之后的输入只在日志中
+	e.Submit(testOrder("b2", "buy", "100", "2", 4))
+	e.Submit(testOrder("b3", "buy", "99", "7", 5))
+	want := engineStateJSON(t, e)
+	e.SetJournal(nil)
+	j.Close()
+
+	j2, err := OpenJournal(journalDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j2.Close()
+	e2 := NewEngine(snapshotTestPairs())
+	st, err := Restore(e2, snapDir, j2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Source != RestoreSourceSnapshot || st.SnapshotSeq != 5 || st.JournalEvents != 2 || st.Seq != 7 {
+		t.Errorf("restore stats = %+v", st)
+	}
+	if got := engineStateJSON(t, e2); got != want {
+		t.Errorf("restored state differs:\n got %s\nwant %s", got, want)
+	}
+	// 恢复后继续撮合：同价队列顺序与冰山单可见量须与原引擎一致
+	live, _ := json.Marshal(e.Match(testOrder("b4", "buy", "100", "4", 6)))
+	restored, _ := json.Marshal(e2.Match(testOrder("b4", "buy", "100", "4", 6)))
+	if string(live) != string(restored) {
+		t.Errorf("post-restore trades differ:\n got %s\nwant %s", restored, live)
+	}
+}
+
+func TestSnapshotCorruptFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	e := NewEngine(snapshotTestPairs())
+	e.Submit(testOrder("a1", "sell", "100", "10", 1))
+	if _, err := e.WriteSnapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+	e.Submit(testOrder("a2", "sell", "101", "10", 2))
+	e.seq = 2 // 未启用日志时序号不前进，模拟第二个快照
+	info, err := e.WriteSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(info.Path)
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(info.Path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEngine(nil).LoadSnapshot(info.Path); !errors.Is(err, ErrSnapshotCorrupt) {
+		t.Errorf("load corrupted snapshot: err = %v", err)
+	}
+	e2 := NewEngine(snapshotTestPairs())
+	got, err := LoadLatestSnapshot(e2, dir)
+	if err != nil || got == nil || got.Seq != 0 {
+		t.Fatalf("fallback snapshot = %+v, %v", got, err)
+	}
+	if e2.GetOrder("a1") == nil || e2.GetOrder("a2") != nil {
+		t.Error("fallback snapshot content mismatch")
+	}
+}
+
+// 写快照后清理已被快照覆盖的日志段（当前段保留），设置归档目录时移入归档目录；恢复与归档回放不受影响
+func TestSnapshotPrunesJournalSegments(t *testing.T) {
+	dir := t.TempDir()
+	journalDir, snapDir, archiveDir := filepath.Join(dir, "journal"), filepath.Join(dir, "snapshots"), filepath.Join(dir, "archive")
+	j, err := OpenJournal(journalDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(snapshotTestPairs())
+	if _, err := Restore(e, snapDir, j, nil); err != nil {
+		t.Fatal(err)
+	}
+	rotate := func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if err := j.rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.Submit(testOrder("a1", "sell", "100", "10", 1))
+	rotate()
+	e.Submit(testOrder("a2", "sell", "101", "10", 2))
+	if segs, _ := journalSegments(journalDir); len(segs) != 2 {
+		t.Fatalf("segments = %d, want 2", len(segs))
+	}
+	if _, err := e.WriteSnapshot(snapDir); err != nil {
+		t.Fatal(err)
+	}
+	segs, _ := journalSegments(journalDir)
+	if len(segs) != 1 || segs[0].start != 2 {
+		t.Fatalf("after snapshot segments = %+v, want only the active segment from seq 2", segs)
+	}
+
+	j.SetArchiveDir(archiveDir)
+	rotate()
+	e.Submit(testOrder("b1", "buy", "99", "1", 3))
+	rotate()
+	e.Submit(testOrder("b2", "buy", "98", "1", 4))
+	if _, err := e.WriteSnapshot(snapDir); err != nil {
+		t.Fatal(err)
+	}
+	// 最旧保留快照 seq=2：仅 seq<=2 的段可清理，seq 3 所在段须保留供回退快照回放
+	if segs, _ := journalSegments(journalDir); len(segs) != 2 || segs[0].start != 3 {
+		t.Fatalf("after second snapshot segments = %+v", segs)
+	}
+	if archived, _ := journalSegments(archiveDir); len(archived) != 1 || archived[0].start != 2 {
+		t.Fatalf("archived = %+v, want segment from seq 2", archived)
+	}
+	want := engineStateJSON(t, e)
+	e.SetJournal(nil)
+	j.Close()
+
+	j2, err := OpenJournal(journalDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j2.Close()
+	if j2.LastSeq() != 4 {
+		t.Fatalf("reopened journal seq = %d, want 4", j2.LastSeq())
+	}
+	e2 := NewEngine(snapshotTestPairs())
+	if _, err := Restore(e2, snapDir, j2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := engineStateJSON(t, e2); got != want {
+		t.Errorf("restored state differs:\n got %s\nwant %s", got, want)
+	}
+	// 无快照时不能从清理后的日志目录回放（首段缺失）
+	if _, err := ReplayJournal(NewEngine(snapshotTestPairs()), journalDir, nil); !errors.Is(err, ErrJournalCorrupt) {
+		t.Errorf("replay pruned journal without snapshot: err = %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package match
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// ValidateSelfTradePrevention 校验自成交防护模式（空为使用交易对配置 / 不防护）
+func ValidateSelfTradePrevention(mode string) error {
+	switch mode {
+	case "", storage.SelfTradeCancelNewest, storage.SelfTradeCancelOldest, storage.SelfTradeCancelBoth, storage.SelfTradeDecrementAndCancel:
+		return nil
+	}
+	return fmt.Errorf("invalid selfTradePrevention: must be cancel_newest, cancel_oldest, cancel_both or decrement_and_cancel")
+}
+
+// selfTradeModeLocked 返回 taker 生效的自成交防护模式：订单设置优先，其次交易对配置（调用方需已持锁）
+func (e *Engine) selfTradeModeLocked(taker *storage.Order) string {
+	if taker.SelfTradePrevention != "" {
+		return taker.SelfTradePrevention
+	}
+	return e.tokens[taker.Pair].SelfTradePrevention
+}
+
+// sameTrader 判断两笔订单是否属于同一 trader（地址大小写不敏感）
+func sameTrader(a, b *storage.Order) bool {
+	return a.Trader != "" && strings.EqualFold(a.Trader, b.Trader)
+}
+
+// selfTrade 一次被阻止的自成交的处理结果
+type selfTrade struct {
+	cancelMaker bool     // 撤销挂单
+	cancelTaker bool     // 撤销 taker 剩余部分并停止撮合
+	decrement   *big.Int // 双方同时减去的数量（decrement_and_cancel），nil 为不减量
+}
+
+// resolveSelfTrade 按模式决定 taker 与同 trader 挂单相遇时的处理；makerLeft 为挂单剩余总量（含冰山隐藏量），
+// unbounded 为按预算且不限数量的市价买单（视为剩余无限大）
+func resolveSelfTrade(mode string, takerLeft, makerLeft *big.Int, unbounded bool) selfTrade {
+	switch mode {
+	case storage.SelfTradeCancelOldest:
+		return selfTrade{cancelMaker: true}
+	case storage.SelfTradeCancelBoth:
+		return selfTrade{cancelMaker: true, cancelTaker: true}
+	case storage.SelfTradeDecrementAndCancel:
+		if unbounded {
+			return selfTrade{cancelMaker: true}
+		}
+		c := takerLeft.Cmp(makerLeft)
+		return selfTrade{cancelMaker: c >= 0, cancelTaker: c <= 0, decrement: minUnits(takerLeft, makerLeft)}
+	default:
+		return selfTrade{cancelTaker: true}
+	}
+}
+
+// decrementOrder 将订单 Amount 减去 qty（自成交防护减量，不计入 Filled）
+func decrementOrder(o *storage.Order, qty *big.Int) {
+	o.Amount = storage.FormatUnits(new(big.Int).Sub(storage.MustUnits(o.Amount), qty))
+}
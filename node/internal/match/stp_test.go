@@ -0,0 +1,81 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// stpBook 卖盘：s1（0x1）10@100、s2（0x2）10@101
+func stpBook() testEngineOption {
+	return withOrders(testOrder("s1", "sell", "100", "10", 1), testOrder("s2", "sell", "101", "10", 2, withTrader("0x2")))
+}
+
+func TestSelfTradePreventionModes(t *testing.T) {
+	cases := []struct {
+		mode       string
+		amount     string
+		wantStatus string
+		wantFilled string
+		wantAmount string
+		wantTrades int
+		wantMaker  string // s1 的状态（空为仍在簿内）
+		wantS1Left string
+	}{
+		{storage.SelfTradeCancelNewest, "15", "cancelled", "0", "15", 0, "", "10"},
+		{storage.SelfTradeCancelOldest, "15", "partial", "10", "15", 1, "cancelled", ""},
+		{storage.SelfTradeCancelBoth, "15", "cancelled", "0", "15", 0, "cancelled", ""},
+		// taker 15 > 挂单 10：挂单撤销，taker 减量 10 后以剩余 5 吃 s2
+		{storage.SelfTradeDecrementAndCancel, "15", "filled", "5", "5", 1, "cancelled", ""},
+		// taker 4 < 挂单 10：taker 撤销，挂单减量至 6
+		{storage.SelfTradeDecrementAndCancel, "4", "cancelled", "0", "0", 0, "", "6"},
+	}
+	for _, c := range cases {
+		e := newTestEngine(t, withSTP(c.mode), stpBook())
+		taker := testOrder("b1", "buy", "101", c.amount, 10)
+		res := e.Submit(taker)
+		if taker.Status != c.wantStatus || taker.Filled != c.wantFilled || taker.Amount != c.wantAmount || len(res.Trades) != c.wantTrades {
+			t.Errorf("%s/%s: taker status=%s filled=%s amount=%s trades=%d", c.mode, c.amount, taker.Status, taker.Filled, taker.Amount, len(res.Trades))
+		}
+		for _, tr := range res.Trades {
+			if tr.Maker == tr.Taker {
+				t.Errorf("%s: self trade %+v", c.mode, tr)
+			}
+		}
+		if len(res.Prevented) != 1 || res.Prevented[0].OrderID != "s1" || c.wantMaker != "" && res.Prevented[0].Status != c.wantMaker {
+			t.Errorf("%s/%s: prevented = %+v", c.mode, c.amount, res.Prevented)
+		}
+		_, asks := e.GetOrderbook("TKA/TKB")
+		var s1 *storage.Order
+		for _, o := range asks {
+			if o.OrderID == "s1" {
+				s1 = o
+			}
+		}
+		if c.wantS1Left == "" && s1 != nil || c.wantS1Left != "" && (s1 == nil || s1.Remaining().String() != c.wantS1Left) {
+			t.Errorf("%s/%s: s1 in book = %+v, want remaining %q", c.mode, c.amount, s1, c.wantS1Left)
+		}
+	}
+}
+
+func TestSelfTradePreventionOrderOverride(t *testing.T) {
+	// 交易对未配置：默认允许（兼容旧行为）；订单可单独启用
+	e := newTestEngine(t, withSTP(""), stpBook())
+	if res := e.Submit(testOrder("b1", "buy", "100", "5", 10)); len(res.Trades) != 1 {
+		t.Fatalf("trades = %d, want 1 without STP", len(res.Trades))
+	}
+	o := testOrder("b2", "buy", "100", "5", 11)
+	o.SelfTradePrevention = storage.SelfTradeCancelNewest
+	if res := e.Submit(o); len(res.Trades) != 0 || o.Status != "cancelled" {
+		t.Errorf("trades=%d status=%s, want cancelled by order-level STP", len(res.Trades), o.Status)
+	}
+	// FOK 会遇到自己的挂单：整单拒绝，订单簿不变
+	fok := testOrder("b3", "buy", "101", "10", 12, withTIF(storage.TimeInForceFOK))
+	fok.SelfTradePrevention = storage.SelfTradeCancelOldest
+	if res := e.Submit(fok); fok.Status != "rejected" || len(res.Prevented) != 0 {
+		t.Errorf("FOK status=%s prevented=%d, want rejected without side effects", fok.Status, len(res.Prevented))
+	}
+	if err := ValidateSelfTradePrevention("expire_maker"); err == nil {
+		t.Error("unknown STP mode should be rejected")
+	}
+}
@@ -0,0 +1,173 @@
+package match
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// ValidateTimeInForce 校验订单有效期参数（与订单类型的组合）
+// - GTD 须设置 ExpiresAt
+// - 市价单仅支持 IOC（默认）与 FOK；FOK 市价单须按 amount 下单，不支持 quote 预算
+// - PostOnlyReprice 仅用于 POST_ONLY
+func ValidateTimeInForce(o *storage.Order) error {
+	tif := o.EffectiveTimeInForce()
+	switch tif {
+	case storage.TimeInForceGTC, storage.TimeInForceIOC, storage.TimeInForceFOK, storage.TimeInForcePostOnly:
+	case storage.TimeInForceGTD:
+		if o.ExpiresAt <= 0 {
+			return fmt.Errorf("invalid timeInForce: GTD requires expiresAt")
+		}
+	default:
+		return fmt.Errorf("invalid timeInForce: must be GTC, GTD, IOC, FOK or POST_ONLY")
+	}
+	if o.PostOnlyReprice && tif != storage.TimeInForcePostOnly {
+		return fmt.Errorf("invalid postOnlyReprice: only allowed with POST_ONLY")
+	}
+	if o.IsMarket() && o.TimeInForce != "" {
+		switch {
+		case tif == storage.TimeInForceIOC:
+		case tif == storage.TimeInForceFOK && o.QuoteAmount == "":
+		case tif == storage.TimeInForceFOK:
+			return fmt.Errorf("invalid timeInForce: FOK market orders require amount, not quoteAmount")
+		default:
+			return fmt.Errorf("invalid timeInForce: market orders only support IOC or FOK")
+		}
+	}
+	return nil
+}
+
+// SubmitResult Submit 的结果：本次撮合成交（含级联激活的条件单成交）与被激活的条件单
+type SubmitResult struct {
+	Trades    []*storage.Trade
+	Activated []*storage.Order // 被激活的条件单（引擎副本，Status/Filled/TriggeredAt 已更新），供持久化与推送
+	Prevented []*storage.Order // 自成交防护撤销（status=cancelled）或减量（Amount 减少）的挂单副本，作为订单状态更新推送
+	// Reason 订单被拒绝（status=rejected）的原因，可用 errors.Is 区分：storage.ErrOrderIDConflict、ErrUnknownPair、
+	// ErrPairNotTrading、ErrJournalWrite 等；参数非法时为校验错误
+	Reason error
+}
+
+// reject 将订单置为 rejected 并记录原因
+func (res *SubmitResult) reject(o *storage.Order, reason error) *SubmitResult {
+	o.Status = storage.OrderStatusRejected
+	res.Reason = reason
+	return res
+}
+
+// Submit 新订单入口：以 taker 身份撮合，再按 timeInForce 将剩余部分挂单或撤销
+// 撮合与挂单在同一交易对分片锁内完成，同交易对的其他订单无法插入其间；order 的 Filled/Status（POST_ONLY 改价后的 Price）原地更新
+// 状态：filled | partial/open（剩余已挂单）| cancelled（IOC/市价剩余撤销，或订单簿已满无法挂单）| rejected（FOK 不足、POST_ONLY 会吃单、参数非法、orderId 冲突）
+// 冰山单作为 taker 时按全部剩余量撮合，挂单后只展示 DisplayAmount
+// 条件单：未满足触发条件时进入触发簿（status=pending）；已满足则立即激活。成交后按最新成交价激活触发簿中的条件单
+func (e *Engine) Submit(o *storage.Order) *SubmitResult {
+	res := &SubmitResult{}
+	if err := ValidateTimeInForce(o); err != nil {
+		return res.reject(o, err)
+	}
+	if err := ValidateTrigger(o); err != nil {
+		return res.reject(o, err)
+	}
+	if err := ValidateIceberg(o); err != nil {
+		return res.reject(o, err)
+	}
+	if err := ValidateSelfTradePrevention(o.SelfTradePrevention); err != nil {
+		return res.reject(o, err)
+	}
+	if o.AmendedAt != 0 || len(o.Amends) > 0 || o.SignedPrice != "" || o.SignedAmount != "" {
+		return res.reject(o, fmt.Errorf("invalid amends: must not be set by client"))
+	}
+	if o.IsMarket() {
+		if _, err := ValidateMarketOrder(o); err != nil {
+			return res.reject(o, err)
+		}
+	} else if p, ok := storage.ParseUnits(o.Price); !ok || p.Sign() <= 0 || o.Amount == "" {
+		return res.reject(o, fmt.Errorf("invalid price or amount"))
+	}
+	sh, unlock := e.lockPair(o.Pair)
+	defer unlock()
+	// 未上架交易对、暂停/只撤单期间、orderId 已被其他订单占有或 nonce 已在其他交易对使用时拒绝，集合竞价期间只接受限价 GTC/GTD（拒绝的订单不写日志）
+	if sh == nil {
+		return res.reject(o, fmt.Errorf("%w: %s", ErrUnknownPair, o.Pair))
+	}
+	if err := e.checkPairStateLocked(o); err != nil {
+		return res.reject(o, err)
+	}
+	if err := e.claimOrderID(o, o.Pair); err != nil {
+		return res.reject(o, err)
+	}
+	defer e.releaseOrderID(o.OrderID)
+	if !e.recordLocked(sh, &JournalEvent{Type: EventSubmit, Order: o}) {
+		return res.reject(o, ErrJournalWrite)
+	}
+	if e.isBatchLocked(o.Pair) {
+		if err := ValidateBatchOrder(o); err != nil {
+			return res.reject(o, err)
+		}
+	}
+	// 排队时间由引擎在准入时打戳（回放时为日志记录的时间），客户端回填的 CreatedAt/QueuedAt 不影响排队
+	o.QueuedAt = e.nowLocked(o.Pair)
+	if o.IsPendingTrigger() {
+		if lt := sh.lastTrade; lt == nil || !triggerReached(o, lt.price) {
+			if e.parkTriggerLocked(o) {
+				o.Status = storage.OrderStatusPending
+			} else {
+				o.Status = storage.OrderStatusRejected
+			}
+			return res
+		}
+		// 下单时已满足触发条件：立即激活
+		o.TriggeredAt = o.QueuedAt
+	}
+	e.submitLocked(o, res)
+	if len(res.Trades) > 0 {
+		e.activateTriggersLocked(o.Pair, res)
+	}
+	return res
+}
+
+// submitLocked 撮合并按 timeInForce 挂单剩余部分，成交与自成交防护结果追加到 res（调用方需已锁定 o.Pair 分片）
+// 批量拍卖交易对不立即撮合，订单留待 Epoch 清算（见 RunAuction）
+func (e *Engine) submitLocked(o *storage.Order, res *SubmitResult) {
+	if e.pairStateLocked(o.Pair) == PairAuction {
+		// 集合竞价：只挂单，结束时统一清算
+		if e.addLocked(o) {
+			o.Status = takerRestingStatus(storage.MustUnits(o.Filled))
+		} else {
+			o.Status = storage.OrderStatusCancelled
+		}
+		return
+	}
+	if e.isBatchLocked(o.Pair) {
+		e.queueAuctionLocked(o)
+		return
+	}
+	trades, prevented := e.matchLocked(o)
+	res.Trades = append(res.Trades, trades...)
+	res.Prevented = append(res.Prevented, prevented...)
+	if o.Status != storage.OrderStatusOpen && o.Status != storage.OrderStatusPartial {
+		return
+	}
+	if !e.addLocked(o) {
+		// 剩余部分无法挂单（如订单簿已满或已过期）：撤销剩余，已成交部分保留
+		o.Status = storage.OrderStatusCancelled
+	}
+}
+
+// postOnlyPrice 返回 POST_ONLY 订单的挂单价：不会与对手盘成交时原价返回；
+// 会成交时若 PostOnlyReprice 则改为对手盘最优价内侧一档（买 best-1 / 卖 best+1，最小单位），否则返回 ok=false
+func postOnlyPrice(ob *OrderBook, o *storage.Order, price *big.Int) (*big.Int, bool) {
+	buy := o.Side == "buy"
+	_, best := ob.best(!buy)
+	if best == nil || buy && price.Cmp(best) < 0 || !buy && price.Cmp(best) > 0 {
+		return price, true
+	}
+	if !o.PostOnlyReprice {
+		return nil, false
+	}
+	if buy {
+		p := new(big.Int).Sub(best, big.NewInt(1))
+		return p, p.Sign() > 0
+	}
+	return new(big.Int).Add(best, big.NewInt(1)), true
+}
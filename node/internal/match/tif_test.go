@@ -0,0 +1,101 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// tifBook 卖盘：a1 10@100、a2 10@101
+func tifBook() testEngineOption {
+	return withOrders(testOrder("a1", "sell", "100", "10", 1), testOrder("a2", "sell", "101", "10", 2))
+}
+
+func TestSubmitGTCRestsRemainder(t *testing.T) {
+	e := newTestEngine(t, tifBook())
+	o := testOrder("b1", "buy", "100", "15", 10)
+	trades := e.Submit(o).Trades
+	if len(trades) != 1 || o.Filled != "10" || o.Status != "partial" {
+		t.Fatalf("trades=%d filled=%s status=%s", len(trades), o.Filled, o.Status)
+	}
+	bids, _ := e.GetOrderbook("TKA/TKB")
+	if len(bids) != 1 || bids[0].OrderID != "b1" || bids[0].Amount != "5" {
+		t.Errorf("resting bid = %+v, want b1 with 5 remaining", bids)
+	}
+}
+
+func TestSubmitIOCCancelsRemainder(t *testing.T) {
+	e := newTestEngine(t, tifBook())
+	o := testOrder("b1", "buy", "100", "15", 10, withTIF(storage.TimeInForceIOC))
+	e.Submit(o)
+	if o.Filled != "10" || o.Status != "cancelled" {
+		t.Errorf("filled=%s status=%s, want 10 cancelled", o.Filled, o.Status)
+	}
+	if bids, _ := e.GetOrderbook("TKA/TKB"); len(bids) != 0 {
+		t.Errorf("IOC remainder must not rest, bids=%d", len(bids))
+	}
+}
+
+func TestSubmitFOK(t *testing.T) {
+	e := newTestEngine(t, tifBook())
+	// 限价 100 只有 10 可成交，需 15：拒绝且订单簿不变
+	o := testOrder("b1", "buy", "100", "15", 10, withTIF(storage.TimeInForceFOK))
+	if trades := e.Submit(o).Trades; len(trades) != 0 || o.Status != "rejected" || o.Filled != "0" {
+		t.Fatalf("trades=%d status=%s filled=%s, want rejected without fills", len(trades), o.Status, o.Filled)
+	}
+	if _, asks := e.GetOrderbook("TKA/TKB"); len(asks) != 2 || asks[0].Filled != "0" {
+		t.Errorf("FOK rejection must not touch the book: %+v", asks)
+	}
+	// 限价 101 有 20 可成交：全部成交
+	o2 := testOrder("b2", "buy", "101", "15", 11, withTIF(storage.TimeInForceFOK))
+	if trades := e.Submit(o2).Trades; len(trades) != 2 || o2.Status != "filled" {
+		t.Errorf("trades=%d status=%s, want 2 filled", len(trades), o2.Status)
+	}
+}
+
+func TestSubmitPostOnly(t *testing.T) {
+	e := newTestEngine(t, tifBook())
+	// 会吃单：拒绝
+	o := testOrder("b1", "buy", "100", "5", 10, withTIF(storage.TimeInForcePostOnly))
+	if trades := e.Submit(o).Trades; len(trades) != 0 || o.Status != "rejected" {
+		t.Fatalf("trades=%d status=%s, want rejected", len(trades), o.Status)
+	}
+	// 改价：挂在最优卖价内侧一档
+	o2 := testOrder("b2", "buy", "105", "5", 11, withTIF(storage.TimeInForcePostOnly))
+	o2.PostOnlyReprice = true
+	if trades := e.Submit(o2).Trades; len(trades) != 0 || o2.Status != "open" || o2.Price != "99" {
+		t.Fatalf("trades=%d status=%s price=%s, want open @99", len(trades), o2.Status, o2.Price)
+	}
+	// 不会吃单：直接挂单
+	o3 := testOrder("b3", "buy", "90", "5", 12, withTIF(storage.TimeInForcePostOnly))
+	e.Submit(o3)
+	bids, asks := e.GetOrderbook("TKA/TKB")
+	if len(bids) != 2 || bids[0].OrderID != "b2" || bids[0].Price != "99" || len(asks) != 2 {
+		t.Errorf("bids=%v asks=%d", orderIDs(bids), len(asks))
+	}
+	// AddOrder 同样拒绝会吃单的 POST_ONLY
+	if e.AddOrder(testOrder("b4", "buy", "100", "5", 13, withTIF(storage.TimeInForcePostOnly))) {
+		t.Error("AddOrder must reject crossing POST_ONLY")
+	}
+}
+
+func TestValidateTimeInForce(t *testing.T) {
+	cases := []struct {
+		o  storage.Order
+		ok bool
+	}{
+		{storage.Order{}, true},
+		{storage.Order{TimeInForce: storage.TimeInForceGTD}, false},
+		{storage.Order{TimeInForce: storage.TimeInForceGTD, ExpiresAt: 100}, true},
+		{storage.Order{TimeInForce: "DAY"}, false},
+		{storage.Order{TimeInForce: storage.TimeInForceIOC, PostOnlyReprice: true}, false},
+		{storage.Order{Type: storage.OrderTypeMarket, TimeInForce: storage.TimeInForcePostOnly}, false},
+		{storage.Order{Type: storage.OrderTypeMarket, TimeInForce: storage.TimeInForceFOK, Amount: "1"}, true},
+		{storage.Order{Type: storage.OrderTypeMarket, TimeInForce: storage.TimeInForceFOK, QuoteAmount: "1"}, false},
+	}
+	for i, c := range cases {
+		if err := ValidateTimeInForce(&c.o); (err == nil) != c.ok {
+			t.Errorf("case %d: err=%v want ok=%v", i, err, c.ok)
+		}
+	}
+}
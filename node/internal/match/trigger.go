@@ -0,0 +1,184 @@
+package match
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// triggerBook 单交易对条件单触发簿
+//
+// 条件单在最新成交价穿越触发价前不进入订单簿：
+// - rising：last >= trigger 时激活（止损买、止盈卖），按触发价升序
+// - falling：last <= trigger 时激活（止损卖、止盈买），按触发价降序
+// 复用订单簿的价格档位跳表，插入/撤销 O(log n)，每次成交后只检查队首档位
+type triggerBook struct {
+	rising  *bookSide
+	falling *bookSide
+	index   map[string]*bookOrder // orderID -> 簿内节点
+}
+
+// lastTrade 交易对最新成交（条件单触发基准）
+type lastTrade struct {
+	price *big.Int
+	ts    int64
+}
+
+func newTriggerBook() *triggerBook {
+	return &triggerBook{
+		rising:  newBookSide(false),
+		falling: newBookSide(true),
+		index:   make(map[string]*bookOrder),
+	}
+}
+
+// triggersOnRise 条件单是否在价格上涨穿越触发价时激活
+func triggersOnRise(o *storage.Order) bool {
+	buy := o.Side == "buy"
+	return o.Trigger == storage.TriggerStop && buy || o.Trigger == storage.TriggerTakeProfit && !buy
+}
+
+// triggerReached 判断最新成交价是否已满足条件单的触发条件
+func triggerReached(o *storage.Order, last *big.Int) bool {
+	trigger := storage.MustUnits(o.TriggerPrice)
+	if triggersOnRise(o) {
+		return last.Cmp(trigger) >= 0
+	}
+	return last.Cmp(trigger) <= 0
+}
+
+// Len 返回待触发条件单数量
+func (tb *triggerBook) Len() int {
+	return tb.rising.orders + tb.falling.orders
+}
+
+// add 放入待触发条件单（o 须为引擎持有的副本）
+func (tb *triggerBook) add(o *storage.Order) {
+	s := tb.falling
+	if triggersOnRise(o) {
+		s = tb.rising
+	}
+	tb.index[o.OrderID] = s.push(o, storage.MustUnits(o.TriggerPrice))
+}
+
+// remove 按 orderID 撤销待触发条件单
+func (tb *triggerBook) remove(orderID string) bool {
+	n, ok := tb.index[orderID]
+	if !ok {
+		return false
+	}
+	delete(tb.index, orderID)
+	n.level.side.unlink(n)
+	return true
+}
+
+// popTriggered 取出所有被 last 触发的条件单，按 CreatedAt、OrderID 升序返回（确定性激活顺序）
+func (tb *triggerBook) popTriggered(last *big.Int) []*storage.Order {
+	var fired []*storage.Order
+	pop := func(s *bookSide, reached func(trigger *big.Int) bool) {
+		// 整档取出；档位清空后从跳表删除，队首前移到下一档
+		for x := s.head.next[0]; x != nil && reached(x.level.price); x = s.head.next[0] {
+			lvl := x.level
+			for lvl.head != nil {
+				n := lvl.head
+				delete(tb.index, n.order.OrderID)
+				fired = append(fired, n.order)
+				s.unlink(n)
+			}
+		}
+	}
+	pop(tb.rising, func(trigger *big.Int) bool { return last.Cmp(trigger) >= 0 })
+	pop(tb.falling, func(trigger *big.Int) bool { return last.Cmp(trigger) <= 0 })
+	sort.SliceStable(fired, func(i, j int) bool {
+		if fired[i].CreatedAt != fired[j].CreatedAt {
+			return fired[i].CreatedAt < fired[j].CreatedAt
+		}
+		return fired[i].OrderID < fired[j].OrderID
+	})
+	return fired
+}
+
+// ValidateTrigger 校验条件单参数：trigger 与 triggerPrice 须同时设置，仅支持限价单，客户端不得设置 triggeredAt
+func ValidateTrigger(o *storage.Order) error {
+	if o.Trigger == "" && o.TriggerPrice == "" {
+		return nil
+	}
+	if o.Trigger != storage.TriggerStop && o.Trigger != storage.TriggerTakeProfit {
+		return fmt.Errorf("invalid trigger: must be stop or take_profit")
+	}
+	if p, ok := storage.ParseUnits(o.TriggerPrice); !ok || p.Sign() <= 0 {
+		return fmt.Errorf("invalid triggerPrice: must be a positive integer in base units")
+	}
+	if o.IsMarket() {
+		return fmt.Errorf("invalid trigger: only limit orders can be conditional")
+	}
+	if o.TriggeredAt != 0 {
+		return fmt.Errorf("invalid triggeredAt: must not be set by client")
+	}
+	return nil
+}
+
+// SetLastTradePrice 设置交易对最新成交价（重启后从成交记录恢复条件单触发基准）
+func (e *Engine) SetLastTradePrice(pair, price string, ts int64) {
+	p, ok := storage.ParseUnits(price)
+	if pair == "" || !ok || p.Sign() <= 0 {
+		return
+	}
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil || !e.recordLocked(sh, &JournalEvent{Type: EventLastPrice, Pair: pair, Price: price, Ts: ts}) {
+		return
+	}
+	sh.lastTrade = &lastTrade{price: p, ts: ts}
+}
+
+// PendingTriggerCount 返回交易对待触发条件单数量
+func (e *Engine) PendingTriggerCount(pair string) int {
+	sh, unlock := e.lockPair(pair)
+	defer unlock()
+	if sh == nil {
+		return 0
+	}
+	return e.triggers[pair].Len()
+}
+
+// parkTriggerLocked 将待触发条件单放入触发簿（调用方需已锁定 o.Pair 分片）
+func (e *Engine) parkTriggerLocked(o *storage.Order) bool {
+	o2, ok := restingCopy(o)
+	if !ok {
+		return false
+	}
+	o2.Status = storage.OrderStatusPending
+	tb := e.triggers[o.Pair]
+	tb.remove(o.OrderID)
+	tb.add(o2)
+	e.indexOrder(o2, o.Pair)
+	e.scheduleExpiryLocked(o2)
+	return true
+}
+
+// activateTriggersLocked 按最新成交价激活条件单：激活的订单依次撮合并挂单，其成交可能继续触发（级联直至稳定）
+// 激活时间取触发成交的时间戳，保证多节点一致（调用方需已锁定该交易对分片）
+func (e *Engine) activateTriggersLocked(pair string, res *SubmitResult) {
+	for {
+		tb := e.triggers[pair]
+		lt := e.shards[pair].lastTrade
+		// 熔断暂停后不再激活，待恢复交易后的下一笔成交触发
+		if tb == nil || lt == nil || e.pairStateLocked(pair) != PairTrading {
+			return
+		}
+		fired := tb.popTriggered(lt.price)
+		if len(fired) == 0 {
+			return
+		}
+		for _, o := range fired {
+			e.holdOrderID(o.OrderID)
+			o.TriggeredAt = lt.ts
+			e.submitLocked(o, res)
+			e.releaseOrderID(o.OrderID)
+			res.Activated = append(res.Activated, o)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// TestSubmitStopOrderActivation 止损卖单在成交价跌破触发价后激活并吃买盘
+func TestSubmitStopOrderActivation(t *testing.T) {
+	e := newTestEngine(t)
+	for _, o := range []*storage.Order{
+		testOrder("b1", "buy", "96", "5", 1),
+		testOrder("b2", "buy", "94", "10", 2),
+		testOrder("a1", "sell", "100", "5", 3),
+	} {
+		if !e.AddOrder(o) {
+			t.Fatalf("AddOrder %s failed", o.OrderID)
+		}
+	}
+	stop := testOrder("s1", "sell", "90", "8", 4, withTrigger(storage.TriggerStop, "95"))
+	if res := e.Submit(stop); len(res.Trades) != 0 || stop.Status != "pending" {
+		t.Fatalf("stop status=%s trades=%d, want pending without trades", stop.Status, len(res.Trades))
+	}
+	if e.PendingTriggerCount("TKA/TKB") != 1 {
+		t.Fatal("stop order should be parked in trigger book")
+	}
+	if bids, asks := e.GetOrderbook("TKA/TKB"); len(bids) != 2 || len(asks) != 1 {
+		t.Fatal("pending stop order must not enter the book")
+	}
+
+	// 成交价 96 未跌破 95：不激活
+	res := e.Submit(testOrder("t1", "sell", "96", "5", 5))
+	if len(res.Trades) != 1 || len(res.Activated) != 0 {
+		t.Fatalf("trades=%d activated=%d, want 1/0", len(res.Trades), len(res.Activated))
+	}
+	// 成交价 94 跌破 95：激活止损单，吃剩余买盘 94
+	res = e.Submit(testOrder("t2", "sell", "94", "2", 6))
+	if len(res.Activated) != 1 || res.Activated[0].OrderID != "s1" {
+		t.Fatalf("activated = %v, want s1", res.Activated)
+	}
+	act := res.Activated[0]
+	if act.TriggeredAt != res.Trades[0].Timestamp || act.Filled != "8" || act.Status != "filled" {
+		t.Errorf("activated s1 triggeredAt=%d filled=%s status=%s", act.TriggeredAt, act.Filled, act.Status)
+	}
+	if len(res.Trades) != 2 || res.Trades[1].TakerOrderID != "s1" || res.Trades[1].Amount != "8" {
+		t.Errorf("trades = %+v", res.Trades)
+	}
+	if e.PendingTriggerCount("TKA/TKB") != 0 {
+		t.Error("trigger book should be empty after activation")
+	}
+}
+
+// TestTriggerActivationOrder 同一成交触发多张条件单时按 CreatedAt、OrderID 确定性激活
+func TestTriggerActivationOrder(t *testing.T) {
+	tb := newTriggerBook()
+	for _, o := range []*storage.Order{
+		testOrder("c", "buy", "110", "1", 2, withTrigger(storage.TriggerStop, "105")),
+		testOrder("a", "buy", "110", "1", 2, withTrigger(storage.TriggerStop, "101")),
+		testOrder("b", "sell", "110", "1", 1, withTrigger(storage.TriggerTakeProfit, "103")),
+		testOrder("d", "buy", "110", "1", 0, withTrigger(storage.TriggerStop, "120")),
+		testOrder("e", "sell", "90", "1", 0, withTrigger(storage.TriggerStop, "99")),
+	} {
+		tb.add(o)
+	}
+	fired := tb.popTriggered(storage.MustUnits("105"))
+	if got := orderIDs(fired); len(got) != 3 || got[0] != "b" || got[1] != "a" || got[2] != "c" {
+		t.Errorf("fired = %v, want [b a c]", got)
+	}
+	if tb.Len() != 2 {
+		t.Errorf("remaining = %d, want 2", tb.Len())
+	}
+	// falling 侧：last <= 99 激活止损卖 e
+	if fired := tb.popTriggered(storage.MustUnits("99")); len(fired) != 1 || fired[0].OrderID != "e" {
+		t.Errorf("fired = %v, want [e]", orderIDs(fired))
+	}
+}
+
+func TestTriggerOrderCancelAndImmediateActivation(t *testing.T) {
+	e := newTestEngine(t, tifBook())
+	stop := testOrder("s1", "buy", "110", "5", 10, withTrigger(storage.TriggerStop, "105"))
+	e.Submit(stop)
+	if !e.RemoveOrder("", "s1") || e.PendingTriggerCount("TKA/TKB") != 0 {
+		t.Fatal("RemoveOrder should cancel pending trigger order")
+	}
+	// 最新成交价 100 已高于触发价 99：下单即激活
+	e.SetLastTradePrice("TKA/TKB", "100", 5)
+	e.clock = func() int64 { return 12 }
+	stop2 := testOrder("s2", "buy", "100", "5", 11, withTrigger(storage.TriggerStop, "99"))
+	res := e.Submit(stop2)
+	if stop2.TriggeredAt != 12 || stop2.Status != "filled" || len(res.Trades) != 1 {
+		t.Errorf("s2 triggeredAt=%d status=%s trades=%d", stop2.TriggeredAt, stop2.Status, len(res.Trades))
+	}
+}
+
+func TestValidateTrigger(t *testing.T) {
+	cases := []struct {
+		o  storage.Order
+		ok bool
+	}{
+		{storage.Order{}, true},
+		{storage.Order{Trigger: storage.TriggerStop, TriggerPrice: "10"}, true},
+		{storage.Order{Trigger: storage.TriggerStop}, false},
+		{storage.Order{TriggerPrice: "10"}, false},
+		{storage.Order{Trigger: "trailing", TriggerPrice: "10"}, false},
+		{storage.Order{Trigger: storage.TriggerTakeProfit, TriggerPrice: "10", Type: storage.OrderTypeMarket}, false},
+		{storage.Order{Trigger: storage.TriggerStop, TriggerPrice: "10", TriggeredAt: 1}, false},
+	}
+	for i, c := range cases {
+		if err := ValidateTrigger(&c.o); (err == nil) != c.ok {
+			t.Errorf("case %d: err=%v want ok=%v", i, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package match
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/P2P-P2P/p2p/node/internal/metrics"
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+// DefaultSignatureCacheSize 签名验证结果缓存的默认容量（config match.signature_cache_size 为 0 时）
+const DefaultSignatureCacheSize = 65536
+
+// sigBatchSize 每个验证 worker 一次取出的最大任务数
+const sigBatchSize = 64
+
+// ErrVerifierStopped 验证器已停止（节点退出中）
+var ErrVerifierStopped = errors.New("signature verifier stopped")
+
+// sigResult ecrecover 结果：恢复出的签名者地址，或恢复失败的错误（结果只取决于哈希与签名，可缓存）
+type sigResult struct {
+	signer common.Address
+	err    error
+}
+
+type verifyJob struct {
+	key  common.Hash // keccak256(签名哈希 || 签名)
+	hash common.Hash
+	sig  []byte
+	done chan sigResult
+}
+
+// SignatureVerifier 订单入口的签名验证阶段：API、gossip 与转发订单在进入撮合引擎前经此验证
+//   - worker 池：ecrecover 在固定数量的 worker 中执行，突发流量排队而不是占满所有 CPU
+//   - 批内去重：worker 一次取出队列中已有的任务（最多 sigBatchSize 个），批内相同签名只恢复一次，结果一次写入缓存。
+//     secp256k1 ECDSA 没有批量公钥恢复（go-ethereum 的 ecrecover 每个签名独立做一次标量乘），
+//     各签名仍逐个恢复；取批只用于合并重复签名（gossip 回环、多 peer 重复转发）并减少缓存加锁与指标上报次数
+//   - LRU 缓存：以 keccak256(EIP-712 签名哈希 || 签名) 为键缓存恢复出的签名者，而不是按 orderID；
+//     订单内容或签名任一改动都会换键，同一订单在 API、gossip 回环与入簿前只做一次 ecrecover
+type SignatureVerifier struct {
+	ctx   context.Context
+	jobs  chan *verifyJob
+	cache *sigCache
+}
+
+// NewSignatureVerifier 启动 workers 个验证 worker（<= 0 时为 CPU 数），ctx 结束时停止；cacheSize <= 0 时使用 DefaultSignatureCacheSize
+func NewSignatureVerifier(ctx context.Context, workers, cacheSize int) *SignatureVerifier {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if cacheSize <= 0 {
+		cacheSize = DefaultSignatureCacheSize
+	}
+	v := &SignatureVerifier{
+		ctx:   ctx,
+		jobs:  make(chan *verifyJob, workers*sigBatchSize),
+		cache: newSigCache(cacheSize),
+	}
+	for i := 0; i < workers; i++ {
+		go v.run()
+	}
+	return v
+}
+
+// Verify 验证订单签名（EIP-712，与 VerifyOrderSignature 相同，通过时填充 order.SignHash）；缓存未命中时交由 worker 池验证并等待结果
+// v 为 nil 时直接同步验证
+func (v *SignatureVerifier) Verify(order *storage.Order, pairTokens *PairTokens) (bool, error) {
+	if v == nil {
+		return VerifyOrderSignature(order, pairTokens)
+	}
+	if v.ctx.Err() != nil {
+		return false, ErrVerifierStopped
+	}
+	order.SignHash = ""
+	if order.Signature == "" {
+		return false, fmt.Errorf("missing signature")
+	}
+	hash, err := OrderSigningHash(order, pairTokens)
+	if err != nil {
+		return false, err
+	}
+	sig, err := parseSignature(order.Signature)
+	if err != nil {
+		return false, err
+	}
+	start := time.Now()
+	key := crypto.Keccak256Hash(hash.Bytes(), sig)
+	res, ok := v.cache.get(key)
+	if ok {
+		metrics.RecordSignatureCacheHit()
+	} else {
+		metrics.RecordSignatureCacheMiss()
+		job := &verifyJob{key: key, hash: hash, sig: sig, done: make(chan sigResult, 1)}
+		select {
+		case v.jobs <- job:
+		case <-v.ctx.Done():
+			return false, ErrVerifierStopped
+		}
+		select {
+		case res = <-job.done:
+		case <-v.ctx.Done():
+			return false, ErrVerifierStopped
+		}
+	}
+	metrics.RecordSignatureVerify(time.Since(start))
+	if res.err != nil {
+		return false, res.err
+	}
+	if res.signer != common.HexToAddress(order.Trader) {
+		return false, nil
+	}
+	order.SignHash = hash.Hex()
+	return true, nil
+}
+
+// run 验证 worker：阻塞取一个任务，再非阻塞取出队列中已有的任务，凑成一批处理
+func (v *SignatureVerifier) run() {
+	batch := make([]*verifyJob, 0, sigBatchSize)
+	for {
+		select {
+		case <-v.ctx.Done():
+			return
+		case job := <-v.jobs:
+			batch = append(batch[:0], job)
+		}
+	fill:
+		for len(batch) < sigBatchSize {
+			select {
+			case job := <-v.jobs:
+				batch = append(batch, job)
+			default:
+				break fill
+			}
+		}
+		v.process(batch)
+	}
+}
+
+// process 处理一批任务：批内相同键只恢复一次（排队期间已被其他批次缓存的直接复用），其余逐个 ecrecover（无批量恢复，见 SignatureVerifier），
+// 结果先写入缓存再返回给调用方
+func (v *SignatureVerifier) process(batch []*verifyJob) {
+	start := time.Now()
+	results := make(map[common.Hash]sigResult, len(batch))
+	for _, job := range batch {
+		if _, ok := results[job.key]; ok {
+			continue
+		}
+		res, ok := v.cache.get(job.key)
+		if !ok {
+			res.signer, res.err = recoverSigner(job.hash, job.sig)
+		}
+		results[job.key] = res
+	}
+	v.cache.addAll(results)
+	for _, job := range batch {
+		job.done <- results[job.key]
+	}
+	metrics.RecordSignatureBatch(len(batch), time.Since(start))
+}
+
+// sigCache 签名验证结果 LRU 缓存
+type sigCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List // 队首为最近使用
+	items map[common.Hash]*list.Element
+}
+
+type sigCacheEntry struct {
+	key common.Hash
+	res sigResult
+}
+
+func newSigCache(size int) *sigCache {
+	return &sigCache{size: size, ll: list.New(), items: make(map[common.Hash]*list.Element)}
+}
+
+func (c *sigCache) get(key common.Hash) (sigResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return sigResult{}, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*sigCacheEntry).res, true
+}
+
+// addAll 写入一批结果，超出容量时淘汰最久未使用的条目
+func (c *sigCache) addAll(results map[common.Hash]sigResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, res := range results {
+		if el, ok := c.items[key]; ok {
+			c.ll.MoveToFront(el)
+			continue
+		}
+		c.items[key] = c.ll.PushFront(&sigCacheEntry{key: key, res: res})
+	}
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*sigCacheEntry).key)
+	}
+}
+
+// len 返回缓存条目数
+func (c *sigCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,121 @@
+package match
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/P2P-P2P/p2p/node/internal/storage"
+)
+
+func signedTestOrder(t *testing.T, id string, pairTokens *PairTokens) *storage.Order {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &storage.Order{
+		OrderID:   id,
+		Trader:    crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Pair:      "TKA/TKB",
+		Side:      "buy",
+		Price:     "100",
+		Amount:    "10",
+		CreatedAt: 1700000000,
+	}
+	typedData, err := orderTypedData(o, pairTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := typedDataHash(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	o.Signature = "0x" + hex.EncodeToString(sig)
+	return o
+}
+
+func TestSignatureVerifierCachesBySignatureHash(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	v := NewSignatureVerifier(ctx, 2, 16)
+	pairTokens := &PairTokens{Token0: "0x1111111111111111111111111111111111111111", Token1: "0x2222222222222222222222222222222222222222"}
+	o := signedTestOrder(t, "o1", pairTokens)
+
+	// 并发验证同一订单（API 与 gossip 回环）：结果一致，只缓存一条
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := *o
+			if valid, err := v.Verify(&c, pairTokens); err != nil || !valid {
+				t.Errorf("valid=%v err=%v, want valid", valid, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := v.cache.len(); n != 1 {
+		t.Errorf("cache entries = %d, want 1", n)
+	}
+
+	// 同一 orderID、改动订单内容：换键重新验证，签名失效
+	tampered := *o
+	tampered.Price = "99"
+	if valid, _ := v.Verify(&tampered, pairTokens); valid {
+		t.Error("tampered price should invalidate signature")
+	}
+	// 同一签名冒充其他 trader：命中缓存但签名者不符
+	forged := *o
+	forged.Trader = "0x00000000000000000000000000000000000000b1"
+	if valid, _ := v.Verify(&forged, pairTokens); valid {
+		t.Error("signature must not validate for another trader")
+	}
+	if valid, err := v.Verify(&storage.Order{OrderID: "o2", Amount: "1", Price: "1"}, pairTokens); err == nil || valid {
+		t.Errorf("missing signature: valid=%v err=%v", valid, err)
+	}
+	// nil 验证器同步验证
+	var nilVerifier *SignatureVerifier
+	if valid, err := nilVerifier.Verify(o, pairTokens); err != nil || !valid {
+		t.Errorf("nil verifier: valid=%v err=%v", valid, err)
+	}
+}
+
+func TestSignatureVerifierStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := NewSignatureVerifier(ctx, 1, 0)
+	cancel()
+	pairTokens := &PairTokens{Token0: "0x1111111111111111111111111111111111111111", Token1: "0x2222222222222222222222222222222222222222"}
+	o := signedTestOrder(t, "o1", pairTokens)
+	if _, err := v.Verify(o, pairTokens); err != ErrVerifierStopped {
+		t.Errorf("err = %v, want ErrVerifierStopped", err)
+	}
+}
+
+func TestSigCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newSigCache(2)
+	k := func(i int) common.Hash { return crypto.Keccak256Hash([]byte(fmt.Sprint(i))) }
+	c.addAll(map[common.Hash]sigResult{k(1): {}})
+	c.addAll(map[common.Hash]sigResult{k(2): {}})
+	c.get(k(1)) // k(1) 最近使用
+	c.addAll(map[common.Hash]sigResult{k(3): {}})
+	if _, ok := c.get(k(2)); ok {
+		t.Error("least recently used entry should be evicted")
+	}
+	if _, ok := c.get(k(1)); !ok {
+		t.Error("recently used entry evicted")
+	}
+	if c.len() != 2 {
+		t.Errorf("len = %d, want 2", c.len())
+	}
+}
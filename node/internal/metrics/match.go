@@ -39,8 +39,115 @@ var (
 		Name: "p2p_match_signature_cache_misses_total",
 		Help: "Total number of signature cache misses",
 	})
+	// p2p_match_signature_verify_seconds 订单签名验证耗时（秒，含排队等待 worker；缓存命中时极短）
+	p2pMatchSignatureVerifySeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "p2p_match_signature_verify_seconds",
+		Help:    "Order signature verification latency in seconds, including time queued for a verifier worker",
+		Buckets: []float64{0.00001, 0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05, 0.25},
+	})
+	// p2p_match_signature_batch_size 每批 ecrecover 的任务数
+	p2pMatchSignatureBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "p2p_match_signature_batch_size",
+		Help:    "Number of signature verification jobs processed per batch",
+		Buckets: []float64{1, 2, 4, 8, 16, 32, 64},
+	})
+	// p2p_match_signature_batch_seconds 每批 ecrecover 耗时（秒）
+	p2pMatchSignatureBatchSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "p2p_match_signature_batch_seconds",
+		Help:    "Duration of one signature verification batch in seconds",
+		Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1},
+	})
+	// p2p_match_orders_expired_total 过期移除的订单数（按交易对）
+	p2pMatchOrdersExpiredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_match_orders_expired_total",
+		Help: "Total number of resting or pending trigger orders removed from the MatchEngine on expiry, by pair",
+	}, []string{"pair"})
+	// p2p_match_queue_depth 撮合输入队列中等待处理的订单数（按交易对）
+	p2pMatchQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "p2p_match_queue_depth",
+		Help: "Number of inputs waiting in the per-pair MatchEngine queue",
+	}, []string{"pair"})
+	// p2p_match_backpressure_total 撮合输入队列已满被拒绝的订单数（按交易对）
+	p2pMatchBackpressureTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_match_backpressure_total",
+		Help: "Total number of inputs rejected because the per-pair MatchEngine queue was full, by pair",
+	}, []string{"pair"})
+	// p2p_match_depth_resync_total 行情订阅因客户端发送队列积压而重新下发快照的次数（按交易对）
+	p2pMatchDepthResyncTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_match_depth_resync_total",
+		Help: "Total number of depth snapshots resent to WebSocket subscribers that fell behind, by pair",
+	}, []string{"pair"})
+	// p2p_match_l3_resync_total L3 逐笔行情订阅因积压被断开、需重新取快照的次数（按交易对）
+	p2pMatchL3ResyncTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_match_l3_resync_total",
+		Help: "Total number of L3 order-by-order subscriptions dropped for falling behind and resynced from a snapshot, by pair",
+	}, []string{"pair"})
+	// p2p_match_restored_orders 启动时恢复的订单数（按来源：snapshot | journal | store | empty）
+	p2pMatchRestoredOrders = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "p2p_match_restored_orders",
+		Help: "Number of orders restored into the MatchEngine at startup, by source",
+	}, []string{"source"})
+	// p2p_match_restored_journal_events 启动时回放的日志事件数
+	p2pMatchRestoredJournalEvents = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "p2p_match_restored_journal_events",
+		Help: "Number of journal events replayed at startup",
+	})
+	// p2p_match_restore_seconds 启动恢复耗时（秒）
+	p2pMatchRestoreSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "p2p_match_restore_seconds",
+		Help: "Duration of MatchEngine restore at startup in seconds",
+	})
+	// p2p_match_journal_seq 引擎最后应用的日志序号（启动恢复与快照时更新）
+	p2pMatchJournalSeq = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "p2p_match_journal_seq",
+		Help: "Last journal sequence number applied by the MatchEngine",
+	})
+	// p2p_match_snapshot_seq 最近一次快照的日志序号
+	p2pMatchSnapshotSeq = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "p2p_match_snapshot_seq",
+		Help: "Journal sequence number covered by the latest engine snapshot",
+	})
 )
 
+// RecordEngineRestore 记录启动恢复结果
+func RecordEngineRestore(source string, orders, journalEvents int, seq uint64, d time.Duration) {
+	p2pMatchRestoredOrders.WithLabelValues(source).Set(float64(orders))
+	p2pMatchRestoredJournalEvents.Set(float64(journalEvents))
+	p2pMatchRestoreSeconds.Set(d.Seconds())
+	p2pMatchJournalSeq.Set(float64(seq))
+}
+
+// RecordSnapshot 记录快照写入
+func RecordSnapshot(seq uint64) {
+	p2pMatchSnapshotSeq.Set(float64(seq))
+	p2pMatchJournalSeq.Set(float64(seq))
+}
+
+// RecordOrderExpired 记录一笔过期移除的订单
+func RecordOrderExpired(pair string) {
+	p2pMatchOrdersExpiredTotal.WithLabelValues(pair).Inc()
+}
+
+// RecordQueueDepth 记录交易对撮合输入队列长度
+func RecordQueueDepth(pair string, n int) {
+	p2pMatchQueueDepth.WithLabelValues(pair).Set(float64(n))
+}
+
+// RecordBackpressure 记录一次队列已满的拒绝
+func RecordBackpressure(pair string) {
+	p2pMatchBackpressureTotal.WithLabelValues(pair).Inc()
+}
+
+// RecordDepthResync 记录一次行情订阅重新下发快照
+func RecordDepthResync(pair string) {
+	p2pMatchDepthResyncTotal.WithLabelValues(pair).Inc()
+}
+
+// RecordL3Resync 记录一次 L3 订阅因积压被断开
+func RecordL3Resync(pair string) {
+	p2pMatchL3ResyncTotal.WithLabelValues(pair).Inc()
+}
+
 // RecordMatch 记录撮合结果，用于 Prometheus 指标（TPS 可从 trades_total 推导，延迟用 histogram）
 func RecordMatch(tradesCount int, latency time.Duration) {
 	if tradesCount > 0 {
@@ -69,3 +176,14 @@ func RecordSignatureCacheHit() {
 func RecordSignatureCacheMiss() {
 	p2pMatchSignatureCacheMisses.Inc()
 }
+
+// RecordSignatureVerify 记录一次订单签名验证耗时
+func RecordSignatureVerify(d time.Duration) {
+	p2pMatchSignatureVerifySeconds.Observe(d.Seconds())
+}
+
+// RecordSignatureBatch 记录一批签名验证的任务数与耗时
+func RecordSignatureBatch(n int, d time.Duration) {
+	p2pMatchSignatureBatchSize.Observe(float64(n))
+	p2pMatchSignatureBatchSeconds.Observe(d.Seconds())
+}
@@ -0,0 +1,389 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// candleFlushInterval 内存中已变化的 K 线写入数据库的间隔
+	candleFlushInterval = 5 * time.Second
+	// candleSeenTrades 去重窗口：记录最近的成交 ID 数（本节点撮合的成交经 gossip 回传、多个节点重复广播）
+	candleSeenTrades = 65536
+)
+
+// CandleAggregator K 线聚合：由已执行的成交（本节点撮合与 gossip 收到的成交）实时更新 1m～1w 各周期 K 线，
+// 定期写入 candles 表并按周期保留期清理；启动时先调用 Backfill 从成交表补齐并加载各周期最新一根。
+// 成交只在内存中聚合，数据库只在 Flush 时读写：内存中没有的 K 线（迟到的成交）先只聚合新成交，查询与写入时再与已写入的部分合并
+type CandleAggregator struct {
+	db        *DB
+	retention map[string]time.Duration // 周期 -> 保留时长，0 为永久保留
+	sink      func(*Candle)            // K 线变化推送（WS kline 频道），在锁外调用
+
+	mu      sync.Mutex
+	candles map[candleKey]*Candle // 各交易对各周期最新一根与尚未写入的 K 线
+	latest  map[candleSeries]int64
+	dirty   map[candleKey]struct{}
+	partial map[candleKey]struct{} // 未从数据库加载、只含新成交的 K 线，Flush 时与已写入的 K 线合并
+	seen    map[string]struct{}
+	ring    []string // 去重窗口内的成交 ID（环形）
+	next    int
+}
+
+type candleSeries struct {
+	pair, interval string
+}
+
+type candleKey struct {
+	candleSeries
+	openTime int64
+}
+
+// NewCandleAggregator 创建 K 线聚合；retention 见 CandleRetention
+func NewCandleAggregator(db *DB, retention map[string]time.Duration) *CandleAggregator {
+	return &CandleAggregator{
+		db:        db,
+		retention: retention,
+		candles:   make(map[candleKey]*Candle),
+		latest:    make(map[candleSeries]int64),
+		dirty:     make(map[candleKey]struct{}),
+		partial:   make(map[candleKey]struct{}),
+		seen:      make(map[string]struct{}),
+		ring:      make([]string, candleSeenTrades),
+	}
+}
+
+// SetSink 设置 K 线变化推送（须在 Add 之前调用）：每笔成交更新的各周期 K 线按周期由短到长依次回调，fn 须立即返回；
+// 迟到成交的 K 线在 Flush 与已写入部分合并后再推送一次
+func (a *CandleAggregator) SetSink(fn func(*Candle)) {
+	a.sink = fn
+}
+
+// Add 计入已执行的成交；重复的成交 ID 与价格/数量无效的成交被忽略
+func (a *CandleAggregator) Add(trades ...*Trade) {
+	var updated []*Candle
+	a.mu.Lock()
+	for _, t := range trades {
+		if t == nil || t.Pair == "" || !a.markSeenLocked(t.TradeID) {
+			continue
+		}
+		for _, iv := range CandleIntervals {
+			if c := a.addLocked(iv, t); c != nil {
+				updated = append(updated, c)
+			}
+		}
+	}
+	a.mu.Unlock()
+	if a.sink != nil {
+		for _, c := range updated {
+			a.sink(c)
+		}
+	}
+}
+
+// addLocked 将成交计入周期 K 线，返回更新后的副本；内存中没有该根 K 线时以该成交新建并标记为待合并（不在锁内读数据库）
+func (a *CandleAggregator) addLocked(interval string, t *Trade) *Candle {
+	key := candleKey{candleSeries{t.Pair, interval}, CandleOpenTime(interval, t.Timestamp)}
+	c, ok := a.candles[key]
+	if ok {
+		c.Add(t)
+	} else {
+		if c = NewCandle(interval, t); c == nil {
+			return nil
+		}
+		a.candles[key] = c
+		a.partial[key] = struct{}{}
+	}
+	a.dirty[key] = struct{}{}
+	if last, ok := a.latest[key.candleSeries]; !ok || key.openTime > last {
+		a.latest[key.candleSeries] = key.openTime
+	}
+	cp := *c
+	return &cp
+}
+
+// markSeenLocked 记录成交 ID，已出现过返回 false；无 ID 的成交不去重
+func (a *CandleAggregator) markSeenLocked(id string) bool {
+	if id == "" {
+		return true
+	}
+	if _, ok := a.seen[id]; ok {
+		return false
+	}
+	if old := a.ring[a.next]; old != "" {
+		delete(a.seen, old)
+	}
+	a.ring[a.next] = id
+	a.next = (a.next + 1) % len(a.ring)
+	a.seen[id] = struct{}{}
+	return true
+}
+
+// Candles 返回 [from, to] 内按起始时间升序的 K 线（含尚未写入数据库的变化），limit > 0 时只取最近的 limit 根
+func (a *CandleAggregator) Candles(pair, interval string, from, to int64, limit int) ([]*Candle, error) {
+	stored, err := a.db.ListCandles(pair, interval, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	byTime := make(map[int64]*Candle, len(stored))
+	for _, c := range stored {
+		byTime[c.OpenTime] = c
+	}
+	a.mu.Lock()
+	for key, c := range a.candles {
+		if key.pair == pair && key.interval == interval && key.openTime >= from && key.openTime <= to {
+			cp := *c
+			if _, partial := a.partial[key]; partial && byTime[key.openTime] != nil {
+				// 迟到成交：与已写入的部分合并
+				cp = *byTime[key.openTime]
+				cp.Merge(c)
+			}
+			byTime[key.openTime] = &cp
+		}
+	}
+	a.mu.Unlock()
+	out := make([]*Candle, 0, len(byTime))
+	for _, c := range byTime {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].OpenTime < out[j].OpenTime })
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out, nil
+}
+
+// Flush 将已变化的 K 线写入数据库（待合并的 K 线先与已写入的部分合并），并释放已写入且不是各周期最新一根的 K 线
+func (a *CandleAggregator) Flush() error {
+	a.mu.Lock()
+	batch := make([]*Candle, 0, len(a.dirty))
+	keys := make([]candleKey, 0, len(a.dirty))
+	var partial []int // batch 中待合并 K 线的下标
+	for key := range a.dirty {
+		cp := *a.candles[key]
+		if _, ok := a.partial[key]; ok {
+			partial = append(partial, len(batch))
+		}
+		batch = append(batch, &cp)
+		keys = append(keys, key)
+	}
+	clear(a.dirty)
+	a.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	// 数据库读写均在锁外
+	stored := make(map[candleKey]*Candle, len(partial))
+	var err error
+	for _, i := range partial {
+		key := keys[i]
+		var c *Candle
+		if c, err = a.db.GetCandle(key.pair, key.interval, key.openTime); err != nil {
+			break
+		}
+		stored[key] = c
+		if c != nil {
+			merged := *c
+			merged.Merge(batch[i])
+			batch[i] = &merged
+		}
+	}
+	if err == nil {
+		err = a.db.UpsertCandles(batch)
+	}
+	a.mu.Lock()
+	if err != nil {
+		// 写入失败：下次重试
+		for _, key := range keys {
+			a.dirty[key] = struct{}{}
+		}
+		a.mu.Unlock()
+		return err
+	}
+	var merged []*Candle
+	for key, c := range stored {
+		// 内存中的 K 线 = 本次写入的快照 + 之后的新成交，与已写入部分合并后即为完整 K 线
+		delete(a.partial, key)
+		if c != nil {
+			c.Merge(a.candles[key])
+			a.candles[key] = c
+			cp := *c
+			merged = append(merged, &cp)
+		}
+	}
+	for key := range a.candles {
+		if _, dirty := a.dirty[key]; !dirty && key.openTime != a.latest[key.candleSeries] {
+			delete(a.candles, key)
+			delete(a.partial, key)
+		}
+	}
+	a.mu.Unlock()
+	if a.sink != nil {
+		for _, c := range merged {
+			a.sink(c)
+		}
+	}
+	return nil
+}
+
+// Backfill 从成交表补齐 K 线（启动时、Add 之前调用）：各交易对各周期从已写入的最后一根 K 线（可能未收盘）起按成交重新聚合并覆盖，
+// 无 K 线时从最早的成交起；该根 K 线的部分成交已被成交保留期清理时保留已写入的结果，从下一根起聚合。
+// 完成后将各周期最新一根载入内存，之后的成交直接在内存中累加。返回写入的 K 线数
+func (a *CandleAggregator) Backfill() (int, error) {
+	starts, err := a.db.TradeStartTimes()
+	if err != nil {
+		return 0, err
+	}
+	latest, err := a.db.LatestCandleTimes()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, pair := range sortedPairs(starts) {
+		first := starts[pair]
+		from := make(map[string]int64, len(CandleIntervals))
+		scan := first
+		for i, iv := range CandleIntervals {
+			start := CandleOpenTime(iv, first)
+			if last, ok := latest[pair][iv]; ok && last >= start {
+				start = last
+				c, err := a.db.GetCandle(pair, iv, last)
+				if err != nil {
+					return total, err
+				}
+				if c != nil && c.FirstTradeAt < first {
+					d, _ := CandleDuration(iv)
+					start = last + d
+				}
+			}
+			from[iv] = start
+			if i == 0 || start < scan {
+				scan = start
+			}
+		}
+		built := make(map[candleKey]*Candle)
+		err := a.db.ForEachTrade(pair, scan, func(t *Trade) error {
+			a.mu.Lock()
+			fresh := a.markSeenLocked(t.TradeID)
+			a.mu.Unlock()
+			if !fresh {
+				return nil
+			}
+			for _, iv := range CandleIntervals {
+				if t.Timestamp < from[iv] {
+					continue
+				}
+				key := candleKey{candleSeries{pair, iv}, CandleOpenTime(iv, t.Timestamp)}
+				if c, ok := built[key]; ok {
+					c.Add(t)
+				} else if c := NewCandle(iv, t); c != nil {
+					built[key] = c
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		batch := make([]*Candle, 0, len(built))
+		for _, c := range built {
+			batch = append(batch, c)
+		}
+		if err := a.db.UpsertCandles(batch); err != nil {
+			return total, err
+		}
+		total += len(batch)
+	}
+	return total, a.loadLatest()
+}
+
+// loadLatest 将各交易对各周期已写入的最新一根 K 线载入内存（内存中已有的不覆盖）
+func (a *CandleAggregator) loadLatest() error {
+	latest, err := a.db.LatestCandleTimes()
+	if err != nil {
+		return err
+	}
+	for pair, ivs := range latest {
+		for iv, openTime := range ivs {
+			c, err := a.db.GetCandle(pair, iv, openTime)
+			if err != nil {
+				return err
+			}
+			if c == nil {
+				continue
+			}
+			key := candleKey{candleSeries{pair, iv}, openTime}
+			a.mu.Lock()
+			if _, ok := a.candles[key]; !ok {
+				a.candles[key] = c
+				if last, ok := a.latest[key.candleSeries]; !ok || openTime > last {
+					a.latest[key.candleSeries] = openTime
+				}
+			}
+			a.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// Prune 按各周期保留期删除过期 K 线，返回删除数
+func (a *CandleAggregator) Prune(now time.Time) (int64, error) {
+	var total int64
+	for _, iv := range CandleIntervals {
+		keep := a.retention[iv]
+		if keep <= 0 {
+			continue
+		}
+		n, err := a.db.DeleteCandlesBefore(iv, now.Add(-keep).Unix())
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Run 定期写入 K 线并每日按保留期清理，直至 ctx 结束（结束前写入剩余变化）
+func (a *CandleAggregator) Run(ctx context.Context) {
+	flush := time.NewTicker(candleFlushInterval)
+	defer flush.Stop()
+	prune := time.NewTicker(24 * time.Hour)
+	defer prune.Stop()
+	a.prune()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := a.Flush(); err != nil {
+				log.Printf("[candles] 写入失败: %v", err)
+			}
+			return
+		case <-flush.C:
+			if err := a.Flush(); err != nil {
+				log.Printf("[candles] 写入失败: %v", err)
+			}
+		case <-prune.C:
+			a.prune()
+		}
+	}
+}
+
+func (a *CandleAggregator) prune() {
+	n, err := a.Prune(time.Now())
+	if err != nil {
+		log.Printf("[candles] 清理超期 K 线失败: %v", err)
+	} else if n > 0 {
+		log.Printf("[candles] 已清理 %d 根超期 K 线", n)
+	}
+}
+
+func sortedPairs(m map[string]int64) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
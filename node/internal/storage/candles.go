@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// CandleIntervals 支持的 K 线周期（由短到长）
+var CandleIntervals = []string{"1m", "3m", "5m", "15m", "30m", "1h", "2h", "4h", "6h", "12h", "1d", "1w"}
+
+var candleDurations = map[string]int64{
+	"1m": 60, "3m": 180, "5m": 300, "15m": 900, "30m": 1800,
+	"1h": 3600, "2h": 7200, "4h": 14400, "6h": 21600, "12h": 43200,
+	"1d": 86400, "1w": 604800,
+}
+
+// DefaultCandleRetentionDays 各周期 K 线默认保留天数（0 为永久保留），可由配置 storage.candle_retention_days 覆盖
+var DefaultCandleRetentionDays = map[string]int{
+	"1m": 30, "3m": 30, "5m": 90, "15m": 180, "30m": 180,
+	"1h": 365, "2h": 365, "4h": 730, "6h": 730, "12h": 730,
+	"1d": 0, "1w": 0,
+}
+
+// candleWeekOffset 周 K 线以 UTC 周一 00:00 为起点（1970-01-01 为周四，1970-01-05 为周一）
+const candleWeekOffset = 4 * 86400
+
+// Candle OHLCV K 线：价格为 quote 最小单位 / 1 个 base 代币，Volume 为 base 最小单位；无成交的周期不生成 K 线
+type Candle struct {
+	Pair     string `json:"pair"`
+	Interval string `json:"interval"`
+	OpenTime int64  `json:"openTime"` // 周期起始（unix 秒，UTC 对齐）
+	Open     string `json:"open"`
+	High     string `json:"high"`
+	Low      string `json:"low"`
+	Close    string `json:"close"`
+	Volume   string `json:"volume"`
+	Trades   int    `json:"trades"`
+	// 首笔、最后一笔成交时间（unix 秒）：乱序到达的成交据此更新开盘价与收盘价
+	FirstTradeAt int64 `json:"-"`
+	LastTradeAt  int64 `json:"-"`
+}
+
+// CandleDuration 返回周期秒数；不支持的周期返回 false
+func CandleDuration(interval string) (int64, bool) {
+	d, ok := candleDurations[interval]
+	return d, ok
+}
+
+// CandleOpenTime 返回 ts 所在周期的起始时间
+func CandleOpenTime(interval string, ts int64) int64 {
+	d := candleDurations[interval]
+	if d == 0 {
+		return ts
+	}
+	off := int64(0)
+	if interval == "1w" {
+		off = candleWeekOffset
+	}
+	t := ts - off
+	start := t - t%d
+	if t < 0 && t%d != 0 {
+		start -= d
+	}
+	return start + off
+}
+
+// NewCandle 以一笔成交开启周期 K 线；成交价格或数量无效返回 nil
+func NewCandle(interval string, t *Trade) *Candle {
+	price, ok1 := ParseUnits(t.Price)
+	amount, ok2 := ParseUnits(t.Amount)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	p := FormatUnits(price)
+	return &Candle{
+		Pair:         t.Pair,
+		Interval:     interval,
+		OpenTime:     CandleOpenTime(interval, t.Timestamp),
+		Open:         p,
+		High:         p,
+		Low:          p,
+		Close:        p,
+		Volume:       FormatUnits(amount),
+		Trades:       1,
+		FirstTradeAt: t.Timestamp,
+		LastTradeAt:  t.Timestamp,
+	}
+}
+
+// Add 将同一周期内的一笔成交计入 K 线（同一秒内的成交按到达顺序更新收盘价）；成交价格或数量无效时忽略
+func (c *Candle) Add(t *Trade) {
+	price, ok1 := ParseUnits(t.Price)
+	amount, ok2 := ParseUnits(t.Amount)
+	if !ok1 || !ok2 {
+		return
+	}
+	p := FormatUnits(price)
+	if price.Cmp(MustUnits(c.High)) > 0 {
+		c.High = p
+	}
+	if price.Cmp(MustUnits(c.Low)) < 0 {
+		c.Low = p
+	}
+	if t.Timestamp < c.FirstTradeAt {
+		c.Open, c.FirstTradeAt = p, t.Timestamp
+	}
+	if t.Timestamp >= c.LastTradeAt {
+		c.Close, c.LastTradeAt = p, t.Timestamp
+	}
+	c.Volume = FormatUnits(new(big.Int).Add(MustUnits(c.Volume), amount))
+	c.Trades++
+}
+
+// Merge 将同一周期另一部分成交聚合的 K 线 o 合并到 c（o 中同一秒的收盘价视为后到达）
+func (c *Candle) Merge(o *Candle) {
+	if MustUnits(o.High).Cmp(MustUnits(c.High)) > 0 {
+		c.High = o.High
+	}
+	if MustUnits(o.Low).Cmp(MustUnits(c.Low)) < 0 {
+		c.Low = o.Low
+	}
+	if o.FirstTradeAt < c.FirstTradeAt {
+		c.Open, c.FirstTradeAt = o.Open, o.FirstTradeAt
+	}
+	if o.LastTradeAt >= c.LastTradeAt {
+		c.Close, c.LastTradeAt = o.Close, o.LastTradeAt
+	}
+	c.Volume = FormatUnits(new(big.Int).Add(MustUnits(c.Volume), MustUnits(o.Volume)))
+	c.Trades += o.Trades
+}
+
+// UpsertCandles 写入 K 线（同交易对、周期、起始时间覆盖）
+func (db *DB) UpsertCandles(candles []*Candle) error {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO candles (pair, interval, open_time, open, high, low, close, volume, trades, first_trade_at, last_trade_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range candles {
+		if _, err := stmt.Exec(c.Pair, c.Interval, c.OpenTime, c.Open, c.High, c.Low, c.Close, c.Volume, c.Trades, c.FirstTradeAt, c.LastTradeAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const candleColumns = `pair, interval, open_time, open, high, low, close, volume, trades, first_trade_at, last_trade_at`
+
+// ListCandles 按起始时间升序查询 [from, to] 内的 K 线；limit > 0 时只取最近的 limit 根
+func (db *DB) ListCandles(pair, interval string, from, to int64, limit int) ([]*Candle, error) {
+	query := `SELECT ` + candleColumns + ` FROM candles WHERE pair = ? AND interval = ? AND open_time >= ? AND open_time <= ? ORDER BY open_time DESC`
+	args := []interface{}{pair, interval, from, to}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Candle
+	for rows.Next() {
+		var c Candle
+		if err := rows.Scan(&c.Pair, &c.Interval, &c.OpenTime, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume, &c.Trades, &c.FirstTradeAt, &c.LastTradeAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// GetCandle 查询单根 K 线，不存在返回 nil
+func (db *DB) GetCandle(pair, interval string, openTime int64) (*Candle, error) {
+	list, err := db.ListCandles(pair, interval, openTime, openTime, 1)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+// LatestCandleTimes 返回各交易对各周期最后一根 K 线的起始时间：pair -> interval -> openTime
+func (db *DB) LatestCandleTimes() (map[string]map[string]int64, error) {
+	rows, err := db.sql.Query(`SELECT pair, interval, MAX(open_time) FROM candles GROUP BY pair, interval`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]map[string]int64)
+	for rows.Next() {
+		var pair, interval string
+		var openTime int64
+		if err := rows.Scan(&pair, &interval, &openTime); err != nil {
+			return nil, err
+		}
+		if out[pair] == nil {
+			out[pair] = make(map[string]int64)
+		}
+		out[pair][interval] = openTime
+	}
+	return out, rows.Err()
+}
+
+// DeleteCandlesBefore 删除某周期起始时间早于 before 的 K 线，用于 K 线保留期清理
+func (db *DB) DeleteCandlesBefore(interval string, before int64) (int64, error) {
+	res, err := db.sql.Exec(`DELETE FROM candles WHERE interval = ? AND open_time < ?`, interval, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// TradeStartTimes 返回成交表中各交易对最早一笔成交的时间（K 线回填的起点）
+func (db *DB) TradeStartTimes() (map[string]int64, error) {
+	rows, err := db.sql.Query(`SELECT pair, MIN(timestamp) FROM trades GROUP BY pair`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]int64)
+	for rows.Next() {
+		var pair string
+		var ts int64
+		if err := rows.Scan(&pair, &ts); err != nil {
+			return nil, err
+		}
+		out[pair] = ts
+	}
+	return out, rows.Err()
+}
+
+// ForEachTrade 按成交时间升序遍历交易对 since（含）之后的成交（只含 tradeId、价格、数量与时间），fn 返回错误时停止
+func (db *DB) ForEachTrade(pair string, since int64, fn func(*Trade) error) error {
+	rows, err := db.sql.Query(
+		`SELECT trade_id, price, amount, timestamp FROM trades WHERE pair = ? AND timestamp >= ? ORDER BY timestamp ASC, rowid ASC`,
+		pair, since,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := Trade{Pair: pair}
+		if err := rows.Scan(&t.TradeID, &t.Price, &t.Amount, &t.Timestamp); err != nil {
+			return err
+		}
+		if err := fn(&t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CandleRetention 合并配置与默认值，返回各周期保留时长（0 为永久保留）；配置值 > 0 为天数，< 0 为永久保留
+func CandleRetention(overrides map[string]int) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration, len(CandleIntervals))
+	for _, iv := range CandleIntervals {
+		out[iv] = time.Duration(DefaultCandleRetentionDays[iv]) * 24 * time.Hour
+	}
+	for iv, days := range overrides {
+		if _, ok := candleDurations[iv]; !ok {
+			return nil, fmt.Errorf("candle_retention_days: unknown interval %q", iv)
+		}
+		switch {
+		case days > 0:
+			out[iv] = time.Duration(days) * 24 * time.Hour
+		case days < 0:
+			out[iv] = 0
+		}
+	}
+	return out, nil
+}
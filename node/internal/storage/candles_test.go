@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// 2024-01-01 00:00:00 UTC，周一
+const candleTestMonday = 1704067200
+
+func TestCandleOpenTime(t *testing.T) {
+	ts := int64(candleTestMonday + 3*86400 + 5*3600 + 17*60 + 42) // 周四 05:17:42
+	cases := map[string]int64{
+		"1m":  candleTestMonday + 3*86400 + 5*3600 + 17*60,
+		"15m": candleTestMonday + 3*86400 + 5*3600 + 15*60,
+		"4h":  candleTestMonday + 3*86400 + 4*3600,
+		"1d":  candleTestMonday + 3*86400,
+		"1w":  candleTestMonday,
+	}
+	for iv, want := range cases {
+		if got := CandleOpenTime(iv, ts); got != want {
+			t.Errorf("%s: open time = %d, want %d", iv, got, want)
+		}
+	}
+	if got := CandleOpenTime("1w", candleTestMonday-1); got != candleTestMonday-7*86400 {
+		t.Errorf("1w before monday = %d", got)
+	}
+	if _, ok := CandleDuration("2m"); ok {
+		t.Error("2m should be unsupported")
+	}
+}
+
+func TestCandleAggregatorOHLCV(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	a := NewCandleAggregator(db, nil)
+	var pushed []*Candle
+	a.SetSink(func(c *Candle) { pushed = append(pushed, c) })
+
+	base := int64(candleTestMonday + 60)
+	a.Add(
+		&Trade{TradeID: "t1", Pair: "TKA/TKB", Price: "100", Amount: "2", Timestamp: base + 10},
+		&Trade{TradeID: "t2", Pair: "TKA/TKB", Price: "120", Amount: "1", Timestamp: base + 20},
+		&Trade{TradeID: "t3", Pair: "TKA/TKB", Price: "90", Amount: "3", Timestamp: base + 5},   // 乱序到达：更新开盘价
+		&Trade{TradeID: "t2", Pair: "TKA/TKB", Price: "120", Amount: "1", Timestamp: base + 20}, // 重复成交
+		&Trade{TradeID: "t4", Pair: "TKA/TKB", Price: "110", Amount: "1", Timestamp: base + 70},
+	)
+	if len(pushed) != 4*len(CandleIntervals) {
+		t.Fatalf("pushed %d updates, want %d", len(pushed), 4*len(CandleIntervals))
+	}
+
+	list, err := a.Candles("TKA/TKB", "1m", 0, base+3600, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("1m candles = %d, want 2", len(list))
+	}
+	c := list[0]
+	if c.OpenTime != base || c.Open != "90" || c.High != "120" || c.Low != "90" || c.Close != "120" || c.Volume != "6" || c.Trades != 3 {
+		t.Errorf("1m candle = %+v", c)
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.ListCandles("TKA/TKB", "1h", 0, base+3600, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Open != "90" || stored[0].Close != "110" || stored[0].Volume != "7" || stored[0].Trades != 4 {
+		t.Fatalf("stored 1h = %+v", stored)
+	}
+
+	// 刷写后迟到的成交只在内存中累加（不读数据库），查询与刷写时与已写入的 K 线合并
+	n := len(pushed)
+	a.Add(&Trade{TradeID: "t5", Pair: "TKA/TKB", Price: "80", Amount: "1", Timestamp: base + 30})
+	list, err = a.Candles("TKA/TKB", "1m", 0, base+3600, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].OpenTime != base+60 {
+		t.Fatalf("limit 1 = %+v", list)
+	}
+	list, _ = a.Candles("TKA/TKB", "1m", base, base, 0)
+	if len(list) != 1 || list[0].Low != "80" || list[0].Trades != 4 || list[0].Close != "80" {
+		t.Errorf("late trade candle = %+v", list)
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := db.GetCandle("TKA/TKB", "1m", base); c == nil || c.Open != "90" || c.High != "120" || c.Low != "80" || c.Close != "80" || c.Volume != "7" || c.Trades != 4 {
+		t.Errorf("stored late trade candle = %+v", c)
+	}
+	// 合并后的完整 K 线再推送一次（1m 迟到；1h 及以上为内存中的最新一根，不需合并）
+	if got := pushed[len(pushed)-1]; len(pushed) != n+len(CandleIntervals)+1 || got.Interval != "1m" || got.Trades != 4 {
+		t.Errorf("pushed after merge = %d, last %+v", len(pushed)-n, got)
+	}
+}
+
+func TestCandleBackfill(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	base := int64(candleTestMonday)
+	trades := []*Trade{
+		{TradeID: "t1", Pair: "TKA/TKB", TakerOrderID: "b", MakerOrderID: "s", Price: "10", Amount: "1", Timestamp: base + 1},
+		{TradeID: "t2", Pair: "TKA/TKB", TakerOrderID: "b", MakerOrderID: "s", Price: "12", Amount: "2", Timestamp: base + 61},
+		{TradeID: "t3", Pair: "TKC/TKD", TakerOrderID: "b", MakerOrderID: "s", Price: "5", Amount: "4", Timestamp: base + 2*86400},
+	}
+	if err := db.InsertTrades(trades); err != nil {
+		t.Fatal(err)
+	}
+	a := NewCandleAggregator(db, nil)
+	if _, err := a.Backfill(); err != nil {
+		t.Fatal(err)
+	}
+	day, err := db.ListCandles("TKA/TKB", "1d", 0, base+86400, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(day) != 1 || day[0].Open != "10" || day[0].Close != "12" || day[0].Volume != "3" || day[0].Trades != 2 {
+		t.Fatalf("backfilled 1d = %+v", day)
+	}
+	// 各周期最新一根已载入内存，新成交直接累加
+	if c := a.candles[candleKey{candleSeries{"TKA/TKB", "1d"}, base}]; c == nil || c.Trades != 2 {
+		t.Errorf("latest 1d candle in memory = %+v", c)
+	}
+	// 已回填的成交经 gossip 再次到达时不重复计入
+	a.Add(trades[1])
+	if list, _ := a.Candles("TKA/TKB", "1d", base, base, 0); len(list) != 1 || list[0].Trades != 2 {
+		t.Errorf("after duplicate add = %+v", list)
+	}
+
+	// 重启后再次回填：从最后一根 K 线起重新聚合，结果不变；新成交被补齐
+	if err := db.InsertTrade(&Trade{TradeID: "t4", Pair: "TKA/TKB", TakerOrderID: "b", MakerOrderID: "s", Price: "11", Amount: "1", Timestamp: base + 62}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCandleAggregator(db, nil).Backfill(); err != nil {
+		t.Fatal(err)
+	}
+	day, _ = db.ListCandles("TKA/TKB", "1d", 0, base+86400, 0)
+	if len(day) != 1 || day[0].Close != "11" || day[0].Volume != "4" || day[0].Trades != 3 {
+		t.Errorf("re-backfilled 1d = %+v", day)
+	}
+	if mins, _ := db.ListCandles("TKA/TKB", "1m", 0, base+86400, 0); len(mins) != 2 {
+		t.Errorf("1m candles = %+v", mins)
+	}
+	if week, _ := db.ListCandles("TKC/TKD", "1w", 0, base+86400*7, 0); len(week) != 1 || week[0].OpenTime != base {
+		t.Errorf("TKC/TKD 1w = %+v", week)
+	}
+}
+
+func TestCandleRetentionPrune(t *testing.T) {
+	if _, err := CandleRetention(map[string]int{"2m": 1}); err == nil {
+		t.Error("unknown interval should fail")
+	}
+	retention, err := CandleRetention(map[string]int{"1m": 1, "1d": 2, "1h": -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retention["1m"] != 24*time.Hour || retention["1h"] != 0 || retention["5m"] != 90*24*time.Hour {
+		t.Fatalf("retention = %v", retention)
+	}
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	now := time.Unix(candleTestMonday+10*86400, 0)
+	old := now.Add(-3 * 24 * time.Hour).Unix()
+	var batch []*Candle
+	for _, iv := range []string{"1m", "1h", "1d", "1w"} {
+		batch = append(batch, NewCandle(iv, &Trade{Pair: "TKA/TKB", Price: "1", Amount: "1", Timestamp: old}))
+	}
+	if err := db.UpsertCandles(batch); err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewCandleAggregator(db, retention).Prune(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("pruned %d, want 2 (1m, 1d)", n)
+	}
+	latest, _ := db.LatestCandleTimes()
+	if _, ok := latest["TKA/TKB"]["1h"]; !ok || len(latest["TKA/TKB"]) != 2 {
+		t.Errorf("remaining = %v", latest)
+	}
+}
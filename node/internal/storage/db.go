@@ -25,8 +25,11 @@ CREATE TABLE IF NOT EXISTS trades (
 	price TEXT NOT NULL,
 	amount TEXT NOT NULL,
 	fee TEXT,
+	maker_fee TEXT,
+	fee_token TEXT,
 	timestamp INTEGER NOT NULL,
-	tx_hash TEXT
+	tx_hash TEXT,
+	matched_local INTEGER NOT NULL DEFAULT 0
 );
 CREATE INDEX IF NOT EXISTS idx_trades_timestamp ON trades(timestamp);
 CREATE INDEX IF NOT EXISTS idx_trades_pair ON trades(pair);
@@ -57,16 +60,72 @@ CREATE TABLE IF NOT EXISTS orders (
 	nonce INTEGER NOT NULL,
 	created_at INTEGER NOT NULL,
 	expires_at INTEGER NOT NULL,
-	signature TEXT
+	signature TEXT,
+	order_type TEXT NOT NULL DEFAULT 'limit',
+	quote_amount TEXT,
+	max_slippage_bps INTEGER NOT NULL DEFAULT 0,
+	time_in_force TEXT NOT NULL DEFAULT 'GTC',
+	post_only_reprice INTEGER NOT NULL DEFAULT 0,
+	trigger_type TEXT,
+	trigger_price TEXT,
+	triggered_at INTEGER NOT NULL DEFAULT 0,
+	display_amount TEXT,
+	self_trade_prevention TEXT,
+	amended_at INTEGER NOT NULL DEFAULT 0,
+	queued_at INTEGER NOT NULL DEFAULT 0,
+	sign_hash TEXT,
+	signed_price TEXT,
+	signed_amount TEXT,
+	amends TEXT
 );
 CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
 CREATE INDEX IF NOT EXISTS idx_orders_pair ON orders(pair);
+`
+
+	marketsSchema = `
+CREATE TABLE IF NOT EXISTS markets (
+	pair TEXT PRIMARY KEY,
+	status TEXT NOT NULL,
+	config TEXT NOT NULL,
+	state TEXT NOT NULL DEFAULT '',
+	state_until INTEGER NOT NULL DEFAULT 0,
+	state_reason TEXT NOT NULL DEFAULT '',
+	updated_at INTEGER NOT NULL
+);
+`
+
+	traderNoncesSchema = `
+CREATE TABLE IF NOT EXISTS trader_nonces (
+	trader TEXT PRIMARY KEY,
+	max_used INTEGER NOT NULL DEFAULT -1,
+	min_valid INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL
+);
+`
+
+	candlesSchema = `
+CREATE TABLE IF NOT EXISTS candles (
+	pair TEXT NOT NULL,
+	interval TEXT NOT NULL,
+	open_time INTEGER NOT NULL,
+	open TEXT NOT NULL,
+	high TEXT NOT NULL,
+	low TEXT NOT NULL,
+	close TEXT NOT NULL,
+	volume TEXT NOT NULL,
+	trades INTEGER NOT NULL,
+	first_trade_at INTEGER NOT NULL,
+	last_trade_at INTEGER NOT NULL,
+	PRIMARY KEY (pair, interval, open_time)
+);
+CREATE INDEX IF NOT EXISTS idx_candles_interval_open_time ON candles(interval, open_time);
 `
 )
 
 // DB 封装 SQLite 连接与表初始化
 type DB struct {
-	sql *sql.DB
+	sql          *sql.DB
+	onOrderEvent func(ev *OrderEvent) // 订单状态迁移回调（SetOrderEventHandler）
 }
 
 // Open 打开或创建数据库，dataDir 下使用 storage.db
@@ -107,6 +166,16 @@ func Open(dataDir string) (*DB, error) {
 			_, _ = sqlDB.Exec("ALTER TABLE trades ADD COLUMN " + col)
 		}
 	}
+	// 迁移：旧库无 fee_token 列时补手续费字段
+	if _, err := sqlDB.Exec("SELECT fee_token FROM trades LIMIT 0"); err != nil {
+		for _, col := range []string{"maker_fee TEXT", "fee_token TEXT"} {
+			_, _ = sqlDB.Exec("ALTER TABLE trades ADD COLUMN " + col)
+		}
+	}
+	// 迁移：旧库无 matched_local 列时补本地撮合标记（旧成交无法区分来源，按非本地处理）
+	if _, err := sqlDB.Exec("SELECT matched_local FROM trades LIMIT 0"); err != nil {
+		_, _ = sqlDB.Exec("ALTER TABLE trades ADD COLUMN matched_local INTEGER NOT NULL DEFAULT 0")
+	}
 	if _, err := sqlDB.Exec(orderbookSchema); err != nil {
 		sqlDB.Close()
 		return nil, fmt.Errorf("init orderbook_snapshots: %w", err)
@@ -115,6 +184,60 @@ func Open(dataDir string) (*DB, error) {
 		sqlDB.Close()
 		return nil, fmt.Errorf("init orders: %w", err)
 	}
+	// 迁移：旧库无 order_type 列时补市价单字段
+	if _, err := sqlDB.Exec("SELECT order_type FROM orders LIMIT 0"); err != nil {
+		for _, col := range []string{"order_type TEXT NOT NULL DEFAULT 'limit'", "quote_amount TEXT", "max_slippage_bps INTEGER NOT NULL DEFAULT 0"} {
+			_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN " + col)
+		}
+	}
+	// 迁移：旧库无 time_in_force 列时补有效期字段
+	if _, err := sqlDB.Exec("SELECT time_in_force FROM orders LIMIT 0"); err != nil {
+		for _, col := range []string{"time_in_force TEXT NOT NULL DEFAULT 'GTC'", "post_only_reprice INTEGER NOT NULL DEFAULT 0"} {
+			_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN " + col)
+		}
+	}
+	// 迁移：旧库无 trigger_type 列时补条件单字段
+	if _, err := sqlDB.Exec("SELECT trigger_type FROM orders LIMIT 0"); err != nil {
+		for _, col := range []string{"trigger_type TEXT", "trigger_price TEXT", "triggered_at INTEGER NOT NULL DEFAULT 0"} {
+			_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN " + col)
+		}
+	}
+	// 迁移：旧库无 display_amount 列时补冰山单字段
+	if _, err := sqlDB.Exec("SELECT display_amount FROM orders LIMIT 0"); err != nil {
+		_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN display_amount TEXT")
+	}
+	// 迁移：旧库无 self_trade_prevention 列时补自成交防护字段
+	if _, err := sqlDB.Exec("SELECT self_trade_prevention FROM orders LIMIT 0"); err != nil {
+		_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN self_trade_prevention TEXT")
+	}
+	// 迁移：旧库无 amended_at 列时补改单字段
+	if _, err := sqlDB.Exec("SELECT amended_at FROM orders LIMIT 0"); err != nil {
+		for _, col := range []string{"amended_at INTEGER NOT NULL DEFAULT 0", "queued_at INTEGER NOT NULL DEFAULT 0"} {
+			_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN " + col)
+		}
+	}
+	// 迁移：旧库无 sign_hash 列时补签名哈希（orderId 归属绑定）
+	if _, err := sqlDB.Exec("SELECT sign_hash FROM orders LIMIT 0"); err != nil {
+		_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN sign_hash TEXT")
+	}
+	// 迁移：旧库无 amends 列时补改单签名链
+	if _, err := sqlDB.Exec("SELECT amends FROM orders LIMIT 0"); err != nil {
+		for _, col := range []string{"signed_price TEXT", "signed_amount TEXT", "amends TEXT"} {
+			_, _ = sqlDB.Exec("ALTER TABLE orders ADD COLUMN " + col)
+		}
+	}
+	if _, err := sqlDB.Exec(marketsSchema); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("init markets: %w", err)
+	}
+	if _, err := sqlDB.Exec(traderNoncesSchema); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("init trader_nonces: %w", err)
+	}
+	if _, err := sqlDB.Exec(candlesSchema); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("init candles: %w", err)
+	}
 	return &DB{sql: sqlDB}, nil
 }
 
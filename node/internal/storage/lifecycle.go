@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// 订单状态：new → pending（条件单待触发）/ open → partial → filled | cancelled | expired | rejected
+// 状态只能沿 orderTransitions 前进，filled 只增不减；所有订单写入（InsertOrder / UpdateOrderStatus）均经此校验
+const (
+	OrderStatusNew       = "new" // 尚未处理（库中以空状态或不存在表示）
+	OrderStatusPending   = "pending"
+	OrderStatusOpen      = "open"
+	OrderStatusPartial   = "partial"
+	OrderStatusFilled    = "filled"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusExpired   = "expired"
+	OrderStatusRejected  = "rejected"
+)
+
+// orderTransitions 允许的状态迁移（同状态视为无迁移，始终允许，如 partial 继续成交）
+var orderTransitions = map[string][]string{
+	OrderStatusNew:     {OrderStatusPending, OrderStatusOpen, OrderStatusPartial, OrderStatusFilled, OrderStatusCancelled, OrderStatusExpired, OrderStatusRejected},
+	OrderStatusPending: {OrderStatusOpen, OrderStatusPartial, OrderStatusFilled, OrderStatusCancelled, OrderStatusExpired, OrderStatusRejected},
+	OrderStatusOpen:    {OrderStatusPartial, OrderStatusFilled, OrderStatusCancelled, OrderStatusExpired},
+	OrderStatusPartial: {OrderStatusFilled, OrderStatusCancelled, OrderStatusExpired},
+}
+
+// ErrInvalidOrderTransition 状态迁移不合法（如已成交订单再撤单）或 filled 回退
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+// ErrOrderEventMismatch 远端订单事件与本地订单不一致（交易对、trader 不同或 filled 超过订单数量）
+var ErrOrderEventMismatch = errors.New("order event does not match stored order")
+
+// IsTerminalOrderStatus 是否为终态（filled / cancelled / expired / rejected）
+func IsTerminalOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusFilled, OrderStatusCancelled, OrderStatusExpired, OrderStatusRejected:
+		return true
+	}
+	return false
+}
+
+// ValidateOrderTransition 校验 from → to 是否合法；空状态视为 new
+func ValidateOrderTransition(from, to string) error {
+	if from == "" {
+		from = OrderStatusNew
+	}
+	if to == "" {
+		to = OrderStatusNew
+	}
+	if from == to {
+		return nil
+	}
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidOrderTransition, from, to)
+}
+
+// OrderEvent 订单状态迁移事件（状态或 filled 变化时产生，事务提交后通知），供 WS 推送与 gossip 广播
+type OrderEvent struct {
+	OrderID   string `json:"orderId"`
+	Pair      string `json:"pair"`
+	Trader    string `json:"trader"`
+	Side      string `json:"side"`
+	From      string `json:"from"` // 迁移前状态，新订单为 new
+	To        string `json:"to"`
+	Amount    string `json:"amount"`
+	Filled    string `json:"filled"`
+	Timestamp int64  `json:"timestamp"`
+	Remote    bool   `json:"-"` // 由 gossip 收到的迁移（ApplyOrderEvent），不再转发
+	Source    string `json:"-"` // gossip 消息发布者 peer ID（经 pubsub 签名校验），由订阅方填入
+}
+
+// SetOrderEventHandler 设置订单事件回调（启动时设置一次；在写入订单的 goroutine 中同步调用）
+func (db *DB) SetOrderEventHandler(fn func(ev *OrderEvent)) {
+	db.onOrderEvent = fn
+}
+
+// Tx 订单与成交写入事务：订单状态迁移在提交后作为 OrderEvent 通知
+type Tx struct {
+	db     *DB
+	tx     *sql.Tx
+	events []*OrderEvent
+	remote bool
+}
+
+// Begin 开始事务
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{db: db, tx: tx}, nil
+}
+
+// Commit 提交事务并依次通知订单事件
+func (t *Tx) Commit() error {
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+	if fn := t.db.onOrderEvent; fn != nil {
+		for _, ev := range t.events {
+			fn(ev)
+		}
+	}
+	return nil
+}
+
+// Rollback 回滚事务（已提交时为空操作），丢弃未通知的事件
+func (t *Tx) Rollback() error {
+	t.events = nil
+	err := t.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+// inTx 在单独事务中执行 fn
+func (db *DB) inTx(fn func(tx *Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// orderState 读取订单当前状态；不存在返回 nil
+func (t *Tx) orderState(orderID string) (*Order, error) {
+	var o Order
+	var filled sql.NullString
+	var signHash sql.NullString
+	err := t.tx.QueryRow(`SELECT order_id, trader, pair, side, amount, filled, status, nonce, sign_hash FROM orders WHERE order_id = ?`, orderID).
+		Scan(&o.OrderID, &o.Trader, &o.Pair, &o.Side, &o.Amount, &filled, &o.Status, &o.Nonce, &signHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.Filled = filled.String
+	o.SignHash = signHash.String
+	return &o, nil
+}
+
+// transition 校验 prev → (status, filled) 并在状态或成交量变化时记录事件；prev 为 nil 表示新订单
+func (t *Tx) transition(prev *Order, o *Order, status, filled string) error {
+	from, prevFilled := OrderStatusNew, new(big.Int)
+	if prev != nil {
+		from, prevFilled = prev.Status, MustUnits(prev.Filled)
+		if from == "" {
+			from = OrderStatusNew
+		}
+	}
+	if err := ValidateOrderTransition(from, status); err != nil {
+		return fmt.Errorf("order %s: %w", o.OrderID, err)
+	}
+	next := MustUnits(filled)
+	if next.Cmp(prevFilled) < 0 {
+		return fmt.Errorf("order %s: %w: filled %s -> %s", o.OrderID, ErrInvalidOrderTransition, prevFilled, next)
+	}
+	if status == "" || prev != nil && from == status && next.Cmp(prevFilled) == 0 {
+		return nil
+	}
+	t.events = append(t.events, &OrderEvent{
+		OrderID: o.OrderID, Pair: o.Pair, Trader: o.Trader, Side: o.Side,
+		From: from, To: status, Amount: o.Amount, Filled: FormatUnits(next), Timestamp: time.Now().Unix(), Remote: t.remote,
+	})
+	return nil
+}
+
+// InsertOrder 插入或替换订单；已存在时须属于同一订单（签名哈希、trader、nonce 相同，否则 ErrOrderIDConflict），
+// 并按状态机校验状态迁移与 filled 不回退；o 无签名哈希（如未验签的成交更新）时沿用已有订单的签名哈希
+func (t *Tx) InsertOrder(o *Order) error {
+	prev, err := t.orderState(o.OrderID)
+	if err != nil {
+		return err
+	}
+	signHash := o.SignHash
+	if prev != nil {
+		if err := CheckOrderOwner(o, prev); err != nil {
+			return err
+		}
+		if signHash == "" {
+			signHash = prev.SignHash
+		}
+	}
+	filled := o.Filled
+	if filled == "" {
+		filled = "0"
+	}
+	if err := t.transition(prev, o, o.Status, filled); err != nil {
+		return err
+	}
+	orderType := o.Type
+	if orderType == "" {
+		orderType = OrderTypeLimit
+	}
+	reprice := 0
+	if o.PostOnlyReprice {
+		reprice = 1
+	}
+	var amends []byte
+	if len(o.Amends) > 0 {
+		if amends, err = json.Marshal(o.Amends); err != nil {
+			return err
+		}
+	}
+	_, err = t.tx.Exec(
+		`INSERT OR REPLACE INTO orders (`+orderColumns+`)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.OrderID, o.Trader, o.Pair, o.Side, orderType, o.Price, o.Amount, filled, o.Status, o.Nonce, o.CreatedAt, o.ExpiresAt, o.Signature, o.QuoteAmount, o.MaxSlippageBps, o.EffectiveTimeInForce(), reprice, o.Trigger, o.TriggerPrice, o.TriggeredAt, o.DisplayAmount, o.SelfTradePrevention, o.AmendedAt, o.QueuedAt, signHash, o.SignedPrice, o.SignedAmount, string(amends),
+	)
+	return err
+}
+
+// UpdateOrderStatus 按状态机更新订单状态与累计成交量；订单不存在时忽略
+func (t *Tx) UpdateOrderStatus(orderID, status, filled string) error {
+	prev, err := t.orderState(orderID)
+	if err != nil || prev == nil {
+		return err
+	}
+	if err := t.transition(prev, prev, status, filled); err != nil {
+		return err
+	}
+	_, err = t.tx.Exec(`UPDATE orders SET status = ?, filled = ? WHERE order_id = ?`, status, filled, orderID)
+	return err
+}
+
+// CloseOrder 将订单置为终态（cancelled / expired），保留已成交量；订单不存在时忽略
+func (t *Tx) CloseOrder(orderID, status string) error {
+	prev, err := t.orderState(orderID)
+	if err != nil || prev == nil {
+		return err
+	}
+	return t.UpdateOrderStatus(orderID, status, FormatUnits(MustUnits(prev.Filled)))
+}
+
+// AddFilled 累加订单成交量 delta 并迁移到 status（如批量拍卖清算结果）；订单不存在时忽略
+func (t *Tx) AddFilled(orderID, status string, delta *big.Int) error {
+	prev, err := t.orderState(orderID)
+	if err != nil || prev == nil {
+		return err
+	}
+	filled := MustUnits(prev.Filled)
+	if delta != nil {
+		filled.Add(filled, delta)
+	}
+	return t.UpdateOrderStatus(orderID, status, FormatUnits(filled))
+}
+
+// InsertTrade 插入本节点撮合引擎产生的成交记录（标记为本地撮合，计入手续费等级成交额）
+func (t *Tx) InsertTrade(tr *Trade) error {
+	_, err := t.tx.Exec(insertMatchedTradeSQL, tradeArgs(tr)...)
+	return err
+}
+
+// ApplyMakerFills 按成交累加 maker 订单的 filled，并推进为 partial / filled（累计成交量达到订单数量）
+// taker 与被激活条件单的状态由调用方以 InsertOrder 写入；本地无记录的 maker 跳过
+func (t *Tx) ApplyMakerFills(trades []*Trade) error {
+	fills := make(map[string]*big.Int)
+	var order []string
+	for _, tr := range trades {
+		if fills[tr.MakerOrderID] == nil {
+			fills[tr.MakerOrderID] = new(big.Int)
+			order = append(order, tr.MakerOrderID)
+		}
+		fills[tr.MakerOrderID].Add(fills[tr.MakerOrderID], MustUnits(tr.Amount))
+	}
+	for _, id := range order {
+		prev, err := t.orderState(id)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			continue
+		}
+		filled := new(big.Int).Add(MustUnits(prev.Filled), fills[id])
+		status := OrderStatusPartial
+		if amount, ok := ParseUnits(prev.Amount); ok && filled.Cmp(amount) >= 0 {
+			status = OrderStatusFilled
+		}
+		if err := t.UpdateOrderStatus(id, status, FormatUnits(filled)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloseOrder 见 Tx.CloseOrder
+func (db *DB) CloseOrder(orderID, status string) error {
+	return db.inTx(func(tx *Tx) error { return tx.CloseOrder(orderID, status) })
+}
+
+// ApplyOrderEvent 应用其他节点广播的订单状态迁移（本地无该订单时忽略）：交易对与 trader 须与本地订单一致、filled 不超过订单数量，
+// 同样经状态机校验，迟到或重复的事件不会回退状态或 filled
+func (db *DB) ApplyOrderEvent(ev *OrderEvent) error {
+	filled, ok := ParseUnits(ev.Filled)
+	if !ok {
+		return fmt.Errorf("order %s: %w: invalid filled %q", ev.OrderID, ErrOrderEventMismatch, ev.Filled)
+	}
+	return db.inTx(func(tx *Tx) error {
+		tx.remote = true
+		prev, err := tx.orderState(ev.OrderID)
+		if err != nil || prev == nil {
+			return err
+		}
+		if ev.Pair != prev.Pair || !strings.EqualFold(ev.Trader, prev.Trader) {
+			return fmt.Errorf("order %s: %w: pair/trader %s/%s", ev.OrderID, ErrOrderEventMismatch, ev.Pair, ev.Trader)
+		}
+		if amount, ok := ParseUnits(prev.Amount); ok && filled.Cmp(amount) > 0 {
+			return fmt.Errorf("order %s: %w: filled %s exceeds amount %s", ev.OrderID, ErrOrderEventMismatch, filled, amount)
+		}
+		return tx.UpdateOrderStatus(ev.OrderID, ev.To, FormatUnits(filled))
+	})
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateOrderTransition(t *testing.T) {
+	ok := [][2]string{
+		{"", OrderStatusOpen}, {OrderStatusNew, OrderStatusRejected}, {OrderStatusPending, OrderStatusPartial},
+		{OrderStatusOpen, OrderStatusPartial}, {OrderStatusPartial, OrderStatusPartial}, {OrderStatusPartial, OrderStatusFilled},
+		{OrderStatusOpen, OrderStatusExpired}, {OrderStatusFilled, OrderStatusFilled},
+	}
+	for _, c := range ok {
+		if err := ValidateOrderTransition(c[0], c[1]); err != nil {
+			t.Errorf("%s -> %s: %v", c[0], c[1], err)
+		}
+	}
+	bad := [][2]string{
+		{OrderStatusFilled, OrderStatusCancelled}, {OrderStatusCancelled, OrderStatusOpen}, {OrderStatusPartial, OrderStatusOpen},
+		{OrderStatusOpen, OrderStatusRejected}, {OrderStatusExpired, OrderStatusPartial}, {OrderStatusOpen, OrderStatusPending},
+	}
+	for _, c := range bad {
+		if err := ValidateOrderTransition(c[0], c[1]); !errors.Is(err, ErrInvalidOrderTransition) {
+			t.Errorf("%s -> %s: err = %v, want ErrInvalidOrderTransition", c[0], c[1], err)
+		}
+	}
+}
+
+func TestMakerFillsPersistedWithTrades(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var events []*OrderEvent
+	db.SetOrderEventHandler(func(ev *OrderEvent) { events = append(events, ev) })
+	for _, o := range []*Order{
+		{OrderID: "m1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: OrderStatusOpen, Nonce: 1, CreatedAt: 1},
+		{OrderID: "m2", Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: OrderStatusOpen, Nonce: 2, CreatedAt: 2},
+	} {
+		if err := db.InsertOrder(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events = nil
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trades := []*Trade{
+		{TradeID: "t1", Pair: "TKA/TKB", TakerOrderID: "b1", MakerOrderID: "m1", Price: "10", Amount: "5", Timestamp: 3},
+		{TradeID: "t2", Pair: "TKA/TKB", TakerOrderID: "b1", MakerOrderID: "m2", Price: "10", Amount: "2", Timestamp: 3},
+	}
+	for _, tr := range trades {
+		if err := tx.InsertTrade(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	taker := &Order{OrderID: "b1", Trader: "0x3", Pair: "TKA/TKB", Side: "buy", Price: "10", Amount: "7", Filled: "7", Status: OrderStatusFilled, Nonce: 3, CreatedAt: 3}
+	if err := tx.InsertOrder(taker); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.ApplyMakerFills(trades); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("events emitted before commit: %d", len(events))
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string][2]string{"m1": {OrderStatusFilled, "5"}, "m2": {OrderStatusPartial, "2"}, "b1": {OrderStatusFilled, "7"}} {
+		o, err := db.GetOrder(id)
+		if err != nil || o == nil {
+			t.Fatalf("GetOrder %s: %v", id, err)
+		}
+		if o.Status != want[0] || o.Filled != want[1] {
+			t.Errorf("%s = %s/%s, want %s/%s", id, o.Status, o.Filled, want[0], want[1])
+		}
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %d, want 3", len(events))
+	}
+	if ev := events[1]; ev.OrderID != "m1" || ev.From != OrderStatusOpen || ev.To != OrderStatusFilled || ev.Filled != "5" {
+		t.Errorf("maker event = %+v", ev)
+	}
+
+	// 已成交订单不可撤单，filled 不可回退；迟到的 gossip 事件被拒绝
+	if err := db.CloseOrder("m1", OrderStatusCancelled); !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Errorf("cancel filled order: err = %v", err)
+	}
+	if err := db.ApplyOrderEvent(&OrderEvent{OrderID: "m2", Pair: "TKA/TKB", Trader: "0x2", To: OrderStatusPartial, Filled: "1"}); !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Errorf("filled regression: err = %v", err)
+	}
+	if err := db.CloseOrder("m2", OrderStatusCancelled); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := db.GetOrder("m2"); o.Status != OrderStatusCancelled || o.Filled != "2" {
+		t.Errorf("cancelled m2 = %s/%s", o.Status, o.Filled)
+	}
+}
+
+func TestApplyOrderEventMustMatchStoredOrder(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.InsertOrder(&Order{OrderID: "m1", Trader: "0xAb", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: OrderStatusOpen, Nonce: 1, CreatedAt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range []*OrderEvent{
+		{OrderID: "m1", Pair: "TKC/TKB", Trader: "0xab", To: OrderStatusFilled, Filled: "5"},
+		{OrderID: "m1", Pair: "TKA/TKB", Trader: "0x2", To: OrderStatusCancelled, Filled: "0"},
+		{OrderID: "m1", Pair: "TKA/TKB", Trader: "0xab", To: OrderStatusFilled, Filled: "6"},
+		{OrderID: "m1", Pair: "TKA/TKB", Trader: "0xab", To: OrderStatusPartial, Filled: "-1"},
+	} {
+		if err := db.ApplyOrderEvent(ev); !errors.Is(err, ErrOrderEventMismatch) {
+			t.Errorf("%s/%s filled %s: err = %v, want ErrOrderEventMismatch", ev.Pair, ev.Trader, ev.Filled, err)
+		}
+	}
+	if err := db.ApplyOrderEvent(&OrderEvent{OrderID: "m1", Pair: "TKA/TKB", Trader: "0xab", To: OrderStatusPartial, Filled: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := db.GetOrder("m1"); o.Status != OrderStatusPartial || o.Filled != "3" {
+		t.Errorf("m1 = %s/%s, want partial/3", o.Status, o.Filled)
+	}
+}
+
+func TestTxRollbackDropsEvents(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	emitted := 0
+	db.SetOrderEventHandler(func(*OrderEvent) { emitted++ })
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.InsertOrder(&Order{OrderID: "o1", Pair: "TKA/TKB", Side: "buy", Price: "1", Amount: "1", Status: OrderStatusOpen}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := db.GetOrder("o1"); o != nil || emitted != 0 {
+		t.Errorf("rolled back order = %+v, events = %d", o, emitted)
+	}
+}
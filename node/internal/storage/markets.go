@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"database/sql"
+)
+
+// 交易对上架状态
+const (
+	MarketListed   = "listed"   // 已上架：接受订单
+	MarketDelisted = "delisted" // 已下架：挂单全部撤销，拒绝新订单
+)
+
+// Market 运行时交易对注册记录（上架/下架/管理员暂停），启动时覆盖配置文件中的交易对
+type Market struct {
+	Pair        string `json:"pair"`
+	Status      string `json:"status"`                // listed | delisted
+	Config      string `json:"config"`                // 交易对参数（与 config.yaml match.pairs 下单个交易对同格式的 YAML），空为沿用配置文件
+	State       string `json:"state,omitempty"`       // 交易状态：trading | halted | auction | cancel-only（空为 trading）
+	StateUntil  int64  `json:"stateUntil,omitempty"`  // 交易状态到期自动流转时间，0 为不自动流转
+	StateReason string `json:"stateReason,omitempty"` // 交易状态原因
+	UpdatedAt   int64  `json:"updatedAt"`
+}
+
+// UpsertMarket 写入交易对注册记录（上架、修改参数或下架）；不修改交易状态字段
+func (db *DB) UpsertMarket(m *Market) error {
+	_, err := db.sql.Exec(
+		`INSERT INTO markets (pair, status, config, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(pair) DO UPDATE SET status = excluded.status, config = excluded.config, updated_at = excluded.updated_at`,
+		m.Pair, m.Status, m.Config, m.UpdatedAt,
+	)
+	return err
+}
+
+// SetMarketState 记录交易对交易状态（暂停、只撤单、集合竞价、恢复）；配置文件中的交易对无注册记录时以空参数登记为 listed
+func (db *DB) SetMarketState(pair, state string, until int64, reason string, updatedAt int64) error {
+	_, err := db.sql.Exec(
+		`INSERT INTO markets (pair, status, config, state, state_until, state_reason, updated_at) VALUES (?, ?, '', ?, ?, ?, ?)
+		 ON CONFLICT(pair) DO UPDATE SET state = excluded.state, state_until = excluded.state_until,
+		 state_reason = excluded.state_reason, updated_at = excluded.updated_at`,
+		pair, MarketListed, state, until, reason, updatedAt,
+	)
+	return err
+}
+
+// GetMarket 查询交易对注册记录，不存在返回 nil
+func (db *DB) GetMarket(pair string) (*Market, error) {
+	var m Market
+	err := db.sql.QueryRow(
+		`SELECT pair, status, config, state, state_until, state_reason, updated_at FROM markets WHERE pair = ?`,
+		pair,
+	).Scan(&m.Pair, &m.Status, &m.Config, &m.State, &m.StateUntil, &m.StateReason, &m.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListMarkets 返回全部交易对注册记录（含已下架），按交易对排序
+func (db *DB) ListMarkets() ([]*Market, error) {
+	rows, err := db.sql.Query(
+		`SELECT pair, status, config, state, state_until, state_reason, updated_at FROM markets ORDER BY pair`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Market
+	for rows.Next() {
+		var m Market
+		if err := rows.Scan(&m.Pair, &m.Status, &m.Config, &m.State, &m.StateUntil, &m.StateReason, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &m)
+	}
+	return out, rows.Err()
+}
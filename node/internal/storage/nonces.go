@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNonceUsed 订单 nonce 已使用，或低于 trader 的有效下限（与 OrderNonceManager.isValidNonce 一致）
+var ErrNonceUsed = errors.New("nonce already used")
+
+// TraderNonce trader 的 nonce 记录：MaxUsed 为已使用的最大 nonce（无则为 -1），
+// MinValid 为 CancelBelowNonce 设置的有效下限；新订单须满足 nonce > MaxUsed 且 nonce >= MinValid
+// （与链上 OrderNonceManager 一致只记最大值而非已用集合：较大 nonce 先被占用后，较小的未用 nonce 也不再可用）
+type TraderNonce struct {
+	Trader    string `json:"trader"`
+	MaxUsed   int64  `json:"maxUsed"`
+	MinValid  int64  `json:"minValid"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// NextNonce 返回下一个可用 nonce（合约 getCurrentNonce 的链下对应）
+func (n *TraderNonce) NextNonce() int64 {
+	if n.MaxUsed+1 > n.MinValid {
+		return n.MaxUsed + 1
+	}
+	return n.MinValid
+}
+
+// check 校验 nonce 是否可用
+func (n *TraderNonce) check(nonce int64) error {
+	if nonce < 0 {
+		return fmt.Errorf("%w: negative nonce %d", ErrNonceUsed, nonce)
+	}
+	if nonce <= n.MaxUsed || nonce < n.MinValid {
+		return fmt.Errorf("%w: trader=%s nonce=%d next=%d", ErrNonceUsed, n.Trader, nonce, n.NextNonce())
+	}
+	return nil
+}
+
+// queryer Tx 与 DB 共用的只读查询
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// getTraderNonce 读取 trader 的 nonce 记录，不存在时返回初始值（MaxUsed=-1）；trader 统一小写
+func getTraderNonce(q queryer, trader string) (*TraderNonce, error) {
+	n := TraderNonce{Trader: strings.ToLower(trader), MaxUsed: -1}
+	err := q.QueryRow(`SELECT max_used, min_valid, updated_at FROM trader_nonces WHERE trader = ?`, n.Trader).
+		Scan(&n.MaxUsed, &n.MinValid, &n.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// putTraderNonce 写入 trader 的 nonce 记录
+func (t *Tx) putTraderNonce(n *TraderNonce) error {
+	n.UpdatedAt = time.Now().Unix()
+	_, err := t.tx.Exec(
+		`INSERT INTO trader_nonces (trader, max_used, min_valid, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(trader) DO UPDATE SET max_used = excluded.max_used, min_valid = excluded.min_valid, updated_at = excluded.updated_at`,
+		n.Trader, n.MaxUsed, n.MinValid, n.UpdatedAt,
+	)
+	return err
+}
+
+// GetTraderNonce 查询 trader 的 nonce 记录（未下过单时 MaxUsed=-1、MinValid=0）
+func (db *DB) GetTraderNonce(trader string) (*TraderNonce, error) {
+	return getTraderNonce(db.sql, trader)
+}
+
+// CheckNonce 只读校验 nonce 是否可用（API 入口预检，不占用）；已使用或低于下限返回 ErrNonceUsed
+func (db *DB) CheckNonce(trader string, nonce int64) error {
+	n, err := getTraderNonce(db.sql, trader)
+	if err != nil {
+		return err
+	}
+	return n.check(nonce)
+}
+
+// UseNonce 校验并占用 nonce：记录的已使用最大 nonce 推进到 nonce；已使用或低于下限返回 ErrNonceUsed
+func (t *Tx) UseNonce(trader string, nonce int64) error {
+	n, err := getTraderNonce(t.tx, trader)
+	if err != nil {
+		return err
+	}
+	if err := n.check(nonce); err != nil {
+		return err
+	}
+	n.MaxUsed = nonce
+	return t.putTraderNonce(n)
+}
+
+// UseNonce 见 Tx.UseNonce（单独事务，校验与占用原子完成）
+func (db *DB) UseNonce(trader string, nonce int64) error {
+	return db.inTx(func(tx *Tx) error { return tx.UseNonce(trader, nonce) })
+}
+
+// CancelBelowNonce 撤销 trader 在所有交易对中 nonce < below 的未完结订单（open / partial / pending），
+// 并将有效下限提高到 below（只升不降），此后 nonce < below 的订单一律拒绝；返回被撤销的订单 ID
+func (t *Tx) CancelBelowNonce(trader string, below int64) ([]string, error) {
+	n, err := getTraderNonce(t.tx, trader)
+	if err != nil {
+		return nil, err
+	}
+	if below > n.MinValid {
+		n.MinValid = below
+		if err := t.putTraderNonce(n); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := t.tx.Query(
+		`SELECT order_id FROM orders WHERE lower(trader) = ? AND nonce < ? AND status IN (?, ?, ?) ORDER BY order_id`,
+		n.Trader, below, OrderStatusOpen, OrderStatusPartial, OrderStatusPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := t.CloseOrder(id, OrderStatusCancelled); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// CancelBelowNonce 见 Tx.CancelBelowNonce（单独事务，订单事件在提交后通知）
+func (db *DB) CancelBelowNonce(trader string, below int64) ([]string, error) {
+	var ids []string
+	err := db.inTx(func(tx *Tx) error {
+		var err error
+		ids, err = tx.CancelBelowNonce(trader, below)
+		return err
+	})
+	return ids, err
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUseNonceRejectsReuse(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.CheckNonce("0xAbC", 0); err != nil {
+		t.Fatalf("fresh trader nonce 0: %v", err)
+	}
+	if err := db.UseNonce("0xAbC", 5); err != nil {
+		t.Fatal(err)
+	}
+	// 地址大小写不敏感；已使用与更小的 nonce 均拒绝
+	for _, nonce := range []int64{5, 3, -1} {
+		if err := db.UseNonce("0xabc", nonce); !errors.Is(err, ErrNonceUsed) {
+			t.Errorf("UseNonce(%d) err = %v, want ErrNonceUsed", nonce, err)
+		}
+	}
+	if err := db.CheckNonce("0xabc", 6); err != nil {
+		t.Errorf("CheckNonce(6): %v", err)
+	}
+	if err := db.UseNonce("0xdef", 5); err != nil {
+		t.Errorf("other trader nonce 5: %v", err)
+	}
+	if n, _ := db.GetTraderNonce("0xABC"); n.MaxUsed != 5 || n.NextNonce() != 6 {
+		t.Errorf("trader nonce = %+v", n)
+	}
+}
+
+func TestCancelBelowNonce(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var events []*OrderEvent
+	db.SetOrderEventHandler(func(ev *OrderEvent) { events = append(events, ev) })
+	for _, o := range []*Order{
+		{OrderID: "a1", Trader: "0xAA", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: OrderStatusOpen, Nonce: 1},
+		{OrderID: "a2", Trader: "0xaa", Pair: "TKC/TKD", Side: "buy", Price: "10", Amount: "5", Filled: "2", Status: OrderStatusPartial, Nonce: 2},
+		{OrderID: "a3", Trader: "0xaa", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: OrderStatusFilled, Filled: "5", Nonce: 3},
+		{OrderID: "a4", Trader: "0xaa", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: OrderStatusOpen, Nonce: 10},
+		{OrderID: "b1", Trader: "0xbb", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: OrderStatusOpen, Nonce: 1},
+	} {
+		if err := db.InsertOrder(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events = nil
+	ids, err := db.CancelBelowNonce("0xAa", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "a1" || ids[1] != "a2" || len(events) != 2 {
+		t.Fatalf("cancelled = %v, events = %d", ids, len(events))
+	}
+	if got, _ := db.GetOrder("a2"); got.Status != OrderStatusCancelled || got.Filled != "2" {
+		t.Errorf("a2 = %s/%s, want cancelled/2", got.Status, got.Filled)
+	}
+	for _, id := range []string{"a4", "b1"} {
+		if got, _ := db.GetOrder(id); got.Status != OrderStatusOpen {
+			t.Errorf("%s status = %s, want open", id, got.Status)
+		}
+	}
+	// 下限只升不降：之后 nonce < 10 的订单一律拒绝
+	if _, err := db.CancelBelowNonce("0xaa", 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UseNonce("0xaa", 9); !errors.Is(err, ErrNonceUsed) {
+		t.Errorf("nonce below cancel-all floor: err = %v", err)
+	}
+	if err := db.UseNonce("0xaa", 10); err != nil {
+		t.Errorf("nonce at floor: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"encoding/json"
+	"time"
 )
 
 // OrderbookLevel [price, quantity]
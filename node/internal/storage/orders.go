@@ -2,81 +2,266 @@ package storage
 
 import (
 	"database/sql"
-	"strconv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 	"time"
 )
 
 // OrderExpired 判断订单是否已过期（用于 Replay/过期防护）
 func OrderExpired(o *Order) bool {
+	return OrderExpiredAt(o, time.Now().Unix())
+}
+
+// OrderExpiredAt 判断订单在 now（unix 秒）时是否已过期；撮合引擎按自身时钟判断，保证日志回放结果一致
+func OrderExpiredAt(o *Order, now int64) bool {
 	if o == nil || o.ExpiresAt <= 0 {
 		return false
 	}
-	return time.Now().Unix() > o.ExpiresAt
+	return now > o.ExpiresAt
 }
 
+// 订单类型
+const (
+	OrderTypeLimit  = "limit"  // 限价单（默认，空值视为 limit）
+	OrderTypeMarket = "market" // 市价单：吃对手盘至数量/预算用尽，剩余撤销，不挂单
+)
+
+// 有效期类型（timeInForce）
+const (
+	TimeInForceGTC      = "GTC"       // 撤单前有效（默认，空值视为 GTC；仍受 ExpiresAt 约束）
+	TimeInForceGTD      = "GTD"       // 至 ExpiresAt 有效（须设置 ExpiresAt）
+	TimeInForceIOC      = "IOC"       // 立即成交，剩余撤销
+	TimeInForceFOK      = "FOK"       // 全部成交或拒绝，无任何副作用
+	TimeInForcePostOnly = "POST_ONLY" // 只做 maker：会吃单时拒绝（或按 PostOnlyReprice 改价）
+)
+
+// 条件单触发类型（按最新成交价穿越 TriggerPrice 激活）
+const (
+	TriggerStop       = "stop"        // 止损：买单 last >= trigger 激活，卖单 last <= trigger 激活
+	TriggerTakeProfit = "take_profit" // 止盈：买单 last <= trigger 激活，卖单 last >= trigger 激活
+)
+
+// 自成交防护（STP）模式：taker 与同一 trader 的挂单相遇时的处理方式，不产生成交
+const (
+	SelfTradeCancelNewest       = "cancel_newest"        // 撤销 taker 剩余部分，挂单保留
+	SelfTradeCancelOldest       = "cancel_oldest"        // 撤销挂单，taker 继续撮合
+	SelfTradeCancelBoth         = "cancel_both"          // 同时撤销挂单与 taker 剩余部分
+	SelfTradeDecrementAndCancel = "decrement_and_cancel" // 双方按较小剩余量减量，减至 0 的一方撤销
+)
+
 // Order 订单（与 Phase3 设计文档 §2.2 对齐）
 type Order struct {
 	OrderID   string `json:"orderId"`
 	Trader    string `json:"trader"`
 	Pair      string `json:"pair"`
-	Side      string `json:"side"` // buy | sell
-	Price     string `json:"price"`
-	Amount    string `json:"amount"`
-	Filled    string `json:"filled"`
-	Status    string `json:"status"` // open | partial | filled | cancelled
+	Side      string `json:"side"`           // buy | sell
+	Type      string `json:"type,omitempty"` // limit | market（空为 limit）
+	Price     string `json:"price"`          // quote 最小单位 / 1 个 base 代币（整数字符串，见 units.go）；市价单为空或 0
+	Amount    string `json:"amount"`         // base 最小单位（整数字符串）；按预算的市价买单可为空或 0
+	Filled    string `json:"filled"`         // base 最小单位（整数字符串）
+	Status    string `json:"status"`         // 见 lifecycle.go 订单状态机：pending（条件单待触发）| open | partial | filled | cancelled | expired | rejected
 	Nonce     int64  `json:"nonce"`
 	CreatedAt int64  `json:"createdAt"`
 	ExpiresAt int64  `json:"expiresAt"`
 	Signature string `json:"signature,omitempty"`
+	SignHash  string `json:"signHash,omitempty"` // EIP-712 签名哈希（验签通过后由节点填充，orderId 绑定的签名内容；改单后保持原值）
+	// 市价单参数
+	QuoteAmount    string `json:"quoteAmount,omitempty"`    // 市价买单 quote 预算（quote 最小单位）；为空则按 Amount 成交
+	MaxSlippageBps uint32 `json:"maxSlippageBps,omitempty"` // 相对撮合开始时对手盘最优价的最大滑点（万分比），0 为不限
+	// 有效期
+	TimeInForce     string `json:"timeInForce,omitempty"`     // GTC | GTD | IOC | FOK | POST_ONLY（空为 GTC）
+	PostOnlyReprice bool   `json:"postOnlyReprice,omitempty"` // POST_ONLY 会吃单时改价为对手盘最优价内侧一档，而非拒绝
+	// 条件单（止损/止盈限价）
+	Trigger      string `json:"trigger,omitempty"`      // stop | take_profit（空为普通订单）
+	TriggerPrice string `json:"triggerPrice,omitempty"` // 触发价（与 Price 同单位）
+	TriggeredAt  int64  `json:"triggeredAt,omitempty"`  // 激活时间（触发成交的时间戳），0 为未激活
+	// 冰山单：对外只展示 DisplayAmount，可见部分成交完后从隐藏量补充并排到同价位队尾
+	DisplayAmount string `json:"displayAmount,omitempty"` // 每次可见数量（base 最小单位），空为普通订单
+	// 自成交防护模式，覆盖交易对配置（空为按交易对配置）
+	SelfTradePrevention string `json:"selfTradePrevention,omitempty"`
+	// 改单（AmendOrder）：AmendedAt 为最近一次改单签名时间（防重放），QueuedAt 为改价/加量后重新排队的时间
+	AmendedAt int64 `json:"amendedAt,omitempty"`
+	QueuedAt  int64 `json:"queuedAt,omitempty"`
+	// 改单签名链：SignedPrice/SignedAmount 为首次改单前的价格与数量（原始签名内容），Amends 为按时间顺序的改单签名；
+	// 改单后的订单由原始签名加改单签名链验证（Signature/SignHash 保持原始订单的签名）
+	SignedPrice  string        `json:"signedPrice,omitempty"`
+	SignedAmount string        `json:"signedAmount,omitempty"`
+	Amends       []SignedAmend `json:"amends,omitempty"`
+}
+
+// SignedAmend 一次已验签的改单（EIP-712 AmendOrder 签名内容）："" 与 "0" 表示该项不变，NewAmount 为新的剩余数量
+type SignedAmend struct {
+	NewPrice  string `json:"newPrice,omitempty"`
+	NewAmount string `json:"newAmount,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// AppendAmend 将改单签名追加到改单签名链并更新 AmendedAt；首次改单时记录原始签名的价格与数量（须在修改价格/数量之前调用）。
+// 新建切片，不与订单的其他副本共享底层数组
+func (o *Order) AppendAmend(a SignedAmend) {
+	if len(o.Amends) == 0 {
+		o.SignedPrice, o.SignedAmount = o.Price, o.Amount
+	}
+	o.Amends = append(append(make([]SignedAmend, 0, len(o.Amends)+1), o.Amends...), a)
+	o.AmendedAt = a.Timestamp
+}
+
+// PriorityTime 返回订单在价格档位内的排队时间：取创建、条件单激活、重新排队时间中的最晚者
+func (o *Order) PriorityTime() int64 {
+	t := o.CreatedAt
+	if o.TriggeredAt > t {
+		t = o.TriggeredAt
+	}
+	if o.QueuedAt > t {
+		t = o.QueuedAt
+	}
+	return t
+}
+
+// IsIceberg 是否为冰山单
+func (o *Order) IsIceberg() bool {
+	return o != nil && o.DisplayAmount != ""
+}
+
+// PublicView 返回对外展示的订单副本：冰山单 Amount 改为 Filled + 当前可见量，隐藏量不外泄
+func (o *Order) PublicView() *Order {
+	if o == nil {
+		return nil
+	}
+	c := *o
+	if !o.IsIceberg() {
+		return &c
+	}
+	visible := o.Remaining()
+	if display := MustUnits(o.DisplayAmount); display.Cmp(visible) < 0 {
+		visible = display
+	}
+	c.Amount = FormatUnits(new(big.Int).Add(MustUnits(o.Filled), visible))
+	return &c
+}
+
+// IsPendingTrigger 是否为尚未激活的条件单
+func (o *Order) IsPendingTrigger() bool {
+	return o != nil && o.Trigger != "" && o.TriggeredAt == 0
+}
+
+// EffectiveTimeInForce 返回生效的有效期类型（空值为 GTC）
+func (o *Order) EffectiveTimeInForce() string {
+	if o == nil || o.TimeInForce == "" {
+		return TimeInForceGTC
+	}
+	return o.TimeInForce
+}
+
+// IsMarket 是否为市价单
+func (o *Order) IsMarket() bool {
+	return o != nil && o.Type == OrderTypeMarket
+}
+
+// orderColumns orders 表查询列（与 scanOrder 顺序一致）
+const orderColumns = `order_id, trader, pair, side, order_type, price, amount, filled, status, nonce, created_at, expires_at, signature, quote_amount, max_slippage_bps, time_in_force, post_only_reprice, trigger_type, trigger_price, triggered_at, display_amount, self_trade_prevention, amended_at, queued_at, sign_hash, signed_price, signed_amount, amends`
+
+// rowScanner 兼容 *sql.Row 与 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder 按 orderColumns 顺序扫描一行订单
+func scanOrder(row rowScanner) (*Order, error) {
+	var o Order
+	var orderType, filled, sig, signHash, quoteAmount sql.NullString
+	var tif, trigger, triggerPrice, display, stp sql.NullString
+	var signedPrice, signedAmount, amends sql.NullString
+	var slippage, reprice, triggeredAt, amendedAt, queuedAt sql.NullInt64
+	if err := row.Scan(&o.OrderID, &o.Trader, &o.Pair, &o.Side, &orderType, &o.Price, &o.Amount, &filled, &o.Status, &o.Nonce, &o.CreatedAt, &o.ExpiresAt, &sig, &quoteAmount, &slippage, &tif, &reprice, &trigger, &triggerPrice, &triggeredAt, &display, &stp, &amendedAt, &queuedAt, &signHash, &signedPrice, &signedAmount, &amends); err != nil {
+		return nil, err
+	}
+	if orderType.String != OrderTypeLimit {
+		o.Type = orderType.String
+	}
+	o.Filled = filled.String
+	o.Signature = sig.String
+	o.QuoteAmount = quoteAmount.String
+	o.MaxSlippageBps = uint32(slippage.Int64)
+	if tif.String != TimeInForceGTC {
+		o.TimeInForce = tif.String
+	}
+	o.PostOnlyReprice = reprice.Int64 != 0
+	o.Trigger = trigger.String
+	o.TriggerPrice = triggerPrice.String
+	o.TriggeredAt = triggeredAt.Int64
+	o.DisplayAmount = display.String
+	o.SelfTradePrevention = stp.String
+	o.AmendedAt = amendedAt.Int64
+	o.QueuedAt = queuedAt.Int64
+	o.SignHash = signHash.String
+	o.SignedPrice = signedPrice.String
+	o.SignedAmount = signedAmount.String
+	if amends.String != "" {
+		if err := json.Unmarshal([]byte(amends.String), &o.Amends); err != nil {
+			return nil, fmt.Errorf("order %s amends: %w", o.OrderID, err)
+		}
+	}
+	return &o, nil
+}
+
+// ErrOrderIDConflict orderId 已属于其他订单：订单 ID 由首次出现的已签名订单（签名哈希，及 trader + nonce）占有，
+// 引擎与存储均拒绝以他人的 orderId 覆盖已有订单（防止广播同 ID 订单挤掉受害者的挂单）
+var ErrOrderIDConflict = errors.New("order id owned by another order")
+
+// CheckOrderOwner 校验 o 与同 orderId 的已有订单 prev 属于同一订单：trader、nonce 相同，且双方均已验签时签名哈希相同；
+// 不同则返回 ErrOrderIDConflict（未验签的旧订单无签名哈希，只比较 trader 与 nonce）
+func CheckOrderOwner(o *Order, prev *Order) error {
+	if !strings.EqualFold(o.Trader, prev.Trader) || o.Nonce != prev.Nonce ||
+		(o.SignHash != "" && prev.SignHash != "" && !strings.EqualFold(o.SignHash, prev.SignHash)) {
+		return fmt.Errorf("%w: orderId=%s", ErrOrderIDConflict, o.OrderID)
+	}
+	return nil
+}
+
+// CheckOrderOwner 校验 orderId 未被其他订单占用（入口预检，先于占用 nonce）
+func (db *DB) CheckOrderOwner(o *Order) error {
+	prev, err := db.GetOrder(o.OrderID)
+	if err != nil || prev == nil {
+		return err
+	}
+	return CheckOrderOwner(o, prev)
 }
 
-// InsertOrder 插入或替换订单（新订单或状态更新）
+// InsertOrder 插入或替换订单（新订单或状态更新），按订单状态机校验（见 lifecycle.go）
 func (db *DB) InsertOrder(o *Order) error {
-	filled := o.Filled
-	if filled == "" {
-		filled = "0"
-	}
-	_, err := db.sql.Exec(
-		`INSERT OR REPLACE INTO orders (order_id, trader, pair, side, price, amount, filled, status, nonce, created_at, expires_at, signature)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		o.OrderID, o.Trader, o.Pair, o.Side, o.Price, o.Amount, filled, o.Status, o.Nonce, o.CreatedAt, o.ExpiresAt, o.Signature,
-	)
-	return err
+	return db.inTx(func(tx *Tx) error { return tx.InsertOrder(o) })
 }
 
-// UpdateOrderStatus 更新订单状态（如撤单后设为 cancelled）
+// UpdateOrderStatus 更新订单状态与累计成交量（如撤单后设为 cancelled），按订单状态机校验
 func (db *DB) UpdateOrderStatus(orderID, status, filled string) error {
-	_, err := db.sql.Exec(
-		`UPDATE orders SET status = ?, filled = ? WHERE order_id = ?`,
-		status, filled, orderID,
-	)
-	return err
+	return db.inTx(func(tx *Tx) error { return tx.UpdateOrderStatus(orderID, status, filled) })
 }
 
 // GetOrder 按 orderId 查询
 func (db *DB) GetOrder(orderID string) (*Order, error) {
-	var o Order
-	var filled, sig sql.NullString
-	err := db.sql.QueryRow(
-		`SELECT order_id, trader, pair, side, price, amount, filled, status, nonce, created_at, expires_at, signature
+	o, err := scanOrder(db.sql.QueryRow(
+		`SELECT `+orderColumns+`
 		 FROM orders WHERE order_id = ?`,
 		orderID,
-	).Scan(&o.OrderID, &o.Trader, &o.Pair, &o.Side, &o.Price, &o.Amount, &filled, &o.Status, &o.Nonce, &o.CreatedAt, &o.ExpiresAt, &sig)
+	))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	o.Filled = filled.String
-	o.Signature = sig.String
-	return &o, nil
+	return o, nil
 }
 
-// ListPairsWithOpenOrders 返回有 open/partial 订单的交易对列表，用于启动时恢复订单簿
+// ListPairsWithOpenOrders 返回有 open/partial 订单或待触发条件单（pending）的交易对列表，用于启动时恢复订单簿
 func (db *DB) ListPairsWithOpenOrders() ([]string, error) {
 	rows, err := db.sql.Query(
-		`SELECT DISTINCT pair FROM orders WHERE status IN ('open', 'partial') ORDER BY pair`,
+		`SELECT DISTINCT pair FROM orders WHERE status IN ('open', 'partial', 'pending') ORDER BY pair`,
 	)
 	if err != nil {
 		return nil, err
@@ -95,6 +280,50 @@ func (db *DB) ListPairsWithOpenOrders() ([]string, error) {
 	return pairs, rows.Err()
 }
 
+// ListPendingTriggerOrders 查询某交易对待触发的条件单（status=pending），按创建时间升序，用于启动时恢复触发簿
+func (db *DB) ListPendingTriggerOrders(pair string) ([]*Order, error) {
+	rows, err := db.sql.Query(
+		`SELECT `+orderColumns+`
+		 FROM orders WHERE pair = ? AND status = 'pending' ORDER BY created_at ASC, order_id ASC`,
+		pair,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// ListRestingOrders 查询某交易对全部挂单（open/partial，不限条数），按创建时间、orderID 升序，用于启动时恢复订单簿
+func (db *DB) ListRestingOrders(pair string) ([]*Order, error) {
+	rows, err := db.sql.Query(
+		`SELECT `+orderColumns+`
+		 FROM orders WHERE pair = ? AND status IN ('open', 'partial') ORDER BY created_at ASC, order_id ASC`,
+		pair,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
 // ListOrdersOpenByPair 查询某交易对当前盘口（open/partial），买盘价格降序、卖盘价格升序，用于订单簿展示
 // 优化：使用索引优化查询
 func (db *DB) ListOrdersOpenByPair(pair string, limit int) (bids, asks []*Order, err error) {
@@ -102,28 +331,25 @@ func (db *DB) ListOrdersOpenByPair(pair string, limit int) (bids, asks []*Order,
 		limit = 200
 	}
 	// 索引优化：使用复合索引 pair + status
-	query := `SELECT order_id, trader, pair, side, price, amount, filled, status, nonce, created_at, expires_at, signature
+	query := `SELECT ` + orderColumns + `
 		  FROM orders WHERE pair = ? AND status IN ('open', 'partial') ORDER BY created_at ASC LIMIT ?`
 	rows, err := db.sql.Query(query, pair, limit*2)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer rows.Close()
-	var filled, sig sql.NullString
 	// 预分配切片容量，减少内存分配
 	bids = make([]*Order, 0, limit)
 	asks = make([]*Order, 0, limit)
 	for rows.Next() {
-		var o Order
-		if err := rows.Scan(&o.OrderID, &o.Trader, &o.Pair, &o.Side, &o.Price, &o.Amount, &filled, &o.Status, &o.Nonce, &o.CreatedAt, &o.ExpiresAt, &sig); err != nil {
+		o, err := scanOrder(rows)
+		if err != nil {
 			return nil, nil, err
 		}
-		o.Filled = filled.String
-		o.Signature = sig.String
 		if o.Side == "buy" {
-			bids = append(bids, &o)
+			bids = append(bids, o)
 		} else {
-			asks = append(asks, &o)
+			asks = append(asks, o)
 		}
 		if len(bids)+len(asks) >= limit*2 {
 			break
@@ -141,9 +367,9 @@ func (db *DB) ListOrdersOpenByPair(pair string, limit int) (bids, asks []*Order,
 	return bids, asks, rows.Err()
 }
 
-func priceFloat(s string) float64 {
-	f, _ := strconv.ParseFloat(s, 64)
-	return f
+// comparePrice 按最小单位整数比较价格（定点，避免 float64 精度丢失）
+func comparePrice(a, b string) int {
+	return MustUnits(a).Cmp(MustUnits(b))
 }
 
 func sortOrdersBids(bids []*Order) {
@@ -153,8 +379,8 @@ func sortOrdersBids(bids []*Order) {
 	// 价格降序，同价时间升序
 	for i := 0; i < len(bids); i++ {
 		for j := i + 1; j < len(bids); j++ {
-			pi, pj := priceFloat(bids[i].Price), priceFloat(bids[j].Price)
-			if pi < pj || (pi == pj && bids[i].CreatedAt > bids[j].CreatedAt) {
+			c := comparePrice(bids[i].Price, bids[j].Price)
+			if c < 0 || (c == 0 && bids[i].CreatedAt > bids[j].CreatedAt) {
 				bids[i], bids[j] = bids[j], bids[i]
 			}
 		}
@@ -167,8 +393,8 @@ func sortOrdersAsks(asks []*Order) {
 	}
 	for i := 0; i < len(asks); i++ {
 		for j := i + 1; j < len(asks); j++ {
-			pi, pj := priceFloat(asks[i].Price), priceFloat(asks[j].Price)
-			if pi > pj || (pi == pj && asks[i].CreatedAt > asks[j].CreatedAt) {
+			c := comparePrice(asks[i].Price, asks[j].Price)
+			if c > 0 || (c == 0 && asks[i].CreatedAt > asks[j].CreatedAt) {
 				asks[i], asks[j] = asks[j], asks[i]
 			}
 		}
@@ -180,7 +406,7 @@ func (db *DB) ListOrdersByTrader(trader, pair string, limit int) ([]*Order, erro
 	if limit <= 0 {
 		limit = 100
 	}
-	query := `SELECT order_id, trader, pair, side, price, amount, filled, status, nonce, created_at, expires_at, signature
+	query := `SELECT ` + orderColumns + `
 		  FROM orders WHERE 1=1`
 	args := []interface{}{}
 	if trader != "" {
@@ -199,15 +425,12 @@ func (db *DB) ListOrdersByTrader(trader, pair string, limit int) ([]*Order, erro
 	}
 	defer rows.Close()
 	var out []*Order
-	var filled, sig sql.NullString
 	for rows.Next() {
-		var o Order
-		if err := rows.Scan(&o.OrderID, &o.Trader, &o.Pair, &o.Side, &o.Price, &o.Amount, &filled, &o.Status, &o.Nonce, &o.CreatedAt, &o.ExpiresAt, &sig); err != nil {
+		o, err := scanOrder(rows)
+		if err != nil {
 			return nil, err
 		}
-		o.Filled = filled.String
-		o.Signature = sig.String
-		out = append(out, &o)
+		out = append(out, o)
 	}
 	return out, rows.Err()
 }
@@ -217,7 +440,7 @@ func (db *DB) ListOrders(pair string, since, until int64, limit int) ([]*Order,
 	if limit <= 0 {
 		limit = 500
 	}
-	query := `SELECT order_id, trader, pair, side, price, amount, filled, status, nonce, created_at, expires_at, signature
+	query := `SELECT ` + orderColumns + `
 		  FROM orders WHERE created_at >= ? AND created_at <= ?`
 	args := []interface{}{since, until}
 	if pair != "" {
@@ -233,14 +456,11 @@ func (db *DB) ListOrders(pair string, since, until int64, limit int) ([]*Order,
 	defer rows.Close()
 	var out []*Order
 	for rows.Next() {
-		var o Order
-		var filled, sig sql.NullString
-		if err := rows.Scan(&o.OrderID, &o.Trader, &o.Pair, &o.Side, &o.Price, &o.Amount, &filled, &o.Status, &o.Nonce, &o.CreatedAt, &o.ExpiresAt, &sig); err != nil {
+		o, err := scanOrder(rows)
+		if err != nil {
 			return nil, err
 		}
-		o.Filled = filled.String
-		o.Signature = sig.String
-		out = append(out, &o)
+		out = append(out, o)
 	}
 	return out, rows.Err()
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -36,9 +37,9 @@ func TestListPairsWithOpenOrders(t *testing.T) {
 	// 插入 open/partial 订单
 	orders := []*Order{
 		{OrderID: "o1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Price: "1", Amount: "100", Filled: "0", Status: "open", Nonce: 1, CreatedAt: 1, ExpiresAt: 0},
-		{OrderID: "o2", Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "1.1", Amount: "50", Filled: "0", Status: "partial", Nonce: 2, CreatedAt: 2, ExpiresAt: 0},
+		{OrderID: "o2", Trader: "0x2", Pair: "TKA/TKB", Side: "sell", Price: "11", Amount: "50", Filled: "0", Status: "partial", Nonce: 2, CreatedAt: 2, ExpiresAt: 0},
 		{OrderID: "o3", Trader: "0x3", Pair: "TKC/TKD", Side: "buy", Price: "2", Amount: "200", Filled: "0", Status: "open", Nonce: 3, CreatedAt: 3, ExpiresAt: 0},
-		{OrderID: "o4", Trader: "0x4", Pair: "TKA/TKB", Side: "buy", Price: "0.9", Amount: "10", Filled: "10", Status: "filled", Nonce: 4, CreatedAt: 4, ExpiresAt: 0},
+		{OrderID: "o4", Trader: "0x4", Pair: "TKA/TKB", Side: "buy", Price: "9", Amount: "10", Filled: "10", Status: "filled", Nonce: 4, CreatedAt: 4, ExpiresAt: 0},
 	}
 	for _, o := range orders {
 		if err := db.InsertOrder(o); err != nil {
@@ -62,3 +63,200 @@ func TestListPairsWithOpenOrders(t *testing.T) {
 		}
 	}
 }
+
+func TestInsertOrderMarketFields(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	o := &Order{OrderID: "m1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Type: OrderTypeMarket, Price: "", Amount: "", Filled: "30", Status: "cancelled", QuoteAmount: "500", MaxSlippageBps: 25, CreatedAt: 1}
+	if err := db.InsertOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetOrder("m1")
+	if err != nil || got == nil {
+		t.Fatalf("GetOrder: %v %v", got, err)
+	}
+	if !got.IsMarket() || got.QuoteAmount != "500" || got.MaxSlippageBps != 25 || got.Status != "cancelled" {
+		t.Errorf("market fields not persisted: %+v", got)
+	}
+	// 限价单读回 Type 为空（与旧 JSON 兼容）
+	if err := db.InsertOrder(&Order{OrderID: "l1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: "open", CreatedAt: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.GetOrder("l1"); got == nil || got.Type != "" || got.IsMarket() {
+		t.Errorf("limit order type = %+v, want empty", got)
+	}
+}
+
+func TestInsertOrderTimeInForceFields(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.InsertOrder(&Order{OrderID: "p1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: "open", TimeInForce: TimeInForcePostOnly, PostOnlyReprice: true, CreatedAt: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.GetOrder("p1"); got == nil || got.TimeInForce != TimeInForcePostOnly || !got.PostOnlyReprice {
+		t.Errorf("time-in-force fields = %+v, want POST_ONLY with reprice", got)
+	}
+	// GTC 读回为空（与旧 JSON 兼容）
+	if err := db.InsertOrder(&Order{OrderID: "g1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Price: "9", Amount: "5", Status: "open", TimeInForce: TimeInForceGTC, CreatedAt: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.GetOrder("g1"); got == nil || got.TimeInForce != "" || got.PostOnlyReprice {
+		t.Errorf("GTC order fields = %+v, want empty time-in-force", got)
+	}
+}
+
+func TestListPendingTriggerOrders(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, o := range []*Order{
+		{OrderID: "s2", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "90", Amount: "5", Status: "pending", Trigger: TriggerStop, TriggerPrice: "95", CreatedAt: 2},
+		{OrderID: "s1", Trader: "0x1", Pair: "TKA/TKB", Side: "buy", Price: "110", Amount: "5", Status: "pending", Trigger: TriggerTakeProfit, TriggerPrice: "90", CreatedAt: 1},
+		{OrderID: "s3", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "90", Amount: "5", Status: "filled", Trigger: TriggerStop, TriggerPrice: "95", TriggeredAt: 7, CreatedAt: 3},
+	} {
+		if err := db.InsertOrder(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending, err := db.ListPendingTriggerOrders("TKA/TKB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].OrderID != "s1" || pending[1].TriggerPrice != "95" || !pending[1].IsPendingTrigger() {
+		t.Errorf("pending = %+v", pending)
+	}
+	if got, _ := db.GetOrder("s3"); got == nil || got.TriggeredAt != 7 || got.IsPendingTrigger() {
+		t.Errorf("activated order = %+v", got)
+	}
+	pairs, _ := db.ListPairsWithOpenOrders()
+	if len(pairs) != 1 || pairs[0] != "TKA/TKB" {
+		t.Errorf("pairs with pending triggers = %v", pairs)
+	}
+	if price, _, err := db.LastTradePrice("TKA/TKB"); err != nil || price != "" {
+		t.Errorf("LastTradePrice on empty trades = %q, %v", price, err)
+	}
+}
+
+func TestIcebergPublicView(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	o := &Order{OrderID: "i1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "30", Filled: "25", Status: "partial", DisplayAmount: "10", CreatedAt: 1}
+	if err := db.InsertOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetOrder("i1")
+	if err != nil || got == nil || !got.IsIceberg() || got.DisplayAmount != "10" {
+		t.Fatalf("display amount not persisted: %+v %v", got, err)
+	}
+	// 剩余 5 小于展示量：只展示剩余部分
+	if v := got.PublicView(); v.Amount != "30" {
+		t.Errorf("PublicView amount = %s, want 30", v.Amount)
+	}
+	got.Filled = "5"
+	if v := got.PublicView(); v.Amount != "15" {
+		t.Errorf("PublicView amount = %s, want 15 (filled 5 + visible 10)", v.Amount)
+	}
+}
+
+func TestInsertOrderRejectsForeignOrderID(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	victim := &Order{OrderID: "o1", Trader: "0xAbC", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Filled: "0", Status: "open", Nonce: 7, CreatedAt: 1}
+	if err := db.InsertOrder(victim); err != nil {
+		t.Fatal(err)
+	}
+	// 他人以同一 orderId 覆盖：拒绝，原订单不变
+	for _, o := range []*Order{
+		{OrderID: "o1", Trader: "0xdef", Pair: "TKA/TKB", Side: "buy", Price: "1", Amount: "1", Filled: "0", Status: "open", Nonce: 7, CreatedAt: 2},
+		{OrderID: "o1", Trader: "0xabc", Pair: "TKA/TKB", Side: "buy", Price: "1", Amount: "1", Filled: "0", Status: "open", Nonce: 8, CreatedAt: 2},
+	} {
+		if err := db.CheckOrderOwner(o); !errors.Is(err, ErrOrderIDConflict) {
+			t.Errorf("CheckOrderOwner trader=%s nonce=%d: err = %v, want ErrOrderIDConflict", o.Trader, o.Nonce, err)
+		}
+		if err := db.InsertOrder(o); !errors.Is(err, ErrOrderIDConflict) {
+			t.Errorf("InsertOrder trader=%s nonce=%d: err = %v, want ErrOrderIDConflict", o.Trader, o.Nonce, err)
+		}
+	}
+	if got, _ := db.GetOrder("o1"); got == nil || got.Side != "sell" || got.Trader != "0xAbC" {
+		t.Fatalf("victim order overwritten: %+v", got)
+	}
+	// 同一订单的状态更新（trader 大小写不敏感）照常写入
+	update := *victim
+	update.Trader, update.Filled, update.Status = "0xabc", "2", "partial"
+	if err := db.InsertOrder(&update); err != nil {
+		t.Errorf("owner update: %v", err)
+	}
+}
+
+// orderId 绑定签名哈希：同 trader、nonce 但签名内容不同的订单视为冲突；无签名哈希的更新沿用已有签名哈希
+func TestInsertOrderBindsSignHash(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	o := &Order{OrderID: "o1", Trader: "0xabc", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Filled: "0", Status: "open", Nonce: 7, CreatedAt: 1, SignHash: "0x01"}
+	if err := db.InsertOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	forged := *o
+	forged.Side, forged.Price, forged.SignHash = "buy", "1", "0x02"
+	if err := db.CheckOrderOwner(&forged); !errors.Is(err, ErrOrderIDConflict) {
+		t.Errorf("CheckOrderOwner different sign hash: err = %v, want ErrOrderIDConflict", err)
+	}
+	if err := db.InsertOrder(&forged); !errors.Is(err, ErrOrderIDConflict) {
+		t.Errorf("InsertOrder different sign hash: err = %v, want ErrOrderIDConflict", err)
+	}
+	update := *o
+	update.SignHash, update.Filled, update.Status = "", "2", "partial"
+	if err := db.InsertOrder(&update); err != nil {
+		t.Fatalf("update without sign hash: %v", err)
+	}
+	if got, _ := db.GetOrder("o1"); got == nil || got.SignHash != "0x01" || got.Filled != "2" {
+		t.Fatalf("stored order = %+v, want sign hash kept", got)
+	}
+}
+
+// TestInsertOrderAmendChain 改单签名链随订单落库，读回后可继续追加
+func TestInsertOrderAmendChain(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	o := &Order{OrderID: "m1", Trader: "0x1", Pair: "TKA/TKB", Side: "sell", Price: "10", Amount: "5", Status: "open", CreatedAt: 1}
+	o.AppendAmend(SignedAmend{NewPrice: "12", Timestamp: 3, Signature: "0x01"})
+	o.Price = "12"
+	if err := db.InsertOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := db.GetOrder("m1")
+	if got == nil || got.SignedPrice != "10" || got.SignedAmount != "5" || got.AmendedAt != 3 || len(got.Amends) != 1 || got.Amends[0] != o.Amends[0] {
+		t.Fatalf("amend chain = %+v", got)
+	}
+	got.AppendAmend(SignedAmend{NewAmount: "3", Timestamp: 4, Signature: "0x02"})
+	if got.SignedPrice != "10" || len(got.Amends) != 2 || len(o.Amends) != 1 {
+		t.Errorf("second amend: signedPrice=%s amends=%d (original copy %d)", got.SignedPrice, len(got.Amends), len(o.Amends))
+	}
+}
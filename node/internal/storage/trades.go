@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math/big"
+	"strings"
 	"time"
 )
 
@@ -17,22 +19,38 @@ type Trade struct {
 	Taker        string `json:"taker,omitempty"`   // 结算用
 	TokenIn      string `json:"tokenIn,omitempty"` // maker 卖出
 	TokenOut     string `json:"tokenOut,omitempty"`
-	AmountIn     string `json:"amountIn,omitempty"`
-	AmountOut    string `json:"amountOut,omitempty"`
-	Price        string `json:"price"`
-	Amount       string `json:"amount"`
-	Fee          string `json:"fee,omitempty"`
+	AmountIn     string `json:"amountIn,omitempty"`  // TokenIn 最小单位
+	AmountOut    string `json:"amountOut,omitempty"` // TokenOut 最小单位
+	Price        string `json:"price"`               // quote 最小单位 / 1 个 base 代币
+	Amount       string `json:"amount"`              // base 最小单位
+	Fee          string `json:"fee,omitempty"`      // taker 手续费（FeeToken 最小单位）
+	MakerFee     string `json:"makerFee,omitempty"` // maker 手续费，负数为返佣
+	FeeToken     string `json:"feeToken,omitempty"` // 手续费代币（quote）
 	Timestamp    int64  `json:"timestamp"`
 	TxHash       string `json:"txHash,omitempty"`
+	Source       string `json:"-"` // gossip 消息发布者 peer ID（经 pubsub 签名校验），由订阅方填入
 }
 
-// InsertTrade 插入成交记录
+// insertTradeSQL 写入 gossip / 链上同步的成交：不覆盖本节点撮合产生的同 ID 成交
+const insertTradeSQL = `INSERT OR REPLACE INTO trades (trade_id, pair, taker_order_id, maker_order_id, maker, taker, token_in, token_out, amount_in, amount_out, price, amount, fee, maker_fee, fee_token, timestamp, tx_hash)
+		 SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM trades WHERE trade_id = ? AND matched_local = 1)`
+
+// insertMatchedTradeSQL 写入本节点撮合引擎产生的成交（matched_local = 1，计入手续费等级成交额）
+const insertMatchedTradeSQL = `INSERT OR REPLACE INTO trades (trade_id, pair, taker_order_id, maker_order_id, maker, taker, token_in, token_out, amount_in, amount_out, price, amount, fee, maker_fee, fee_token, timestamp, tx_hash, matched_local)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`
+
+func tradeArgs(t *Trade) []interface{} {
+	return []interface{}{t.TradeID, t.Pair, t.TakerOrderID, t.MakerOrderID, t.Maker, t.Taker, t.TokenIn, t.TokenOut, t.AmountIn, t.AmountOut, t.Price, t.Amount, t.Fee, t.MakerFee, t.FeeToken, t.Timestamp, t.TxHash}
+}
+
+// remoteTradeArgs insertTradeSQL 的参数：末尾追加 trade_id 用于本地成交检查
+func remoteTradeArgs(t *Trade) []interface{} {
+	return append(tradeArgs(t), t.TradeID)
+}
+
+// InsertTrade 插入 gossip / 链上同步的成交记录（本节点撮合的同 ID 成交保持不变）
 func (db *DB) InsertTrade(t *Trade) error {
-	_, err := db.sql.Exec(
-		`INSERT OR REPLACE INTO trades (trade_id, pair, taker_order_id, maker_order_id, maker, taker, token_in, token_out, amount_in, amount_out, price, amount, fee, timestamp, tx_hash)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		t.TradeID, t.Pair, t.TakerOrderID, t.MakerOrderID, t.Maker, t.Taker, t.TokenIn, t.TokenOut, t.AmountIn, t.AmountOut, t.Price, t.Amount, t.Fee, t.Timestamp, t.TxHash,
-	)
+	_, err := db.sql.Exec(insertTradeSQL, remoteTradeArgs(t)...)
 	return err
 }
 
@@ -43,17 +61,13 @@ func (db *DB) InsertTrades(trades []*Trade) error {
 		return err
 	}
 	defer tx.Rollback()
-	stmt, err := tx.Prepare(
-		`INSERT OR REPLACE INTO trades (trade_id, pair, taker_order_id, maker_order_id, maker, taker, token_in, token_out, amount_in, amount_out, price, amount, fee, timestamp, tx_hash)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-	)
+	stmt, err := tx.Prepare(insertTradeSQL)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 	for _, t := range trades {
-		_, err := stmt.Exec(t.TradeID, t.Pair, t.TakerOrderID, t.MakerOrderID, t.Maker, t.Taker, t.TokenIn, t.TokenOut, t.AmountIn, t.AmountOut, t.Price, t.Amount, t.Fee, t.Timestamp, t.TxHash)
-		if err != nil {
+		if _, err := stmt.Exec(remoteTradeArgs(t)...); err != nil {
 			return err
 		}
 	}
@@ -65,7 +79,7 @@ func (db *DB) ListTrades(since, until int64, limit int, pair string) ([]*Trade,
 	if limit <= 0 {
 		limit = 1000
 	}
-	query := `SELECT trade_id, pair, taker_order_id, maker_order_id, maker, taker, token_in, token_out, amount_in, amount_out, price, amount, fee, timestamp, tx_hash
+	query := `SELECT trade_id, pair, taker_order_id, maker_order_id, maker, taker, token_in, token_out, amount_in, amount_out, price, amount, fee, maker_fee, fee_token, timestamp, tx_hash
 		 FROM trades WHERE timestamp >= ? AND timestamp <= ?`
 	args := []interface{}{since, until}
 	if pair != "" {
@@ -82,8 +96,8 @@ func (db *DB) ListTrades(since, until int64, limit int, pair string) ([]*Trade,
 	var out []*Trade
 	for rows.Next() {
 		var t Trade
-		var takerOid, makerOid, makerAddr, takerAddr, tokenIn, tokenOut, amountIn, amountOut, fee, txHash sql.NullString
-		if err := rows.Scan(&t.TradeID, &t.Pair, &takerOid, &makerOid, &makerAddr, &takerAddr, &tokenIn, &tokenOut, &amountIn, &amountOut, &t.Price, &t.Amount, &fee, &t.Timestamp, &txHash); err != nil {
+		var takerOid, makerOid, makerAddr, takerAddr, tokenIn, tokenOut, amountIn, amountOut, fee, makerFee, feeToken, txHash sql.NullString
+		if err := rows.Scan(&t.TradeID, &t.Pair, &takerOid, &makerOid, &makerAddr, &takerAddr, &tokenIn, &tokenOut, &amountIn, &amountOut, &t.Price, &t.Amount, &fee, &makerFee, &feeToken, &t.Timestamp, &txHash); err != nil {
 			return nil, err
 		}
 		t.TakerOrderID = takerOid.String
@@ -95,12 +109,69 @@ func (db *DB) ListTrades(since, until int64, limit int, pair string) ([]*Trade,
 		t.AmountIn = amountIn.String
 		t.AmountOut = amountOut.String
 		t.Fee = fee.String
+		t.MakerFee = makerFee.String
+		t.FeeToken = feeToken.String
 		t.TxHash = txHash.String
 		out = append(out, &t)
 	}
 	return out, rows.Err()
 }
 
+// TraderQuoteVolumes 统计交易对 [since, until] 内本节点撮合产生的成交中各 trader 的 quote 成交额（maker 与 taker 均计入，最小单位），用于手续费等级
+// quote 金额取成交中代币为 quoteToken 的一侧（amount_in 或 amount_out）；gossip / 链上同步的成交任意 peer 可伪造，不计入
+func (db *DB) TraderQuoteVolumes(pair, quoteToken string, since, until int64) (map[string]*big.Int, error) {
+	rows, err := db.sql.Query(
+		`SELECT maker, taker, token_in, amount_in, amount_out FROM trades WHERE pair = ? AND matched_local = 1 AND timestamp >= ? AND timestamp <= ?`,
+		pair, since, until,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]*big.Int)
+	add := func(trader string, v *big.Int) {
+		if trader == "" {
+			return
+		}
+		trader = strings.ToLower(trader)
+		sum, ok := out[trader]
+		if !ok {
+			sum = new(big.Int)
+			out[trader] = sum
+		}
+		sum.Add(sum, v)
+	}
+	for rows.Next() {
+		var maker, taker, tokenIn, amountIn, amountOut sql.NullString
+		if err := rows.Scan(&maker, &taker, &tokenIn, &amountIn, &amountOut); err != nil {
+			return nil, err
+		}
+		quote := amountOut.String
+		if strings.EqualFold(tokenIn.String, quoteToken) {
+			quote = amountIn.String
+		}
+		v, ok := ParseUnits(quote)
+		if !ok {
+			continue
+		}
+		add(maker.String, v)
+		add(taker.String, v)
+	}
+	return out, rows.Err()
+}
+
+// LastTradePrice 返回某交易对最近一笔成交的价格与时间（无成交返回空串），用于重启后恢复条件单触发基准
+func (db *DB) LastTradePrice(pair string) (price string, timestamp int64, err error) {
+	err = db.sql.QueryRow(
+		`SELECT price, timestamp FROM trades WHERE pair = ? ORDER BY timestamp DESC, rowid DESC LIMIT 1`,
+		pair,
+	).Scan(&price, &timestamp)
+	if err == sql.ErrNoRows {
+		return "", 0, nil
+	}
+	return price, timestamp, err
+}
+
 // DeleteTradesBefore 删除指定时间之前的记录，用于保留期清理（默认两周）
 // 优化：批量删除，避免长时间锁定
 func (db *DB) DeleteTradesBefore(beforeUnix int64) (int64, error) {
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"math/big"
+)
+
+// DefaultTokenDecimals 未配置代币精度时使用的默认值（与 ERC20 常见 18 位一致）
+const DefaultTokenDecimals uint8 = 18
+
+// 价格与数量统一以最小单位整数表示（定点，无浮点）：
+// - Order.Amount / Order.Filled / Trade.Amount：base 代币（token0）最小单位
+// - Order.Price / Trade.Price：每 1 个完整 base 代币（10^base精度 个最小单位）对应的 quote 代币（token1）最小单位
+// - quote 数量 = amount * price / 10^base精度（向下取整），多节点结果逐字节一致
+
+// ParseUnits 解析最小单位整数字符串（十进制，非负）；空串、小数、负数或非法字符返回 ok=false
+func ParseUnits(s string) (*big.Int, bool) {
+	if s == "" {
+		return nil, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return nil, false
+		}
+	}
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, false
+	}
+	return v, true
+}
+
+// MustUnits 解析最小单位整数字符串，非法时返回 0（仅用于已校验过的内部数据）
+func MustUnits(s string) *big.Int {
+	v, ok := ParseUnits(s)
+	if !ok {
+		return new(big.Int)
+	}
+	return v
+}
+
+// FormatUnits 将最小单位整数格式化为规范十进制字符串（无前导零；nil 视为 0）
+func FormatUnits(v *big.Int) string {
+	if v == nil {
+		return "0"
+	}
+	return v.String()
+}
+
+// Pow10 返回 10^decimals
+func Pow10(decimals uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+}
+
+// QuoteAmount 计算 quote 数量 = amount * price / 10^baseDecimals（向下取整，确定性）
+func QuoteAmount(amount, price *big.Int, baseDecimals uint8) *big.Int {
+	q := new(big.Int).Mul(amount, price)
+	return q.Quo(q, Pow10(baseDecimals))
+}
+
+// Remaining 返回订单未成交数量 Amount - Filled（最小单位）；非法或已成交返回 0
+func (o *Order) Remaining() *big.Int {
+	if o == nil {
+		return new(big.Int)
+	}
+	left := new(big.Int).Sub(MustUnits(o.Amount), MustUnits(o.Filled))
+	if left.Sign() < 0 {
+		return left.SetInt64(0)
+	}
+	return left
+}
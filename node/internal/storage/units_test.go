@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"0", "0", true},
+		{"1500000000000000000", "1500000000000000000", true},
+		{"007", "7", true},
+		{"", "", false},
+		{"1.5", "", false},
+		{"-1", "", false},
+		{"1e18", "", false},
+		{" 1", "", false},
+	}
+	for _, c := range cases {
+		v, ok := ParseUnits(c.in)
+		if ok != c.ok {
+			t.Errorf("ParseUnits(%q) ok=%v want %v", c.in, ok, c.ok)
+			continue
+		}
+		if ok && FormatUnits(v) != c.want {
+			t.Errorf("ParseUnits(%q)=%s want %s", c.in, FormatUnits(v), c.want)
+		}
+	}
+}
+
+func TestQuoteAmount(t *testing.T) {
+	// 0.3 个 base（18 位）× 价格 1.5（quote 6 位）= 450000
+	amount, _ := ParseUnits("300000000000000000")
+	price, _ := ParseUnits("1500000")
+	if got := QuoteAmount(amount, price, 18).String(); got != "450000" {
+		t.Errorf("QuoteAmount=%s want 450000", got)
+	}
+	// 向下取整
+	if got := QuoteAmount(big.NewInt(1), big.NewInt(1), 18).String(); got != "0" {
+		t.Errorf("QuoteAmount dust=%s want 0", got)
+	}
+}
+
+func TestOrderRemaining(t *testing.T) {
+	o := &Order{Amount: "100", Filled: "30"}
+	if got := o.Remaining().String(); got != "70" {
+		t.Errorf("Remaining=%s want 70", got)
+	}
+	o.Filled = "120"
+	if got := o.Remaining().String(); got != "0" {
+		t.Errorf("overfilled Remaining=%s want 0", got)
+	}
+}
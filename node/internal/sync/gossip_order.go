@@ -11,6 +11,9 @@ import (
 const (
 	TopicOrderNew          = "/p2p-exchange/order/new"
 	TopicOrderCancel       = "/p2p-exchange/order/cancel"
+	TopicOrderAmend        = "/p2p-exchange/order/amend" // 改单（cancel-replace 原子操作）
+	TopicOrderCancelAll    = "/p2p-exchange/order/cancel-all" // 按 nonce 批量撤单（trader 所有交易对）
+	TopicOrderStatus       = "/p2p-exchange/order/status" // 订单状态迁移（storage.OrderEvent）
 	TopicTradeExecuted     = "/p2p-exchange/trade/executed"
 	TopicSyncOrderbook     = "/p2p-exchange/sync/orderbook"
 	TopicMatchRegister     = "/p2p-exchange/match/register"     // 方案 B：节点注册
@@ -24,6 +27,24 @@ type CancelRequest struct {
 	Timestamp int64  `json:"timestamp,omitempty"` // 签名时间戳
 }
 
+// AmendRequest 改单请求（EIP-712 AmendOrder 签名）：newPrice 为新价格，newAmount 为新的剩余数量，"0" 或空表示不变
+type AmendRequest struct {
+	OrderID   string `json:"orderId"`
+	NewPrice  string `json:"newPrice,omitempty"`
+	NewAmount string `json:"newAmount,omitempty"`
+	Signature string `json:"signature"`
+	Timestamp int64  `json:"timestamp"` // 签名时间戳，同时作为改价/加量后的排队时间
+}
+
+// CancelAllRequest 批量撤单请求（EIP-712 CancelAllBelowNonce 签名）：撤销 trader 在所有交易对中 nonce < nonce 的订单，
+// 此后 nonce 小于该值的新订单一律拒绝
+type CancelAllRequest struct {
+	Trader    string `json:"trader"`
+	Nonce     int64  `json:"nonce"`
+	Signature string `json:"signature"`
+	Timestamp int64  `json:"timestamp"` // 签名时间戳
+}
+
 // ParseOrderNew 解析 /order/new 消息为 Order
 func ParseOrderNew(data []byte) (*storage.Order, error) {
 	var o storage.Order
@@ -42,6 +63,24 @@ func ParseOrderCancel(data []byte) (*CancelRequest, error) {
 	return &c, nil
 }
 
+// ParseOrderAmend 解析 /order/amend 消息
+func ParseOrderAmend(data []byte) (*AmendRequest, error) {
+	var a AmendRequest
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ParseOrderCancelAll 解析 /order/cancel-all 消息
+func ParseOrderCancelAll(data []byte) (*CancelAllRequest, error) {
+	var c CancelAllRequest
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
 // ParseTradeExecuted 解析 /trade/executed 消息为 Trade（与 storage.Trade 一致）
 func ParseTradeExecuted(data []byte) (*storage.Trade, error) {
 	var t storage.Trade
@@ -51,6 +90,15 @@ func ParseTradeExecuted(data []byte) (*storage.Trade, error) {
 	return &t, nil
 }
 
+// ParseOrderStatus 解析 /order/status 消息为订单状态迁移事件
+func ParseOrderStatus(data []byte) (*storage.OrderEvent, error) {
+	var ev storage.OrderEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
 // ParseOrderbookSnapshot 解析 /sync/orderbook 快照消息
 func ParseOrderbookSnapshot(data []byte) (*storage.OrderbookSnapshot, error) {
 	var s storage.OrderbookSnapshot
@@ -105,13 +153,25 @@ func PersistOrderCancel(store *storage.DB, data []byte) {
 		log.Printf("[order/cancel] 本地无该订单 orderId=%s，跳过", c.OrderID)
 		return
 	}
-	if err := store.UpdateOrderStatus(c.OrderID, "cancelled", existing.Filled); err != nil {
+	if err := store.UpdateOrderStatus(c.OrderID, storage.OrderStatusCancelled, existing.Filled); err != nil {
 		log.Printf("[order/cancel] 更新失败: %v", err)
 		return
 	}
 	log.Printf("[order/cancel] 已撤单 orderId=%s", c.OrderID)
 }
 
+// PersistOrderStatus 存储节点：应用订单状态迁移（maker 成交、过期等；本地无该订单时忽略）
+func PersistOrderStatus(store *storage.DB, data []byte) {
+	ev, err := ParseOrderStatus(data)
+	if err != nil {
+		log.Printf("[order/status] 解析失败: %v", err)
+		return
+	}
+	if err := store.ApplyOrderEvent(ev); err != nil {
+		log.Printf("[order/status] 更新失败 orderId=%s: %v", ev.OrderID, err)
+	}
+}
+
 // PersistTradeExecuted 存储节点：持久化成交
 func PersistTradeExecuted(store *storage.DB, data []byte) {
 	t, err := ParseTradeExecuted(data)
@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/P2P-P2P/p2p/node/internal/match"
+)
+
+const L3ProtocolID = protocol.ID("/p2p-exchange/marketdata/l3/1.0.0")
+
+const (
+	// l3StreamBuffer 每条流可积压的事件批次数
+	l3StreamBuffer = 1024
+	// l3WriteTimeout 单条消息写超时，超时视为对端失效并关闭流
+	l3WriteTimeout = 10 * time.Second
+	// l3MaxLine 客户端单行最大长度（快照包含交易对全部挂单）
+	l3MaxLine = 64 << 20
+)
+
+// L3StreamRequest 订阅请求（流上第一行）
+type L3StreamRequest struct {
+	Pair string `json:"pair"`
+}
+
+// L3StreamMessage 服务端发送的一行：先为 snapshot（或 error），此后为按序的事件批次；
+// 订阅积压被断开时服务端再发送一条新的 snapshot，客户端以其替换本地订单簿
+type L3StreamMessage struct {
+	Snapshot *match.L3Snapshot `json:"snapshot,omitempty"`
+	Events   []*match.L3Event  `json:"events,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// ServeL3 注册 L3 逐笔行情流协议服务端（撮合节点调用）：其他节点打开流并发送 {"pair":...} 后持续收到快照与事件，直至任一方关闭流
+func ServeL3(h host.Host, feed *match.L3Feed) {
+	h.SetStreamHandler(L3ProtocolID, func(s network.Stream) {
+		defer s.Close()
+		reader := bufio.NewReader(s)
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req L3StreamRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			log.Printf("[L3] 解析请求失败: %v", err)
+			return
+		}
+		// 对端关闭流或断开时结束订阅
+		done := make(chan struct{})
+		go func() {
+			_, _ = io.Copy(io.Discard, reader)
+			close(done)
+		}()
+		remote := s.Conn().RemotePeer()
+		log.Printf("[L3] %s 订阅 %s", remote, req.Pair)
+		for {
+			sub, err := feed.Subscribe(req.Pair, l3StreamBuffer)
+			if err != nil {
+				_ = writeL3(s, &L3StreamMessage{Error: err.Error()})
+				return
+			}
+			if !serveL3Sub(s, sub, done) {
+				return
+			}
+			log.Printf("[L3] %s 订阅 %s 积压，重新下发快照", remote, req.Pair)
+		}
+	})
+	log.Printf("L3 行情流协议已注册: %s", L3ProtocolID)
+}
+
+// serveL3Sub 发送快照与事件直至订阅结束；订阅因积压被断开时返回 true（应重新订阅），其余情况关闭订阅并返回 false
+func serveL3Sub(s network.Stream, sub *match.L3Subscription, done <-chan struct{}) bool {
+	defer sub.Close()
+	if writeL3(s, &L3StreamMessage{Snapshot: sub.Snapshot}) != nil {
+		return false
+	}
+	for {
+		select {
+		case <-done:
+			return false
+		case events, ok := <-sub.C:
+			if !ok {
+				return sub.Lagged()
+			}
+			if writeL3(s, &L3StreamMessage{Events: events}) != nil {
+				return false
+			}
+		}
+	}
+}
+
+func writeL3(s network.Stream, msg *L3StreamMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_ = s.SetWriteDeadline(time.Now().Add(l3WriteTimeout))
+	_, err = s.Write(data)
+	return err
+}
+
+// SubscribeL3 向指定 peer 订阅交易对逐笔行情（客户端调用）：按序对每条消息调用 fn，直至 ctx 结束、流关闭或 fn 返回错误
+// 可配合 match.L3Book 重建订单簿：snapshot 时 NewL3Book，events 时逐条 Apply，出错时重新订阅
+func SubscribeL3(ctx context.Context, h host.Host, peerID peer.ID, pair string, fn func(*L3StreamMessage) error) error {
+	s, err := h.NewStream(ctx, peerID, L3ProtocolID)
+	if err != nil {
+		return fmt.Errorf("打开 stream: %w", err)
+	}
+	defer s.Close()
+	stop := context.AfterFunc(ctx, func() { _ = s.Reset() })
+	defer stop()
+	data, err := json.Marshal(L3StreamRequest{Pair: pair})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := s.Write(data); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(s)
+	scanner.Buffer(make([]byte, 0, 64<<10), l3MaxLine)
+	for scanner.Scan() {
+		var msg L3StreamMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return fmt.Errorf("解析消息: %w", err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("订阅 %s: %s", pair, msg.Error)
+		}
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -29,6 +29,9 @@ func NewOrderPublisher(h host.Host, ps *pubsub.PubSub) (*OrderPublisher, error)
 	topicNames := []string{
 		TopicOrderNew,
 		TopicOrderCancel,
+		TopicOrderAmend,
+		TopicOrderCancelAll,
+		TopicOrderStatus,
 		TopicTradeExecuted,
 		TopicSyncOrderbook,
 	}
@@ -66,6 +69,39 @@ func (op *OrderPublisher) PublishCancel(ctx context.Context, cancel *CancelReque
 	return topic.Publish(ctx, data)
 }
 
+// PublishAmend 广播改单
+func (op *OrderPublisher) PublishAmend(ctx context.Context, amend *AmendRequest) error {
+	data, err := json.Marshal(amend)
+	if err != nil {
+		return err
+	}
+	
+	topic := op.topics[TopicOrderAmend]
+	return topic.Publish(ctx, data)
+}
+
+// PublishCancelAll 广播按 nonce 批量撤单
+func (op *OrderPublisher) PublishCancelAll(ctx context.Context, req *CancelAllRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	
+	topic := op.topics[TopicOrderCancelAll]
+	return topic.Publish(ctx, data)
+}
+
+// PublishOrderStatus 广播订单状态迁移
+func (op *OrderPublisher) PublishOrderStatus(ctx context.Context, ev *storage.OrderEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	
+	topic := op.topics[TopicOrderStatus]
+	return topic.Publish(ctx, data)
+}
+
 // PublishTrade 广播成交
 func (op *OrderPublisher) PublishTrade(ctx context.Context, trade *storage.Trade) error {
 	data, err := json.Marshal(trade)
@@ -16,6 +16,9 @@ import (
 type OrderHandler interface {
 	OnNewOrder(order *storage.Order) error
 	OnCancelOrder(cancel *CancelRequest) error
+	OnAmendOrder(amend *AmendRequest) error
+	OnCancelAll(req *CancelAllRequest) error
+	OnOrderStatus(ev *storage.OrderEvent) error
 	OnTradeExecuted(trade *storage.Trade) error
 }
 
@@ -80,6 +83,21 @@ func (os *OrderSubscriber) Start(ctx context.Context) error {
 		return err
 	}
 	
+	// 订阅改单
+	if err := os.subscribeAmendOrders(ctx); err != nil {
+		return err
+	}
+	
+	// 订阅按 nonce 批量撤单
+	if err := os.subscribeCancelAll(ctx); err != nil {
+		return err
+	}
+	
+	// 订阅订单状态迁移
+	if err := os.subscribeOrderStatus(ctx); err != nil {
+		return err
+	}
+	
 	// 订阅成交通知
 	if err := os.subscribeTradeExecuted(ctx); err != nil {
 		return err
@@ -163,6 +181,118 @@ func (os *OrderSubscriber) subscribeCancelOrders(ctx context.Context) error {
 	return nil
 }
 
+func (os *OrderSubscriber) subscribeAmendOrders(ctx context.Context) error {
+	topic, err := os.pubsub.Join(TopicOrderAmend)
+	if err != nil {
+		return err
+	}
+	
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+	
+	go func() {
+		defer sub.Cancel()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+
+			if !os.allowAndRecord(TopicOrderAmend, msg) {
+				continue
+			}
+			
+			amend, err := ParseOrderAmend(msg.Data)
+			if err != nil {
+				continue
+			}
+			
+			if err := os.handler.OnAmendOrder(amend); err != nil {
+				log.Printf("处理改单失败: %v", err)
+			}
+		}
+	}()
+	
+	return nil
+}
+
+func (os *OrderSubscriber) subscribeCancelAll(ctx context.Context) error {
+	topic, err := os.pubsub.Join(TopicOrderCancelAll)
+	if err != nil {
+		return err
+	}
+	
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+	
+	go func() {
+		defer sub.Cancel()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+
+			if !os.allowAndRecord(TopicOrderCancelAll, msg) {
+				continue
+			}
+			
+			req, err := ParseOrderCancelAll(msg.Data)
+			if err != nil {
+				continue
+			}
+			
+			if err := os.handler.OnCancelAll(req); err != nil {
+				log.Printf("处理批量撤单失败: %v", err)
+			}
+		}
+	}()
+	
+	return nil
+}
+
+func (os *OrderSubscriber) subscribeOrderStatus(ctx context.Context) error {
+	topic, err := os.pubsub.Join(TopicOrderStatus)
+	if err != nil {
+		return err
+	}
+	
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+	
+	go func() {
+		defer sub.Cancel()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+
+			if !os.allowAndRecord(TopicOrderStatus, msg) {
+				continue
+			}
+			
+			ev, err := ParseOrderStatus(msg.Data)
+			if err != nil {
+				continue
+			}
+			ev.Source = msg.GetFrom().String()
+			
+			if err := os.handler.OnOrderStatus(ev); err != nil {
+				log.Printf("处理订单状态失败: %v", err)
+			}
+		}
+	}()
+	
+	return nil
+}
+
 func (os *OrderSubscriber) subscribeTradeExecuted(ctx context.Context) error {
 	topic, err := os.pubsub.Join(TopicTradeExecuted)
 	if err != nil {
@@ -190,8 +320,11 @@ func (os *OrderSubscriber) subscribeTradeExecuted(ctx context.Context) error {
 			if err := json.Unmarshal(msg.Data, &trade); err != nil {
 				continue
 			}
+			trade.Source = msg.GetFrom().String()
 			
-			os.handler.OnTradeExecuted(&trade)
+			if err := os.handler.OnTradeExecuted(&trade); err != nil {
+				log.Printf("处理成交失败: %v", err)
+			}
 		}
 	}()
 	
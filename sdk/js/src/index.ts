@@ -17,6 +17,19 @@ export interface Order {
   createdAt: number
   expiresAt: number
   signature?: string
+  /** GTC | GTD | IOC | FOK | POST_ONLY（默认 GTC） */
+  timeInForce?: string
+  /** 条件单：stop | take_profit */
+  trigger?: string
+  /** 条件单触发价（最小单位） */
+  triggerPrice?: string
+  triggeredAt?: number
+  /** 冰山单每次展示数量（最小单位），剩余部分隐藏 */
+  displayAmount?: string
+  /** 自成交防护：cancel_newest | cancel_oldest | cancel_both | decrement_and_cancel（默认按交易对配置） */
+  selfTradePrevention?: string
+  /** POST_ONLY 会吃单时改价为对手盘最优价内侧一档，而非拒绝 */
+  postOnlyReprice?: boolean
 }
 
 export interface Trade {
@@ -32,6 +45,11 @@ export interface Trade {
   amountOut?: string
   price: string
   amount: string
+  /** taker 手续费（feeToken 最小单位） */
+  fee?: string
+  /** maker 手续费，负数为返佣 */
+  makerFee?: string
+  feeToken?: string
   timestamp: number
   txHash?: string
 }
@@ -42,6 +60,30 @@ export interface OrderbookResponse {
   asks: Order[]
 }
 
+/** 交易对交易规则（最小单位整数字符串，未设置为不限制） */
+export interface MarketRules {
+  tickSize?: string
+  lotSize?: string
+  minQty?: string
+  maxQty?: string
+  minNotional?: string
+  /** 限价与最新成交价的最大偏离（万分比） */
+  maxPriceDeviationBps?: number
+}
+
+export interface MarketInfo {
+  pair: string
+  token0: string
+  token1: string
+  decimals0: number
+  decimals1: number
+  selfTradePrevention?: string
+  /** continuous（连续撮合）| batch（每 Epoch 统一清算价批量拍卖） */
+  matchingMode: string
+  rules: MarketRules
+  lastPrice?: string
+}
+
 export interface NodeAPIConfig {
   baseUrl: string
   timeout?: number
@@ -98,6 +140,13 @@ export class NodeAPIClient {
     return this.request<OrderbookResponse>(`/api/orderbook?pair=${encodeURIComponent(pair)}`)
   }
 
+  /**
+   * 查询交易对与交易规则（下单前预校验）
+   */
+  async getMarkets(): Promise<MarketInfo[]> {
+    return this.request<MarketInfo[]>('/api/markets')
+  }
+
   /**
    * 查询成交记录
    */
@@ -132,6 +181,15 @@ export class NodeAPIClient {
     return this.request<Order[]>(`/api/orders?${query.toString()}`)
   }
 
+  /**
+   * 查询 trader 的下一个可用 nonce（签名订单前调用，nonce 签入 EIP-712 订单）
+   * nonce 须严格递增且各交易对共用：较大 nonce 先入簿后较小 nonce 的订单会被拒绝，多个交易对同时下单时须串行提交
+   */
+  async getNextNonce(trader: string): Promise<number> {
+    const res = await this.request<{ next: number }>(`/api/nonce?trader=${encodeURIComponent(trader)}`)
+    return Number(res.next)
+  }
+
   /**
    * 提交订单
    */
@@ -196,11 +254,13 @@ export class OrderSigner {
 
   /**
    * 签名订单（EIP-712）
+   * @param baseDecimals base 代币精度（默认 18），amountOut 按 quote 最小单位计算
    */
   async signOrder(
     order: Omit<Order, 'signature'>,
     tokenIn: string,
-    tokenOut: string
+    tokenOut: string,
+    baseDecimals: number = 18
   ): Promise<string> {
     const domain = {
       name: 'P2P DEX',
@@ -212,31 +272,47 @@ export class OrderSigner {
       Order: [
         { name: 'orderId', type: 'string' },
         { name: 'userAddress', type: 'address' },
+        { name: 'nonce', type: 'uint256' },
         { name: 'tokenIn', type: 'address' },
         { name: 'tokenOut', type: 'address' },
+        { name: 'side', type: 'string' },
         { name: 'amountIn', type: 'uint256' },
         { name: 'amountOut', type: 'uint256' },
         { name: 'price', type: 'uint256' },
         { name: 'timestamp', type: 'uint256' },
         { name: 'expiresAt', type: 'uint256' },
+        { name: 'timeInForce', type: 'string' },
+        { name: 'trigger', type: 'string' },
+        { name: 'triggerPrice', type: 'uint256' },
+        { name: 'displayAmount', type: 'uint256' },
+        { name: 'postOnlyReprice', type: 'bool' },
+        { name: 'selfTradePrevention', type: 'string' },
       ],
     }
 
-    // 计算 amountOut = amountIn * price
+    // 计算 amountOut = amountIn * price / 10^baseDecimals（与节点 storage.QuoteAmount 一致）
     const amountIn = BigInt(order.amount)
     const price = BigInt(order.price)
-    const amountOut = amountIn * price
+    const amountOut = (amountIn * price) / 10n ** BigInt(baseDecimals)
 
     const value = {
       orderId: order.orderId,
       userAddress: order.trader,
+      nonce: order.nonce.toString(),
       tokenIn,
       tokenOut,
+      side: order.side,
       amountIn: order.amount,
       amountOut: amountOut.toString(),
       price: order.price,
       timestamp: order.createdAt.toString(),
       expiresAt: order.expiresAt.toString(),
+      timeInForce: order.timeInForce || 'GTC',
+      trigger: order.trigger || '',
+      triggerPrice: order.triggerPrice || '0',
+      displayAmount: order.displayAmount || '0',
+      postOnlyReprice: order.postOnlyReprice || false,
+      selfTradePrevention: order.selfTradePrevention || '',
     }
 
     return await this.signer.signTypedData(domain, types, value)